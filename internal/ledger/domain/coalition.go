@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Coalition groups organizations that share one point currency. Members keep their own
+// ledger chains; a member's points can be redeemed at any other member, which leaves the
+// issuing org owing the redeeming org until the next settlement statement.
+type Coalition struct {
+	ID         string             `gorm:"column:id"`
+	Name       string             `gorm:"column:name"`
+	Currency   string             `gorm:"column:currency"`
+	PointValue int64              `gorm:"column:point_value"` // settlement value of one point in minor currency units
+	Members    []*CoalitionMember `gorm:"foreignKey:CoalitionID"`
+	CreatedAt  time.Time          `gorm:"column:created_at"`
+	UpdatedAt  time.Time          `gorm:"column:updated_at"`
+}
+
+type CoalitionParams struct {
+	Name       string
+	Currency   string
+	PointValue int64
+}
+
+func NewCoalition(p CoalitionParams) *Coalition {
+	return &Coalition{
+		ID:         uuid.NewString(),
+		Name:       p.Name,
+		Currency:   p.Currency,
+		PointValue: p.PointValue,
+	}
+}
+
+func (m *Coalition) OrgIDs() []string {
+	ids := make([]string, 0, len(m.Members))
+	for _, member := range m.Members {
+		ids = append(ids, member.OrgID)
+	}
+	return ids
+}
+
+// CoalitionReference is the reference of a debit written on another member's chain for a
+// redemption at orgID, keeping reference IDs unique per chain.
+func CoalitionReference(orgID, referenceID string) string {
+	return orgID + ":" + referenceID
+}
+
+type CoalitionMember struct {
+	ID          string    `gorm:"column:id"`
+	CoalitionID string    `gorm:"column:coalition_id"`
+	OrgID       string    `gorm:"column:org_id"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+}
+
+func NewCoalitionMember(coalitionID, orgID string) *CoalitionMember {
+	return &CoalitionMember{
+		ID:          uuid.NewString(),
+		CoalitionID: coalitionID,
+		OrgID:       orgID,
+	}
+}
+
+// SettlementObligation records that DebtorOrgID's points were redeemed at CreditorOrgID.
+type SettlementObligation struct {
+	ID            string    `gorm:"column:id"`
+	CoalitionID   string    `gorm:"column:coalition_id"`
+	DebtorOrgID   string    `gorm:"column:debtor_org_id"`
+	CreditorOrgID string    `gorm:"column:creditor_org_id"`
+	UserID        string    `gorm:"column:user_id"`
+	LedgerEntryID string    `gorm:"column:ledger_entry_id"`
+	Points        int64     `gorm:"column:points"`
+	StatementID   *string   `gorm:"column:statement_id"`
+	CreatedAt     time.Time `gorm:"column:created_at"`
+}
+
+type SettlementObligationParams struct {
+	CoalitionID   string
+	DebtorOrgID   string
+	CreditorOrgID string
+	Entry         *LedgerEntry
+	Points        int64
+}
+
+func NewSettlementObligation(p SettlementObligationParams) *SettlementObligation {
+	return &SettlementObligation{
+		ID:            uuid.NewString(),
+		CoalitionID:   p.CoalitionID,
+		DebtorOrgID:   p.DebtorOrgID,
+		CreditorOrgID: p.CreditorOrgID,
+		UserID:        p.Entry.UserID,
+		LedgerEntryID: p.Entry.ID,
+		Points:        p.Points,
+		CreatedAt:     time.Now(),
+	}
+}
+
+type SettlementStatement struct {
+	ID          string            `gorm:"column:id"`
+	CoalitionID string            `gorm:"column:coalition_id"`
+	PeriodStart time.Time         `gorm:"column:period_start"`
+	PeriodEnd   time.Time         `gorm:"column:period_end"`
+	Lines       []*SettlementLine `gorm:"foreignKey:StatementID"`
+	CreatedAt   time.Time         `gorm:"column:created_at"`
+}
+
+// SettlementLine is the net amount one member owes another for the statement period.
+type SettlementLine struct {
+	ID            string `gorm:"column:id"`
+	StatementID   string `gorm:"column:statement_id"`
+	DebtorOrgID   string `gorm:"column:debtor_org_id"`
+	CreditorOrgID string `gorm:"column:creditor_org_id"`
+	Points        int64  `gorm:"column:points"`
+	Amount        int64  `gorm:"column:amount"`
+}
+
+// NewSettlementStatement nets the period's obligations per pair of members, so each pair
+// settles with a single line in one direction. Pairs that cancel out are omitted.
+func NewSettlementStatement(c *Coalition, start, end time.Time, obligations []*SettlementObligation) *SettlementStatement {
+	statement := &SettlementStatement{
+		ID:          uuid.NewString(),
+		CoalitionID: c.ID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		CreatedAt:   time.Now(),
+	}
+
+	type pair struct{ a, b string }
+	net := map[pair]int64{}
+	for _, o := range obligations {
+		// Key every pair in lexical order; a positive total means a owes b.
+		if o.DebtorOrgID < o.CreditorOrgID {
+			net[pair{o.DebtorOrgID, o.CreditorOrgID}] += o.Points
+		} else {
+			net[pair{o.CreditorOrgID, o.DebtorOrgID}] -= o.Points
+		}
+	}
+
+	for p, points := range net {
+		line := &SettlementLine{
+			ID:            uuid.NewString(),
+			StatementID:   statement.ID,
+			DebtorOrgID:   p.a,
+			CreditorOrgID: p.b,
+			Points:        points,
+		}
+
+		switch {
+		case points == 0:
+			continue
+		case points < 0:
+			line.DebtorOrgID, line.CreditorOrgID = p.b, p.a
+			line.Points = -points
+		}
+
+		line.Amount = line.Points * c.PointValue
+		statement.Lines = append(statement.Lines, line)
+	}
+
+	sort.Slice(statement.Lines, func(i, j int) bool {
+		if statement.Lines[i].DebtorOrgID != statement.Lines[j].DebtorOrgID {
+			return statement.Lines[i].DebtorOrgID < statement.Lines[j].DebtorOrgID
+		}
+		return statement.Lines[i].CreditorOrgID < statement.Lines[j].CreditorOrgID
+	})
+
+	return statement
+}
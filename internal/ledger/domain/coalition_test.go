@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSettlementStatementNetsPairs(t *testing.T) {
+	c := &Coalition{ID: "coalition-id", PointValue: 10}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	obligations := []*SettlementObligation{
+		{DebtorOrgID: "org-a", CreditorOrgID: "org-b", Points: 300},
+		{DebtorOrgID: "org-b", CreditorOrgID: "org-a", Points: 100},
+		{DebtorOrgID: "org-c", CreditorOrgID: "org-a", Points: 50},
+		{DebtorOrgID: "org-b", CreditorOrgID: "org-c", Points: 20},
+		{DebtorOrgID: "org-c", CreditorOrgID: "org-b", Points: 20},
+	}
+
+	statement := NewSettlementStatement(c, start, end, obligations)
+
+	if len(statement.Lines) != 2 {
+		t.Fatalf("expected 2 lines after netting, got %d", len(statement.Lines))
+	}
+
+	ab, ca := statement.Lines[0], statement.Lines[1]
+	if ab.DebtorOrgID != "org-a" || ab.CreditorOrgID != "org-b" || ab.Points != 200 || ab.Amount != 2000 {
+		t.Fatalf("unexpected a->b line %+v", ab)
+	}
+
+	if ca.DebtorOrgID != "org-c" || ca.CreditorOrgID != "org-a" || ca.Points != 50 || ca.Amount != 500 {
+		t.Fatalf("unexpected c->a line %+v", ca)
+	}
+
+	for _, l := range statement.Lines {
+		if l.StatementID != statement.ID {
+			t.Fatalf("line %+v not linked to statement", l)
+		}
+	}
+}
+
+func TestNewSettlementStatementWithoutObligations(t *testing.T) {
+	statement := NewSettlementStatement(&Coalition{ID: "coalition-id"}, time.Time{}, time.Now(), nil)
+	if len(statement.Lines) != 0 {
+		t.Fatalf("expected no lines, got %d", len(statement.Lines))
+	}
+}
+
+func TestGroupAllocationsByOrg(t *testing.T) {
+	groups := GroupAllocationsByOrg([]RedeemAllocation{
+		{CreditPoolID: "pool-1", OrgID: "org-b", Amount: 30},
+		{CreditPoolID: "pool-2", OrgID: "org-a", Amount: 50},
+		{CreditPoolID: "pool-3", OrgID: "org-b", Amount: 20},
+	})
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+
+	if groups[0].OrgID != "org-b" || groups[0].Amount != 50 || len(groups[0].Allocations) != 2 {
+		t.Fatalf("unexpected first group %+v", groups[0])
+	}
+
+	if groups[1].OrgID != "org-a" || groups[1].Amount != 50 || len(groups[1].Allocations) != 1 {
+		t.Fatalf("unexpected second group %+v", groups[1])
+	}
+}
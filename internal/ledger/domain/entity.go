@@ -45,6 +45,9 @@ type LedgerEntry struct {
 	PreviousHash  string         `gorm:"column:previous_hash"`
 	Hash          string         `gorm:"column:hash"`
 	Metadata      datatypes.JSON `gorm:"column:metadata"`
+	// Kind is set by the ledger from the operation that wrote the entry, never from
+	// caller input. Entries written before it was stored have none.
+	Kind JournalKind `gorm:"column:kind"`
 }
 
 type LedgerParams struct {
@@ -57,6 +60,7 @@ type LedgerParams struct {
 	Description   string
 	PreviousHash  string
 	Metadata      datatypes.JSON
+	Kind          JournalKind
 }
 
 func NewLedgerEntry(p LedgerParams) *LedgerEntry {
@@ -71,6 +75,7 @@ func NewLedgerEntry(p LedgerParams) *LedgerEntry {
 		Description:   p.Description,
 		PreviousHash:  p.PreviousHash,
 		Metadata:      p.Metadata,
+		Kind:          p.Kind,
 	}
 }
 
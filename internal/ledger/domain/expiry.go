@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ExpiryReference is the reference of the entry expiring pool. A pool expires once, so a
+// retried expiry finds the entry it already wrote.
+func ExpiryReference(pool *CreditPool) string {
+	return fmt.Sprintf("expiry:%s", pool.ID)
+}
+
+// NewExpiryEntry returns the DEBIT entry that expires what is left of pool, chained after
+// last. It moves the points from the liability to breakage income.
+func NewExpiryEntry(pool *CreditPool, last *LedgerEntry, transactionID string) *LedgerEntry {
+	meta, _ := json.Marshal(map[string]any{
+		MetaReason: ReasonExpiry,
+		MetaSources: []MetaDebit{{
+			LedgerEntryID: pool.LedgerEntryID,
+			Amount:        pool.Remaining,
+		}},
+	})
+
+	entry := NewLedgerEntry(LedgerParams{
+		OrgID:         pool.OrgID,
+		UserID:        pool.UserID,
+		Type:          EntryTypeDebit,
+		Amount:        pool.Remaining,
+		TransactionID: transactionID,
+		ReferenceID:   ExpiryReference(pool),
+		Description:   fmt.Sprintf("Expiry of points earned on %s", pool.CreatedAt.UTC().Format(time.DateOnly)),
+		PreviousHash:  last.Hash,
+		Metadata:      datatypes.JSON(meta),
+		Kind:          JournalKindExpire,
+	})
+	entry.Hash = entry.GenerateHash()
+
+	return entry
+}
@@ -0,0 +1,41 @@
+package domain
+
+import "testing"
+
+func TestNewExpiryEntryMovesLiabilityToBreakage(t *testing.T) {
+	earned := replayEntry("earn", 0, EntryTypeCredit, 300, "")
+	earned.Kind = JournalKindEarn
+	redeemed := replayEntry("redeem", 1, EntryTypeDebit, 100, "")
+	redeemed.Kind = JournalKindRedeem
+	linked(earned, redeemed)
+
+	pool := &CreditPool{ID: "pool-id", LedgerEntryID: earned.ID, OrgID: "org-id", UserID: "user-id", Remaining: 200, CreatedAt: earned.CreatedAt}
+	expiry := NewExpiryEntry(pool, redeemed, "txn-id")
+
+	if expiry.Type != EntryTypeDebit || expiry.Amount != 200 || expiry.PreviousHash != redeemed.Hash || expiry.Hash == "" {
+		t.Fatalf("unexpected expiry entry %+v", expiry)
+	}
+
+	if expiry.ReferenceID != ExpiryReference(pool) || JournalKindFor(expiry) != JournalKindExpire {
+		t.Fatalf("expiry entry has reference %q and kind %q", expiry.ReferenceID, JournalKindFor(expiry))
+	}
+
+	journal, err := NewJournalEntry(JournalParams{Kind: JournalKindFor(expiry), Entry: expiry})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if journal.Postings[0].AccountCode != AccountPointsLiability || journal.Postings[1].AccountCode != AccountBreakageIncome {
+		t.Fatalf("expiry posted %s -> %s", journal.Postings[0].AccountCode, journal.Postings[1].AccountCode)
+	}
+
+	if delta := NewRollupDelta(expiry); delta.Expired != 200 || delta.Redeemed != 0 {
+		t.Fatalf("expiry rolled up as %+v", delta)
+	}
+
+	// Replaying the chain drains the expired pool like the ledger did.
+	r := replay(t, []*LedgerEntry{earned, redeemed, expiry})
+	if got := remaining(r)["earn"]; got != 0 || len(r.Issues) != 0 {
+		t.Fatalf("replay left %d in the expired pool with issues %+v", got, r.Issues)
+	}
+	assertConsistent(t, r)
+}
@@ -1,12 +1,125 @@
 package domain
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Entry types mirror ledgerv1.EntryType names, which is how they are persisted.
+const (
+	EntryTypeCredit = "CREDIT"
+	EntryTypeDebit  = "DEBIT"
+)
+
+// Metadata keys the ledger usecase writes on entries.
+const (
+	MetaSources = "sources"
+	MetaReason  = "reason"
+	MetaReverts = "reverts"
+	// MetaRedeemedAt and MetaCoalitionID mark a debit taken from one coalition member's
+	// points for a redemption at another member.
+	MetaRedeemedAt  = "redeemed_at"
+	MetaCoalitionID = "coalition_id"
+
+	ReasonExpiry = "EXPIRY"
+)
+
+// reservedMetadata are the keys the ledger writes itself; callers may not set them.
+var reservedMetadata = []string{MetaSources, MetaReason, MetaReverts, MetaRedeemedAt, MetaCoalitionID}
+
+// ValidateMetadata rejects caller metadata that sets a key the ledger reserves.
+func ValidateMetadata(meta map[string]string) error {
+	for _, key := range reservedMetadata {
+		if _, ok := meta[key]; ok {
+			return fmt.Errorf("metadata key %q is reserved", key)
+		}
+	}
+	return nil
+}
+
+// MatchRequest checks that entries, the entries one transaction wrote for a reference,
+// are what a request for amount of typ with metadata would write, so a retry gets them
+// back and a reference reused for anything else is refused. A coalition redemption
+// spreads amount over its entries. Credits don't keep caller metadata, so only the
+// metadata of debits is compared.
+func MatchRequest(entries []*LedgerEntry, userID, typ string, kind JournalKind, amount int64, metadata map[string]string) error {
+	var total int64
+	for _, e := range entries {
+		if e.UserID != userID || e.Type != typ {
+			return fmt.Errorf("reference was used for a %s of another member", e.Type)
+		}
+
+		if got := JournalKindFor(e); got != kind {
+			return fmt.Errorf("reference was used for a %s entry", got)
+		}
+
+		if typ == EntryTypeDebit {
+			stored := callerMetadata(e)
+			if len(stored) != len(metadata) {
+				return fmt.Errorf("reference was used with other metadata")
+			}
+			for k, v := range metadata {
+				if stored[k] != v {
+					return fmt.Errorf("reference was used with another %q", k)
+				}
+			}
+		}
+
+		total += e.Amount
+	}
+
+	if total != amount {
+		return fmt.Errorf("reference was used for %d points", total)
+	}
+
+	return nil
+}
+
+// callerMetadata is the metadata of entry the caller set, without the keys the ledger
+// writes itself.
+func callerMetadata(entry *LedgerEntry) map[string]any {
+	meta := entry.MetadataMap()
+	for _, key := range reservedMetadata {
+		delete(meta, key)
+	}
+	return meta
+}
+
 type RedeemAllocation struct {
 	CreditPoolID    string
+	OrgID           string
 	SourceID        string
 	Amount          int64
 	RemainingAmount int64
 }
 
+// AllocationGroup is the part of a redemption drawn from one organization's pools.
+type AllocationGroup struct {
+	OrgID       string
+	Amount      int64
+	Allocations []RedeemAllocation
+}
+
+// GroupAllocationsByOrg splits allocations per organization, keeping the order in which
+// each organization was first drawn from.
+func GroupAllocationsByOrg(allocations []RedeemAllocation) []*AllocationGroup {
+	var groups []*AllocationGroup
+	index := map[string]*AllocationGroup{}
+
+	for _, a := range allocations {
+		g, ok := index[a.OrgID]
+		if !ok {
+			g = &AllocationGroup{OrgID: a.OrgID}
+			index[a.OrgID] = g
+			groups = append(groups, g)
+		}
+		g.Amount += a.Amount
+		g.Allocations = append(g.Allocations, a)
+	}
+
+	return groups
+}
+
 // var allowedSubTypes = map[common.TransactionType][]common.TransactionSubType{
 // 	common.TransactionType_CREDIT: {
 // 		common.TransactionSubType_EARNING,
@@ -33,3 +146,16 @@ type MetaDebit struct {
 	LedgerEntryID string `json:"ledger_entry_id"`
 	Amount        int64  `json:"amount"`
 }
+
+func (m *LedgerEntry) MetadataMap() map[string]any {
+	meta := map[string]any{}
+	if len(m.Metadata) == 0 {
+		return meta
+	}
+
+	if err := json.Unmarshal(m.Metadata, &meta); err != nil {
+		return map[string]any{}
+	}
+
+	return meta
+}
@@ -0,0 +1,299 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AccountType string
+
+var (
+	AccountTypeAsset     AccountType = "ASSET"
+	AccountTypeLiability AccountType = "LIABILITY"
+	AccountTypeEquity    AccountType = "EQUITY"
+	AccountTypeIncome    AccountType = "INCOME"
+	AccountTypeExpense   AccountType = "EXPENSE"
+)
+
+// NormalSide is the side on which an account of this type increases.
+func (t AccountType) NormalSide() PostingSide {
+	switch t {
+	case AccountTypeAsset, AccountTypeExpense:
+		return PostingSideDebit
+	default:
+		return PostingSideCredit
+	}
+}
+
+const (
+	AccountPointsLiability  = "POINTS_LIABILITY"
+	AccountMarketingExpense = "MARKETING_EXPENSE"
+	AccountRedemptionIncome = "REDEMPTION_INCOME"
+	AccountBreakageIncome   = "BREAKAGE_INCOME"
+)
+
+// SystemAccounts is the chart of accounts every organization gets on its first posting.
+var SystemAccounts = []Account{
+	{Code: AccountPointsLiability, Name: "Points liability", Type: AccountTypeLiability},
+	{Code: AccountMarketingExpense, Name: "Marketing expense", Type: AccountTypeExpense},
+	{Code: AccountRedemptionIncome, Name: "Redemption income", Type: AccountTypeIncome},
+	{Code: AccountBreakageIncome, Name: "Breakage income", Type: AccountTypeIncome},
+}
+
+type Account struct {
+	ID        string      `gorm:"column:id"`
+	OrgID     string      `gorm:"column:org_id"`
+	Code      string      `gorm:"column:code"`
+	Name      string      `gorm:"column:name"`
+	Type      AccountType `gorm:"column:type"`
+	System    bool        `gorm:"column:system"`
+	CreatedAt time.Time   `gorm:"column:created_at"`
+}
+
+func NewSystemAccount(orgID string, tmpl Account) *Account {
+	return &Account{
+		ID:        uuid.NewString(),
+		OrgID:     orgID,
+		Code:      tmpl.Code,
+		Name:      tmpl.Name,
+		Type:      tmpl.Type,
+		System:    true,
+		CreatedAt: time.Now(),
+	}
+}
+
+type PostingSide string
+
+var (
+	PostingSideDebit  PostingSide = "DEBIT"
+	PostingSideCredit PostingSide = "CREDIT"
+)
+
+type JournalKind string
+
+var (
+	JournalKindEarn    JournalKind = "EARN"
+	JournalKindRedeem  JournalKind = "REDEEM"
+	JournalKindExpire  JournalKind = "EXPIRE"
+	JournalKindReverse JournalKind = "REVERSE"
+)
+
+// journalRules maps a kind to the account debited and the account credited.
+var journalRules = map[JournalKind][2]string{
+	JournalKindEarn:   {AccountMarketingExpense, AccountPointsLiability},
+	JournalKindRedeem: {AccountPointsLiability, AccountRedemptionIncome},
+	JournalKindExpire: {AccountPointsLiability, AccountBreakageIncome},
+}
+
+type JournalEntry struct {
+	ID            string      `gorm:"column:id"`
+	OrgID         string      `gorm:"column:org_id"`
+	LedgerEntryID string      `gorm:"column:ledger_entry_id"`
+	Kind          JournalKind `gorm:"column:kind"`
+	Description   string      `gorm:"column:description"`
+	Postings      []*Posting  `gorm:"foreignKey:JournalEntryID"`
+	CreatedAt     time.Time   `gorm:"column:created_at"`
+}
+
+type Posting struct {
+	ID             string      `gorm:"column:id"`
+	JournalEntryID string      `gorm:"column:journal_entry_id"`
+	OrgID          string      `gorm:"column:org_id"`
+	AccountCode    string      `gorm:"column:account_code"`
+	Side           PostingSide `gorm:"column:side"`
+	Amount         int64       `gorm:"column:amount"`
+	CreatedAt      time.Time   `gorm:"column:created_at"`
+}
+
+type JournalParams struct {
+	Kind        JournalKind
+	Entry       *LedgerEntry
+	Description string
+	// Reverses holds the postings of the journal being reversed, only used with JournalKindReverse.
+	Reverses []*Posting
+}
+
+// NewJournalEntry builds the balanced journal for a ledger entry.
+func NewJournalEntry(p JournalParams) (*JournalEntry, error) {
+	now := time.Now()
+	journal := &JournalEntry{
+		ID:            uuid.NewString(),
+		OrgID:         p.Entry.OrgID,
+		LedgerEntryID: p.Entry.ID,
+		Kind:          p.Kind,
+		Description:   p.Description,
+		CreatedAt:     now,
+	}
+
+	posting := func(code string, side PostingSide, amount int64) *Posting {
+		return &Posting{
+			ID:             uuid.NewString(),
+			JournalEntryID: journal.ID,
+			OrgID:          journal.OrgID,
+			AccountCode:    code,
+			Side:           side,
+			Amount:         amount,
+			CreatedAt:      now,
+		}
+	}
+
+	switch p.Kind {
+	case JournalKindReverse:
+		if len(p.Reverses) == 0 {
+			return nil, fmt.Errorf("reversal of %s has no postings to reverse", p.Entry.ID)
+		}
+		for _, r := range p.Reverses {
+			side := PostingSideDebit
+			if r.Side == PostingSideDebit {
+				side = PostingSideCredit
+			}
+			journal.Postings = append(journal.Postings, posting(r.AccountCode, side, r.Amount))
+		}
+	default:
+		rule, ok := journalRules[p.Kind]
+		if !ok {
+			return nil, fmt.Errorf("unsupported journal kind %q", p.Kind)
+		}
+		journal.Postings = []*Posting{
+			posting(rule[0], PostingSideDebit, p.Entry.Amount),
+			posting(rule[1], PostingSideCredit, p.Entry.Amount),
+		}
+	}
+
+	if err := journal.Validate(); err != nil {
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// Validate enforces the double-entry invariant: debits equal credits and no posting is empty.
+func (m *JournalEntry) Validate() error {
+	var debit, credit int64
+	for _, p := range m.Postings {
+		if p.Amount <= 0 {
+			return fmt.Errorf("journal %s has a non-positive posting on %s", m.ID, p.AccountCode)
+		}
+		switch p.Side {
+		case PostingSideDebit:
+			debit += p.Amount
+		case PostingSideCredit:
+			credit += p.Amount
+		default:
+			return fmt.Errorf("journal %s has an invalid posting side %q", m.ID, p.Side)
+		}
+	}
+
+	if debit != credit {
+		return fmt.Errorf("journal %s is unbalanced: debit=%d credit=%d", m.ID, debit, credit)
+	}
+
+	return nil
+}
+
+// JournalKindFor returns the journal kind of a ledger entry: the kind the ledger stored
+// on it, or for entries written before kinds were stored, the kind read from the
+// metadata the ledger wrote then.
+func JournalKindFor(entry *LedgerEntry) JournalKind {
+	if entry.Kind != "" {
+		return entry.Kind
+	}
+
+	meta := entry.MetadataMap()
+	if _, ok := meta[MetaReverts]; ok {
+		return JournalKindReverse
+	}
+
+	if entry.Type == EntryTypeCredit {
+		return JournalKindEarn
+	}
+
+	if reason, _ := meta[MetaReason].(string); reason == ReasonExpiry {
+		return JournalKindExpire
+	}
+
+	return JournalKindRedeem
+}
+
+// AccountTotal is the sum of postings on one account and side.
+type AccountTotal struct {
+	AccountCode string      `gorm:"column:account_code"`
+	Side        PostingSide `gorm:"column:side"`
+	Amount      int64       `gorm:"column:amount"`
+}
+
+type TrialBalanceLine struct {
+	AccountCode string
+	AccountName string
+	AccountType AccountType
+	Debit       int64
+	Credit      int64
+	// Balance is signed on the account's normal side.
+	Balance int64
+}
+
+type TrialBalance struct {
+	OrgID       string
+	Start       time.Time
+	End         time.Time
+	Lines       []*TrialBalanceLine
+	TotalDebit  int64
+	TotalCredit int64
+}
+
+func (m *TrialBalance) Balanced() bool {
+	return m.TotalDebit == m.TotalCredit
+}
+
+// BuildTrialBalance folds account totals into a trial balance ordered by account code.
+func BuildTrialBalance(orgID string, start, end time.Time, accounts []*Account, totals []*AccountTotal) *TrialBalance {
+	tb := &TrialBalance{
+		OrgID: orgID,
+		Start: start,
+		End:   end,
+	}
+
+	lines := make(map[string]*TrialBalanceLine, len(accounts))
+	for _, a := range accounts {
+		lines[a.Code] = &TrialBalanceLine{
+			AccountCode: a.Code,
+			AccountName: a.Name,
+			AccountType: a.Type,
+		}
+	}
+
+	for _, t := range totals {
+		line, ok := lines[t.AccountCode]
+		if !ok {
+			line = &TrialBalanceLine{AccountCode: t.AccountCode}
+			lines[t.AccountCode] = line
+		}
+
+		switch t.Side {
+		case PostingSideDebit:
+			line.Debit += t.Amount
+			tb.TotalDebit += t.Amount
+		case PostingSideCredit:
+			line.Credit += t.Amount
+			tb.TotalCredit += t.Amount
+		}
+	}
+
+	for _, line := range lines {
+		if line.AccountType.NormalSide() == PostingSideDebit {
+			line.Balance = line.Debit - line.Credit
+		} else {
+			line.Balance = line.Credit - line.Debit
+		}
+		tb.Lines = append(tb.Lines, line)
+	}
+
+	sort.Slice(tb.Lines, func(i, j int) bool {
+		return tb.Lines[i].AccountCode < tb.Lines[j].AccountCode
+	})
+
+	return tb
+}
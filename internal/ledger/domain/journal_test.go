@@ -0,0 +1,226 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+func TestNewJournalEntryIsBalanced(t *testing.T) {
+	entry := &LedgerEntry{ID: "entry-id", OrgID: "org-id", Type: EntryTypeCredit, Amount: 500}
+
+	cases := []struct {
+		kind   JournalKind
+		debit  string
+		credit string
+	}{
+		{JournalKindEarn, AccountMarketingExpense, AccountPointsLiability},
+		{JournalKindRedeem, AccountPointsLiability, AccountRedemptionIncome},
+		{JournalKindExpire, AccountPointsLiability, AccountBreakageIncome},
+	}
+
+	for _, c := range cases {
+		journal, err := NewJournalEntry(JournalParams{Kind: c.kind, Entry: entry})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.kind, err)
+		}
+
+		if len(journal.Postings) != 2 {
+			t.Fatalf("%s: expected 2 postings, got %d", c.kind, len(journal.Postings))
+		}
+
+		debit, credit := journal.Postings[0], journal.Postings[1]
+		if debit.AccountCode != c.debit || debit.Side != PostingSideDebit || debit.Amount != 500 {
+			t.Fatalf("%s: unexpected debit posting %+v", c.kind, debit)
+		}
+
+		if credit.AccountCode != c.credit || credit.Side != PostingSideCredit || credit.Amount != 500 {
+			t.Fatalf("%s: unexpected credit posting %+v", c.kind, credit)
+		}
+
+		if journal.LedgerEntryID != entry.ID || journal.OrgID != entry.OrgID {
+			t.Fatalf("%s: journal not linked to entry", c.kind)
+		}
+	}
+}
+
+func TestNewJournalEntryReverseFlipsPostings(t *testing.T) {
+	entry := &LedgerEntry{ID: "entry-id", OrgID: "org-id", Amount: 500}
+	original, err := NewJournalEntry(JournalParams{Kind: JournalKindEarn, Entry: entry})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reversal, err := NewJournalEntry(JournalParams{
+		Kind:     JournalKindReverse,
+		Entry:    &LedgerEntry{ID: "reversal-id", OrgID: "org-id", Amount: 500},
+		Reverses: original.Postings,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, p := range reversal.Postings {
+		o := original.Postings[i]
+		if p.AccountCode != o.AccountCode || p.Amount != o.Amount || p.Side == o.Side {
+			t.Fatalf("posting %d not reversed: original %+v reversal %+v", i, o, p)
+		}
+	}
+
+	if _, err := NewJournalEntry(JournalParams{Kind: JournalKindReverse, Entry: entry}); err == nil {
+		t.Fatal("expected error when reversing without postings")
+	}
+}
+
+func TestNewJournalEntryRejectsUnknownKind(t *testing.T) {
+	if _, err := NewJournalEntry(JournalParams{Kind: "GIFT", Entry: &LedgerEntry{Amount: 1}}); err == nil {
+		t.Fatal("expected error for unknown kind")
+	}
+}
+
+func TestJournalEntryValidate(t *testing.T) {
+	journal := &JournalEntry{
+		ID: "journal-id",
+		Postings: []*Posting{
+			{AccountCode: AccountPointsLiability, Side: PostingSideDebit, Amount: 100},
+			{AccountCode: AccountBreakageIncome, Side: PostingSideCredit, Amount: 90},
+		},
+	}
+
+	if err := journal.Validate(); err == nil {
+		t.Fatal("expected unbalanced journal to fail validation")
+	}
+
+	journal.Postings[1].Amount = 100
+	if err := journal.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	journal.Postings[0].Amount, journal.Postings[1].Amount = 0, 0
+	if err := journal.Validate(); err == nil {
+		t.Fatal("expected zero postings to fail validation")
+	}
+}
+
+func TestJournalKindFor(t *testing.T) {
+	cases := []struct {
+		name  string
+		entry *LedgerEntry
+		want  JournalKind
+	}{
+		{"credit", &LedgerEntry{Type: EntryTypeCredit}, JournalKindEarn},
+		{"debit", &LedgerEntry{Type: EntryTypeDebit, Metadata: datatypes.JSON(`{"sources":[]}`)}, JournalKindRedeem},
+		{"expiry", &LedgerEntry{Type: EntryTypeDebit, Metadata: datatypes.JSON(`{"reason":"EXPIRY"}`)}, JournalKindExpire},
+		{"reversal", &LedgerEntry{Type: EntryTypeCredit, Metadata: datatypes.JSON(`{"reverts":"entry-id"}`)}, JournalKindReverse},
+		{"stored kind", &LedgerEntry{Type: EntryTypeDebit, Kind: JournalKindRedeem, Metadata: datatypes.JSON(`{"reverts":"entry-id","reason":"EXPIRY"}`)}, JournalKindRedeem},
+	}
+
+	for _, c := range cases {
+		if got := JournalKindFor(c.entry); got != c.want {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestBuildTrialBalance(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	accounts := make([]*Account, 0, len(SystemAccounts))
+	for _, a := range SystemAccounts {
+		accounts = append(accounts, NewSystemAccount("org-id", a))
+	}
+
+	totals := []*AccountTotal{
+		{AccountCode: AccountMarketingExpense, Side: PostingSideDebit, Amount: 1000},
+		{AccountCode: AccountPointsLiability, Side: PostingSideCredit, Amount: 1000},
+		{AccountCode: AccountPointsLiability, Side: PostingSideDebit, Amount: 300},
+		{AccountCode: AccountBreakageIncome, Side: PostingSideCredit, Amount: 300},
+	}
+
+	tb := BuildTrialBalance("org-id", start, end, accounts, totals)
+
+	if !tb.Balanced() || tb.TotalDebit != 1300 || tb.TotalCredit != 1300 {
+		t.Fatalf("expected balanced totals of 1300, got debit=%d credit=%d", tb.TotalDebit, tb.TotalCredit)
+	}
+
+	if len(tb.Lines) != len(SystemAccounts) {
+		t.Fatalf("expected %d lines, got %d", len(SystemAccounts), len(tb.Lines))
+	}
+
+	balances := map[string]int64{}
+	for _, l := range tb.Lines {
+		balances[l.AccountCode] = l.Balance
+	}
+
+	want := map[string]int64{
+		AccountMarketingExpense: 1000,
+		AccountPointsLiability:  700,
+		AccountBreakageIncome:   300,
+		AccountRedemptionIncome: 0,
+	}
+	for code, b := range want {
+		if balances[code] != b {
+			t.Fatalf("expected %s balance %d, got %d", code, b, balances[code])
+		}
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	if err := ValidateMetadata(map[string]string{"order_id": "o-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{MetaReverts, MetaReason, MetaSources, MetaRedeemedAt, MetaCoalitionID} {
+		if err := ValidateMetadata(map[string]string{key: "x"}); err == nil {
+			t.Fatalf("reserved key %s accepted", key)
+		}
+	}
+}
+
+func TestMatchRequest(t *testing.T) {
+	debit := func(amount int64, meta string) *LedgerEntry {
+		return &LedgerEntry{UserID: "user-id", Type: EntryTypeDebit, Kind: JournalKindRedeem, Amount: amount, Metadata: datatypes.JSON(meta)}
+	}
+	written := []*LedgerEntry{
+		debit(300, `{"order":"A1","sources":[{"ledger_entry_id":"e1","amount":300}]}`),
+		debit(200, `{"order":"A1","sources":[{"ledger_entry_id":"e2","amount":200}],"redeemed_at":"org-b"}`),
+	}
+
+	if err := MatchRequest(written, "user-id", EntryTypeDebit, JournalKindRedeem, 500, map[string]string{"order": "A1"}); err != nil {
+		t.Fatalf("retry of the same redemption refused: %v", err)
+	}
+
+	cases := map[string]func() error{
+		"amount": func() error {
+			return MatchRequest(written, "user-id", EntryTypeDebit, JournalKindRedeem, 400, map[string]string{"order": "A1"})
+		},
+		"metadata": func() error {
+			return MatchRequest(written, "user-id", EntryTypeDebit, JournalKindRedeem, 500, map[string]string{"order": "B2"})
+		},
+		"extra metadata": func() error {
+			return MatchRequest(written, "user-id", EntryTypeDebit, JournalKindRedeem, 500, map[string]string{"order": "A1", "note": "x"})
+		},
+		"member": func() error {
+			return MatchRequest(written, "other-id", EntryTypeDebit, JournalKindRedeem, 500, map[string]string{"order": "A1"})
+		},
+		"type": func() error {
+			return MatchRequest(written, "user-id", EntryTypeCredit, JournalKindEarn, 500, nil)
+		},
+		"kind": func() error {
+			return MatchRequest([]*LedgerEntry{{UserID: "user-id", Type: EntryTypeDebit, Kind: JournalKindExpire, Amount: 500}}, "user-id", EntryTypeDebit, JournalKindRedeem, 500, nil)
+		},
+	}
+	for name, match := range cases {
+		if err := match(); err == nil {
+			t.Fatalf("reference reused with another %s accepted", name)
+		}
+	}
+
+	// Credits keep no caller metadata, so only their amount is compared.
+	credit := []*LedgerEntry{{UserID: "user-id", Type: EntryTypeCredit, Amount: 100}}
+	if err := MatchRequest(credit, "user-id", EntryTypeCredit, JournalKindEarn, 100, map[string]string{"order": "A1"}); err != nil {
+		t.Fatalf("retry of the same credit refused: %v", err)
+	}
+}
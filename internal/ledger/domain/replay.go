@@ -0,0 +1,408 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReplayStatusReplayed  = "REPLAYED"
+	ReplayStatusSwapped   = "SWAPPED"
+	ReplayStatusDiscarded = "DISCARDED"
+)
+
+// ReplayScope selects the chains a replay rebuilds: one user of an org, a whole org,
+// or every chain when both are empty.
+type ReplayScope struct {
+	OrgID  string
+	UserID string
+}
+
+func (s ReplayScope) Validate() error {
+	if s.UserID != "" && s.OrgID == "" {
+		return fmt.Errorf("org_id is required to replay a single user")
+	}
+	return nil
+}
+
+// ReplayRun records one replay into the shadow tables. A run is swapped in or discarded
+// once; Watermark and Entries pin the ledger state it was derived from.
+type ReplayRun struct {
+	ID           string     `gorm:"column:id"`
+	OrgID        string     `gorm:"column:org_id"`
+	UserID       string     `gorm:"column:user_id"`
+	Status       string     `gorm:"column:status"`
+	Chains       int64      `gorm:"column:chains"`
+	Entries      int64      `gorm:"column:entries"`
+	Watermark    time.Time  `gorm:"column:watermark"`
+	PoolDiffs    int64      `gorm:"column:pool_diffs"`
+	BalanceDiffs int64      `gorm:"column:balance_diffs"`
+	Issues       int64      `gorm:"column:issues"`
+	CreatedAt    time.Time  `gorm:"column:created_at"`
+	SwappedAt    *time.Time `gorm:"column:swapped_at"`
+}
+
+func NewReplayRun(scope ReplayScope) *ReplayRun {
+	return &ReplayRun{
+		ID:     uuid.NewString(),
+		OrgID:  scope.OrgID,
+		UserID: scope.UserID,
+	}
+}
+
+func (m *ReplayRun) Scope() ReplayScope {
+	return ReplayScope{OrgID: m.OrgID, UserID: m.UserID}
+}
+
+// ShadowCreditPool and ShadowBalance hold a run's derived state until it is swapped in.
+type ShadowCreditPool struct {
+	RunID string `gorm:"column:run_id"`
+	CreditPool
+}
+
+func (ShadowCreditPool) TableName() string { return "credit_pools_shadow" }
+
+type ShadowBalance struct {
+	RunID string `gorm:"column:run_id"`
+	Balance
+}
+
+func (ShadowBalance) TableName() string { return "balances_shadow" }
+
+// ReplayIssue is an entry the replay could not apply cleanly, e.g. a debit larger than
+// the points available at that point of the chain.
+type ReplayIssue struct {
+	LedgerEntryID string
+	Message       string
+}
+
+type replayAllocation struct {
+	pool   *CreditPool
+	amount int64
+}
+
+// ChainReplay re-derives the pools and balance of one (org, user) chain.
+type ChainReplay struct {
+	Pools   []*CreditPool
+	Balance *Balance
+	Issues  []ReplayIssue
+
+	byEntry     map[string]*LedgerEntry
+	poolOf      map[string]*CreditPool
+	allocations map[string][]replayAllocation
+	reverted    map[string]bool
+}
+
+// ChainGenesis is the previous hash of the first entry of a chain.
+const ChainGenesis = "GENESIS"
+
+// SortChain orders entries the way they were appended to the chain, by following
+// PreviousHash from the genesis entry. Timestamps play no part: entries written in
+// the same instant still have one order. It fails when the entries don't form one
+// unbroken chain: no genesis or several, two entries linked to the same one, or
+// entries the walk never reaches.
+func SortChain(entries []*LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var genesis *LedgerEntry
+	next := make(map[string]*LedgerEntry, len(entries))
+	for _, e := range entries {
+		if e.PreviousHash == ChainGenesis {
+			if genesis != nil {
+				return fmt.Errorf("chain has two genesis entries, %s and %s", genesis.ID, e.ID)
+			}
+			genesis = e
+			continue
+		}
+
+		if other, ok := next[e.PreviousHash]; ok {
+			return fmt.Errorf("chain forks after hash %s into entries %s and %s", e.PreviousHash, other.ID, e.ID)
+		}
+		next[e.PreviousHash] = e
+	}
+
+	if genesis == nil {
+		return fmt.Errorf("chain has no genesis entry")
+	}
+
+	ordered := make([]*LedgerEntry, 0, len(entries))
+	for e := genesis; e != nil; e = next[e.Hash] {
+		if len(ordered) == len(entries) {
+			return fmt.Errorf("chain loops back at entry %s", e.ID)
+		}
+		ordered = append(ordered, e)
+	}
+
+	if len(ordered) != len(entries) {
+		reached := make(map[*LedgerEntry]bool, len(ordered))
+		for _, e := range ordered {
+			reached[e] = true
+		}
+
+		for _, e := range entries {
+			if !reached[e] {
+				return fmt.Errorf("chain is broken at entry %s: no entry has hash %s", e.ID, e.PreviousHash)
+			}
+		}
+	}
+
+	copy(entries, ordered)
+	return nil
+}
+
+// ReplayChain applies entries of a single chain in chain order:
+//
+//   - a credit opens a pool for its amount;
+//   - a debit (redemption or expiry) is allocated FIFO over the open pools, the rule
+//     processDebit applies;
+//   - a reversal undoes the entry it reverts: a reverted credit drains its own pool first
+//     and then the oldest pools, a reverted debit gives its allocations back.
+//
+// The balance follows the entries, so it equals the sum of the pools unless issues were
+// recorded. A chain that SortChain can't order isn't replayed.
+func ReplayChain(entries []*LedgerEntry) (*ChainReplay, error) {
+	r := &ChainReplay{
+		byEntry:     map[string]*LedgerEntry{},
+		poolOf:      map[string]*CreditPool{},
+		allocations: map[string][]replayAllocation{},
+		reverted:    map[string]bool{},
+	}
+
+	if err := SortChain(entries); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		r.apply(e)
+	}
+
+	return r, nil
+}
+
+func (r *ChainReplay) issue(e *LedgerEntry, format string, args ...any) {
+	r.Issues = append(r.Issues, ReplayIssue{LedgerEntryID: e.ID, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ChainReplay) touchBalance(e *LedgerEntry, delta int64) {
+	if r.Balance == nil {
+		r.Balance = &Balance{
+			ID:        uuid.NewString(),
+			OrgID:     e.OrgID,
+			UserID:    e.UserID,
+			CreatedAt: e.CreatedAt,
+		}
+	}
+	r.Balance.Balance += delta
+	r.Balance.UpdatedAt = e.CreatedAt
+}
+
+func (r *ChainReplay) apply(e *LedgerEntry) {
+	r.byEntry[e.ID] = e
+
+	kind := JournalKindFor(e)
+	if r.revertedEntry(e) != nil {
+		kind = JournalKindReverse
+	}
+
+	switch kind {
+	case JournalKindEarn:
+		pool := &CreditPool{
+			ID:            uuid.NewString(),
+			LedgerEntryID: e.ID,
+			OrgID:         e.OrgID,
+			UserID:        e.UserID,
+			Remaining:     e.Amount,
+			CreatedAt:     e.CreatedAt,
+		}
+		r.Pools = append(r.Pools, pool)
+		r.poolOf[e.ID] = pool
+		r.touchBalance(e, e.Amount)
+
+	case JournalKindRedeem, JournalKindExpire:
+		allocs, short := r.allocate(e.Amount, nil)
+		if short > 0 {
+			r.issue(e, "debit exceeds available points by %d", short)
+		}
+		r.allocations[e.ID] = allocs
+		r.touchBalance(e, -e.Amount)
+
+	case JournalKindReverse:
+		r.reverse(e)
+	}
+}
+
+// allocate consumes amount from the open pools oldest first, starting with first when set.
+// It returns the allocations and the part that could not be covered.
+func (r *ChainReplay) allocate(amount int64, first *CreditPool) ([]replayAllocation, int64) {
+	var allocs []replayAllocation
+
+	take := func(p *CreditPool) {
+		n := min(p.Remaining, amount)
+		if n <= 0 {
+			return
+		}
+		p.Remaining -= n
+		amount -= n
+		allocs = append(allocs, replayAllocation{pool: p, amount: n})
+	}
+
+	if first != nil {
+		take(first)
+	}
+	for _, p := range r.Pools {
+		if amount == 0 {
+			break
+		}
+		take(p)
+	}
+
+	return allocs, amount
+}
+
+func (r *ChainReplay) reverse(e *LedgerEntry) {
+	original := r.revertedEntry(e)
+	if original == nil {
+		r.issue(e, "reverted entry not found in chain")
+		return
+	}
+
+	if r.reverted[original.ID] {
+		r.issue(e, "entry %s already reverted", original.ID)
+		return
+	}
+	r.reverted[original.ID] = true
+
+	if original.Type == EntryTypeCredit {
+		_, short := r.allocate(original.Amount, r.poolOf[original.ID])
+		if short > 0 {
+			r.issue(e, "reversal exceeds available points by %d", short)
+		}
+		r.touchBalance(e, -original.Amount)
+		return
+	}
+
+	for _, a := range r.allocations[original.ID] {
+		a.pool.Remaining += a.amount
+	}
+	r.touchBalance(e, original.Amount)
+}
+
+// legacyRevertPrefix is the description reversals carried before they recorded the
+// reverted entry in their metadata.
+const legacyRevertPrefix = "Revert of "
+
+// revertedEntry resolves the target of a reversal, or nil when e is not one.
+func (r *ChainReplay) revertedEntry(e *LedgerEntry) *LedgerEntry {
+	if id, ok := e.MetadataMap()[MetaReverts].(string); ok {
+		return r.byEntry[id]
+	}
+
+	if id, ok := strings.CutPrefix(e.Description, legacyRevertPrefix); ok {
+		return r.byEntry[id]
+	}
+
+	return nil
+}
+
+// AdoptIDs reuses the IDs of the live rows the replay re-derives, so swapping a run in
+// keeps pool and balance IDs stable.
+func (r *ChainReplay) AdoptIDs(pools []*CreditPool, balance *Balance) {
+	ids := make(map[string]string, len(pools))
+	for _, p := range pools {
+		ids[p.LedgerEntryID] = p.ID
+	}
+
+	for _, p := range r.Pools {
+		if id, ok := ids[p.LedgerEntryID]; ok {
+			p.ID = id
+		}
+	}
+
+	if balance != nil && r.Balance != nil {
+		r.Balance.ID = balance.ID
+		r.Balance.CreatedAt = balance.CreatedAt
+	}
+}
+
+const (
+	ReplayDiffMissing = "MISSING" // derived but absent from live state
+	ReplayDiffExtra   = "EXTRA"   // live but not derived from the ledger
+	ReplayDiffChanged = "CHANGED"
+)
+
+// ReplayDiff is one difference between live state and a replay. Key is the pool's ledger
+// entry ID; it is empty for balances.
+type ReplayDiff struct {
+	Kind   string // POOL or BALANCE
+	Change string
+	OrgID  string
+	UserID string
+	Key    string
+	Live   int64
+	Shadow int64
+}
+
+func DiffPools(live, shadow []*CreditPool) []*ReplayDiff {
+	var diffs []*ReplayDiff
+
+	byEntry := make(map[string]*CreditPool, len(live))
+	for _, p := range live {
+		byEntry[p.LedgerEntryID] = p
+	}
+
+	for _, s := range shadow {
+		l, ok := byEntry[s.LedgerEntryID]
+		delete(byEntry, s.LedgerEntryID)
+
+		switch {
+		case !ok:
+			diffs = append(diffs, &ReplayDiff{Kind: "POOL", Change: ReplayDiffMissing, OrgID: s.OrgID, UserID: s.UserID, Key: s.LedgerEntryID, Shadow: s.Remaining})
+		case l.Remaining != s.Remaining:
+			diffs = append(diffs, &ReplayDiff{Kind: "POOL", Change: ReplayDiffChanged, OrgID: s.OrgID, UserID: s.UserID, Key: s.LedgerEntryID, Live: l.Remaining, Shadow: s.Remaining})
+		}
+	}
+
+	for _, l := range live {
+		if _, ok := byEntry[l.LedgerEntryID]; ok {
+			diffs = append(diffs, &ReplayDiff{Kind: "POOL", Change: ReplayDiffExtra, OrgID: l.OrgID, UserID: l.UserID, Key: l.LedgerEntryID, Live: l.Remaining})
+		}
+	}
+
+	return diffs
+}
+
+func DiffBalances(live, shadow []*Balance) []*ReplayDiff {
+	var diffs []*ReplayDiff
+
+	key := func(b *Balance) string { return b.OrgID + "/" + b.UserID }
+
+	byKey := make(map[string]*Balance, len(live))
+	for _, b := range live {
+		byKey[key(b)] = b
+	}
+
+	for _, s := range shadow {
+		l, ok := byKey[key(s)]
+		delete(byKey, key(s))
+
+		switch {
+		case !ok:
+			diffs = append(diffs, &ReplayDiff{Kind: "BALANCE", Change: ReplayDiffMissing, OrgID: s.OrgID, UserID: s.UserID, Shadow: s.Balance})
+		case l.Balance != s.Balance:
+			diffs = append(diffs, &ReplayDiff{Kind: "BALANCE", Change: ReplayDiffChanged, OrgID: s.OrgID, UserID: s.UserID, Live: l.Balance, Shadow: s.Balance})
+		}
+	}
+
+	for _, l := range live {
+		if _, ok := byKey[key(l)]; ok {
+			diffs = append(diffs, &ReplayDiff{Kind: "BALANCE", Change: ReplayDiffExtra, OrgID: l.OrgID, UserID: l.UserID, Live: l.Balance})
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,244 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+var replayEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func replayEntry(id string, minute int, typ string, amount int64, metadata string) *LedgerEntry {
+	e := &LedgerEntry{
+		ID:        id,
+		OrgID:     "org-id",
+		UserID:    "user-id",
+		Type:      typ,
+		Amount:    amount,
+		CreatedAt: replayEpoch.Add(time.Duration(minute) * time.Minute),
+	}
+	if metadata != "" {
+		e.Metadata = datatypes.JSON(metadata)
+	}
+	return e
+}
+
+// linked chains entries in the order given, as the ledger appends them.
+func linked(entries ...*LedgerEntry) []*LedgerEntry {
+	previous := ChainGenesis
+	for _, e := range entries {
+		e.PreviousHash = previous
+		e.Hash = "hash-" + e.ID
+		previous = e.Hash
+	}
+	return entries
+}
+
+func replay(t *testing.T, entries []*LedgerEntry) *ChainReplay {
+	t.Helper()
+
+	r, err := ReplayChain(entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return r
+}
+
+func remaining(r *ChainReplay) map[string]int64 {
+	res := map[string]int64{}
+	for _, p := range r.Pools {
+		res[p.LedgerEntryID] = p.Remaining
+	}
+	return res
+}
+
+func assertConsistent(t *testing.T, r *ChainReplay) {
+	t.Helper()
+
+	var sum int64
+	for _, p := range r.Pools {
+		sum += p.Remaining
+	}
+
+	if r.Balance == nil || r.Balance.Balance != sum {
+		t.Fatalf("balance %+v does not match pools total %d", r.Balance, sum)
+	}
+}
+
+func TestReplayChainAllocatesDebitsFIFO(t *testing.T) {
+	// Entries are deliberately out of order; the replay sorts them by chain order.
+	entries := linked(
+		replayEntry("earn-1", 1, EntryTypeCredit, 100, ""),
+		replayEntry("earn-2", 2, EntryTypeCredit, 100, ""),
+		replayEntry("redeem", 3, EntryTypeDebit, 150, ""),
+	)
+	r := replay(t, []*LedgerEntry{entries[2], entries[1], entries[0]})
+
+	if len(r.Issues) != 0 {
+		t.Fatalf("unexpected issues %+v", r.Issues)
+	}
+
+	got := remaining(r)
+	if got["earn-1"] != 0 || got["earn-2"] != 50 {
+		t.Fatalf("expected oldest pool drained first, got %v", got)
+	}
+
+	assertConsistent(t, r)
+}
+
+func TestReplayChainReversals(t *testing.T) {
+	r := replay(t, linked(
+		replayEntry("earn-1", 1, EntryTypeCredit, 100, ""),
+		replayEntry("earn-2", 2, EntryTypeCredit, 100, ""),
+		replayEntry("redeem", 3, EntryTypeDebit, 120, ""),
+		replayEntry("revert-redeem", 4, EntryTypeCredit, 120, `{"reverts":"redeem"}`),
+		replayEntry("revert-earn", 5, EntryTypeDebit, 100, `{"reverts":"earn-2"}`),
+	))
+
+	if len(r.Issues) != 0 {
+		t.Fatalf("unexpected issues %+v", r.Issues)
+	}
+
+	got := remaining(r)
+	if got["earn-1"] != 100 || got["earn-2"] != 0 {
+		t.Fatalf("unexpected pools after reversals %v", got)
+	}
+
+	if len(r.Pools) != 2 {
+		t.Fatalf("reversals must not open pools, got %d", len(r.Pools))
+	}
+
+	assertConsistent(t, r)
+}
+
+func TestReplayChainLegacyRevert(t *testing.T) {
+	legacy := replayEntry("revert", 2, EntryTypeDebit, 100, "")
+	legacy.Description = "Revert of earn"
+
+	r := replay(t, linked(
+		replayEntry("earn", 1, EntryTypeCredit, 100, ""),
+		legacy,
+	))
+
+	if got := remaining(r); got["earn"] != 0 {
+		t.Fatalf("expected legacy revert to drain the pool, got %v", got)
+	}
+
+	assertConsistent(t, r)
+}
+
+func TestReplayChainRecordsIssues(t *testing.T) {
+	r := replay(t, linked(
+		replayEntry("earn", 1, EntryTypeCredit, 50, ""),
+		replayEntry("redeem", 2, EntryTypeDebit, 80, ""),
+		replayEntry("revert-1", 3, EntryTypeCredit, 80, `{"reverts":"redeem"}`),
+		replayEntry("revert-2", 4, EntryTypeCredit, 80, `{"reverts":"redeem"}`),
+		replayEntry("revert-3", 5, EntryTypeCredit, 10, `{"reverts":"missing"}`),
+	))
+
+	if len(r.Issues) != 3 {
+		t.Fatalf("expected 3 issues, got %+v", r.Issues)
+	}
+
+	for i, id := range []string{"redeem", "revert-2", "revert-3"} {
+		if r.Issues[i].LedgerEntryID != id {
+			t.Fatalf("issue %d: expected entry %s, got %+v", i, id, r.Issues[i])
+		}
+	}
+}
+
+func TestReplayAdoptIDsAndDiff(t *testing.T) {
+	r := replay(t, linked(
+		replayEntry("earn-1", 1, EntryTypeCredit, 100, ""),
+		replayEntry("earn-2", 2, EntryTypeCredit, 100, ""),
+		replayEntry("redeem", 3, EntryTypeDebit, 50, ""),
+	))
+
+	livePools := []*CreditPool{
+		{ID: "pool-1", LedgerEntryID: "earn-1", OrgID: "org-id", UserID: "user-id", Remaining: 100},
+		{ID: "pool-x", LedgerEntryID: "stray", OrgID: "org-id", UserID: "user-id", Remaining: 10},
+	}
+	liveBalance := &Balance{ID: "balance-id", OrgID: "org-id", UserID: "user-id", Balance: 110}
+
+	r.AdoptIDs(livePools, liveBalance)
+
+	if r.Pools[0].ID != "pool-1" || r.Balance.ID != "balance-id" {
+		t.Fatalf("expected live IDs to be kept, got pool %s balance %s", r.Pools[0].ID, r.Balance.ID)
+	}
+
+	diffs := DiffPools(livePools, r.Pools)
+	changes := map[string]string{}
+	for _, d := range diffs {
+		changes[d.Key] = d.Change
+	}
+
+	if len(diffs) != 3 ||
+		changes["earn-1"] != ReplayDiffChanged ||
+		changes["earn-2"] != ReplayDiffMissing ||
+		changes["stray"] != ReplayDiffExtra {
+		t.Fatalf("unexpected pool diffs %v", changes)
+	}
+
+	balances := DiffBalances([]*Balance{liveBalance}, []*Balance{r.Balance})
+	if len(balances) != 1 || balances[0].Live != 110 || balances[0].Shadow != 150 {
+		t.Fatalf("unexpected balance diffs %+v", balances)
+	}
+
+	if diffs := DiffPools(r.Pools, r.Pools); len(diffs) != 0 {
+		t.Fatalf("expected no diffs against itself, got %+v", diffs)
+	}
+}
+
+func TestSortChainFollowsHashes(t *testing.T) {
+	// The same instant for every entry: only the hashes know the order.
+	entries := linked(
+		replayEntry("c", 1, EntryTypeCredit, 10, ""),
+		replayEntry("a", 1, EntryTypeCredit, 10, ""),
+		replayEntry("b", 1, EntryTypeDebit, 5, ""),
+	)
+	shuffled := []*LedgerEntry{entries[1], entries[2], entries[0]}
+
+	if err := SortChain(shuffled); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, id := range []string{"c", "a", "b"} {
+		if shuffled[i].ID != id {
+			t.Fatalf("position %d: expected %s, got %s", i, id, shuffled[i].ID)
+		}
+	}
+}
+
+func TestSortChainRejectsForksAndBreaks(t *testing.T) {
+	chain := func() []*LedgerEntry {
+		return linked(
+			replayEntry("earn-1", 1, EntryTypeCredit, 10, ""),
+			replayEntry("earn-2", 2, EntryTypeCredit, 10, ""),
+			replayEntry("earn-3", 3, EntryTypeCredit, 10, ""),
+		)
+	}
+
+	fork := chain()
+	fork[2].PreviousHash = fork[1].PreviousHash
+
+	broken := chain()
+	broken[2].PreviousHash = "hash-missing"
+
+	twoGeneses := chain()
+	twoGeneses[1].PreviousHash = ChainGenesis
+
+	noGenesis := chain()
+	noGenesis[0].PreviousHash = "hash-earn-3"
+
+	for name, entries := range map[string][]*LedgerEntry{
+		"fork":        fork,
+		"broken link": broken,
+		"two geneses": twoGeneses,
+		"no genesis":  noGenesis,
+	} {
+		if _, err := ReplayChain(entries); err == nil {
+			t.Fatalf("%s: expected the replay to fail", name)
+		}
+	}
+}
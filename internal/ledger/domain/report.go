@@ -0,0 +1,211 @@
+package domain
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DailyRollup holds the point movements of one organization for one UTC day.
+// Rows are incremented in the same transaction as the ledger entry they summarise.
+type DailyRollup struct {
+	ID        string    `gorm:"column:id"`
+	OrgID     string    `gorm:"column:org_id;uniqueIndex:idx_daily_rollup_org_day"`
+	Day       time.Time `gorm:"column:day;type:date;uniqueIndex:idx_daily_rollup_org_day"`
+	Issued    int64     `gorm:"column:issued"`
+	Redeemed  int64     `gorm:"column:redeemed"`
+	Expired   int64     `gorm:"column:expired"`
+	Reversed  int64     `gorm:"column:reversed"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func RollupDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// NewRollupDelta returns the increment a ledger entry contributes to its day's rollup.
+func NewRollupDelta(entry *LedgerEntry) *DailyRollup {
+	createdAt := entry.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	delta := &DailyRollup{
+		ID:        uuid.NewString(),
+		OrgID:     entry.OrgID,
+		Day:       RollupDay(createdAt),
+		UpdatedAt: time.Now(),
+	}
+
+	switch JournalKindFor(entry) {
+	case JournalKindEarn:
+		delta.Issued = entry.Amount
+	case JournalKindRedeem:
+		delta.Redeemed = entry.Amount
+	case JournalKindExpire:
+		delta.Expired = entry.Amount
+	case JournalKindReverse:
+		delta.Reversed = entry.Amount
+	}
+
+	return delta
+}
+
+// BuildRollups re-derives the daily rollups of entries, one row per organization and day
+// ordered by day, as Record would have incremented them.
+func BuildRollups(entries []*LedgerEntry) []*DailyRollup {
+	type key struct {
+		orgID string
+		day   time.Time
+	}
+
+	var rollups []*DailyRollup
+	index := map[key]*DailyRollup{}
+	for _, e := range entries {
+		delta := NewRollupDelta(e)
+
+		r, ok := index[key{delta.OrgID, delta.Day}]
+		if !ok {
+			index[key{delta.OrgID, delta.Day}] = delta
+			rollups = append(rollups, delta)
+			continue
+		}
+
+		r.Issued += delta.Issued
+		r.Redeemed += delta.Redeemed
+		r.Expired += delta.Expired
+		r.Reversed += delta.Reversed
+	}
+
+	sort.SliceStable(rollups, func(i, j int) bool {
+		return rollups[i].Day.Before(rollups[j].Day)
+	})
+
+	return rollups
+}
+
+type RollupTotals struct {
+	Issued   int64 `gorm:"column:issued"`
+	Redeemed int64 `gorm:"column:redeemed"`
+	Expired  int64 `gorm:"column:expired"`
+	Reversed int64 `gorm:"column:reversed"`
+}
+
+func (t *RollupTotals) Add(r *DailyRollup) {
+	t.Issued += r.Issued
+	t.Redeemed += r.Redeemed
+	t.Expired += r.Expired
+	t.Reversed += r.Reversed
+}
+
+// Outstanding is the number of issued points still owed to members.
+func (t RollupTotals) Outstanding() int64 {
+	return t.Issued - t.Reversed - t.Redeemed - t.Expired
+}
+
+// BreakageRate is the share of settled points that expired instead of being redeemed.
+func (t RollupTotals) BreakageRate() float64 {
+	settled := t.Redeemed + t.Expired
+	if settled <= 0 {
+		return 0
+	}
+	return float64(t.Expired) / float64(settled)
+}
+
+type LiabilityReportRow struct {
+	Month       time.Time
+	Issued      int64
+	Redeemed    int64
+	Expired     int64
+	Reversed    int64
+	Outstanding int64
+	// BreakageRate is the cumulative rate up to and including this month.
+	BreakageRate      float64
+	EstimatedBreakage int64
+}
+
+// BuildLiabilityReport folds daily rollups into monthly rows. opening holds the totals of
+// every rollup before the first month so that outstanding and breakage carry forward.
+func BuildLiabilityReport(opening RollupTotals, rollups []*DailyRollup) []*LiabilityReportRow {
+	var (
+		rows       []*LiabilityReportRow
+		current    *LiabilityReportRow
+		cumulative = opening
+	)
+
+	closeMonth := func() {
+		if current == nil {
+			return
+		}
+		current.Outstanding = cumulative.Outstanding()
+		current.BreakageRate = cumulative.BreakageRate()
+		current.EstimatedBreakage = int64(math.Round(float64(current.Outstanding) * current.BreakageRate))
+		rows = append(rows, current)
+	}
+
+	for _, r := range rollups {
+		day := RollupDay(r.Day)
+		month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		if current == nil || !current.Month.Equal(month) {
+			closeMonth()
+			// Months without movement still carry the outstanding balance forward.
+			for current != nil && current.Month.AddDate(0, 1, 0).Before(month) {
+				current = &LiabilityReportRow{Month: current.Month.AddDate(0, 1, 0)}
+				closeMonth()
+			}
+			current = &LiabilityReportRow{Month: month}
+		}
+
+		current.Issued += r.Issued
+		current.Redeemed += r.Redeemed
+		current.Expired += r.Expired
+		current.Reversed += r.Reversed
+		cumulative.Add(r)
+	}
+	closeMonth()
+
+	return rows
+}
+
+var liabilityCSVHeader = []string{
+	"month",
+	"issued",
+	"redeemed",
+	"expired",
+	"reversed",
+	"outstanding",
+	"breakage_rate",
+	"estimated_breakage",
+}
+
+func WriteLiabilityCSV(w io.Writer, rows []*LiabilityReportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(liabilityCSVHeader); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		if err := cw.Write([]string{
+			r.Month.Format("2006-01"),
+			strconv.FormatInt(r.Issued, 10),
+			strconv.FormatInt(r.Redeemed, 10),
+			strconv.FormatInt(r.Expired, 10),
+			strconv.FormatInt(r.Reversed, 10),
+			strconv.FormatInt(r.Outstanding, 10),
+			strconv.FormatFloat(r.BreakageRate, 'f', 4, 64),
+			strconv.FormatInt(r.EstimatedBreakage, 10),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
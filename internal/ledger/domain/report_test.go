@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+func TestNewRollupDelta(t *testing.T) {
+	createdAt := time.Date(2025, 3, 4, 23, 30, 0, 0, time.FixedZone("WIB", 7*3600))
+
+	cases := []struct {
+		name  string
+		entry *LedgerEntry
+		want  DailyRollup
+	}{
+		{"earn", &LedgerEntry{Type: EntryTypeCredit, Amount: 100}, DailyRollup{Issued: 100}},
+		{"redeem", &LedgerEntry{Type: EntryTypeDebit, Amount: 40}, DailyRollup{Redeemed: 40}},
+		{"expire", &LedgerEntry{Type: EntryTypeDebit, Amount: 10, Metadata: datatypes.JSON(`{"reason":"EXPIRY"}`)}, DailyRollup{Expired: 10}},
+		{"reverse", &LedgerEntry{Type: EntryTypeCredit, Amount: 5, Metadata: datatypes.JSON(`{"reverts":"x"}`)}, DailyRollup{Reversed: 5}},
+	}
+
+	for _, c := range cases {
+		c.entry.OrgID = "org-id"
+		c.entry.CreatedAt = createdAt
+
+		got := NewRollupDelta(c.entry)
+		if got.Issued != c.want.Issued || got.Redeemed != c.want.Redeemed || got.Expired != c.want.Expired || got.Reversed != c.want.Reversed {
+			t.Fatalf("%s: unexpected delta %+v", c.name, got)
+		}
+
+		if !got.Day.Equal(time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("%s: expected UTC day 2025-03-04, got %s", c.name, got.Day)
+		}
+	}
+}
+
+func TestBuildRollupsRederivesEntries(t *testing.T) {
+	at := func(d, h int) time.Time { return time.Date(2025, 1, d, h, 0, 0, 0, time.UTC) }
+
+	// Entries from before kinds were stored still roll up by their metadata.
+	entries := []*LedgerEntry{
+		{OrgID: "org-id", Type: EntryTypeCredit, Amount: 500, CreatedAt: at(2, 9)},
+		{OrgID: "org-id", Type: EntryTypeDebit, Amount: 100, CreatedAt: at(1, 8)},
+		{OrgID: "org-id", Type: EntryTypeCredit, Amount: 200, CreatedAt: at(2, 18)},
+		{OrgID: "org-id", Type: EntryTypeDebit, Amount: 50, Kind: JournalKindExpire, CreatedAt: at(2, 20)},
+		{OrgID: "org-id", Type: EntryTypeDebit, Amount: 30, Metadata: datatypes.JSON(`{"reason":"EXPIRY"}`), CreatedAt: at(3, 1)},
+	}
+
+	rollups := BuildRollups(entries)
+	if len(rollups) != 3 {
+		t.Fatalf("expected 3 days, got %d", len(rollups))
+	}
+
+	first, second, third := rollups[0], rollups[1], rollups[2]
+	if !first.Day.Equal(at(1, 0)) || first.Redeemed != 100 {
+		t.Fatalf("unexpected first day %+v", first)
+	}
+
+	if !second.Day.Equal(at(2, 0)) || second.Issued != 700 || second.Expired != 50 {
+		t.Fatalf("unexpected second day %+v", second)
+	}
+
+	if third.Expired != 30 {
+		t.Fatalf("unexpected third day %+v", third)
+	}
+
+	rows := BuildLiabilityReport(RollupTotals{}, rollups)
+	if rows[0].Expired != 80 || rows[0].Outstanding != 520 || rows[0].EstimatedBreakage == 0 {
+		t.Fatalf("expected expiries to show as breakage, got %+v", rows[0])
+	}
+}
+
+func TestBuildLiabilityReport(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 0, 0, 0, 0, time.UTC) }
+
+	opening := RollupTotals{Issued: 1000, Redeemed: 300, Expired: 100}
+	rollups := []*DailyRollup{
+		{Day: day(1, 3), Issued: 500},
+		{Day: day(1, 20), Redeemed: 200, Expired: 100},
+		{Day: day(3, 1), Issued: 100, Reversed: 100},
+	}
+
+	rows := BuildLiabilityReport(opening, rollups)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 months including the empty February, got %d", len(rows))
+	}
+
+	jan, feb, mar := rows[0], rows[1], rows[2]
+
+	if jan.Issued != 500 || jan.Redeemed != 200 || jan.Expired != 100 {
+		t.Fatalf("unexpected january movements %+v", jan)
+	}
+
+	// 1500 issued - 500 redeemed - 200 expired
+	if jan.Outstanding != 800 {
+		t.Fatalf("expected january outstanding 800, got %d", jan.Outstanding)
+	}
+
+	// 200 expired of 700 settled
+	if jan.EstimatedBreakage != 229 {
+		t.Fatalf("expected january estimated breakage 229, got %d", jan.EstimatedBreakage)
+	}
+
+	if !feb.Month.Equal(day(2, 1)) || feb.Issued != 0 || feb.Outstanding != 800 {
+		t.Fatalf("expected february to carry the outstanding balance, got %+v", feb)
+	}
+
+	if mar.Outstanding != 800 || mar.Reversed != 100 {
+		t.Fatalf("unexpected march row %+v", mar)
+	}
+}
+
+func TestBuildLiabilityReportWithoutSettlements(t *testing.T) {
+	rows := BuildLiabilityReport(RollupTotals{}, []*DailyRollup{{Day: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Issued: 10}})
+	if rows[0].BreakageRate != 0 || rows[0].EstimatedBreakage != 0 {
+		t.Fatalf("expected no breakage without settlements, got %+v", rows[0])
+	}
+}
+
+func TestWriteLiabilityCSV(t *testing.T) {
+	rows := []*LiabilityReportRow{{
+		Month:             time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Issued:            1500,
+		Redeemed:          500,
+		Expired:           200,
+		Outstanding:       800,
+		BreakageRate:      0.2857,
+		EstimatedBreakage: 229,
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteLiabilityCSV(&buf, rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got %d lines", len(lines))
+	}
+
+	if lines[0] != strings.Join(liabilityCSVHeader, ",") {
+		t.Fatalf("unexpected header %q", lines[0])
+	}
+
+	if lines[1] != "2025-01,1500,500,200,0,800,0.2857,229" {
+		t.Fatalf("unexpected row %q", lines[1])
+	}
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
 	"gorm.io/gorm"
@@ -30,6 +31,8 @@ type CreditPoolRepository interface {
 	// BatchCreate(ctx context.Context, resources []*CreditPool, batchSize int) error
 	// BatchUpdate(ctx context.Context, resources []*CreditPool) error
 	Count(ctx context.Context, query *CreditPool) (int64, error)
+	// SumRemaining totals the unconsumed points across the org's pools.
+	SumRemaining(ctx context.Context, orgID string) (int64, error)
 }
 
 type BalanceRepository interface {
@@ -43,3 +46,81 @@ type BalanceRepository interface {
 	// BatchUpdate(ctx context.Context, resources []*Balance) error
 	Count(ctx context.Context, query *Balance) (int64, error)
 }
+
+type AccountRepository interface {
+	WithTrx(tx *gorm.DB) AccountRepository
+	Find(ctx context.Context, query *Account, opts ...option.QueryOption) ([]*Account, error)
+	FindOne(ctx context.Context, query *Account, opts ...option.QueryOption) (*Account, error)
+	Create(ctx context.Context, resource *Account) error
+}
+
+type JournalRepository interface {
+	WithTrx(tx *gorm.DB) JournalRepository
+	Find(ctx context.Context, query *JournalEntry, opts ...option.QueryOption) ([]*JournalEntry, error)
+	FindOne(ctx context.Context, query *JournalEntry, opts ...option.QueryOption) (*JournalEntry, error)
+	// Create persists the journal together with its postings.
+	Create(ctx context.Context, resource *JournalEntry) error
+	// SumByAccount totals postings per account and side for postings created in [start, end).
+	SumByAccount(ctx context.Context, orgID string, start, end time.Time) ([]*AccountTotal, error)
+}
+
+type RollupRepository interface {
+	WithTrx(tx *gorm.DB) RollupRepository
+	// Increment adds delta onto the org's row for delta.Day, creating the row when missing.
+	Increment(ctx context.Context, delta *DailyRollup) error
+	// Find returns the org's rollups for days in [start, end) ordered by day.
+	Find(ctx context.Context, orgID string, start, end time.Time) ([]*DailyRollup, error)
+	// SumBefore totals every rollup of the org before day.
+	SumBefore(ctx context.Context, orgID string, day time.Time) (*RollupTotals, error)
+	// Lock holds off every rollup increment until the transaction ends.
+	Lock(ctx context.Context) error
+	// Replace swaps the org's rollups for rollups.
+	Replace(ctx context.Context, orgID string, rollups []*DailyRollup) error
+}
+
+type CoalitionRepository interface {
+	WithTrx(tx *gorm.DB) CoalitionRepository
+	Find(ctx context.Context, query *Coalition, opts ...option.QueryOption) ([]*Coalition, error)
+	// FindOne loads the coalition with its members.
+	FindOne(ctx context.Context, query *Coalition, opts ...option.QueryOption) (*Coalition, error)
+	// FindByOrg returns the coalition orgID belongs to, or nil.
+	FindByOrg(ctx context.Context, orgID string) (*Coalition, error)
+	Create(ctx context.Context, resource *Coalition) error
+	AddMember(ctx context.Context, member *CoalitionMember) error
+	RemoveMember(ctx context.Context, coalitionID, orgID string) error
+}
+
+type SettlementRepository interface {
+	WithTrx(tx *gorm.DB) SettlementRepository
+	CreateObligation(ctx context.Context, obligation *SettlementObligation) error
+	// FindUnsettled returns obligations created in [start, end) that no statement covers yet.
+	FindUnsettled(ctx context.Context, coalitionID string, start, end time.Time) ([]*SettlementObligation, error)
+	// CreateStatement persists the statement and marks the obligations as settled by it.
+	CreateStatement(ctx context.Context, statement *SettlementStatement, obligations []*SettlementObligation) error
+	FindStatements(ctx context.Context, query *SettlementStatement, opts ...option.QueryOption) ([]*SettlementStatement, error)
+}
+
+// ReplayChainKey identifies one (org, user) ledger chain.
+type ReplayChainKey struct {
+	OrgID  string `gorm:"column:org_id"`
+	UserID string `gorm:"column:user_id"`
+}
+
+type ReplayRepository interface {
+	WithTrx(tx *gorm.DB) ReplayRepository
+	CreateRun(ctx context.Context, run *ReplayRun) error
+	FindRun(ctx context.Context, runID string, opts ...option.QueryOption) (*ReplayRun, error)
+	UpdateRun(ctx context.Context, runID string, resource any) error
+	// Chains lists the chains in scope that have at least one entry.
+	Chains(ctx context.Context, scope ReplayScope) ([]*ReplayChainKey, error)
+	// Watermark returns the number of entries in scope and the latest created_at among them.
+	Watermark(ctx context.Context, scope ReplayScope) (int64, time.Time, error)
+	WriteShadow(ctx context.Context, runID string, pools []*CreditPool, balance *Balance) error
+	ShadowPools(ctx context.Context, runID string) ([]*CreditPool, error)
+	ShadowBalances(ctx context.Context, runID string) ([]*Balance, error)
+	LivePools(ctx context.Context, scope ReplayScope) ([]*CreditPool, error)
+	LiveBalances(ctx context.Context, scope ReplayScope, opts ...option.QueryOption) ([]*Balance, error)
+	// Swap replaces the live pools and balances in the run's scope with its shadow rows.
+	Swap(ctx context.Context, run *ReplayRun) error
+	DeleteShadow(ctx context.Context, runID string) error
+}
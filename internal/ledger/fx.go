@@ -4,6 +4,8 @@ import (
 	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
 	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/infrastructure/persistence"
 	grpc_handler "github.com/smallbiznis/smallbiznis-apps/internal/ledger/interfaces/grpc"
+	http_handler "github.com/smallbiznis/smallbiznis-apps/internal/ledger/interfaces/http"
+	task_handler "github.com/smallbiznis/smallbiznis-apps/internal/ledger/interfaces/task"
 	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/usecase"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/server"
 	"go.uber.org/fx"
@@ -14,6 +16,58 @@ func RegisterServiceServer(s *grpc.Server, srv *grpc_handler.Handler) {
 	ledgerv1.RegisterLedgerServiceServer(s, srv)
 }
 
+// DoubleEntry opts a ledger server into the double-entry journal. Once installed every
+// ledger entry is posted against the organization's chart of accounts in the same transaction.
+var DoubleEntry = fx.Module("ledger.double_entry",
+	fx.Provide(
+		persistence.NewAccountRepository,
+		persistence.NewJournalRepository,
+		usecase.NewJournal,
+	),
+)
+
+// Reporting keeps daily point rollups in step with the ledger and serves the
+// liability report over gRPC and as a CSV export on the HTTP gateway.
+var Reporting = fx.Module("ledger.reporting",
+	fx.Provide(
+		persistence.NewRollupRepository,
+		usecase.NewReport,
+	),
+	fx.Invoke(
+		http_handler.RegisterReportRoutes,
+	),
+)
+
+// Coalition lets member organizations redeem each other's points. Cross-org redemptions
+// record settlement obligations that are netted into monthly statements.
+var Coalition = fx.Module("ledger.coalition",
+	fx.Provide(
+		persistence.NewCoalitionRepository,
+		persistence.NewSettlementRepository,
+		usecase.NewCoalition,
+	),
+	fx.Invoke(
+		task_handler.RegisterSettlementTasks,
+	),
+)
+
+// Replay rebuilds credit pools and balances from the entry log into shadow tables,
+// so they can be diffed against live state and swapped in.
+var Replay = fx.Module("ledger.replay",
+	fx.Provide(
+		persistence.NewReplayRepository,
+		usecase.NewReplay,
+	),
+)
+
+// Expiry expires points daily once they are older than the configured expiry, moving
+// them from the liability to breakage income.
+var Expiry = fx.Module("ledger.expiry",
+	fx.Invoke(
+		task_handler.RegisterExpiryTasks,
+	),
+)
+
 var Server = fx.Module("rulengine.service.server",
 	fx.Provide(
 		server.NewListener,
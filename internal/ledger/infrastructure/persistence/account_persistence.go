@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type AccountParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type accountRepository struct {
+	db   *gorm.DB
+	repo repository.Repository[domain.Account]
+}
+
+func NewAccountRepository(p AccountParams) domain.AccountRepository {
+	return &accountRepository{
+		db:   p.DB,
+		repo: repository.ProvideStore[domain.Account](p.DB),
+	}
+}
+
+func (r *accountRepository) WithTrx(tx *gorm.DB) domain.AccountRepository {
+	return &accountRepository{
+		db:   tx,
+		repo: repository.ProvideStore[domain.Account](tx),
+	}
+}
+
+func (r *accountRepository) Find(ctx context.Context, f *domain.Account, opts ...option.QueryOption) ([]*domain.Account, error) {
+	return r.repo.Find(ctx, f, opts...)
+}
+
+func (r *accountRepository) FindOne(ctx context.Context, f *domain.Account, opts ...option.QueryOption) (*domain.Account, error) {
+	return r.repo.FindOne(ctx, f, opts...)
+}
+
+func (r *accountRepository) Create(ctx context.Context, account *domain.Account) error {
+	return r.repo.Create(ctx, account)
+}
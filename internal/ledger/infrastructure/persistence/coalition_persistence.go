@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type CoalitionParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type coalitionRepository struct {
+	db   *gorm.DB
+	repo repository.Repository[domain.Coalition]
+}
+
+func NewCoalitionRepository(p CoalitionParams) domain.CoalitionRepository {
+	return &coalitionRepository{
+		db:   p.DB,
+		repo: repository.ProvideStore[domain.Coalition](p.DB),
+	}
+}
+
+func (r *coalitionRepository) WithTrx(tx *gorm.DB) domain.CoalitionRepository {
+	return &coalitionRepository{
+		db:   tx,
+		repo: repository.ProvideStore[domain.Coalition](tx),
+	}
+}
+
+func (r *coalitionRepository) Find(ctx context.Context, f *domain.Coalition, opts ...option.QueryOption) ([]*domain.Coalition, error) {
+	return r.repo.Find(ctx, f, append(opts, option.WithPreloads("Members"))...)
+}
+
+func (r *coalitionRepository) FindOne(ctx context.Context, f *domain.Coalition, opts ...option.QueryOption) (*domain.Coalition, error) {
+	return r.repo.FindOne(ctx, f, append(opts, option.WithPreloads("Members"))...)
+}
+
+func (r *coalitionRepository) FindByOrg(ctx context.Context, orgID string) (*domain.Coalition, error) {
+	member, err := repository.ProvideStore[domain.CoalitionMember](r.db).FindOne(ctx, &domain.CoalitionMember{OrgID: orgID})
+	if err != nil || member == nil {
+		return nil, err
+	}
+
+	return r.FindOne(ctx, &domain.Coalition{ID: member.CoalitionID})
+}
+
+func (r *coalitionRepository) Create(ctx context.Context, coalition *domain.Coalition) error {
+	return r.repo.Create(ctx, coalition)
+}
+
+func (r *coalitionRepository) AddMember(ctx context.Context, member *domain.CoalitionMember) error {
+	return repository.ProvideStore[domain.CoalitionMember](r.db).Create(ctx, member)
+}
+
+func (r *coalitionRepository) RemoveMember(ctx context.Context, coalitionID, orgID string) error {
+	return r.db.WithContext(ctx).
+		Where("coalition_id = ? AND org_id = ?", coalitionID, orgID).
+		Delete(&domain.CoalitionMember{}).Error
+}
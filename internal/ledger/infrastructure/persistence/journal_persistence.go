@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type JournalParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type journalRepository struct {
+	db   *gorm.DB
+	repo repository.Repository[domain.JournalEntry]
+}
+
+func NewJournalRepository(p JournalParams) domain.JournalRepository {
+	return &journalRepository{
+		db:   p.DB,
+		repo: repository.ProvideStore[domain.JournalEntry](p.DB),
+	}
+}
+
+func (r *journalRepository) WithTrx(tx *gorm.DB) domain.JournalRepository {
+	return &journalRepository{
+		db:   tx,
+		repo: repository.ProvideStore[domain.JournalEntry](tx),
+	}
+}
+
+func (r *journalRepository) Find(ctx context.Context, f *domain.JournalEntry, opts ...option.QueryOption) ([]*domain.JournalEntry, error) {
+	return r.repo.Find(ctx, f, append(opts, option.WithPreloads("Postings"))...)
+}
+
+func (r *journalRepository) FindOne(ctx context.Context, f *domain.JournalEntry, opts ...option.QueryOption) (*domain.JournalEntry, error) {
+	return r.repo.FindOne(ctx, f, append(opts, option.WithPreloads("Postings"))...)
+}
+
+func (r *journalRepository) Create(ctx context.Context, journal *domain.JournalEntry) error {
+	return r.repo.Create(ctx, journal)
+}
+
+func (r *journalRepository) SumByAccount(ctx context.Context, orgID string, start, end time.Time) ([]*domain.AccountTotal, error) {
+	var totals []*domain.AccountTotal
+	err := r.db.WithContext(ctx).
+		Model(&domain.Posting{}).
+		Select("account_code, side, SUM(amount) AS amount").
+		Where("org_id = ?", orgID).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Group("account_code, side").
+		Scan(&totals).Error
+	return totals, err
+}
@@ -0,0 +1,179 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+const (
+	poolColumns    = "id, ledger_entry_id, org_id, user_id, remaining, created_at"
+	balanceColumns = "id, org_id, user_id, balance, created_at, updated_at"
+)
+
+type ReplayParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type replayRepository struct {
+	db   *gorm.DB
+	runs repository.Repository[domain.ReplayRun]
+}
+
+func NewReplayRepository(p ReplayParams) domain.ReplayRepository {
+	return &replayRepository{
+		db:   p.DB,
+		runs: repository.ProvideStore[domain.ReplayRun](p.DB),
+	}
+}
+
+func (r *replayRepository) WithTrx(tx *gorm.DB) domain.ReplayRepository {
+	return &replayRepository{
+		db:   tx,
+		runs: repository.ProvideStore[domain.ReplayRun](tx),
+	}
+}
+
+func scoped(db *gorm.DB, scope domain.ReplayScope) *gorm.DB {
+	if scope.OrgID != "" {
+		db = db.Where("org_id = ?", scope.OrgID)
+	}
+	if scope.UserID != "" {
+		db = db.Where("user_id = ?", scope.UserID)
+	}
+	return db
+}
+
+func (r *replayRepository) CreateRun(ctx context.Context, run *domain.ReplayRun) error {
+	return r.runs.Create(ctx, run)
+}
+
+func (r *replayRepository) FindRun(ctx context.Context, runID string, opts ...option.QueryOption) (*domain.ReplayRun, error) {
+	return r.runs.FindOne(ctx, &domain.ReplayRun{ID: runID}, opts...)
+}
+
+func (r *replayRepository) UpdateRun(ctx context.Context, runID string, run any) error {
+	return r.runs.Update(ctx, runID, run)
+}
+
+func (r *replayRepository) Chains(ctx context.Context, scope domain.ReplayScope) ([]*domain.ReplayChainKey, error) {
+	var keys []*domain.ReplayChainKey
+	err := scoped(r.db.WithContext(ctx).Model(&domain.LedgerEntry{}), scope).
+		Distinct("org_id", "user_id").
+		Order("org_id, user_id").
+		Scan(&keys).Error
+	return keys, err
+}
+
+func (r *replayRepository) Watermark(ctx context.Context, scope domain.ReplayScope) (int64, time.Time, error) {
+	var row struct {
+		Entries int64      `gorm:"column:entries"`
+		Latest  *time.Time `gorm:"column:latest"`
+	}
+
+	err := scoped(r.db.WithContext(ctx).Model(&domain.LedgerEntry{}), scope).
+		Select("COUNT(*) AS entries, MAX(created_at) AS latest").
+		Scan(&row).Error
+	if err != nil || row.Latest == nil {
+		return row.Entries, time.Time{}, err
+	}
+
+	return row.Entries, *row.Latest, nil
+}
+
+func (r *replayRepository) WriteShadow(ctx context.Context, runID string, pools []*domain.CreditPool, balance *domain.Balance) error {
+	if len(pools) > 0 {
+		rows := make([]*domain.ShadowCreditPool, 0, len(pools))
+		for _, p := range pools {
+			rows = append(rows, &domain.ShadowCreditPool{RunID: runID, CreditPool: *p})
+		}
+		if err := r.db.WithContext(ctx).CreateInBatches(rows, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	if balance != nil {
+		return r.db.WithContext(ctx).Create(&domain.ShadowBalance{RunID: runID, Balance: *balance}).Error
+	}
+
+	return nil
+}
+
+func (r *replayRepository) ShadowPools(ctx context.Context, runID string) ([]*domain.CreditPool, error) {
+	var pools []*domain.CreditPool
+	err := r.db.WithContext(ctx).Table(domain.ShadowCreditPool{}.TableName()).
+		Where("run_id = ?", runID).
+		Order("created_at").
+		Find(&pools).Error
+	return pools, err
+}
+
+func (r *replayRepository) ShadowBalances(ctx context.Context, runID string) ([]*domain.Balance, error) {
+	var balances []*domain.Balance
+	err := r.db.WithContext(ctx).Table(domain.ShadowBalance{}.TableName()).
+		Where("run_id = ?", runID).
+		Find(&balances).Error
+	return balances, err
+}
+
+func (r *replayRepository) LivePools(ctx context.Context, scope domain.ReplayScope) ([]*domain.CreditPool, error) {
+	var pools []*domain.CreditPool
+	err := scoped(r.db.WithContext(ctx).Model(&domain.CreditPool{}), scope).
+		Order("created_at").
+		Find(&pools).Error
+	return pools, err
+}
+
+func (r *replayRepository) LiveBalances(ctx context.Context, scope domain.ReplayScope, opts ...option.QueryOption) ([]*domain.Balance, error) {
+	db := scoped(r.db.WithContext(ctx).Model(&domain.Balance{}), scope)
+	for _, opt := range opts {
+		db = opt.Apply(db)
+	}
+
+	var balances []*domain.Balance
+	err := db.Find(&balances).Error
+	return balances, err
+}
+
+func (r *replayRepository) Swap(ctx context.Context, run *domain.ReplayRun) error {
+	db := r.db.WithContext(ctx)
+	scope := run.Scope()
+
+	if err := scoped(db, scope).Delete(&domain.CreditPool{}).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(
+		"INSERT INTO credit_pools ("+poolColumns+") SELECT "+poolColumns+" FROM credit_pools_shadow WHERE run_id = ?", run.ID,
+	).Error; err != nil {
+		return err
+	}
+
+	if err := scoped(db, scope).Delete(&domain.Balance{}).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(
+		"INSERT INTO balances ("+balanceColumns+") SELECT "+balanceColumns+" FROM balances_shadow WHERE run_id = ?", run.ID,
+	).Error; err != nil {
+		return err
+	}
+
+	return r.DeleteShadow(ctx, run.ID)
+}
+
+func (r *replayRepository) DeleteShadow(ctx context.Context, runID string) error {
+	db := r.db.WithContext(ctx)
+
+	if err := db.Where("run_id = ?", runID).Delete(&domain.ShadowCreditPool{}).Error; err != nil {
+		return err
+	}
+
+	return db.Where("run_id = ?", runID).Delete(&domain.ShadowBalance{}).Error
+}
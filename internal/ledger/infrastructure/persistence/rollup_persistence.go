@@ -0,0 +1,82 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RollupParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type rollupRepository struct {
+	db *gorm.DB
+}
+
+func NewRollupRepository(p RollupParams) domain.RollupRepository {
+	return &rollupRepository{
+		db: p.DB,
+	}
+}
+
+func (r *rollupRepository) WithTrx(tx *gorm.DB) domain.RollupRepository {
+	return &rollupRepository{
+		db: tx,
+	}
+}
+
+func (r *rollupRepository) Increment(ctx context.Context, delta *domain.DailyRollup) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "org_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"issued":     gorm.Expr("daily_rollups.issued + ?", delta.Issued),
+			"redeemed":   gorm.Expr("daily_rollups.redeemed + ?", delta.Redeemed),
+			"expired":    gorm.Expr("daily_rollups.expired + ?", delta.Expired),
+			"reversed":   gorm.Expr("daily_rollups.reversed + ?", delta.Reversed),
+			"updated_at": delta.UpdatedAt,
+		}),
+	}).Create(delta).Error
+}
+
+func (r *rollupRepository) Find(ctx context.Context, orgID string, start, end time.Time) ([]*domain.DailyRollup, error) {
+	var rollups []*domain.DailyRollup
+	err := r.db.WithContext(ctx).
+		Where("org_id = ?", orgID).
+		Where("day >= ? AND day < ?", start, end).
+		Order("day ASC").
+		Find(&rollups).Error
+	return rollups, err
+}
+
+func (r *rollupRepository) SumBefore(ctx context.Context, orgID string, day time.Time) (*domain.RollupTotals, error) {
+	var totals domain.RollupTotals
+	err := r.db.WithContext(ctx).
+		Model(&domain.DailyRollup{}).
+		Select("COALESCE(SUM(issued), 0) AS issued, COALESCE(SUM(redeemed), 0) AS redeemed, COALESCE(SUM(expired), 0) AS expired, COALESCE(SUM(reversed), 0) AS reversed").
+		Where("org_id = ?", orgID).
+		Where("day < ?", day).
+		Scan(&totals).Error
+	return &totals, err
+}
+
+func (r *rollupRepository) Lock(ctx context.Context) error {
+	return r.db.WithContext(ctx).Exec("LOCK TABLE daily_rollups IN SHARE ROW EXCLUSIVE MODE").Error
+}
+
+func (r *rollupRepository) Replace(ctx context.Context, orgID string, rollups []*domain.DailyRollup) error {
+	if err := r.db.WithContext(ctx).Where("org_id = ?", orgID).Delete(&domain.DailyRollup{}).Error; err != nil {
+		return err
+	}
+
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	return r.db.WithContext(ctx).CreateInBatches(rollups, 500).Error
+}
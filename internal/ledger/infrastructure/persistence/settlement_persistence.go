@@ -0,0 +1,76 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type SettlementParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type settlementRepository struct {
+	db         *gorm.DB
+	obligation repository.Repository[domain.SettlementObligation]
+	statement  repository.Repository[domain.SettlementStatement]
+}
+
+func NewSettlementRepository(p SettlementParams) domain.SettlementRepository {
+	return &settlementRepository{
+		db:         p.DB,
+		obligation: repository.ProvideStore[domain.SettlementObligation](p.DB),
+		statement:  repository.ProvideStore[domain.SettlementStatement](p.DB),
+	}
+}
+
+func (r *settlementRepository) WithTrx(tx *gorm.DB) domain.SettlementRepository {
+	return &settlementRepository{
+		db:         tx,
+		obligation: repository.ProvideStore[domain.SettlementObligation](tx),
+		statement:  repository.ProvideStore[domain.SettlementStatement](tx),
+	}
+}
+
+func (r *settlementRepository) CreateObligation(ctx context.Context, obligation *domain.SettlementObligation) error {
+	return r.obligation.Create(ctx, obligation)
+}
+
+func (r *settlementRepository) FindUnsettled(ctx context.Context, coalitionID string, start, end time.Time) ([]*domain.SettlementObligation, error) {
+	return r.obligation.Find(ctx, &domain.SettlementObligation{CoalitionID: coalitionID},
+		option.ApplyOperator(option.Condition{Field: "statement_id", Operator: option.ISNULL}),
+		option.ApplyOperator(option.Condition{Field: "created_at", Operator: option.GTE, Value: start}),
+		option.ApplyOperator(option.Condition{Field: "created_at", Operator: option.LT, Value: end}),
+		option.WithLockingUpdate(),
+	)
+}
+
+func (r *settlementRepository) CreateStatement(ctx context.Context, statement *domain.SettlementStatement, obligations []*domain.SettlementObligation) error {
+	if err := r.statement.Create(ctx, statement); err != nil {
+		return err
+	}
+
+	if len(obligations) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(obligations))
+	for _, o := range obligations {
+		ids = append(ids, o.ID)
+	}
+
+	return r.db.WithContext(ctx).
+		Model(&domain.SettlementObligation{}).
+		Where("id IN ?", ids).
+		Update("statement_id", statement.ID).Error
+}
+
+func (r *settlementRepository) FindStatements(ctx context.Context, f *domain.SettlementStatement, opts ...option.QueryOption) ([]*domain.SettlementStatement, error) {
+	return r.statement.Find(ctx, f, append(opts, option.WithPreloads("Lines"))...)
+}
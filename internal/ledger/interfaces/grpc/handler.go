@@ -5,6 +5,7 @@ import (
 
 	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
 	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
 	"go.uber.org/fx"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -12,17 +13,29 @@ import (
 
 type Handler struct {
 	ledgerv1.UnimplementedLedgerServiceServer
-	ledgerUsecase usecase.LedgerUsecase
+	ledgerUsecase  usecase.LedgerUsecase
+	journalUsecase usecase.JournalUsecase
+	reportUsecase  usecase.ReportUsecase
+	coalition      usecase.CoalitionUsecase
+	replay         usecase.ReplayUsecase
 }
 
 type Params struct {
 	fx.In
-	LedgerUsecase usecase.LedgerUsecase
+	LedgerUsecase  usecase.LedgerUsecase
+	JournalUsecase usecase.JournalUsecase   `optional:"true"`
+	ReportUsecase  usecase.ReportUsecase    `optional:"true"`
+	Coalition      usecase.CoalitionUsecase `optional:"true"`
+	Replay         usecase.ReplayUsecase    `optional:"true"`
 }
 
 func NewHandler(p Params) *Handler {
 	return &Handler{
-		ledgerUsecase: p.LedgerUsecase,
+		ledgerUsecase:  p.LedgerUsecase,
+		journalUsecase: p.JournalUsecase,
+		reportUsecase:  p.ReportUsecase,
+		coalition:      p.Coalition,
+		replay:         p.Replay,
 	}
 }
 
@@ -66,3 +79,249 @@ func (h *Handler) GetBalance(ctx context.Context, req *ledgerv1.GetBalanceReques
 func (h *Handler) VerifyChain(ctx context.Context, req *ledgerv1.VerifyChainRequest) (*ledgerv1.VerifyChainResponse, error) {
 	return h.ledgerUsecase.VerifyChain(ctx, req)
 }
+
+func (h *Handler) GetTrialBalance(ctx context.Context, req *ledgerv1.GetTrialBalanceRequest) (*ledgerv1.GetTrialBalanceResponse, error) {
+	if h.journalUsecase == nil {
+		return nil, status.Error(codes.Unimplemented, "double-entry journal is not enabled")
+	}
+
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.GetStartTime() == nil {
+		return nil, status.Error(codes.InvalidArgument, "startTime is required")
+	}
+
+	res, err := h.journalUsecase.GetTrialBalance(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) GetLiabilityReport(ctx context.Context, req *ledgerv1.GetLiabilityReportRequest) (*ledgerv1.GetLiabilityReportResponse, error) {
+	if h.reportUsecase == nil {
+		return nil, status.Error(codes.Unimplemented, "ledger reporting is not enabled")
+	}
+
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.GetStartTime() == nil {
+		return nil, status.Error(codes.InvalidArgument, "startTime is required")
+	}
+
+	res, err := h.reportUsecase.GetLiabilityReport(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) coalitionEnabled() error {
+	if h.coalition == nil {
+		return status.Error(codes.Unimplemented, "coalitions are not enabled")
+	}
+	return nil
+}
+
+func (h *Handler) CreateCoalition(ctx context.Context, req *ledgerv1.CreateCoalitionRequest) (*ledgerv1.Coalition, error) {
+	if err := h.coalitionEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.Currency == "" {
+		return nil, status.Error(codes.InvalidArgument, "currency is required")
+	}
+
+	if req.PointValue <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "pointValue must be greater than 0")
+	}
+
+	res, err := h.coalition.CreateCoalition(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) GetCoalition(ctx context.Context, req *ledgerv1.GetCoalitionRequest) (*ledgerv1.Coalition, error) {
+	if err := h.coalitionEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := h.coalition.GetCoalition(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) AddCoalitionMember(ctx context.Context, req *ledgerv1.AddCoalitionMemberRequest) (*ledgerv1.Coalition, error) {
+	if err := h.coalitionEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.CoalitionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "coalitionId is required")
+	}
+
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.coalition.AddCoalitionMember(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) RemoveCoalitionMember(ctx context.Context, req *ledgerv1.RemoveCoalitionMemberRequest) (*ledgerv1.Coalition, error) {
+	if err := h.coalitionEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.CoalitionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "coalitionId is required")
+	}
+
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.coalition.RemoveCoalitionMember(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) GenerateSettlementStatement(ctx context.Context, req *ledgerv1.GenerateSettlementStatementRequest) (*ledgerv1.SettlementStatement, error) {
+	if err := h.coalitionEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.CoalitionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "coalitionId is required")
+	}
+
+	if req.GetStartTime() == nil {
+		return nil, status.Error(codes.InvalidArgument, "startTime is required")
+	}
+
+	res, err := h.coalition.GenerateSettlementStatement(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) ListSettlementStatements(ctx context.Context, req *ledgerv1.ListSettlementStatementsRequest) (*ledgerv1.ListSettlementStatementsResponse, error) {
+	if err := h.coalitionEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.CoalitionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "coalitionId is required")
+	}
+
+	res, err := h.coalition.ListSettlementStatements(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) replayEnabled() error {
+	if h.replay == nil {
+		return status.Error(codes.Unimplemented, "ledger replay is not enabled")
+	}
+	return nil
+}
+
+func (h *Handler) StartReplay(ctx context.Context, req *ledgerv1.StartReplayRequest) (*ledgerv1.ReplayRun, error) {
+	if err := h.replayEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.UserId != "" && req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required to replay a user")
+	}
+
+	res, err := h.replay.StartReplay(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) GetReplay(ctx context.Context, req *ledgerv1.GetReplayRequest) (*ledgerv1.GetReplayResponse, error) {
+	if err := h.replayEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := h.replay.GetReplay(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) SwapReplay(ctx context.Context, req *ledgerv1.SwapReplayRequest) (*ledgerv1.ReplayRun, error) {
+	if err := h.replayEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := h.replay.SwapReplay(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) DiscardReplay(ctx context.Context, req *ledgerv1.DiscardReplayRequest) (*ledgerv1.ReplayRun, error) {
+	if err := h.replayEnabled(); err != nil {
+		return nil, err
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := h.replay.DiscardReplay(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
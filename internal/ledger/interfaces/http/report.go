@@ -0,0 +1,107 @@
+package http_handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/server"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	LiabilityReportCSVPath = "/v1/ledger/reports/liability.csv"
+	RebuildRollupsPath     = "/v1/ledger/reports/rollups/rebuild"
+)
+
+type ReportParams struct {
+	fx.In
+	Mux    *runtime.ServeMux
+	Report usecase.ReportUsecase
+}
+
+// RegisterReportRoutes serves the liability report as CSV on the gateway mux, and
+// the rebuild of the rollups it reads from the ledger entries.
+//
+//	GET  /v1/ledger/reports/liability.csv?start=2025-01&end=2025-06
+//	POST /v1/ledger/reports/rollups/rebuild
+//
+// The organization comes from the X-ORG-ID header or the org_id query parameter,
+// end is exclusive and defaults to the current month. Rollups are only recorded from
+// the release that introduced them: rebuild once per organization to cover the
+// entries written before it.
+func RegisterReportRoutes(p ReportParams) error {
+	if err := p.Mux.HandlePath(http.MethodPost, RebuildRollupsPath, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		days, err := p.Report.Rebuild(r.Context(), orgOf(r))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"days": days})
+	}); err != nil {
+		return err
+	}
+
+	return p.Mux.HandlePath(http.MethodGet, LiabilityReportCSVPath, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		query := r.URL.Query()
+
+		orgID := orgOf(r)
+		if orgID == "" {
+			writeError(w, errutil.BadRequest("organizationId is required", nil))
+			return
+		}
+
+		start, err := time.Parse("2006-01", query.Get("start"))
+		if err != nil {
+			writeError(w, errutil.BadRequest("start must be formatted as YYYY-MM", err))
+			return
+		}
+
+		end := time.Now()
+		if v := query.Get("end"); v != "" {
+			if end, err = time.Parse("2006-01", v); err != nil {
+				writeError(w, errutil.BadRequest("end must be formatted as YYYY-MM", err))
+				return
+			}
+		}
+
+		rows, err := p.Report.LiabilityReport(r.Context(), orgID, start, end)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="liability-%s-%s.csv"`, orgID, start.Format("2006-01")))
+		if err := domain.WriteLiabilityCSV(w, rows); err != nil {
+			zap.L().Error("failed to write liability csv", zap.Error(err), zap.String("org_id", orgID))
+		}
+	})
+}
+
+func orgOf(r *http.Request) string {
+	if orgID := r.Header.Get(server.OrgID); orgID != "" {
+		return orgID
+	}
+	return r.URL.Query().Get("org_id")
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var base errutil.BaseError
+	if !errors.As(err, &base) {
+		base = errutil.Internal("internal error", err).(errutil.BaseError)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(base.Code.HTTPStatus())
+	_ = json.NewEncoder(w).Encode(base.JSON())
+}
@@ -0,0 +1,50 @@
+package task_handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/usecase"
+	asynqx "github.com/smallbiznis/smallbiznis-apps/pkg/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// expirySchedule runs at 02:00 UTC every day.
+const expirySchedule = "0 2 * * *"
+
+type ExpiryParams struct {
+	fx.In
+	Mux       *asynq.ServeMux  `optional:"true"`
+	Scheduler *asynq.Scheduler `optional:"true"`
+	Config    *config.Config
+	Ledger    usecase.LedgerUsecase
+}
+
+// RegisterExpiryTasks handles the points expiry when an asynq server is installed and
+// schedules it when an asynq scheduler is installed. Without LEDGER_POINTS_EXPIRY points
+// never expire and nothing is registered.
+func RegisterExpiryTasks(p ExpiryParams) error {
+	expiry := p.Config.Ledger.PointsExpiry
+	if expiry <= 0 {
+		return nil
+	}
+
+	if p.Mux != nil {
+		p.Mux.HandleFunc(asynqx.PointsExpiryTask, func(ctx context.Context, t *asynq.Task) error {
+			expired, err := p.Ledger.ExpirePoints(ctx, time.Now().Add(-expiry))
+			zap.L().Info("expired credit pools", zap.Int("pools", expired))
+			return err
+		})
+	}
+
+	if p.Scheduler != nil {
+		if _, err := p.Scheduler.Register(expirySchedule, asynq.NewTask(asynqx.PointsExpiryTask, nil), asynq.Unique(time.Hour)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
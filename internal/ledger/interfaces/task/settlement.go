@@ -0,0 +1,39 @@
+package task_handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/usecase"
+	asynqx "github.com/smallbiznis/smallbiznis-apps/pkg/asynq"
+	"go.uber.org/fx"
+)
+
+// settlementSchedule runs at 01:00 UTC on the first day of each month.
+const settlementSchedule = "0 1 1 * *"
+
+type SettlementParams struct {
+	fx.In
+	Mux       *asynq.ServeMux  `optional:"true"`
+	Scheduler *asynq.Scheduler `optional:"true"`
+	Coalition usecase.CoalitionUsecase
+}
+
+// RegisterSettlementTasks handles the monthly settlement task when an asynq server is
+// installed and schedules it when an asynq scheduler is installed.
+func RegisterSettlementTasks(p SettlementParams) error {
+	if p.Mux != nil {
+		p.Mux.HandleFunc(asynqx.SettlementStatementTask, func(ctx context.Context, t *asynq.Task) error {
+			return p.Coalition.GenerateMonthlyStatements(ctx, time.Now())
+		})
+	}
+
+	if p.Scheduler != nil {
+		if _, err := p.Scheduler.Register(settlementSchedule, asynq.NewTask(asynqx.SettlementStatementTask, nil), asynq.Unique(time.Hour)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -source=coalition_usecase.go -destination=./../../usecase/mock_coalition_usecase.go -package=usecase
+type CoalitionUsecase interface {
+	// Membership returns the coalition orgID belongs to, or nil when it is standalone.
+	Membership(ctx context.Context, tx *gorm.DB, orgID string) (*domain.Coalition, error)
+	// RecordObligation stores what the issuing org owes the redeeming org inside tx.
+	RecordObligation(ctx context.Context, tx *gorm.DB, p domain.SettlementObligationParams) error
+	// GenerateStatement settles the coalition's open obligations for [start, end). It is
+	// idempotent: a statement already generated for the same period is returned as is.
+	GenerateStatement(ctx context.Context, coalitionID string, start, end time.Time) (*domain.SettlementStatement, error)
+	// GenerateMonthlyStatements generates the statement of the month before now for every
+	// coalition. A coalition that fails doesn't stop the others; the errors are returned together.
+	GenerateMonthlyStatements(ctx context.Context, now time.Time) error
+
+	CreateCoalition(ctx context.Context, req *ledgerv1.CreateCoalitionRequest) (*ledgerv1.Coalition, error)
+	GetCoalition(ctx context.Context, req *ledgerv1.GetCoalitionRequest) (*ledgerv1.Coalition, error)
+	AddCoalitionMember(ctx context.Context, req *ledgerv1.AddCoalitionMemberRequest) (*ledgerv1.Coalition, error)
+	RemoveCoalitionMember(ctx context.Context, req *ledgerv1.RemoveCoalitionMemberRequest) (*ledgerv1.Coalition, error)
+	GenerateSettlementStatement(ctx context.Context, req *ledgerv1.GenerateSettlementStatementRequest) (*ledgerv1.SettlementStatement, error)
+	ListSettlementStatements(ctx context.Context, req *ledgerv1.ListSettlementStatementsRequest) (*ledgerv1.ListSettlementStatementsResponse, error)
+}
+
+type coalitionUsecase struct {
+	fx.In
+	DB                   *gorm.DB
+	CoalitionRepository  domain.CoalitionRepository
+	SettlementRepository domain.SettlementRepository
+}
+
+func NewCoalition(p coalitionUsecase) CoalitionUsecase {
+	return &p
+}
+
+func (s *coalitionUsecase) Membership(ctx context.Context, tx *gorm.DB, orgID string) (*domain.Coalition, error) {
+	return s.CoalitionRepository.WithTrx(tx).FindByOrg(ctx, orgID)
+}
+
+func (s *coalitionUsecase) RecordObligation(ctx context.Context, tx *gorm.DB, p domain.SettlementObligationParams) error {
+	return s.SettlementRepository.WithTrx(tx).CreateObligation(ctx, domain.NewSettlementObligation(p))
+}
+
+func (s *coalitionUsecase) GenerateStatement(ctx context.Context, coalitionID string, start, end time.Time) (*domain.SettlementStatement, error) {
+	if !end.After(start) {
+		return nil, errutil.BadRequest("end_time must be after start_time", nil)
+	}
+
+	var statement *domain.SettlementStatement
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		coalition, err := s.CoalitionRepository.WithTrx(tx).FindOne(ctx, &domain.Coalition{ID: coalitionID})
+		if err != nil {
+			return err
+		}
+
+		if coalition == nil {
+			return errutil.NotFound("coalition not found", nil)
+		}
+
+		existing, err := s.SettlementRepository.WithTrx(tx).FindStatements(ctx, &domain.SettlementStatement{
+			CoalitionID: coalitionID,
+			PeriodStart: start,
+			PeriodEnd:   end,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			statement = existing[0]
+			return nil
+		}
+
+		obligations, err := s.SettlementRepository.WithTrx(tx).FindUnsettled(ctx, coalitionID, start, end)
+		if err != nil {
+			return err
+		}
+
+		statement = domain.NewSettlementStatement(coalition, start, end, obligations)
+		return s.SettlementRepository.WithTrx(tx).CreateStatement(ctx, statement, obligations)
+	}); err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+func (s *coalitionUsecase) GenerateMonthlyStatements(ctx context.Context, now time.Time) error {
+	now = now.UTC()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, -1, 0)
+
+	coalitions, err := s.CoalitionRepository.Find(ctx, &domain.Coalition{})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range coalitions {
+		statement, err := s.GenerateStatement(ctx, c.ID, start, end)
+		if err != nil {
+			zap.L().Error("failed to generate settlement statement", zap.Error(err), zap.String("coalition_id", c.ID))
+			errs = append(errs, err)
+			continue
+		}
+
+		zap.L().Info("settlement statement generated",
+			zap.String("coalition_id", c.ID),
+			zap.String("statement_id", statement.ID),
+			zap.Int("lines", len(statement.Lines)),
+		)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *coalitionUsecase) CreateCoalition(ctx context.Context, req *ledgerv1.CreateCoalitionRequest) (*ledgerv1.Coalition, error) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	opts := []zap.Field{
+		zap.String("trace_id", traceID),
+		zap.String("span_id", spanID),
+	}
+
+	coalition := domain.NewCoalition(domain.CoalitionParams{
+		Name:       req.Name,
+		Currency:   req.Currency,
+		PointValue: req.PointValue,
+	})
+
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.CoalitionRepository.WithTrx(tx).Create(ctx, coalition); err != nil {
+			return err
+		}
+
+		for _, orgID := range req.OrgIds {
+			if err := s.addMember(ctx, tx, coalition.ID, orgID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		zap.L().With(opts...).Error("failed to create coalition", zap.Error(err))
+		return nil, err
+	}
+
+	return s.GetCoalition(ctx, &ledgerv1.GetCoalitionRequest{Id: coalition.ID})
+}
+
+func (s *coalitionUsecase) GetCoalition(ctx context.Context, req *ledgerv1.GetCoalitionRequest) (*ledgerv1.Coalition, error) {
+	coalition, err := s.CoalitionRepository.FindOne(ctx, &domain.Coalition{ID: req.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	if coalition == nil {
+		return nil, errutil.NotFound("coalition not found", nil)
+	}
+
+	return toCoalitionProto(coalition), nil
+}
+
+// addMember enrols orgID. An org belongs to at most one coalition, so its points have a
+// single settlement currency.
+func (s *coalitionUsecase) addMember(ctx context.Context, tx *gorm.DB, coalitionID, orgID string) error {
+	current, err := s.CoalitionRepository.WithTrx(tx).FindByOrg(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	if current != nil {
+		return errutil.Conflict("organization already belongs to a coalition", nil,
+			errutil.WithDetails(errutil.Detail{Field: "org_id", Message: "member of coalition " + current.ID}))
+	}
+
+	return s.CoalitionRepository.WithTrx(tx).AddMember(ctx, domain.NewCoalitionMember(coalitionID, orgID))
+}
+
+func (s *coalitionUsecase) AddCoalitionMember(ctx context.Context, req *ledgerv1.AddCoalitionMemberRequest) (*ledgerv1.Coalition, error) {
+	coalition, err := s.CoalitionRepository.FindOne(ctx, &domain.Coalition{ID: req.CoalitionId})
+	if err != nil {
+		return nil, err
+	}
+
+	if coalition == nil {
+		return nil, errutil.NotFound("coalition not found", nil)
+	}
+
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return s.addMember(ctx, tx, req.CoalitionId, req.OrgId)
+	}); err != nil {
+		zap.L().Error("failed to add coalition member", zap.Error(err), zap.String("org_id", req.OrgId))
+		return nil, err
+	}
+
+	return s.GetCoalition(ctx, &ledgerv1.GetCoalitionRequest{Id: req.CoalitionId})
+}
+
+// RemoveCoalitionMember stops further cross-org redemptions for the org. Obligations it
+// already incurred stay open until the next statement settles them.
+func (s *coalitionUsecase) RemoveCoalitionMember(ctx context.Context, req *ledgerv1.RemoveCoalitionMemberRequest) (*ledgerv1.Coalition, error) {
+	if err := s.CoalitionRepository.RemoveMember(ctx, req.CoalitionId, req.OrgId); err != nil {
+		zap.L().Error("failed to remove coalition member", zap.Error(err), zap.String("org_id", req.OrgId))
+		return nil, err
+	}
+
+	return s.GetCoalition(ctx, &ledgerv1.GetCoalitionRequest{Id: req.CoalitionId})
+}
+
+func (s *coalitionUsecase) GenerateSettlementStatement(ctx context.Context, req *ledgerv1.GenerateSettlementStatementRequest) (*ledgerv1.SettlementStatement, error) {
+	end := time.Now()
+	if req.GetEndTime() != nil {
+		end = req.GetEndTime().AsTime()
+	}
+
+	statement, err := s.GenerateStatement(ctx, req.CoalitionId, req.GetStartTime().AsTime(), end)
+	if err != nil {
+		zap.L().Error("failed to generate settlement statement", zap.Error(err), zap.String("coalition_id", req.CoalitionId))
+		return nil, err
+	}
+
+	coalition, err := s.CoalitionRepository.FindOne(ctx, &domain.Coalition{ID: req.CoalitionId})
+	if err != nil {
+		return nil, err
+	}
+
+	return toSettlementStatementProto(coalition, statement, ""), nil
+}
+
+// ListSettlementStatements returns the coalition's statements, newest first. When OrgId is
+// set only the lines that org is party to are returned.
+func (s *coalitionUsecase) ListSettlementStatements(ctx context.Context, req *ledgerv1.ListSettlementStatementsRequest) (*ledgerv1.ListSettlementStatementsResponse, error) {
+	coalition, err := s.CoalitionRepository.FindOne(ctx, &domain.Coalition{ID: req.CoalitionId})
+	if err != nil {
+		return nil, err
+	}
+
+	if coalition == nil {
+		return nil, errutil.NotFound("coalition not found", nil)
+	}
+
+	statements, err := s.SettlementRepository.FindStatements(ctx, &domain.SettlementStatement{
+		CoalitionID: req.CoalitionId,
+	}, option.WithSortBy(option.QuerySortBy{
+		SortBy:  "period_start",
+		OrderBy: "desc",
+		Allow: map[string]bool{
+			"period_start": true,
+		},
+	}))
+	if err != nil {
+		zap.L().Error("failed to query settlement statements", zap.Error(err), zap.String("coalition_id", req.CoalitionId))
+		return nil, err
+	}
+
+	data := make([]*ledgerv1.SettlementStatement, 0, len(statements))
+	for _, st := range statements {
+		data = append(data, toSettlementStatementProto(coalition, st, req.OrgId))
+	}
+
+	return &ledgerv1.ListSettlementStatementsResponse{
+		Data: data,
+	}, nil
+}
+
+func toCoalitionProto(c *domain.Coalition) *ledgerv1.Coalition {
+	members := make([]*ledgerv1.CoalitionMember, 0, len(c.Members))
+	for _, m := range c.Members {
+		members = append(members, &ledgerv1.CoalitionMember{
+			OrgId:     m.OrgID,
+			CreatedAt: timestamppb.New(m.CreatedAt),
+		})
+	}
+
+	return &ledgerv1.Coalition{
+		Id:         c.ID,
+		Name:       c.Name,
+		Currency:   c.Currency,
+		PointValue: c.PointValue,
+		Members:    members,
+		CreatedAt:  timestamppb.New(c.CreatedAt),
+	}
+}
+
+func toSettlementStatementProto(c *domain.Coalition, st *domain.SettlementStatement, orgID string) *ledgerv1.SettlementStatement {
+	lines := make([]*ledgerv1.SettlementLine, 0, len(st.Lines))
+	for _, l := range st.Lines {
+		if orgID != "" && l.DebtorOrgID != orgID && l.CreditorOrgID != orgID {
+			continue
+		}
+
+		lines = append(lines, &ledgerv1.SettlementLine{
+			DebtorOrgId:   l.DebtorOrgID,
+			CreditorOrgId: l.CreditorOrgID,
+			Points:        l.Points,
+			Amount:        l.Amount,
+		})
+	}
+
+	return &ledgerv1.SettlementStatement{
+		Id:          st.ID,
+		CoalitionId: st.CoalitionID,
+		PeriodStart: timestamppb.New(st.PeriodStart),
+		PeriodEnd:   timestamppb.New(st.PeriodEnd),
+		Currency:    c.Currency,
+		Lines:       lines,
+		CreatedAt:   timestamppb.New(st.CreatedAt),
+	}
+}
@@ -0,0 +1,166 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -source=journal_usecase.go -destination=./../../usecase/mock_journal_usecase.go -package=usecase
+type JournalUsecase interface {
+	// Post writes the balanced journal for entry inside tx, so postings commit or roll back with the entry.
+	Post(ctx context.Context, tx *gorm.DB, entry *domain.LedgerEntry) (*domain.JournalEntry, error)
+	GetTrialBalance(ctx context.Context, req *ledgerv1.GetTrialBalanceRequest) (*ledgerv1.GetTrialBalanceResponse, error)
+}
+
+type journalUsecase struct {
+	fx.In
+	DB                *gorm.DB
+	AccountRepository domain.AccountRepository
+	JournalRepository domain.JournalRepository
+}
+
+func NewJournal(p journalUsecase) JournalUsecase {
+	return &p
+}
+
+func (s *journalUsecase) ensureAccounts(ctx context.Context, tx *gorm.DB, orgID string) error {
+	existing, err := s.AccountRepository.WithTrx(tx).Find(ctx, &domain.Account{OrgID: orgID, System: true})
+	if err != nil {
+		return err
+	}
+
+	if len(existing) == len(domain.SystemAccounts) {
+		return nil
+	}
+
+	codes := make(map[string]bool, len(existing))
+	for _, a := range existing {
+		codes[a.Code] = true
+	}
+
+	for _, tmpl := range domain.SystemAccounts {
+		if codes[tmpl.Code] {
+			continue
+		}
+
+		if err := s.AccountRepository.WithTrx(tx).Create(ctx, domain.NewSystemAccount(orgID, tmpl)); err != nil {
+			zap.L().Error("failed to create system account", zap.Error(err), zap.String("org_id", orgID), zap.String("code", tmpl.Code))
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *journalUsecase) Post(ctx context.Context, tx *gorm.DB, entry *domain.LedgerEntry) (*domain.JournalEntry, error) {
+	if err := s.ensureAccounts(ctx, tx, entry.OrgID); err != nil {
+		return nil, err
+	}
+
+	params := domain.JournalParams{
+		Kind:        domain.JournalKindFor(entry),
+		Entry:       entry,
+		Description: entry.Description,
+	}
+
+	if params.Kind == domain.JournalKindReverse {
+		originalID, _ := entry.MetadataMap()[domain.MetaReverts].(string)
+		// An entry only ever reverses one of its own organization's.
+		original, err := s.JournalRepository.WithTrx(tx).FindOne(ctx, &domain.JournalEntry{
+			OrgID:         entry.OrgID,
+			LedgerEntryID: originalID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if original == nil {
+			return nil, fmt.Errorf("journal for reverted entry %s not found", originalID)
+		}
+
+		params.Reverses = original.Postings
+	}
+
+	journal, err := domain.NewJournalEntry(params)
+	if err != nil {
+		zap.L().Error("failed to build journal", zap.Error(err), zap.String("ledger_entry_id", entry.ID))
+		return nil, err
+	}
+
+	if err := s.JournalRepository.WithTrx(tx).Create(ctx, journal); err != nil {
+		zap.L().Error("failed to create journal", zap.Error(err), zap.String("ledger_entry_id", entry.ID))
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+func (s *journalUsecase) GetTrialBalance(ctx context.Context, req *ledgerv1.GetTrialBalanceRequest) (*ledgerv1.GetTrialBalanceResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	opts := []zap.Field{
+		zap.String("trace_id", traceID),
+		zap.String("span_id", spanID),
+		zap.String("org_id", req.OrgId),
+	}
+
+	start := req.GetStartTime().AsTime()
+	end := req.GetEndTime().AsTime()
+	if req.GetEndTime() == nil {
+		end = time.Now()
+	}
+
+	if !end.After(start) {
+		return nil, errutil.BadRequest("end_time must be after start_time", nil)
+	}
+
+	accounts, err := s.AccountRepository.Find(ctx, &domain.Account{OrgID: req.OrgId})
+	if err != nil {
+		zap.L().With(opts...).Error("failed to query accounts", zap.Error(err))
+		return nil, err
+	}
+
+	totals, err := s.JournalRepository.SumByAccount(ctx, req.OrgId, start, end)
+	if err != nil {
+		zap.L().With(opts...).Error("failed to sum postings", zap.Error(err))
+		return nil, err
+	}
+
+	tb := domain.BuildTrialBalance(req.OrgId, start, end, accounts, totals)
+
+	lines := make([]*ledgerv1.TrialBalanceLine, 0, len(tb.Lines))
+	for _, l := range tb.Lines {
+		lines = append(lines, &ledgerv1.TrialBalanceLine{
+			AccountCode: l.AccountCode,
+			AccountName: l.AccountName,
+			AccountType: string(l.AccountType),
+			Debit:       l.Debit,
+			Credit:      l.Credit,
+			Balance:     l.Balance,
+		})
+	}
+
+	return &ledgerv1.GetTrialBalanceResponse{
+		OrgId:       tb.OrgID,
+		StartTime:   timestamppb.New(tb.Start),
+		EndTime:     timestamppb.New(tb.End),
+		Lines:       lines,
+		TotalDebit:  tb.TotalDebit,
+		TotalCredit: tb.TotalCredit,
+		Balanced:    tb.Balanced(),
+	}, nil
+}
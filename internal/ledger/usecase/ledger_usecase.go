@@ -3,12 +3,15 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
 	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	webhook "github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	webhook_usecase "github.com/smallbiznis/smallbiznis-apps/internal/webhook/usecase"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
 	"go.opentelemetry.io/otel/trace"
@@ -21,12 +24,17 @@ import (
 
 //go:generate mockgen -source=usecase.go -destination=./../../usecase/mock_ledger_usecase.go -package=usecase
 type LedgerUsecase interface {
+	// AddEntry writes the entry of req once per reference: repeating the request returns
+	// the entry already written, and reusing the reference for another entry is a Conflict.
 	AddEntry(ctx context.Context, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error)
 	ReverEntry(ctx context.Context, req *ledgerv1.RevertEntryRequest) (*ledgerv1.LedgerEntry, error)
 	ListEntries(ctx context.Context, req *ledgerv1.ListEntriesRequest) (*ledgerv1.ListEntriesResponse, error)
 	GetEntry(ctx context.Context, req *ledgerv1.GetEntryRequest) (*ledgerv1.LedgerEntry, error)
 	VerifyChain(ctx context.Context, req *ledgerv1.VerifyChainRequest) (*ledgerv1.VerifyChainResponse, error)
 	GetBalance(ctx context.Context, req *ledgerv1.GetBalanceRequest) (*ledgerv1.GetBalanceResponse, error)
+	// ExpirePoints expires what is left of every pool earned before before, with one
+	// EXPIRE entry per pool, and returns how many pools it expired.
+	ExpirePoints(ctx context.Context, before time.Time) (int, error)
 }
 
 type ledgerUsecase struct {
@@ -35,6 +43,10 @@ type ledgerUsecase struct {
 	LedgerRepository     domain.LedgerRepository
 	CreditPoolRepository domain.CreditPoolRepository
 	BalanceRepository    domain.BalanceRepository
+	Journal              JournalUsecase            `optional:"true"`
+	Report               ReportUsecase             `optional:"true"`
+	Coalition            CoalitionUsecase          `optional:"true"`
+	Webhook              webhook_usecase.Publisher `optional:"true"`
 }
 
 func NewLedger(p ledgerUsecase) LedgerUsecase {
@@ -53,21 +65,49 @@ func (s *ledgerUsecase) GetBalance(ctx context.Context, req *ledgerv1.GetBalance
 		zap.String("span_id", spanID),
 	}
 
-	lastEntry, err := s.BalanceRepository.FindOne(ctx, &domain.Balance{OrgID: req.OrgId, UserID: req.UserId}, option.WithSortBy(option.QuerySortBy{OrderBy: "DESC"}))
+	coalition, err := s.membership(ctx, s.DB, req.OrgId)
 	if err != nil {
-		zap.L().With(opts...).Error("failed to query FindOne entry", zap.Error(err))
+		zap.L().With(opts...).Error("failed to query coalition membership", zap.Error(err))
 		return nil, err
 	}
 
-	var lastBalance int64 = 0
-	if lastEntry != nil {
-		lastBalance = lastEntry.Balance
+	// A coalition shares one balance across its members.
+	query := &domain.Balance{OrgID: req.OrgId, UserID: req.UserId}
+	queryOpts := []option.QueryOption{}
+	if coalition != nil {
+		query.OrgID = ""
+		queryOpts = append(queryOpts, option.ApplyOperator(option.Condition{
+			Field:    "org_id",
+			Operator: option.IN,
+			Value:    coalition.OrgIDs(),
+		}))
 	}
 
-	return &ledgerv1.GetBalanceResponse{
-		Balance:       lastBalance,
-		LastUpdatedAt: timestamppb.New(lastEntry.CreatedAt),
-	}, nil
+	balances, err := s.BalanceRepository.Find(ctx, query, queryOpts...)
+	if err != nil {
+		zap.L().With(opts...).Error("failed to query balances", zap.Error(err))
+		return nil, err
+	}
+
+	var (
+		lastBalance   int64 = 0
+		lastUpdatedAt time.Time
+	)
+	for _, b := range balances {
+		lastBalance += b.Balance
+		if b.UpdatedAt.After(lastUpdatedAt) {
+			lastUpdatedAt = b.UpdatedAt
+		}
+	}
+
+	res := &ledgerv1.GetBalanceResponse{
+		Balance: lastBalance,
+	}
+	if !lastUpdatedAt.IsZero() {
+		res.LastUpdatedAt = timestamppb.New(lastUpdatedAt)
+	}
+
+	return res, nil
 }
 
 func (s *ledgerUsecase) AddEntry(ctx context.Context, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error) {
@@ -82,6 +122,10 @@ func (s *ledgerUsecase) AddEntry(ctx context.Context, req *ledgerv1.AddEntryRequ
 		zap.String("span_id", spanID),
 	}
 
+	if err := domain.ValidateMetadata(req.Metadata); err != nil {
+		return nil, errutil.BadRequest("invalid metadata", nil, errutil.WithErr(err))
+	}
+
 	exist, err := s.LedgerRepository.FindOne(ctx, &domain.LedgerEntry{
 		OrgID:       req.OrgId,
 		ReferenceID: req.ReferenceId,
@@ -91,23 +135,80 @@ func (s *ledgerUsecase) AddEntry(ctx context.Context, req *ledgerv1.AddEntryRequ
 		return nil, err
 	}
 
+	if exist == nil && s.Coalition != nil {
+		// A redemption drawn entirely from other members leaves no entry under req.OrgId.
+		exist, err = s.LedgerRepository.FindOne(ctx, &domain.LedgerEntry{
+			ReferenceID: domain.CoalitionReference(req.OrgId, req.ReferenceId),
+		})
+		if err != nil {
+			zap.L().With(opts...).Error("failed to query FindOne entry", zap.Error(err))
+			return nil, err
+		}
+	}
+
 	if exist != nil {
-		zap.L().With(opts...).Error("failed to create new entry", zap.Error(fmt.Errorf("reference_id %s already exists", req.ReferenceId)))
-		return nil, errutil.BadRequest("failed to create new entry; reference_id already exists", nil)
+		// A retry of the request gets the entry it already wrote. Reusing the reference
+		// for anything else is refused.
+		written, err := s.LedgerRepository.Find(ctx, &domain.LedgerEntry{
+			UserID:        exist.UserID,
+			TransactionID: exist.TransactionID,
+		})
+		if err != nil {
+			zap.L().With(opts...).Error("failed to query transaction entries", zap.Error(err))
+			return nil, err
+		}
+
+		kind := domain.JournalKindRedeem
+		if req.Type == ledgerv1.EntryType_CREDIT {
+			kind = domain.JournalKindEarn
+		}
+
+		if err := domain.MatchRequest(written, req.UserId, req.Type.String(), kind, req.Amount, req.Metadata); err != nil {
+			zap.L().With(opts...).Error("failed to create new entry", zap.Error(err), zap.String("reference_id", req.ReferenceId))
+			return nil, errutil.Conflict("reference_id already used by another entry", nil, errutil.WithErr(err))
+		}
+
+		return &ledgerv1.LedgerEntry{
+			Id:            exist.ID,
+			OrgId:         exist.OrgID,
+			UserId:        exist.UserID,
+			Type:          ledgerv1.EntryType(ledgerv1.EntryType_value[exist.Type]),
+			Amount:        exist.Amount,
+			TransactionId: exist.TransactionID,
+			ReferenceId:   exist.ReferenceID,
+			Description:   exist.Description,
+		}, nil
 	}
 
-	if err := s.processAddEntry(ctx, req); err != nil {
+	if err := s.processAddEntry(ctx, req, domain.JournalKindRedeem); err != nil {
 		zap.L().Error("failed process add entry", zap.Error(err))
 		return nil, err
 	}
 
 	entry, err := s.LedgerRepository.FindOne(ctx, &domain.LedgerEntry{
+		OrgID:       req.OrgId,
 		ReferenceID: req.ReferenceId,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	if entry == nil {
+		entry, err = s.LedgerRepository.FindOne(ctx, &domain.LedgerEntry{
+			ReferenceID: domain.CoalitionReference(req.OrgId, req.ReferenceId),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A coalition redemption writes one entry per issuing org under the same transaction.
+	entries, err := s.LedgerRepository.Find(ctx, &domain.LedgerEntry{TransactionID: entry.TransactionID})
+	if err != nil {
+		zap.L().With(opts...).Error("failed to query transaction entries", zap.Error(err))
+	}
+	s.publishEntries(ctx, entries...)
+
 	return &ledgerv1.LedgerEntry{
 		Id:            entry.ID,
 		OrgId:         entry.OrgID,
@@ -153,6 +254,17 @@ func (s *ledgerUsecase) ReverEntry(ctx context.Context, req *ledgerv1.RevertEntr
 		return nil, err
 	}
 
+	reversal, err := s.LedgerRepository.FindOne(ctx, &domain.LedgerEntry{
+		OrgID:       current.OrgID,
+		ReferenceID: current.TransactionID,
+	})
+	if err != nil {
+		zap.L().With(opts...).Error("failed to query reversal entry", zap.Error(err))
+	}
+	if reversal != nil {
+		s.publishEntries(ctx, reversal)
+	}
+
 	return &ledgerv1.LedgerEntry{
 		Id:            current.ID,
 		OrgId:         current.OrgID,
@@ -185,7 +297,9 @@ func (s *ledgerUsecase) getLastEntry(tx *gorm.DB, ctx context.Context, req *doma
 	return lastEntry, nil
 }
 
-func (s *ledgerUsecase) processAddEntry(ctx context.Context, req *ledgerv1.AddEntryRequest) error {
+// processAddEntry writes the entry of req. A DEBIT is journaled as debitKind, which
+// is the caller's to decide and never the request's.
+func (s *ledgerUsecase) processAddEntry(ctx context.Context, req *ledgerv1.AddEntryRequest, debitKind domain.JournalKind) error {
 	return s.DB.Transaction(func(tx *gorm.DB) error {
 
 		lastEntry, err := s.getLastEntry(tx, ctx, &domain.LedgerEntry{
@@ -198,7 +312,7 @@ func (s *ledgerUsecase) processAddEntry(ctx context.Context, req *ledgerv1.AddEn
 
 		// Handle DEBIT
 		if req.Type == ledgerv1.EntryType_DEBIT {
-			return s.processDebit(ctx, tx, lastEntry, req)
+			return s.processDebit(ctx, tx, lastEntry, req, debitKind)
 		}
 
 		// Handle CREDIT
@@ -206,12 +320,15 @@ func (s *ledgerUsecase) processAddEntry(ctx context.Context, req *ledgerv1.AddEn
 	})
 }
 
-func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry *domain.LedgerEntry, req *ledgerv1.AddEntryRequest) error {
-
-	entries, err := s.CreditPoolRepository.WithTrx(tx).Find(ctx, &domain.CreditPool{
+// debitPools returns the pools a redemption at req.OrgId may draw from, oldest first. For a
+// coalition member that is the user's pools at every member org.
+func (s *ledgerUsecase) debitPools(ctx context.Context, tx *gorm.DB, coalition *domain.Coalition, req *ledgerv1.AddEntryRequest) ([]*domain.CreditPool, error) {
+	query := &domain.CreditPool{
 		OrgID:  req.OrgId,
 		UserID: req.UserId,
-	},
+	}
+
+	opts := []option.QueryOption{
 		option.ApplyOperator(option.Condition{
 			Field:    "remaining",
 			Operator: option.GT,
@@ -227,33 +344,51 @@ func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry
 			},
 		),
 		option.WithLockingUpdate(),
-	)
-	if err != nil {
-		return err
 	}
 
-	if len(entries) == 0 {
-		return fmt.Errorf("insufficient points")
+	if coalition != nil {
+		query.OrgID = ""
+		opts = append(opts, option.ApplyOperator(option.Condition{
+			Field:    "org_id",
+			Operator: option.IN,
+			Value:    coalition.OrgIDs(),
+		}))
 	}
 
-	transactionID, err := domain.GenerateTransactionID()
+	return s.CreditPoolRepository.WithTrx(tx).Find(ctx, query, opts...)
+}
+
+func (s *ledgerUsecase) membership(ctx context.Context, tx *gorm.DB, orgID string) (*domain.Coalition, error) {
+	if s.Coalition == nil {
+		return nil, nil
+	}
+	return s.Coalition.Membership(ctx, tx, orgID)
+}
+
+// processDebit redeems req.Amount from the user's oldest pools. Inside a coalition the pools
+// may belong to other members: each issuing org gets its own DEBIT entry on its own chain
+// and an obligation towards the redeeming org, all under one transaction ID.
+func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry *domain.LedgerEntry, req *ledgerv1.AddEntryRequest, kind domain.JournalKind) error {
+
+	coalition, err := s.membership(ctx, tx, req.OrgId)
 	if err != nil {
-		zap.L().Error("failed to generate transactionId", zap.Error(err))
+		zap.L().Error("failed to query coalition membership", zap.Error(err))
 		return err
 	}
 
-	balance, err := s.BalanceRepository.FindOne(ctx, &domain.Balance{
-		OrgID:  req.OrgId,
-		UserID: req.UserId,
-	},
-		option.WithLockingUpdate(),
-	)
+	entries, err := s.debitPools(ctx, tx, coalition, req)
 	if err != nil {
 		return err
 	}
 
-	if balance == nil {
-		return fmt.Errorf("balance not found")
+	if len(entries) == 0 {
+		return fmt.Errorf("insufficient points")
+	}
+
+	transactionID, err := domain.GenerateTransactionID()
+	if err != nil {
+		zap.L().Error("failed to generate transactionId", zap.Error(err))
+		return err
 	}
 
 	var totalAvailable int64
@@ -274,6 +409,7 @@ func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry
 		allocatable := min(entry.Remaining, remaining)
 		allocations = append(allocations, domain.RedeemAllocation{
 			CreditPoolID:    entry.ID,
+			OrgID:           entry.OrgID,
 			SourceID:        entry.LedgerEntryID,
 			Amount:          allocatable,
 			RemainingAmount: entry.Remaining - allocatable,
@@ -285,31 +421,80 @@ func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry
 		return fmt.Errorf("insufficient points")
 	}
 
-	metadebit := make([]domain.MetaDebit, 0, len(allocations))
-	for _, a := range allocations {
+	for _, group := range domain.GroupAllocationsByOrg(allocations) {
+		if err := s.debitGroup(ctx, tx, lastEntry, coalition, transactionID, group, req, kind); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// debitGroup writes the DEBIT entry for the part of a redemption drawn from group.OrgID.
+func (s *ledgerUsecase) debitGroup(ctx context.Context, tx *gorm.DB, lastEntry *domain.LedgerEntry, coalition *domain.Coalition, transactionID string, group *domain.AllocationGroup, req *ledgerv1.AddEntryRequest, kind domain.JournalKind) error {
+	crossOrg := group.OrgID != req.OrgId
+	referenceID := req.ReferenceId
+
+	if crossOrg {
+		last, err := s.getLastEntry(tx, ctx, &domain.LedgerEntry{
+			OrgID:  group.OrgID,
+			UserID: req.UserId,
+		})
+		if err != nil {
+			return err
+		}
+		lastEntry = last
+		referenceID = domain.CoalitionReference(req.OrgId, req.ReferenceId)
+	}
+
+	if lastEntry == nil {
+		return fmt.Errorf("ledger chain not found for org %s", group.OrgID)
+	}
+
+	balance, err := s.BalanceRepository.WithTrx(tx).FindOne(ctx, &domain.Balance{
+		OrgID:  group.OrgID,
+		UserID: req.UserId,
+	},
+		option.WithLockingUpdate(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if balance == nil {
+		return fmt.Errorf("balance not found")
+	}
+
+	metadebit := make([]domain.MetaDebit, 0, len(group.Allocations))
+	for _, a := range group.Allocations {
 		metadebit = append(metadebit, domain.MetaDebit{
 			LedgerEntryID: a.SourceID,
 			Amount:        a.Amount,
 		})
 	}
 
-	meta := make(map[string]any, len(req.Metadata)+1)
+	meta := make(map[string]any, len(req.Metadata)+3)
 	for k, v := range req.Metadata {
 		meta[k] = v
 	}
-	meta["sources"] = metadebit
+	meta[domain.MetaSources] = metadebit
+	if crossOrg {
+		meta[domain.MetaRedeemedAt] = req.OrgId
+		meta[domain.MetaCoalitionID] = coalition.ID
+	}
 
 	b, _ := json.Marshal(meta)
 	entry := domain.NewLedgerEntry(domain.LedgerParams{
 		Type:          ledgerv1.EntryType_DEBIT.String(),
-		OrgID:         req.OrgId,
+		OrgID:         group.OrgID,
 		UserID:        req.UserId,
-		Amount:        req.Amount,
+		Amount:        group.Amount,
 		TransactionID: transactionID,
-		ReferenceID:   req.ReferenceId,
+		ReferenceID:   referenceID,
 		Description:   req.Description,
 		PreviousHash:  lastEntry.Hash,
 		Metadata:      datatypes.JSON(b),
+		Kind:          kind,
 	})
 	entry.Hash = entry.GenerateHash()
 
@@ -317,7 +502,24 @@ func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry
 		return err
 	}
 
-	for _, alloc := range allocations {
+	if err := s.recordEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+
+	if crossOrg {
+		if err := s.Coalition.RecordObligation(ctx, tx, domain.SettlementObligationParams{
+			CoalitionID:   coalition.ID,
+			DebtorOrgID:   group.OrgID,
+			CreditorOrgID: req.OrgId,
+			Entry:         entry,
+			Points:        group.Amount,
+		}); err != nil {
+			zap.L().Error("failed to record settlement obligation", zap.Error(err), zap.String("ledger_entry_id", entry.ID))
+			return err
+		}
+	}
+
+	for _, alloc := range group.Allocations {
 		updates := map[string]any{
 			"remaining":   gorm.Expr("remaining - ?", alloc.Amount),
 			"consumed_at": time.Now(),
@@ -329,19 +531,15 @@ func (s *ledgerUsecase) processDebit(ctx context.Context, tx *gorm.DB, lastEntry
 	}
 
 	updates := map[string]any{
-		"balance":    gorm.Expr("balance - ?", req.Amount),
+		"balance":    gorm.Expr("balance - ?", group.Amount),
 		"updated_at": time.Now(),
 	}
-	if err := s.BalanceRepository.WithTrx(tx).Update(ctx, balance.ID, &updates); err != nil {
-		return err
-	}
-
-	return nil
+	return s.BalanceRepository.WithTrx(tx).Update(ctx, balance.ID, &updates)
 }
 
 func (s *ledgerUsecase) processCredit(ctx context.Context, tx *gorm.DB, lastEntry *domain.LedgerEntry, req *ledgerv1.AddEntryRequest) error {
 	var (
-		previousHash    string = "GENESIS"
+		previousHash    string = domain.ChainGenesis
 		previousBalance int64  = 0
 	)
 
@@ -368,6 +566,7 @@ func (s *ledgerUsecase) processCredit(ctx context.Context, tx *gorm.DB, lastEntr
 		TransactionID: transactionID,
 		ReferenceID:   req.ReferenceId,
 		Description:   req.Description,
+		Kind:          domain.JournalKindEarn,
 	})
 
 	if lastEntry != nil {
@@ -383,6 +582,10 @@ func (s *ledgerUsecase) processCredit(ctx context.Context, tx *gorm.DB, lastEntr
 		return err
 	}
 
+	if err := s.recordEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+
 	if err := s.CreditPoolRepository.WithTrx(tx).Create(ctx, &domain.CreditPool{
 		ID:            uuid.NewString(),
 		OrgID:         req.OrgId,
@@ -442,6 +645,10 @@ func (s *ledgerUsecase) processRevertCredit(ctx context.Context, tx *gorm.DB, la
 		return err
 	}
 
+	meta, _ := json.Marshal(map[string]any{
+		domain.MetaReverts: lastEntry.ID,
+	})
+
 	entry := domain.NewLedgerEntry(domain.LedgerParams{
 		OrgID:         lastEntry.OrgID,
 		UserID:        lastEntry.UserID,
@@ -450,6 +657,8 @@ func (s *ledgerUsecase) processRevertCredit(ctx context.Context, tx *gorm.DB, la
 		TransactionID: transactionID,
 		ReferenceID:   lastEntry.TransactionID,
 		Description:   fmt.Sprintf("Revert of %s", lastEntry.ID),
+		Metadata:      datatypes.JSON(meta),
+		Kind:          domain.JournalKindReverse,
 	})
 
 	entry.PreviousHash = lastEntry.Hash
@@ -459,12 +668,205 @@ func (s *ledgerUsecase) processRevertCredit(ctx context.Context, tx *gorm.DB, la
 		return err
 	}
 
+	if err := s.recordEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+
 	return s.BalanceRepository.WithTrx(tx).Update(ctx, balance.ID, &domain.Balance{
 		Balance:   balance.Balance - lastEntry.Amount,
 		UpdatedAt: time.Now(),
 	})
 }
 
+func (s *ledgerUsecase) ExpirePoints(ctx context.Context, before time.Time) (int, error) {
+	pools, err := s.CreditPoolRepository.Find(ctx, &domain.CreditPool{},
+		option.ApplyOperator(option.Condition{
+			Field:    "remaining",
+			Operator: option.GT,
+			Value:    0,
+		}),
+		option.ApplyOperator(option.Condition{
+			Field:    "created_at",
+			Operator: option.LT,
+			Value:    before,
+		}),
+		option.WithSortBy(option.QuerySortBy{
+			SortBy:  "created_at",
+			OrderBy: "asc",
+			Allow: map[string]bool{
+				"created_at": true,
+			},
+		}),
+	)
+	if err != nil {
+		zap.L().Error("failed to query expiring credit pools", zap.Error(err))
+		return 0, err
+	}
+
+	// Pools expire oldest first, the order a replay allocates the expiries in. One pool
+	// failing doesn't hold back the others.
+	var (
+		expired int
+		errs    []error
+	)
+	for _, pool := range pools {
+		entry, err := s.expirePool(ctx, pool)
+		if err != nil {
+			zap.L().Error("failed to expire credit pool", zap.Error(err), zap.String("credit_pool_id", pool.ID))
+			errs = append(errs, fmt.Errorf("credit pool %s: %w", pool.ID, err))
+			continue
+		}
+
+		if entry != nil {
+			expired++
+			s.publishEntries(ctx, entry)
+		}
+	}
+
+	return expired, errors.Join(errs...)
+}
+
+// expirePool writes the EXPIRE entry for what is left of pool. It returns nil when the
+// pool was consumed in the meantime. Locks are taken in the order processDebit takes them.
+func (s *ledgerUsecase) expirePool(ctx context.Context, pool *domain.CreditPool) (*domain.LedgerEntry, error) {
+	var entry *domain.LedgerEntry
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		lastEntry, err := s.getLastEntry(tx, ctx, &domain.LedgerEntry{
+			OrgID:  pool.OrgID,
+			UserID: pool.UserID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if lastEntry == nil {
+			return fmt.Errorf("ledger chain not found for org %s", pool.OrgID)
+		}
+
+		current, err := s.CreditPoolRepository.WithTrx(tx).FindOne(ctx, &domain.CreditPool{ID: pool.ID}, option.WithLockingUpdate())
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.Remaining <= 0 {
+			return nil
+		}
+
+		balance, err := s.BalanceRepository.WithTrx(tx).FindOne(ctx, &domain.Balance{
+			OrgID:  current.OrgID,
+			UserID: current.UserID,
+		}, option.WithLockingUpdate())
+		if err != nil {
+			return err
+		}
+
+		if balance == nil {
+			return fmt.Errorf("balance not found")
+		}
+
+		transactionID, err := domain.GenerateTransactionID()
+		if err != nil {
+			zap.L().Error("failed to generate transactionId", zap.Error(err))
+			return err
+		}
+
+		expiry := domain.NewExpiryEntry(current, lastEntry, transactionID)
+		if err := s.LedgerRepository.WithTrx(tx).Create(ctx, expiry); err != nil {
+			return err
+		}
+
+		if err := s.recordEntry(ctx, tx, expiry); err != nil {
+			return err
+		}
+
+		pools := map[string]any{
+			"remaining":   0,
+			"consumed_at": time.Now(),
+		}
+		if err := s.CreditPoolRepository.WithTrx(tx).Update(ctx, current.ID, &pools); err != nil {
+			zap.L().Error("failed to update credit pools", zap.Error(err))
+			return err
+		}
+
+		updates := map[string]any{
+			"balance":    gorm.Expr("balance - ?", expiry.Amount),
+			"updated_at": time.Now(),
+		}
+		if err := s.BalanceRepository.WithTrx(tx).Update(ctx, balance.ID, &updates); err != nil {
+			return err
+		}
+
+		entry = expiry
+		return nil
+	})
+	return entry, err
+}
+
+// recordEntry keeps the state derived from entry (journal postings, report rollups) in step
+// with the ledger inside the same transaction. Each layer is skipped when it is not installed.
+func (s *ledgerUsecase) recordEntry(ctx context.Context, tx *gorm.DB, entry *domain.LedgerEntry) error {
+	if s.Journal != nil {
+		if _, err := s.Journal.Post(ctx, tx, entry); err != nil {
+			zap.L().Error("failed to post journal", zap.Error(err), zap.String("ledger_entry_id", entry.ID))
+			return err
+		}
+	}
+
+	if s.Report != nil {
+		if err := s.Report.Record(ctx, tx, entry); err != nil {
+			zap.L().Error("failed to record rollup", zap.Error(err), zap.String("ledger_entry_id", entry.ID))
+			return err
+		}
+	}
+
+	return nil
+}
+
+var entryTopics = map[domain.JournalKind]string{
+	domain.JournalKindEarn:    webhook.TopicPointsEarned,
+	domain.JournalKindRedeem:  webhook.TopicPointsRedeemed,
+	domain.JournalKindExpire:  webhook.TopicPointsExpired,
+	domain.JournalKindReverse: webhook.TopicPointsReversed,
+}
+
+type entryEvent struct {
+	ID            string         `json:"id"`
+	OrgID         string         `json:"org_id"`
+	UserID        string         `json:"user_id"`
+	Type          string         `json:"type"`
+	Amount        int64          `json:"amount"`
+	TransactionID string         `json:"transaction_id"`
+	ReferenceID   string         `json:"reference_id"`
+	Description   string         `json:"description"`
+	Metadata      datatypes.JSON `json:"metadata,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// publishEntries notifies the entries' organizations once they are committed. Publishing
+// is best effort: the entry stands even if the event cannot be queued.
+func (s *ledgerUsecase) publishEntries(ctx context.Context, entries ...*domain.LedgerEntry) {
+	if s.Webhook == nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if err := s.Webhook.Publish(ctx, entry.OrgID, entryTopics[domain.JournalKindFor(entry)], entryEvent{
+			ID:            entry.ID,
+			OrgID:         entry.OrgID,
+			UserID:        entry.UserID,
+			Type:          entry.Type,
+			Amount:        entry.Amount,
+			TransactionID: entry.TransactionID,
+			ReferenceID:   entry.ReferenceID,
+			Description:   entry.Description,
+			Metadata:      entry.Metadata,
+			CreatedAt:     entry.CreatedAt,
+		}); err != nil {
+			zap.L().Error("failed to publish ledger event", zap.Error(err), zap.String("ledger_entry_id", entry.ID))
+		}
+	}
+}
+
 func (s *ledgerUsecase) ListEntries(ctx context.Context, req *ledgerv1.ListEntriesRequest) (*ledgerv1.ListEntriesResponse, error) {
 	span := trace.SpanFromContext(ctx)
 	defer span.End()
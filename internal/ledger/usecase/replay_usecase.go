@@ -0,0 +1,358 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -source=replay_usecase.go -destination=./../../usecase/mock_replay_usecase.go -package=usecase
+type ReplayUsecase interface {
+	// Replay re-derives pools and balances of every chain in scope into the shadow tables.
+	Replay(ctx context.Context, scope domain.ReplayScope) (*domain.ReplayRun, []domain.ReplayIssue, error)
+	Diff(ctx context.Context, runID string) (*domain.ReplayRun, []*domain.ReplayDiff, error)
+	// Swap replaces live state with the run's shadow rows. It refuses when the ledger
+	// changed since the replay.
+	Swap(ctx context.Context, runID string) (*domain.ReplayRun, error)
+	Discard(ctx context.Context, runID string) (*domain.ReplayRun, error)
+
+	StartReplay(ctx context.Context, req *ledgerv1.StartReplayRequest) (*ledgerv1.ReplayRun, error)
+	GetReplay(ctx context.Context, req *ledgerv1.GetReplayRequest) (*ledgerv1.GetReplayResponse, error)
+	SwapReplay(ctx context.Context, req *ledgerv1.SwapReplayRequest) (*ledgerv1.ReplayRun, error)
+	DiscardReplay(ctx context.Context, req *ledgerv1.DiscardReplayRequest) (*ledgerv1.ReplayRun, error)
+}
+
+type replayUsecase struct {
+	fx.In
+	DB               *gorm.DB
+	LedgerRepository domain.LedgerRepository
+	ReplayRepository domain.ReplayRepository
+}
+
+func NewReplay(p replayUsecase) ReplayUsecase {
+	return &p
+}
+
+func (s *replayUsecase) Replay(ctx context.Context, scope domain.ReplayScope) (*domain.ReplayRun, []domain.ReplayIssue, error) {
+	if err := scope.Validate(); err != nil {
+		return nil, nil, errutil.BadRequest(err.Error(), nil)
+	}
+
+	run := domain.NewReplayRun(scope)
+
+	entries, watermark, err := s.ReplayRepository.Watermark(ctx, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	run.Entries, run.Watermark = entries, watermark
+
+	chains, err := s.ReplayRepository.Chains(ctx, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var issues []domain.ReplayIssue
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.ReplayRepository.WithTrx(tx)
+
+		for _, chain := range chains {
+			chainScope := domain.ReplayScope{OrgID: chain.OrgID, UserID: chain.UserID}
+
+			ledger, err := s.LedgerRepository.Find(ctx, &domain.LedgerEntry{
+				OrgID:  chain.OrgID,
+				UserID: chain.UserID,
+			}, option.WithSortBy(option.QuerySortBy{}))
+			if err != nil {
+				return err
+			}
+
+			livePools, err := repo.LivePools(ctx, chainScope)
+			if err != nil {
+				return err
+			}
+
+			liveBalances, err := repo.LiveBalances(ctx, chainScope)
+			if err != nil {
+				return err
+			}
+
+			var liveBalance *domain.Balance
+			if len(liveBalances) > 0 {
+				liveBalance = liveBalances[0]
+			}
+
+			result, err := domain.ReplayChain(ledger)
+			if err != nil {
+				return errutil.UnprocessableEntity(
+					fmt.Sprintf("ledger chain of user %s in org %s can't be replayed: %v", chain.UserID, chain.OrgID, err), nil,
+					errutil.WithErr(err),
+				)
+			}
+			result.AdoptIDs(livePools, liveBalance)
+
+			if err := repo.WriteShadow(ctx, run.ID, result.Pools, result.Balance); err != nil {
+				return err
+			}
+
+			issues = append(issues, result.Issues...)
+		}
+
+		run.Chains = int64(len(chains))
+		run.Issues = int64(len(issues))
+		run.Status = domain.ReplayStatusReplayed
+		return repo.CreateRun(ctx, run)
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	_, diffs, err := s.Diff(ctx, run.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, d := range diffs {
+		if d.Kind == "POOL" {
+			run.PoolDiffs++
+		} else {
+			run.BalanceDiffs++
+		}
+	}
+
+	if err := s.ReplayRepository.UpdateRun(ctx, run.ID, map[string]any{
+		"pool_diffs":    run.PoolDiffs,
+		"balance_diffs": run.BalanceDiffs,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	return run, issues, nil
+}
+
+func findRun(ctx context.Context, repo domain.ReplayRepository, runID string, opts ...option.QueryOption) (*domain.ReplayRun, error) {
+	run, err := repo.FindRun(ctx, runID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if run == nil {
+		return nil, errutil.NotFound("replay run not found", nil)
+	}
+
+	return run, nil
+}
+
+func (s *replayUsecase) Diff(ctx context.Context, runID string) (*domain.ReplayRun, []*domain.ReplayDiff, error) {
+	run, err := findRun(ctx, s.ReplayRepository, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	livePools, err := s.ReplayRepository.LivePools(ctx, run.Scope())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shadowPools, err := s.ReplayRepository.ShadowPools(ctx, run.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	liveBalances, err := s.ReplayRepository.LiveBalances(ctx, run.Scope())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shadowBalances, err := s.ReplayRepository.ShadowBalances(ctx, run.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diffs := append(domain.DiffPools(livePools, shadowPools), domain.DiffBalances(liveBalances, shadowBalances)...)
+	return run, diffs, nil
+}
+
+func (s *replayUsecase) Swap(ctx context.Context, runID string) (*domain.ReplayRun, error) {
+	var run *domain.ReplayRun
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.ReplayRepository.WithTrx(tx)
+
+		var err error
+		run, err = findRun(ctx, repo, runID, option.WithLockingUpdate())
+		if err != nil {
+			return err
+		}
+
+		if run.Status != domain.ReplayStatusReplayed {
+			return errutil.Conflict("replay run is already "+run.Status, nil)
+		}
+
+		// Writers lock the balance row before touching a chain, so holding these
+		// locks keeps the scope still while the watermark is compared and rows swapped.
+		if _, err := repo.LiveBalances(ctx, run.Scope(), option.WithLockingUpdate()); err != nil {
+			return err
+		}
+
+		entries, watermark, err := repo.Watermark(ctx, run.Scope())
+		if err != nil {
+			return err
+		}
+
+		if entries != run.Entries || !watermark.Equal(run.Watermark) {
+			return errutil.Conflict("ledger changed since the replay, start a new run", nil)
+		}
+
+		if err := repo.Swap(ctx, run); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		run.Status, run.SwappedAt = domain.ReplayStatusSwapped, &now
+		return repo.UpdateRun(ctx, run.ID, map[string]any{
+			"status":     run.Status,
+			"swapped_at": now,
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (s *replayUsecase) Discard(ctx context.Context, runID string) (*domain.ReplayRun, error) {
+	var run *domain.ReplayRun
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.ReplayRepository.WithTrx(tx)
+
+		var err error
+		run, err = findRun(ctx, repo, runID, option.WithLockingUpdate())
+		if err != nil {
+			return err
+		}
+
+		if run.Status != domain.ReplayStatusReplayed {
+			return errutil.Conflict("replay run is already "+run.Status, nil)
+		}
+
+		if err := repo.DeleteShadow(ctx, run.ID); err != nil {
+			return err
+		}
+
+		run.Status = domain.ReplayStatusDiscarded
+		return repo.UpdateRun(ctx, run.ID, map[string]any{"status": run.Status})
+	}); err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func toReplayRunPB(run *domain.ReplayRun, issues []domain.ReplayIssue) *ledgerv1.ReplayRun {
+	res := &ledgerv1.ReplayRun{
+		Id:           run.ID,
+		OrgId:        run.OrgID,
+		UserId:       run.UserID,
+		Status:       run.Status,
+		Chains:       run.Chains,
+		Entries:      run.Entries,
+		PoolDiffs:    run.PoolDiffs,
+		BalanceDiffs: run.BalanceDiffs,
+		IssueCount:   run.Issues,
+		CreatedAt:    timestamppb.New(run.CreatedAt),
+	}
+
+	if run.SwappedAt != nil {
+		res.SwappedAt = timestamppb.New(*run.SwappedAt)
+	}
+
+	for _, i := range issues {
+		res.Issues = append(res.Issues, &ledgerv1.ReplayIssue{
+			LedgerEntryId: i.LedgerEntryID,
+			Message:       i.Message,
+		})
+	}
+
+	return res
+}
+
+func (s *replayUsecase) StartReplay(ctx context.Context, req *ledgerv1.StartReplayRequest) (*ledgerv1.ReplayRun, error) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	opts := []zap.Field{
+		zap.String("trace_id", traceID),
+		zap.String("span_id", spanID),
+		zap.String("org_id", req.OrgId),
+		zap.String("user_id", req.UserId),
+	}
+
+	run, issues, err := s.Replay(ctx, domain.ReplayScope{OrgID: req.OrgId, UserID: req.UserId})
+	if err != nil {
+		zap.L().With(opts...).Error("failed to replay ledger", zap.Error(err))
+		return nil, err
+	}
+
+	zap.L().With(opts...).Info("ledger replayed",
+		zap.String("run_id", run.ID),
+		zap.Int64("chains", run.Chains),
+		zap.Int64("pool_diffs", run.PoolDiffs),
+		zap.Int64("balance_diffs", run.BalanceDiffs),
+		zap.Int64("issues", run.Issues),
+	)
+
+	return toReplayRunPB(run, issues), nil
+}
+
+func (s *replayUsecase) GetReplay(ctx context.Context, req *ledgerv1.GetReplayRequest) (*ledgerv1.GetReplayResponse, error) {
+	run, diffs, err := s.Diff(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ledgerv1.GetReplayResponse{Run: toReplayRunPB(run, nil)}
+	for _, d := range diffs {
+		res.Diffs = append(res.Diffs, &ledgerv1.ReplayDiff{
+			Kind:          d.Kind,
+			Change:        d.Change,
+			OrgId:         d.OrgID,
+			UserId:        d.UserID,
+			LedgerEntryId: d.Key,
+			Live:          d.Live,
+			Shadow:        d.Shadow,
+		})
+	}
+
+	return res, nil
+}
+
+func (s *replayUsecase) SwapReplay(ctx context.Context, req *ledgerv1.SwapReplayRequest) (*ledgerv1.ReplayRun, error) {
+	run, err := s.Swap(ctx, req.Id)
+	if err != nil {
+		zap.L().Error("failed to swap replay", zap.Error(err), zap.String("run_id", req.Id))
+		return nil, err
+	}
+
+	return toReplayRunPB(run, nil), nil
+}
+
+func (s *replayUsecase) DiscardReplay(ctx context.Context, req *ledgerv1.DiscardReplayRequest) (*ledgerv1.ReplayRun, error) {
+	run, err := s.Discard(ctx, req.Id)
+	if err != nil {
+		zap.L().Error("failed to discard replay", zap.Error(err), zap.String("run_id", req.Id))
+		return nil, err
+	}
+
+	return toReplayRunPB(run, nil), nil
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/ledger/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -source=report_usecase.go -destination=./../../usecase/mock_report_usecase.go -package=usecase
+type ReportUsecase interface {
+	// Record increments the daily rollup for entry inside tx.
+	Record(ctx context.Context, tx *gorm.DB, entry *domain.LedgerEntry) error
+	// Rebuild re-derives the org's rollups from its ledger entries, covering the entries
+	// written before rollups were recorded, and returns the number of days rebuilt.
+	Rebuild(ctx context.Context, orgID string) (int, error)
+	LiabilityReport(ctx context.Context, orgID string, start, end time.Time) ([]*domain.LiabilityReportRow, error)
+	GetLiabilityReport(ctx context.Context, req *ledgerv1.GetLiabilityReportRequest) (*ledgerv1.GetLiabilityReportResponse, error)
+}
+
+type reportUsecase struct {
+	fx.In
+	DB                   *gorm.DB
+	LedgerRepository     domain.LedgerRepository
+	RollupRepository     domain.RollupRepository
+	CreditPoolRepository domain.CreditPoolRepository
+}
+
+func NewReport(p reportUsecase) ReportUsecase {
+	return &p
+}
+
+func (s *reportUsecase) Record(ctx context.Context, tx *gorm.DB, entry *domain.LedgerEntry) error {
+	return s.RollupRepository.WithTrx(tx).Increment(ctx, domain.NewRollupDelta(entry))
+}
+
+func (s *reportUsecase) Rebuild(ctx context.Context, orgID string) (int, error) {
+	if orgID == "" {
+		return 0, errutil.BadRequest("organizationId is required", nil)
+	}
+
+	var days int
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		repo := s.RollupRepository.WithTrx(tx)
+
+		// Entries committed before the lock are read below; entries written after it
+		// increment the rebuilt rows once the transaction ends.
+		if err := repo.Lock(ctx); err != nil {
+			return err
+		}
+
+		entries, err := s.LedgerRepository.WithTrx(tx).Find(ctx, &domain.LedgerEntry{OrgID: orgID})
+		if err != nil {
+			return err
+		}
+
+		rollups := domain.BuildRollups(entries)
+		days = len(rollups)
+		return repo.Replace(ctx, orgID, rollups)
+	})
+	if err != nil {
+		zap.L().Error("failed to rebuild rollups", zap.Error(err), zap.String("org_id", orgID))
+		return 0, err
+	}
+
+	return days, nil
+}
+
+// monthRange widens [start, end) to whole UTC months.
+func monthRange(start, end time.Time) (time.Time, time.Time) {
+	start = start.UTC()
+	end = end.UTC()
+
+	from := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if to.Before(end) {
+		to = to.AddDate(0, 1, 0)
+	}
+
+	return from, to
+}
+
+func (s *reportUsecase) LiabilityReport(ctx context.Context, orgID string, start, end time.Time) ([]*domain.LiabilityReportRow, error) {
+	if !end.After(start) {
+		return nil, errutil.BadRequest("end_time must be after start_time", nil)
+	}
+
+	from, to := monthRange(start, end)
+
+	opening, err := s.RollupRepository.SumBefore(ctx, orgID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	rollups, err := s.RollupRepository.Find(ctx, orgID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.BuildLiabilityReport(*opening, rollups), nil
+}
+
+func (s *reportUsecase) GetLiabilityReport(ctx context.Context, req *ledgerv1.GetLiabilityReportRequest) (*ledgerv1.GetLiabilityReportResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	opts := []zap.Field{
+		zap.String("trace_id", traceID),
+		zap.String("span_id", spanID),
+		zap.String("org_id", req.OrgId),
+	}
+
+	end := time.Now()
+	if req.GetEndTime() != nil {
+		end = req.GetEndTime().AsTime()
+	}
+
+	rows, err := s.LiabilityReport(ctx, req.OrgId, req.GetStartTime().AsTime(), end)
+	if err != nil {
+		zap.L().With(opts...).Error("failed to build liability report", zap.Error(err))
+		return nil, err
+	}
+
+	outstanding, err := s.CreditPoolRepository.SumRemaining(ctx, req.OrgId)
+	if err != nil {
+		zap.L().With(opts...).Error("failed to sum credit pools", zap.Error(err))
+		return nil, err
+	}
+
+	data := make([]*ledgerv1.LiabilityReportRow, 0, len(rows))
+	for _, r := range rows {
+		data = append(data, &ledgerv1.LiabilityReportRow{
+			Month:             r.Month.Format("2006-01"),
+			Issued:            r.Issued,
+			Redeemed:          r.Redeemed,
+			Expired:           r.Expired,
+			Reversed:          r.Reversed,
+			Outstanding:       r.Outstanding,
+			BreakageRate:      r.BreakageRate,
+			EstimatedBreakage: r.EstimatedBreakage,
+		})
+	}
+
+	return &ledgerv1.GetLiabilityReportResponse{
+		OrgId:              req.OrgId,
+		Data:               data,
+		CurrentOutstanding: outstanding,
+	}, nil
+}
@@ -53,3 +53,13 @@ func (r *creditPoolRepository) Create(ctx context.Context, entry *domain.CreditP
 func (r *creditPoolRepository) Update(ctx context.Context, entryID string, entry any) error {
 	return r.repo.Update(ctx, entryID, entry)
 }
+
+func (r *creditPoolRepository) SumRemaining(ctx context.Context, orgID string) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).
+		Model(&domain.CreditPool{}).
+		Select("COALESCE(SUM(remaining), 0)").
+		Where("org_id = ?", orgID).
+		Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,316 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	EndpointStatusActive   = "ACTIVE"
+	EndpointStatusDisabled = "DISABLED"
+
+	DeliveryStatusPending   = "PENDING"
+	DeliveryStatusRetrying  = "RETRYING"
+	DeliveryStatusSucceeded = "SUCCEEDED"
+	DeliveryStatusFailed    = "FAILED"
+)
+
+const (
+	TopicPointsEarned   = "ledger.points.earned"
+	TopicPointsRedeemed = "ledger.points.redeemed"
+	TopicPointsExpired  = "ledger.points.expired"
+	TopicPointsReversed = "ledger.points.reversed"
+
+	TopicFlowCreated   = "workflow.flow.created"
+	TopicFlowUpdated   = "workflow.flow.updated"
+	TopicFlowPublished = "workflow.flow.published"
+	TopicFlowPaused    = "workflow.flow.paused"
+	TopicFlowResumed   = "workflow.flow.resumed"
+	TopicFlowArchived  = "workflow.flow.archived"
+	TopicFlowDeleted   = "workflow.flow.deleted"
+	// TopicFlowBudgetExhausted is sent when a flow spends its budget and is paused.
+	TopicFlowBudgetExhausted = "workflow.flow.budget_exhausted"
+)
+
+var Topics = []string{
+	TopicPointsEarned,
+	TopicPointsRedeemed,
+	TopicPointsExpired,
+	TopicPointsReversed,
+	TopicFlowCreated,
+	TopicFlowUpdated,
+	TopicFlowPublished,
+	TopicFlowPaused,
+	TopicFlowResumed,
+	TopicFlowArchived,
+	TopicFlowDeleted,
+	TopicFlowBudgetExhausted,
+}
+
+const (
+	// MaxAttempts bounds the automatic attempts of one delivery.
+	MaxAttempts = 8
+	// DisableAfterFailures is the number of consecutive failed attempts after which an
+	// endpoint is disabled until the merchant enables it again.
+	DisableAfterFailures = 20
+
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 6 * time.Hour
+)
+
+// ValidTopic accepts a known topic, a service wildcard such as "ledger.*", or "*".
+func ValidTopic(topic string) bool {
+	if topic == "*" {
+		return true
+	}
+
+	for _, t := range Topics {
+		if t == topic {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(topic, "*"); ok && prefix != "" && strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Endpoint struct {
+	ID             string         `gorm:"column:id"`
+	OrgID          string         `gorm:"column:org_id"`
+	URL            string         `gorm:"column:url"`
+	Description    string         `gorm:"column:description"`
+	Topics         datatypes.JSON `gorm:"column:topics"` // serialized []string
+	Secret         string         `gorm:"column:secret"` // AES-GCM encrypted signing secret
+	Status         string         `gorm:"column:status"`
+	FailureCount   int            `gorm:"column:failure_count"`
+	DisabledReason string         `gorm:"column:disabled_reason"`
+	DisabledAt     *time.Time     `gorm:"column:disabled_at"`
+	CreatedAt      time.Time      `gorm:"column:created_at"`
+	UpdatedAt      time.Time      `gorm:"column:updated_at"`
+}
+
+type EndpointParams struct {
+	OrgID       string
+	URL         string
+	Description string
+	Topics      []string
+	Secret      string
+}
+
+func NewEndpoint(p EndpointParams) *Endpoint {
+	e := &Endpoint{
+		ID:          uuid.NewString(),
+		OrgID:       p.OrgID,
+		URL:         p.URL,
+		Description: p.Description,
+		Secret:      p.Secret,
+		Status:      EndpointStatusActive,
+	}
+	e.SetTopics(p.Topics)
+	return e
+}
+
+func (m *Endpoint) SetTopics(topics []string) {
+	b, _ := json.Marshal(topics)
+	m.Topics = datatypes.JSON(b)
+}
+
+func (m *Endpoint) GetTopics() []string {
+	var topics []string
+	if len(m.Topics) == 0 {
+		return topics
+	}
+	_ = json.Unmarshal(m.Topics, &topics)
+	return topics
+}
+
+// Subscribes reports whether topic matches one of the endpoint's subscriptions.
+func (m *Endpoint) Subscribes(topic string) bool {
+	for _, t := range m.GetTopics() {
+		if t == "*" || t == topic {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Endpoint) Active() bool {
+	return m.Status == EndpointStatusActive
+}
+
+// RecordSuccess resets the consecutive failure count.
+func (m *Endpoint) RecordSuccess() {
+	m.FailureCount = 0
+}
+
+// RecordFailure counts a failed attempt and disables the endpoint once it has failed
+// DisableAfterFailures times in a row. It reports whether the endpoint was disabled.
+func (m *Endpoint) RecordFailure(now time.Time) bool {
+	m.FailureCount++
+	if m.FailureCount < DisableAfterFailures || !m.Active() {
+		return false
+	}
+
+	m.Status = EndpointStatusDisabled
+	m.DisabledReason = "too many consecutive failed deliveries"
+	m.DisabledAt = &now
+	return true
+}
+
+// Enable reactivates a disabled endpoint with a clean failure count.
+func (m *Endpoint) Enable() {
+	m.Status = EndpointStatusActive
+	m.FailureCount = 0
+	m.DisabledReason = ""
+	m.DisabledAt = nil
+}
+
+// Event is the envelope posted to endpoints. Data holds the topic specific payload.
+type Event struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	OrgID     string          `json:"org_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func NewEvent(orgID, topic string, data any) (*Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		ID:        uuid.NewString(),
+		Topic:     topic,
+		OrgID:     orgID,
+		CreatedAt: time.Now().UTC(),
+		Data:      b,
+	}, nil
+}
+
+// Delivery is one event sent to one endpoint. Rows form the delivery log; replaying a
+// delivery creates a new row pointing back at the original through ReplayOf.
+type Delivery struct {
+	ID             string         `gorm:"column:id"`
+	OrgID          string         `gorm:"column:org_id"`
+	EndpointID     string         `gorm:"column:endpoint_id"`
+	EventID        string         `gorm:"column:event_id"`
+	Topic          string         `gorm:"column:topic"`
+	Payload        datatypes.JSON `gorm:"column:payload"`
+	Status         string         `gorm:"column:status"`
+	Attempts       int            `gorm:"column:attempts"`
+	ResponseStatus int            `gorm:"column:response_status"`
+	LastError      string         `gorm:"column:last_error"`
+	ReplayOf       *string        `gorm:"column:replay_of"`
+	NextAttemptAt  *time.Time     `gorm:"column:next_attempt_at"`
+	DeliveredAt    *time.Time     `gorm:"column:delivered_at"`
+	CreatedAt      time.Time      `gorm:"column:created_at"`
+	UpdatedAt      time.Time      `gorm:"column:updated_at"`
+}
+
+func NewDelivery(endpoint *Endpoint, event *Event) (*Delivery, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{
+		ID:         uuid.NewString(),
+		OrgID:      endpoint.OrgID,
+		EndpointID: endpoint.ID,
+		EventID:    event.ID,
+		Topic:      event.Topic,
+		Payload:    datatypes.JSON(b),
+		Status:     DeliveryStatusPending,
+	}, nil
+}
+
+// Replay copies the delivery into a new pending one with the same payload.
+func (m *Delivery) Replay() *Delivery {
+	original := m.ID
+	return &Delivery{
+		ID:         uuid.NewString(),
+		OrgID:      m.OrgID,
+		EndpointID: m.EndpointID,
+		EventID:    m.EventID,
+		Topic:      m.Topic,
+		Payload:    m.Payload,
+		Status:     DeliveryStatusPending,
+		ReplayOf:   &original,
+	}
+}
+
+// RetryDelay is the wait before the attempt following attempt number n: it doubles from
+// 30 seconds and is capped at six hours.
+func RetryDelay(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+
+	delay := retryBaseDelay
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// AttemptResult is the outcome of one HTTP attempt.
+type AttemptResult struct {
+	StatusCode int
+	Err        error
+}
+
+func (r AttemptResult) Succeeded() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// RecordAttempt applies the outcome of an attempt and reports whether another attempt
+// should be scheduled.
+func (m *Delivery) RecordAttempt(r AttemptResult, now time.Time) bool {
+	m.Attempts++
+	m.ResponseStatus = r.StatusCode
+	m.NextAttemptAt = nil
+
+	if r.Succeeded() {
+		m.Status = DeliveryStatusSucceeded
+		m.LastError = ""
+		m.DeliveredAt = &now
+		return false
+	}
+
+	m.LastError = "unexpected response status"
+	if r.Err != nil {
+		m.LastError = r.Err.Error()
+	}
+
+	if m.Attempts >= MaxAttempts {
+		m.Status = DeliveryStatusFailed
+		return false
+	}
+
+	next := now.Add(RetryDelay(m.Attempts))
+	m.Status = DeliveryStatusRetrying
+	m.NextAttemptAt = &next
+	return true
+}
+
+// Abandon fails the delivery without another attempt, e.g. when its endpoint was disabled.
+func (m *Delivery) Abandon(reason string) {
+	m.Status = DeliveryStatusFailed
+	m.LastError = reason
+	m.NextAttemptAt = nil
+}
@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEndpointSubscribes(t *testing.T) {
+	cases := []struct {
+		topics []string
+		topic  string
+		want   bool
+	}{
+		{[]string{TopicPointsEarned}, TopicPointsEarned, true},
+		{[]string{TopicPointsEarned}, TopicPointsRedeemed, false},
+		{[]string{"ledger.*"}, TopicPointsRedeemed, true},
+		{[]string{"ledger.*"}, TopicFlowCreated, false},
+		{[]string{"*"}, TopicFlowUpdated, true},
+		{nil, TopicFlowUpdated, false},
+	}
+
+	for _, c := range cases {
+		e := NewEndpoint(EndpointParams{Topics: c.topics})
+		if got := e.Subscribes(c.topic); got != c.want {
+			t.Fatalf("topics %v subscribes %s: expected %v, got %v", c.topics, c.topic, c.want, got)
+		}
+	}
+}
+
+func TestValidTopic(t *testing.T) {
+	for _, topic := range []string{TopicPointsEarned, "ledger.*", "workflow.flow.*", "*"} {
+		if !ValidTopic(topic) {
+			t.Fatalf("expected %q to be valid", topic)
+		}
+	}
+
+	for _, topic := range []string{"", "ledger.points", "billing.*"} {
+		if ValidTopic(topic) {
+			t.Fatalf("expected %q to be invalid", topic)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, d := range want {
+		if got := RetryDelay(i + 1); got != d {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, d, got)
+		}
+	}
+
+	if got := RetryDelay(30); got != retryMaxDelay {
+		t.Fatalf("expected delay capped at %s, got %s", retryMaxDelay, got)
+	}
+}
+
+func TestDeliveryRecordAttempt(t *testing.T) {
+	now := time.Now()
+	d := &Delivery{Status: DeliveryStatusPending}
+
+	if !d.RecordAttempt(AttemptResult{StatusCode: 500}, now) {
+		t.Fatal("expected a retry after the first failure")
+	}
+
+	if d.Status != DeliveryStatusRetrying || d.NextAttemptAt == nil || !d.NextAttemptAt.Equal(now.Add(RetryDelay(1))) {
+		t.Fatalf("unexpected delivery after failure %+v", d)
+	}
+
+	if d.RecordAttempt(AttemptResult{StatusCode: 204}, now) {
+		t.Fatal("expected no retry after success")
+	}
+
+	if d.Status != DeliveryStatusSucceeded || d.DeliveredAt == nil || d.NextAttemptAt != nil || d.Attempts != 2 {
+		t.Fatalf("unexpected delivery after success %+v", d)
+	}
+
+	d = &Delivery{Attempts: MaxAttempts - 1}
+	if d.RecordAttempt(AttemptResult{Err: errors.New("connection refused")}, now) {
+		t.Fatal("expected no retry after the last attempt")
+	}
+
+	if d.Status != DeliveryStatusFailed || d.LastError != "connection refused" {
+		t.Fatalf("unexpected delivery after last attempt %+v", d)
+	}
+}
+
+func TestEndpointDisabledAfterRepeatedFailures(t *testing.T) {
+	e := NewEndpoint(EndpointParams{})
+
+	for i := 1; i < DisableAfterFailures; i++ {
+		if e.RecordFailure(time.Now()) {
+			t.Fatalf("endpoint disabled after %d failures", i)
+		}
+	}
+
+	if !e.RecordFailure(time.Now()) || e.Active() || e.DisabledAt == nil {
+		t.Fatalf("expected endpoint disabled after %d failures, got %+v", DisableAfterFailures, e)
+	}
+
+	e.Enable()
+	if !e.Active() || e.FailureCount != 0 || e.DisabledAt != nil {
+		t.Fatalf("expected endpoint re-enabled, got %+v", e)
+	}
+
+	e.RecordFailure(time.Now())
+	e.RecordSuccess()
+	if e.FailureCount != 0 {
+		t.Fatalf("expected success to reset failure count, got %d", e.FailureCount)
+	}
+}
+
+func TestReplayKeepsPayload(t *testing.T) {
+	event, err := NewEvent("org-id", TopicPointsEarned, map[string]any{"amount": 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	original, err := NewDelivery(NewEndpoint(EndpointParams{OrgID: "org-id"}), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	original.Status, original.Attempts = DeliveryStatusFailed, MaxAttempts
+
+	replay := original.Replay()
+	if replay.ID == original.ID || replay.ReplayOf == nil || *replay.ReplayOf != original.ID {
+		t.Fatalf("replay not linked to original: %+v", replay)
+	}
+
+	if replay.Status != DeliveryStatusPending || replay.Attempts != 0 || string(replay.Payload) != string(original.Payload) {
+		t.Fatalf("unexpected replay %+v", replay)
+	}
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -source=repository.go -destination=./../../repository/mock_webhook_repository.go -package=repository
+type EndpointRepository interface {
+	WithTrx(tx *gorm.DB) EndpointRepository
+	Find(ctx context.Context, query *Endpoint, opts ...option.QueryOption) ([]*Endpoint, error)
+	FindOne(ctx context.Context, query *Endpoint, opts ...option.QueryOption) (*Endpoint, error)
+	Create(ctx context.Context, resource *Endpoint) error
+	Update(ctx context.Context, resourceID string, resource any) error
+	Delete(ctx context.Context, resourceID string) error
+}
+
+type DeliveryRepository interface {
+	WithTrx(tx *gorm.DB) DeliveryRepository
+	Find(ctx context.Context, query *Delivery, opts ...option.QueryOption) ([]*Delivery, error)
+	FindOne(ctx context.Context, query *Delivery, opts ...option.QueryOption) (*Delivery, error)
+	Create(ctx context.Context, resource *Delivery) error
+	Update(ctx context.Context, resourceID string, resource any) error
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Smallbiznis-Signature"
+	HeaderEvent     = "X-Smallbiznis-Event"
+	HeaderDelivery  = "X-Smallbiznis-Delivery"
+
+	secretPrefix = "whsec_"
+)
+
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+func computeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the signature header value "t=<unix>,v1=<hex>", where v1 is the
+// HMAC-SHA256 of "<unix>.<body>" keyed by the endpoint secret. Binding the timestamp
+// lets receivers reject replays outside their tolerance.
+func Sign(secret string, at time.Time, body []byte) string {
+	ts := at.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", ts, computeSignature(secret, ts, body))
+}
+
+// VerifySignature checks header against body and rejects signatures older than tolerance.
+func VerifySignature(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var (
+		ts   int64
+		sigs []string
+	)
+
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+
+		switch k {
+		case "t":
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid signature timestamp")
+			}
+			ts = parsed
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+
+	if ts == 0 || len(sigs) == 0 {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	if tolerance > 0 && now.Sub(time.Unix(ts, 0)) > tolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	expected := computeSignature(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("signature mismatch")
+}
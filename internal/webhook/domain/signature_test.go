@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(secret, secretPrefix) {
+		t.Fatalf("expected secret prefix %q, got %q", secretPrefix, secret)
+	}
+
+	body := []byte(`{"id":"event-id"}`)
+	at := time.Unix(1735689600, 0)
+	header := Sign(secret, at, body)
+
+	if !strings.HasPrefix(header, "t=1735689600,v1=") {
+		t.Fatalf("unexpected header %q", header)
+	}
+
+	if err := VerifySignature(secret, header, body, at.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := VerifySignature(secret, header, []byte(`{"id":"other"}`), at, 5*time.Minute); err == nil {
+		t.Fatal("expected tampered body to fail verification")
+	}
+
+	if err := VerifySignature("whsec_other", header, body, at, 5*time.Minute); err == nil {
+		t.Fatal("expected wrong secret to fail verification")
+	}
+
+	if err := VerifySignature(secret, header, body, at.Add(time.Hour), 5*time.Minute); err == nil {
+		t.Fatal("expected stale signature to fail verification")
+	}
+
+	if err := VerifySignature(secret, "v1=abc", body, at, 0); err == nil {
+		t.Fatal("expected malformed header to fail verification")
+	}
+}
+
+func TestSignKnownVector(t *testing.T) {
+	// HMAC-SHA256("secret", "1700000000.{}")
+	got := Sign("secret", time.Unix(1700000000, 0), []byte("{}"))
+	want := "t=1700000000,v1=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
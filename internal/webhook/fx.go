@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	webhookv1 "github.com/smallbiznis/go-genproto/smallbiznis/webhook/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/infrastructure/persistence"
+	grpc_handler "github.com/smallbiznis/smallbiznis-apps/internal/webhook/interfaces/grpc"
+	task_handler "github.com/smallbiznis/smallbiznis-apps/internal/webhook/interfaces/task"
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/server"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func RegisterServiceServer(s *grpc.Server, srv *grpc_handler.Handler) {
+	webhookv1.RegisterWebhookServiceServer(s, srv)
+}
+
+func RegisterServiceHandlerFromEndpoint(lc fx.Lifecycle, mux *runtime.ServeMux, cfg *config.Config) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+
+			opts := []grpc.DialOption{
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			}
+
+			if err := webhookv1.RegisterWebhookServiceHandlerFromEndpoint(ctx, mux, fmt.Sprintf(":%s", cfg.Grpc.Addr), opts); err != nil {
+				zap.L().Error("failed to RegisterWebhookServiceHandlerFromEndpoint", zap.Error(err))
+			}
+
+			return nil
+		},
+	})
+}
+
+// Module provides the webhook Publisher to services that emit events and processes
+// deliveries when an asynq server is installed. It requires the asynq client.
+var Module = fx.Module("webhook",
+	fx.Provide(
+		persistence.NewEndpointRepository,
+		persistence.NewDeliveryRepository,
+		usecase.NewDeliveryClient,
+		usecase.NewWebhook,
+		usecase.NewPublisher,
+	),
+	fx.Invoke(
+		task_handler.RegisterDeliveryTask,
+	),
+)
+
+// Server serves endpoint registration and the delivery log. Install it with Module.
+var Server = fx.Module("webhook.service.server",
+	fx.Provide(
+		server.NewListener,
+		server.WithOption,
+		server.NewGRPCServer,
+		server.NewServeMux,
+	),
+	fx.Provide(
+		grpc_handler.NewHandler,
+	),
+	fx.Invoke(
+		RegisterServiceServer,
+		RegisterServiceHandlerFromEndpoint,
+		server.StartGRPCServer,
+	),
+	server.NewServer,
+)
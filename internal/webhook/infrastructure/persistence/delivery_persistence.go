@@ -0,0 +1,51 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type DeliveryParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type deliveryRepository struct {
+	db   *gorm.DB
+	repo repository.Repository[domain.Delivery]
+}
+
+func NewDeliveryRepository(p DeliveryParams) domain.DeliveryRepository {
+	return &deliveryRepository{
+		db:   p.DB,
+		repo: repository.ProvideStore[domain.Delivery](p.DB),
+	}
+}
+
+func (r *deliveryRepository) WithTrx(tx *gorm.DB) domain.DeliveryRepository {
+	return &deliveryRepository{
+		db:   tx,
+		repo: repository.ProvideStore[domain.Delivery](tx),
+	}
+}
+
+func (r *deliveryRepository) Find(ctx context.Context, f *domain.Delivery, opts ...option.QueryOption) ([]*domain.Delivery, error) {
+	return r.repo.Find(ctx, f, opts...)
+}
+
+func (r *deliveryRepository) FindOne(ctx context.Context, f *domain.Delivery, opts ...option.QueryOption) (*domain.Delivery, error) {
+	return r.repo.FindOne(ctx, f, opts...)
+}
+
+func (r *deliveryRepository) Create(ctx context.Context, delivery *domain.Delivery) error {
+	return r.repo.Create(ctx, delivery)
+}
+
+func (r *deliveryRepository) Update(ctx context.Context, deliveryID string, delivery any) error {
+	return r.repo.Update(ctx, deliveryID, delivery)
+}
@@ -0,0 +1,55 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type EndpointParams struct {
+	fx.In
+	DB *gorm.DB
+}
+
+type endpointRepository struct {
+	db   *gorm.DB
+	repo repository.Repository[domain.Endpoint]
+}
+
+func NewEndpointRepository(p EndpointParams) domain.EndpointRepository {
+	return &endpointRepository{
+		db:   p.DB,
+		repo: repository.ProvideStore[domain.Endpoint](p.DB),
+	}
+}
+
+func (r *endpointRepository) WithTrx(tx *gorm.DB) domain.EndpointRepository {
+	return &endpointRepository{
+		db:   tx,
+		repo: repository.ProvideStore[domain.Endpoint](tx),
+	}
+}
+
+func (r *endpointRepository) Find(ctx context.Context, f *domain.Endpoint, opts ...option.QueryOption) ([]*domain.Endpoint, error) {
+	return r.repo.Find(ctx, f, opts...)
+}
+
+func (r *endpointRepository) FindOne(ctx context.Context, f *domain.Endpoint, opts ...option.QueryOption) (*domain.Endpoint, error) {
+	return r.repo.FindOne(ctx, f, opts...)
+}
+
+func (r *endpointRepository) Create(ctx context.Context, endpoint *domain.Endpoint) error {
+	return r.repo.Create(ctx, endpoint)
+}
+
+func (r *endpointRepository) Update(ctx context.Context, endpointID string, endpoint any) error {
+	return r.repo.Update(ctx, endpointID, endpoint)
+}
+
+func (r *endpointRepository) Delete(ctx context.Context, endpointID string) error {
+	return r.db.WithContext(ctx).Where("id = ?", endpointID).Delete(&domain.Endpoint{}).Error
+}
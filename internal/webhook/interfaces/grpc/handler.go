@@ -0,0 +1,144 @@
+package grpc_handler
+
+import (
+	"context"
+
+	webhookv1 "github.com/smallbiznis/go-genproto/smallbiznis/webhook/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/fx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Handler struct {
+	webhookv1.UnimplementedWebhookServiceServer
+	webhookUsecase usecase.WebhookUsecase
+}
+
+type Params struct {
+	fx.In
+	WebhookUsecase usecase.WebhookUsecase
+}
+
+func NewHandler(p Params) *Handler {
+	return &Handler{
+		webhookUsecase: p.WebhookUsecase,
+	}
+}
+
+func (h *Handler) CreateEndpoint(ctx context.Context, req *webhookv1.CreateEndpointRequest) (*webhookv1.CreateEndpointResponse, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.Url == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is required")
+	}
+
+	res, err := h.webhookUsecase.CreateEndpoint(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) GetEndpoint(ctx context.Context, req *webhookv1.GetEndpointRequest) (*webhookv1.Endpoint, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.webhookUsecase.GetEndpoint(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) ListEndpoints(ctx context.Context, req *webhookv1.ListEndpointsRequest) (*webhookv1.ListEndpointsResponse, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.webhookUsecase.ListEndpoints(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) UpdateEndpoint(ctx context.Context, req *webhookv1.UpdateEndpointRequest) (*webhookv1.Endpoint, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := h.webhookUsecase.UpdateEndpoint(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) DeleteEndpoint(ctx context.Context, req *webhookv1.DeleteEndpointRequest) (*webhookv1.DeleteEndpointResponse, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.webhookUsecase.DeleteEndpoint(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) RotateEndpointSecret(ctx context.Context, req *webhookv1.RotateEndpointSecretRequest) (*webhookv1.CreateEndpointResponse, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.webhookUsecase.RotateEndpointSecret(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) ListDeliveries(ctx context.Context, req *webhookv1.ListDeliveriesRequest) (*webhookv1.ListDeliveriesResponse, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.webhookUsecase.ListDeliveries(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) ReplayDelivery(ctx context.Context, req *webhookv1.ReplayDeliveryRequest) (*webhookv1.Delivery, error) {
+	if req.OrgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := h.webhookUsecase.ReplayDelivery(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
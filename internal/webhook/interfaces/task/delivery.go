@@ -0,0 +1,34 @@
+package task_handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/usecase"
+	asynqx "github.com/smallbiznis/smallbiznis-apps/pkg/asynq"
+	"go.uber.org/fx"
+)
+
+type DeliveryParams struct {
+	fx.In
+	Mux     *asynq.ServeMux `optional:"true"`
+	Webhook usecase.WebhookUsecase
+}
+
+// RegisterDeliveryTask processes webhook deliveries when an asynq server is installed.
+func RegisterDeliveryTask(p DeliveryParams) {
+	if p.Mux == nil {
+		return
+	}
+
+	p.Mux.HandleFunc(asynqx.WebhookDeliveryTask, func(ctx context.Context, t *asynq.Task) error {
+		var payload asynqx.WebhookDeliveryPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+		}
+
+		return p.Webhook.Deliver(ctx, payload.DeliveryID)
+	})
+}
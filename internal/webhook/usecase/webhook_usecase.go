@@ -0,0 +1,636 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hibiken/asynq"
+	webhookv1 "github.com/smallbiznis/go-genproto/smallbiznis/webhook/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	asynqx "github.com/smallbiznis/smallbiznis-apps/pkg/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/pagination"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/security"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+const (
+	deliveryTimeout     = 10 * time.Second
+	defaultDeliveryPage = 50
+	maxDeliveryPage     = 250
+)
+
+// Publisher is what other services depend on to notify merchants of their events.
+type Publisher interface {
+	// Publish fans the event out to every active endpoint of orgID subscribed to topic.
+	// data is serialized as the "data" field of the envelope.
+	Publish(ctx context.Context, orgID, topic string, data any) error
+}
+
+//go:generate mockgen -source=webhook_usecase.go -destination=./../../usecase/mock_webhook_usecase.go -package=usecase
+type WebhookUsecase interface {
+	Publisher
+	// Deliver makes one attempt of the delivery and schedules the next one on failure.
+	Deliver(ctx context.Context, deliveryID string) error
+
+	CreateEndpoint(ctx context.Context, req *webhookv1.CreateEndpointRequest) (*webhookv1.CreateEndpointResponse, error)
+	GetEndpoint(ctx context.Context, req *webhookv1.GetEndpointRequest) (*webhookv1.Endpoint, error)
+	ListEndpoints(ctx context.Context, req *webhookv1.ListEndpointsRequest) (*webhookv1.ListEndpointsResponse, error)
+	UpdateEndpoint(ctx context.Context, req *webhookv1.UpdateEndpointRequest) (*webhookv1.Endpoint, error)
+	DeleteEndpoint(ctx context.Context, req *webhookv1.DeleteEndpointRequest) (*webhookv1.DeleteEndpointResponse, error)
+	RotateEndpointSecret(ctx context.Context, req *webhookv1.RotateEndpointSecretRequest) (*webhookv1.CreateEndpointResponse, error)
+	ListDeliveries(ctx context.Context, req *webhookv1.ListDeliveriesRequest) (*webhookv1.ListDeliveriesResponse, error)
+	ReplayDelivery(ctx context.Context, req *webhookv1.ReplayDeliveryRequest) (*webhookv1.Delivery, error)
+}
+
+// DeliveryClient is the HTTP client deliveries are posted with. Endpoint URLs come
+// from merchants, so it only dials public addresses, doesn't follow redirects and
+// gives up after deliveryTimeout.
+type DeliveryClient struct {
+	*http.Client
+}
+
+func NewDeliveryClient() *DeliveryClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = security.PublicDialer(deliveryTimeout).DialContext
+
+	return &DeliveryClient{Client: &http.Client{
+		Transport: transport,
+		Timeout:   deliveryTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+type webhookUsecase struct {
+	fx.In
+	DB                 *gorm.DB
+	Config             *config.Config
+	Client             *asynq.Client
+	HTTP               *DeliveryClient
+	EndpointRepository domain.EndpointRepository
+	DeliveryRepository domain.DeliveryRepository
+}
+
+func NewWebhook(p webhookUsecase) WebhookUsecase {
+	return &p
+}
+
+// NewPublisher exposes the usecase to services that only publish events.
+func NewPublisher(u WebhookUsecase) Publisher {
+	return u
+}
+
+func (s *webhookUsecase) secretKey() ([]byte, error) {
+	key, err := security.ValidateBase64Secret(s.Config.SecretAES)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		return nil, fmt.Errorf("SECRET_AES is not a valid AES key")
+	}
+
+	return key, nil
+}
+
+func (s *webhookUsecase) encryptSecret(secret string) (string, error) {
+	key, err := s.secretKey()
+	if err != nil {
+		return "", err
+	}
+	return security.Encrypt(secret, key)
+}
+
+func (s *webhookUsecase) decryptSecret(encrypted string) (string, error) {
+	key, err := s.secretKey()
+	if err != nil {
+		return "", err
+	}
+	return security.Decrypt(encrypted, key)
+}
+
+func (s *webhookUsecase) enqueue(ctx context.Context, delivery *domain.Delivery, delay time.Duration) error {
+	payload, err := json.Marshal(asynqx.WebhookDeliveryPayload{DeliveryID: delivery.ID})
+	if err != nil {
+		return err
+	}
+
+	// Attempts are rescheduled by Deliver itself; asynq only retries infrastructure errors.
+	_, err = s.Client.EnqueueContext(ctx, asynq.NewTask(asynqx.WebhookDeliveryTask, payload),
+		asynq.TaskID(fmt.Sprintf("%s:%d", delivery.ID, delivery.Attempts)),
+		asynq.ProcessIn(delay),
+		asynq.MaxRetry(3),
+	)
+	return err
+}
+
+func (s *webhookUsecase) Publish(ctx context.Context, orgID, topic string, data any) error {
+	endpoints, err := s.EndpointRepository.Find(ctx, &domain.Endpoint{
+		OrgID:  orgID,
+		Status: domain.EndpointStatusActive,
+	})
+	if err != nil {
+		return err
+	}
+
+	var event *domain.Event
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(topic) {
+			continue
+		}
+
+		if event == nil {
+			if event, err = domain.NewEvent(orgID, topic, data); err != nil {
+				return err
+			}
+		}
+
+		delivery, err := domain.NewDelivery(endpoint, event)
+		if err != nil {
+			return err
+		}
+
+		if err := s.DeliveryRepository.Create(ctx, delivery); err != nil {
+			zap.L().Error("failed to create webhook delivery", zap.Error(err), zap.String("endpoint_id", endpoint.ID))
+			return err
+		}
+
+		// The delivery stays PENDING in the log and can be replayed if enqueueing fails.
+		if err := s.enqueue(ctx, delivery, 0); err != nil {
+			zap.L().Error("failed to enqueue webhook delivery", zap.Error(err), zap.String("delivery_id", delivery.ID))
+		}
+	}
+
+	return nil
+}
+
+func (s *webhookUsecase) post(ctx context.Context, endpoint *domain.Endpoint, delivery *domain.Delivery) domain.AttemptResult {
+	secret, err := s.decryptSecret(endpoint.Secret)
+	if err != nil {
+		return domain.AttemptResult{Err: fmt.Errorf("failed to decrypt endpoint secret: %w", err)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return domain.AttemptResult{Err: err}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(domain.HeaderEvent, delivery.Topic)
+	req.Header.Set(domain.HeaderDelivery, delivery.ID)
+	req.Header.Set(domain.HeaderSignature, domain.Sign(secret, time.Now(), body))
+
+	res, err := s.HTTP.Do(req)
+	if err != nil {
+		return domain.AttemptResult{Err: err}
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	result := domain.AttemptResult{StatusCode: res.StatusCode}
+	if !result.Succeeded() {
+		result.Err = fmt.Errorf("endpoint responded with status %d", res.StatusCode)
+	}
+
+	return result
+}
+
+func deliveryUpdates(d *domain.Delivery) map[string]any {
+	return map[string]any{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"response_status": d.ResponseStatus,
+		"last_error":      d.LastError,
+		"next_attempt_at": d.NextAttemptAt,
+		"delivered_at":    d.DeliveredAt,
+		"updated_at":      time.Now(),
+	}
+}
+
+func endpointUpdates(e *domain.Endpoint) map[string]any {
+	return map[string]any{
+		"url":             e.URL,
+		"description":     e.Description,
+		"topics":          e.Topics,
+		"secret":          e.Secret,
+		"status":          e.Status,
+		"failure_count":   e.FailureCount,
+		"disabled_reason": e.DisabledReason,
+		"disabled_at":     e.DisabledAt,
+		"updated_at":      time.Now(),
+	}
+}
+
+func (s *webhookUsecase) Deliver(ctx context.Context, deliveryID string) error {
+	delivery, err := s.DeliveryRepository.FindOne(ctx, &domain.Delivery{ID: deliveryID})
+	if err != nil {
+		return err
+	}
+
+	if delivery == nil {
+		zap.L().Warn("webhook delivery not found", zap.String("delivery_id", deliveryID))
+		return nil
+	}
+
+	if delivery.Status == domain.DeliveryStatusSucceeded || delivery.Status == domain.DeliveryStatusFailed {
+		return nil
+	}
+
+	endpoint, err := s.EndpointRepository.FindOne(ctx, &domain.Endpoint{ID: delivery.EndpointID})
+	if err != nil {
+		return err
+	}
+
+	if endpoint == nil || !endpoint.Active() {
+		delivery.Abandon("endpoint is disabled or deleted")
+		return s.DeliveryRepository.Update(ctx, delivery.ID, deliveryUpdates(delivery))
+	}
+
+	result := s.post(ctx, endpoint, delivery)
+
+	var retry bool
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// Reload under lock: concurrent deliveries share the endpoint's failure count.
+		endpoint, err := s.EndpointRepository.WithTrx(tx).FindOne(ctx, &domain.Endpoint{ID: delivery.EndpointID}, option.WithLockingUpdate())
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		retry = delivery.RecordAttempt(result, now)
+
+		if endpoint != nil {
+			if result.Succeeded() {
+				endpoint.RecordSuccess()
+			} else if endpoint.RecordFailure(now) {
+				zap.L().Warn("webhook endpoint disabled after repeated failures",
+					zap.String("endpoint_id", endpoint.ID),
+					zap.String("org_id", endpoint.OrgID),
+					zap.Int("failure_count", endpoint.FailureCount),
+				)
+			}
+
+			if err := s.EndpointRepository.WithTrx(tx).Update(ctx, endpoint.ID, endpointUpdates(endpoint)); err != nil {
+				return err
+			}
+		}
+
+		if retry && (endpoint == nil || !endpoint.Active()) {
+			delivery.Abandon("endpoint is disabled or deleted")
+			retry = false
+		}
+
+		return s.DeliveryRepository.WithTrx(tx).Update(ctx, delivery.ID, deliveryUpdates(delivery))
+	}); err != nil {
+		zap.L().Error("failed to record webhook attempt", zap.Error(err), zap.String("delivery_id", delivery.ID))
+		return err
+	}
+
+	if retry {
+		return s.enqueue(ctx, delivery, domain.RetryDelay(delivery.Attempts))
+	}
+
+	return nil
+}
+
+func validateEndpoint(rawURL string, topics []string) error {
+	var details []errutil.Detail
+
+	u, err := url.Parse(rawURL)
+	switch {
+	case err != nil || u.Host == "":
+		details = append(details, errutil.Detail{Field: "url", Message: "must be an absolute URL"})
+	case u.Scheme != "https":
+		details = append(details, errutil.Detail{Field: "url", Message: "must use https"})
+	}
+
+	if len(topics) == 0 {
+		details = append(details, errutil.Detail{Field: "topics", Message: "at least one topic is required"})
+	}
+
+	for _, t := range topics {
+		if !domain.ValidTopic(t) {
+			details = append(details, errutil.Detail{Field: "topics", Message: fmt.Sprintf("unknown topic %q", t)})
+		}
+	}
+
+	if len(details) > 0 {
+		return errutil.BadRequest("invalid webhook endpoint", nil, errutil.WithDetails(details...))
+	}
+
+	return nil
+}
+
+func (s *webhookUsecase) CreateEndpoint(ctx context.Context, req *webhookv1.CreateEndpointRequest) (*webhookv1.CreateEndpointResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	opts := []zap.Field{
+		zap.String("trace_id", traceID),
+		zap.String("span_id", spanID),
+		zap.String("org_id", req.OrgId),
+	}
+
+	if err := validateEndpoint(req.Url, req.Topics); err != nil {
+		return nil, err
+	}
+
+	secret, err := domain.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.encryptSecret(secret)
+	if err != nil {
+		zap.L().With(opts...).Error("failed to encrypt endpoint secret", zap.Error(err))
+		return nil, err
+	}
+
+	endpoint := domain.NewEndpoint(domain.EndpointParams{
+		OrgID:       req.OrgId,
+		URL:         req.Url,
+		Description: req.Description,
+		Topics:      req.Topics,
+		Secret:      encrypted,
+	})
+
+	if err := s.EndpointRepository.Create(ctx, endpoint); err != nil {
+		zap.L().With(opts...).Error("failed to create endpoint", zap.Error(err))
+		return nil, err
+	}
+
+	// The plain secret is only ever returned here and on rotation.
+	return &webhookv1.CreateEndpointResponse{
+		Endpoint: toEndpointProto(endpoint),
+		Secret:   secret,
+	}, nil
+}
+
+func (s *webhookUsecase) findEndpoint(ctx context.Context, id, orgID string) (*domain.Endpoint, error) {
+	endpoint, err := s.EndpointRepository.FindOne(ctx, &domain.Endpoint{ID: id, OrgID: orgID})
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint == nil {
+		return nil, errutil.NotFound("webhook endpoint not found", nil)
+	}
+
+	return endpoint, nil
+}
+
+func (s *webhookUsecase) GetEndpoint(ctx context.Context, req *webhookv1.GetEndpointRequest) (*webhookv1.Endpoint, error) {
+	endpoint, err := s.findEndpoint(ctx, req.Id, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	return toEndpointProto(endpoint), nil
+}
+
+func (s *webhookUsecase) ListEndpoints(ctx context.Context, req *webhookv1.ListEndpointsRequest) (*webhookv1.ListEndpointsResponse, error) {
+	endpoints, err := s.EndpointRepository.Find(ctx, &domain.Endpoint{OrgID: req.OrgId})
+	if err != nil {
+		zap.L().Error("failed to query endpoints", zap.Error(err), zap.String("org_id", req.OrgId))
+		return nil, err
+	}
+
+	data := make([]*webhookv1.Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		data = append(data, toEndpointProto(e))
+	}
+
+	return &webhookv1.ListEndpointsResponse{
+		Data: data,
+	}, nil
+}
+
+// UpdateEndpoint changes the fields that are set. Setting the status to ACTIVE re-enables
+// an endpoint that was disabled after repeated failures.
+func (s *webhookUsecase) UpdateEndpoint(ctx context.Context, req *webhookv1.UpdateEndpointRequest) (*webhookv1.Endpoint, error) {
+	endpoint, err := s.findEndpoint(ctx, req.Id, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Url != "" {
+		endpoint.URL = req.Url
+	}
+
+	if req.Description != "" {
+		endpoint.Description = req.Description
+	}
+
+	if len(req.Topics) > 0 {
+		endpoint.SetTopics(req.Topics)
+	}
+
+	if err := validateEndpoint(endpoint.URL, endpoint.GetTopics()); err != nil {
+		return nil, err
+	}
+
+	switch req.Status {
+	case webhookv1.EndpointStatus_ACTIVE:
+		endpoint.Enable()
+	case webhookv1.EndpointStatus_DISABLED:
+		if endpoint.Active() {
+			now := time.Now()
+			endpoint.Status = domain.EndpointStatusDisabled
+			endpoint.DisabledReason = "disabled by merchant"
+			endpoint.DisabledAt = &now
+		}
+	}
+
+	if err := s.EndpointRepository.Update(ctx, endpoint.ID, endpointUpdates(endpoint)); err != nil {
+		zap.L().Error("failed to update endpoint", zap.Error(err), zap.String("endpoint_id", endpoint.ID))
+		return nil, err
+	}
+
+	return s.GetEndpoint(ctx, &webhookv1.GetEndpointRequest{Id: endpoint.ID, OrgId: endpoint.OrgID})
+}
+
+func (s *webhookUsecase) DeleteEndpoint(ctx context.Context, req *webhookv1.DeleteEndpointRequest) (*webhookv1.DeleteEndpointResponse, error) {
+	endpoint, err := s.findEndpoint(ctx, req.Id, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.EndpointRepository.Delete(ctx, endpoint.ID); err != nil {
+		zap.L().Error("failed to delete endpoint", zap.Error(err), zap.String("endpoint_id", endpoint.ID))
+		return nil, err
+	}
+
+	return &webhookv1.DeleteEndpointResponse{}, nil
+}
+
+func (s *webhookUsecase) RotateEndpointSecret(ctx context.Context, req *webhookv1.RotateEndpointSecretRequest) (*webhookv1.CreateEndpointResponse, error) {
+	endpoint, err := s.findEndpoint(ctx, req.Id, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := domain.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.Secret, err = s.encryptSecret(secret); err != nil {
+		return nil, err
+	}
+
+	if err := s.EndpointRepository.Update(ctx, endpoint.ID, endpointUpdates(endpoint)); err != nil {
+		zap.L().Error("failed to rotate endpoint secret", zap.Error(err), zap.String("endpoint_id", endpoint.ID))
+		return nil, err
+	}
+
+	return &webhookv1.CreateEndpointResponse{
+		Endpoint: toEndpointProto(endpoint),
+		Secret:   secret,
+	}, nil
+}
+
+func (s *webhookUsecase) ListDeliveries(ctx context.Context, req *webhookv1.ListDeliveriesRequest) (*webhookv1.ListDeliveriesResponse, error) {
+	query := &domain.Delivery{
+		OrgID:      req.OrgId,
+		EndpointID: req.EndpointId,
+	}
+
+	if req.Status != webhookv1.DeliveryStatus_DELIVERY_STATUS_UNSPECIFIED {
+		query.Status = req.Status.String()
+	}
+
+	limit := int(req.PageSize)
+	if limit <= 0 {
+		limit = defaultDeliveryPage
+	}
+	limit = min(limit, maxDeliveryPage)
+
+	deliveries, err := s.DeliveryRepository.Find(ctx, query,
+		option.WithSortBy(option.QuerySortBy{OrderBy: "desc"}),
+		option.ApplyPagination(pagination.Pagination{Limit: limit}),
+	)
+	if err != nil {
+		zap.L().Error("failed to query deliveries", zap.Error(err), zap.String("org_id", req.OrgId))
+		return nil, err
+	}
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	data := make([]*webhookv1.Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		data = append(data, toDeliveryProto(d))
+	}
+
+	return &webhookv1.ListDeliveriesResponse{
+		Data: data,
+	}, nil
+}
+
+// ReplayDelivery sends a logged delivery again as a new delivery with a fresh attempt budget.
+func (s *webhookUsecase) ReplayDelivery(ctx context.Context, req *webhookv1.ReplayDeliveryRequest) (*webhookv1.Delivery, error) {
+	original, err := s.DeliveryRepository.FindOne(ctx, &domain.Delivery{ID: req.Id, OrgID: req.OrgId})
+	if err != nil {
+		return nil, err
+	}
+
+	if original == nil {
+		return nil, errutil.NotFound("webhook delivery not found", nil)
+	}
+
+	endpoint, err := s.findEndpoint(ctx, original.EndpointID, original.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !endpoint.Active() {
+		return nil, errutil.BadRequest("webhook endpoint is disabled; enable it before replaying", nil)
+	}
+
+	replay := original.Replay()
+	if err := s.DeliveryRepository.Create(ctx, replay); err != nil {
+		zap.L().Error("failed to create replay delivery", zap.Error(err), zap.String("delivery_id", original.ID))
+		return nil, err
+	}
+
+	if err := s.enqueue(ctx, replay, 0); err != nil {
+		zap.L().Error("failed to enqueue replay delivery", zap.Error(err), zap.String("delivery_id", replay.ID))
+		return nil, err
+	}
+
+	return toDeliveryProto(replay), nil
+}
+
+func toEndpointProto(e *domain.Endpoint) *webhookv1.Endpoint {
+	endpoint := &webhookv1.Endpoint{
+		Id:             e.ID,
+		OrgId:          e.OrgID,
+		Url:            e.URL,
+		Description:    e.Description,
+		Topics:         e.GetTopics(),
+		Status:         webhookv1.EndpointStatus(webhookv1.EndpointStatus_value[e.Status]),
+		FailureCount:   int32(e.FailureCount),
+		DisabledReason: e.DisabledReason,
+		CreatedAt:      timestamppb.New(e.CreatedAt),
+		UpdatedAt:      timestamppb.New(e.UpdatedAt),
+	}
+
+	if e.DisabledAt != nil {
+		endpoint.DisabledAt = timestamppb.New(*e.DisabledAt)
+	}
+
+	return endpoint
+}
+
+func toDeliveryProto(d *domain.Delivery) *webhookv1.Delivery {
+	delivery := &webhookv1.Delivery{
+		Id:             d.ID,
+		OrgId:          d.OrgID,
+		EndpointId:     d.EndpointID,
+		EventId:        d.EventID,
+		Topic:          d.Topic,
+		Payload:        string(d.Payload),
+		Status:         webhookv1.DeliveryStatus(webhookv1.DeliveryStatus_value[d.Status]),
+		Attempts:       int32(d.Attempts),
+		ResponseStatus: int32(d.ResponseStatus),
+		LastError:      d.LastError,
+		CreatedAt:      timestamppb.New(d.CreatedAt),
+	}
+
+	if d.ReplayOf != nil {
+		delivery.ReplayOf = *d.ReplayOf
+	}
+
+	if d.NextAttemptAt != nil {
+		delivery.NextAttemptAt = timestamppb.New(*d.NextAttemptAt)
+	}
+
+	if d.DeliveredAt != nil {
+		delivery.DeliveredAt = timestamppb.New(*d.DeliveredAt)
+	}
+
+	return delivery
+}
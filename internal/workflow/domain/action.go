@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/reward"
+)
+
+// actionSchemas validates the parameters of each supported action type. REWARD_POINT
+// is credited by the EarnPoint workflow itself; every other type runs through the
+// action handler registered for it.
+var actionSchemas = map[string]func(params []byte) error{
+	workflowv1.ActionType_REWARD_POINT.String(): func(params []byte) error {
+		_, err := reward.Parse(params)
+		return err
+	},
+	workflowv1.ActionType_ISSUE_COUPON.String():         schema[IssueCouponParams],
+	workflowv1.ActionType_SET_MEMBER_TAG.String():       schema[MemberTagParams],
+	workflowv1.ActionType_SET_MEMBER_ATTRIBUTE.String(): schema[MemberAttributeParams],
+	workflowv1.ActionType_UPGRADE_TIER.String():         schema[UpgradeTierParams],
+	workflowv1.ActionType_SEND_NOTIFICATION.String():    schema[NotificationParams],
+	workflowv1.ActionType_CALL_WEBHOOK.String():         schema[WebhookParams],
+	workflowv1.ActionType_DEDUCT_POINTS.String():        schema[DeductPointsParams],
+}
+
+// ActionTypes lists the action types flows can fire.
+func ActionTypes() []string {
+	types := make([]string, 0, len(actionSchemas))
+	for t := range actionSchemas {
+		types = append(types, t)
+	}
+	return types
+}
+
+// ValidateActionParameters checks parameters against the schema of the action type.
+func ValidateActionParameters(typ string, params []byte) error {
+	schema, ok := actionSchemas[typ]
+	if !ok {
+		return fmt.Errorf("unsupported action type %s", typ)
+	}
+	return schema(params)
+}
+
+type validator interface {
+	validate() error
+}
+
+func schema[T any, P interface {
+	*T
+	validator
+}](params []byte) error {
+	_, err := ParseActionParams[T, P](params)
+	return err
+}
+
+// ParseActionParams decodes and validates the parameters of an action.
+func ParseActionParams[T any, P interface {
+	*T
+	validator
+}](params []byte) (*T, error) {
+	if len(params) == 0 {
+		return nil, errors.New("parameters are required")
+	}
+
+	var v T
+	if err := json.Unmarshal(params, &v); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	if err := P(&v).validate(); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+var attributeKey = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// IssueCouponParams issue the member a coupon code of the campaign, valid for
+// ValidDays when set. Codes are Prefix followed by Length random characters.
+type IssueCouponParams struct {
+	Campaign  string `json:"campaign"`
+	Prefix    string `json:"prefix,omitempty"`
+	Length    int    `json:"length,omitempty"`
+	ValidDays int    `json:"valid_days,omitempty"`
+}
+
+func (p *IssueCouponParams) validate() error {
+	switch {
+	case p.Campaign == "":
+		return errors.New("campaign is required")
+	case p.Length != 0 && (p.Length < 6 || p.Length > 16):
+		return errors.New("length must be between 6 and 16")
+	case p.ValidDays < 0:
+		return errors.New("valid_days can't be negative")
+	}
+	return nil
+}
+
+// MemberTagParams add Tag to the member, or take it off when Remove is set.
+type MemberTagParams struct {
+	Tag    string `json:"tag"`
+	Remove bool   `json:"remove,omitempty"`
+}
+
+func (p *MemberTagParams) validate() error {
+	if !attributeKey.MatchString(p.Tag) {
+		return errors.New("tag must be lower case letters, digits and underscores")
+	}
+	return nil
+}
+
+// MemberAttributeParams set an attribute of the member.
+type MemberAttributeParams struct {
+	Attribute string `json:"attribute"`
+	Value     any    `json:"value"`
+}
+
+func (p *MemberAttributeParams) validate() error {
+	switch {
+	case !attributeKey.MatchString(p.Attribute):
+		return errors.New("attribute must be lower case letters, digits and underscores")
+	case p.Value == nil:
+		return errors.New("value is required")
+	}
+	return nil
+}
+
+// UpgradeTierParams move the member to Tier. With From set, only members in one of
+// those tiers move, so a flow never downgrades.
+type UpgradeTierParams struct {
+	Tier string   `json:"tier"`
+	From []string `json:"from,omitempty"`
+}
+
+func (p *UpgradeTierParams) validate() error {
+	if p.Tier == "" {
+		return errors.New("tier is required")
+	}
+	for _, t := range p.From {
+		if t == p.Tier {
+			return fmt.Errorf("from can't include the target tier %s", p.Tier)
+		}
+	}
+	return nil
+}
+
+var notificationChannels = map[string]bool{"EMAIL": true, "SMS": true, "PUSH": true, "IN_APP": true}
+
+// NotificationParams send the member the template on the channel. Data fills the
+// template's placeholders besides the event attributes.
+type NotificationParams struct {
+	Template string            `json:"template"`
+	Channel  string            `json:"channel"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+func (p *NotificationParams) validate() error {
+	switch {
+	case p.Template == "":
+		return errors.New("template is required")
+	case !notificationChannels[p.Channel]:
+		return fmt.Errorf("unsupported channel %q, use EMAIL, SMS, PUSH or IN_APP", p.Channel)
+	}
+	return nil
+}
+
+// WebhookParams post the execution's event to URL.
+type WebhookParams struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (p *WebhookParams) validate() error {
+	u, err := url.Parse(p.URL)
+	switch {
+	case err != nil || u.Host == "":
+		return errors.New("url must be an absolute URL")
+	case u.Scheme != "https":
+		return errors.New("url must use https")
+	}
+	return nil
+}
+
+// DeductPointsParams debit Points from the member's balance.
+type DeductPointsParams struct {
+	Points int64 `json:"points"`
+}
+
+func (p *DeductPointsParams) validate() error {
+	if p.Points <= 0 {
+		return errors.New("points must be positive")
+	}
+	return nil
+}
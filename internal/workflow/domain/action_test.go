@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func TestValidateActionParameters(t *testing.T) {
+	cases := []struct {
+		typ    workflowv1.ActionType
+		params string
+		err    string
+	}{
+		{workflowv1.ActionType_ISSUE_COUPON, `{"campaign":"welcome","length":8}`, ""},
+		{workflowv1.ActionType_ISSUE_COUPON, `{"length":8}`, "campaign is required"},
+		{workflowv1.ActionType_ISSUE_COUPON, `{"campaign":"welcome","length":40}`, "length"},
+		{workflowv1.ActionType_SET_MEMBER_TAG, `{"tag":"vip"}`, ""},
+		{workflowv1.ActionType_SET_MEMBER_TAG, `{"tag":"VIP member"}`, "tag must be"},
+		{workflowv1.ActionType_SET_MEMBER_ATTRIBUTE, `{"attribute":"segment","value":"lapsed"}`, ""},
+		{workflowv1.ActionType_SET_MEMBER_ATTRIBUTE, `{"attribute":"segment"}`, "value is required"},
+		{workflowv1.ActionType_UPGRADE_TIER, `{"tier":"GOLD","from":["SILVER"]}`, ""},
+		{workflowv1.ActionType_UPGRADE_TIER, `{"tier":"GOLD","from":["GOLD"]}`, "target tier"},
+		{workflowv1.ActionType_SEND_NOTIFICATION, `{"template":"welcome","channel":"EMAIL"}`, ""},
+		{workflowv1.ActionType_SEND_NOTIFICATION, `{"template":"welcome","channel":"FAX"}`, "unsupported channel"},
+		{workflowv1.ActionType_CALL_WEBHOOK, `{"url":"https://example.com/hook"}`, ""},
+		{workflowv1.ActionType_CALL_WEBHOOK, `{"url":"http://example.com/hook"}`, "https"},
+		{workflowv1.ActionType_DEDUCT_POINTS, `{"points":100}`, ""},
+		{workflowv1.ActionType_DEDUCT_POINTS, `{"points":-5}`, "positive"},
+		{workflowv1.ActionType_DEDUCT_POINTS, ``, "parameters are required"},
+	}
+
+	for _, c := range cases {
+		err := ValidateActionParameters(c.typ.String(), []byte(c.params))
+		switch {
+		case c.err == "" && err != nil:
+			t.Fatalf("%s %s: unexpected error %v", c.typ, c.params, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Fatalf("%s %s: error = %v, want %q", c.typ, c.params, err, c.err)
+		}
+	}
+}
+
+func TestValidateGraphChecksActionParameters(t *testing.T) {
+	nodes := []*Node{
+		trigger("start"),
+		{ID: "tag", Type: workflowv1.NodeType_ACTION, Action: &NodeAction{Type: "SET_MEMBER_TAG", Parameters: []byte(`{}`)}},
+	}
+
+	details := ValidateGraph(nodes, []*Edge{edge("start", "tag", "")})
+	if detailFor(details, "nodes[1].action.parameters") == "" {
+		t.Fatalf("invalid tag parameters not reported: %+v", details)
+	}
+}
+
+func TestCouponCodeIsStable(t *testing.T) {
+	code := CouponCode("exec-1:0", "WELCOME-", 0)
+	if !strings.HasPrefix(code, "WELCOME-") || len(code) != len("WELCOME-")+DefaultCouponLength {
+		t.Fatalf("code = %q, want WELCOME- and %d characters", code, DefaultCouponLength)
+	}
+
+	if again := CouponCode("exec-1:0", "WELCOME-", 0); again != code {
+		t.Fatalf("same key gave %q then %q", code, again)
+	}
+
+	if other := CouponCode("exec-2:0", "WELCOME-", 0); other == code {
+		t.Fatalf("two keys gave the same code %q", code)
+	}
+}
+
+func TestMemberProfileActions(t *testing.T) {
+	m := NewMemberProfile("org-id", "user-id")
+
+	if !m.Tag("vip", false) || m.Tag("vip", false) {
+		t.Fatalf("tagging twice should change the tags once, got %v", m.GetTags())
+	}
+	if !m.Tag("vip", true) || len(m.GetTags()) != 0 {
+		t.Fatalf("tag not removed: %v", m.GetTags())
+	}
+
+	m.Tier = "BRONZE"
+	if m.UpgradeTier("GOLD", []string{"SILVER"}) {
+		t.Fatalf("BRONZE member moved though only SILVER members qualify")
+	}
+	if !m.UpgradeTier("GOLD", []string{"BRONZE", "SILVER"}) || m.Tier != "GOLD" {
+		t.Fatalf("tier = %s, want GOLD", m.Tier)
+	}
+	if m.UpgradeTier("GOLD", nil) {
+		t.Fatalf("GOLD member upgraded to GOLD again")
+	}
+}
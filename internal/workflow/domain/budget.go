@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+)
+
+// BudgetExhausted is why a reward its flow's budget couldn't cover was skipped.
+const BudgetExhausted = "budget exhausted"
+
+// Budgeted reports whether the flow has a points budget. A flow without one rewards
+// without limit.
+func (m *Flow) Budgeted() bool {
+	return m.Budget > 0
+}
+
+// BudgetRemaining is what is left of the flow's budget; zero for a flow without one.
+func (m *Flow) BudgetRemaining() int64 {
+	if !m.Budgeted() || m.BudgetConsumed >= m.Budget {
+		return 0
+	}
+	return m.Budget - m.BudgetConsumed
+}
+
+// BudgetGrants returns how many of the points of rewards the flow's remaining budget
+// grants, charging them in order, each whole or not at all, as their spends are
+// reserved. A flow without a budget grants them all.
+func (m *Flow) BudgetGrants(rewards []int64) int64 {
+	var granted int64
+	remaining := m.BudgetRemaining()
+	for _, p := range rewards {
+		if !m.Budgeted() || p <= remaining {
+			granted += p
+			remaining -= p
+		}
+	}
+	return granted
+}
+
+// ValidateBudget checks a budget set on a flow: it can't be negative, and zero
+// removes the budget.
+func ValidateBudget(budget int64) []errutil.Detail {
+	if budget < 0 {
+		return []errutil.Detail{{Field: "budget", Message: "budget can't be negative"}}
+	}
+	return nil
+}
+
+// BudgetSpend is one reward action's claim on its flow's budget. ID is the action's
+// key, so a retried action claims once. Granted is false when the budget couldn't
+// cover Points and the reward was skipped. Paused is set on the spend that exhausted
+// the budget and paused the flow. VoidedAt is set when the reward wasn't credited
+// after all and the points went back to the budget.
+type BudgetSpend struct {
+	ID             string     `gorm:"column:id;primaryKey"`
+	OrganizationID string     `gorm:"column:organization_id"`
+	FlowID         string     `gorm:"column:flow_id"`
+	ExecutionID    string     `gorm:"column:execution_id"`
+	Points         int64      `gorm:"column:points"`
+	Granted        bool       `gorm:"column:granted"`
+	Paused         bool       `gorm:"column:paused"`
+	VoidedAt       *time.Time `gorm:"column:voided_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
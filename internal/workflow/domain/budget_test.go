@@ -0,0 +1,23 @@
+package domain
+
+import "testing"
+
+func TestFlowBudgetGrants(t *testing.T) {
+	cases := []struct {
+		name     string
+		flow     *Flow
+		rewards  []int64
+		expected int64
+	}{
+		{"no budget", &Flow{}, []int64{50, 70}, 120},
+		{"covered", &Flow{Budget: 200, BudgetConsumed: 50}, []int64{50, 70}, 120},
+		{"later reward fits", &Flow{Budget: 100, BudgetConsumed: 40}, []int64{70, 50}, 50},
+		{"exhausted", &Flow{Budget: 100, BudgetConsumed: 100}, []int64{10}, 0},
+	}
+
+	for _, c := range cases {
+		if got := c.flow.BudgetGrants(c.rewards); got != c.expected {
+			t.Fatalf("%s: granted %d, want %d", c.name, got, c.expected)
+		}
+	}
+}
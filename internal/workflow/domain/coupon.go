@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+)
+
+// DefaultCouponLength is the length of a coupon code's random part when the action
+// doesn't set one.
+const DefaultCouponLength = 8
+
+// couponAlphabet leaves out the characters easily misread: 0, O, 1, I and L.
+const couponAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// MemberCoupon is a coupon code a flow issued a member. Its ID is the key of the
+// action that issued it, so an action issues one coupon however often it runs.
+type MemberCoupon struct {
+	ID             string     `gorm:"column:id;primaryKey"`
+	OrganizationID string     `gorm:"column:organization_id"`
+	UserID         string     `gorm:"column:user_id"`
+	Campaign       string     `gorm:"column:campaign"`
+	Code           string     `gorm:"column:code"`
+	ExpiresAt      *time.Time `gorm:"column:expires_at"`
+	RedeemedAt     *time.Time `gorm:"column:redeemed_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+// NewMemberCoupon issues the coupon of the action keyed key at now.
+func NewMemberCoupon(key, orgID, userID string, p *IssueCouponParams, now time.Time) *MemberCoupon {
+	c := &MemberCoupon{
+		ID:             key,
+		OrganizationID: orgID,
+		UserID:         userID,
+		Campaign:       p.Campaign,
+		Code:           CouponCode(key, p.Prefix, p.Length),
+	}
+
+	if p.ValidDays > 0 {
+		expires := now.AddDate(0, 0, p.ValidDays)
+		c.ExpiresAt = &expires
+	}
+
+	return c
+}
+
+// CouponCode derives the code of the action keyed key: prefix followed by length
+// characters drawn from the key's hash. The same key always gives the same code.
+func CouponCode(key, prefix string, length int) string {
+	if length <= 0 {
+		length = DefaultCouponLength
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	code := []byte(prefix)
+	for i := 0; i < length; i++ {
+		n := binary.BigEndian.Uint16(sum[(i*2)%len(sum):])
+		code = append(code, couponAlphabet[int(n)%len(couponAlphabet)])
+	}
+	return string(code)
+}
@@ -0,0 +1,235 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"sigs.k8s.io/yaml"
+)
+
+// DocumentSchemaVersion identifies the format of flow documents. Documents of any
+// other version are refused on import. The format is described by
+// flow_document.schema.json next to this file.
+const DocumentSchemaVersion = "workflow.smallbiznis.io/flow/v1"
+
+// Document formats.
+const (
+	DocumentJSON = "json"
+	DocumentYAML = "yaml"
+)
+
+// FlowDocument is a flow in a portable form, for moving it between organizations and
+// environments. It carries the graph and the settings that make sense outside the
+// organization; IDs are remapped on import, so a document can be imported any
+// number of times.
+type FlowDocument struct {
+	SchemaVersion  string          `json:"schema_version"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description,omitempty"`
+	Version        int32           `json:"version,omitempty"` // version of the flow that was exported
+	Priority       int32           `json:"priority,omitempty"`
+	ExclusiveGroup string          `json:"exclusive_group,omitempty"`
+	Budget         int64           `json:"budget,omitempty"`
+	Nodes          []*DocumentNode `json:"nodes"`
+	Edges          []*Edge         `json:"edges"`
+	Overflow       json.RawMessage `json:"overflow,omitempty"`
+}
+
+// DocumentNode is a node of a document. Unlike a stored node, its type is the
+// NodeType name, which stays readable and stable across releases.
+type DocumentNode struct {
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	Trigger   *NodeTrigger   `json:"trigger,omitempty"`
+	Condition *NodeCondition `json:"condition,omitempty"`
+	Action    *NodeAction    `json:"action,omitempty"`
+	Wait      *NodeWait      `json:"wait,omitempty"`
+	WaitEvent *NodeWaitEvent `json:"wait_event,omitempty"`
+	Split     *NodeSplit     `json:"split,omitempty"`
+	Position  Position       `json:"position"`
+}
+
+// ExportFlow builds the document of the flow's live graph.
+func ExportFlow(flow *Flow) (*FlowDocument, error) {
+	var nodes []*Node
+	if err := json.Unmarshal(flow.Nodes, &nodes); err != nil {
+		return nil, fmt.Errorf("invalid nodes: %w", err)
+	}
+
+	edges := []*Edge{}
+	if len(flow.Edges) > 0 {
+		if err := json.Unmarshal(flow.Edges, &edges); err != nil {
+			return nil, fmt.Errorf("invalid edges: %w", err)
+		}
+	}
+
+	doc := &FlowDocument{
+		SchemaVersion:  DocumentSchemaVersion,
+		Name:           flow.Name,
+		Description:    flow.Description,
+		Version:        flow.Version,
+		Priority:       flow.Priority,
+		ExclusiveGroup: flow.ExclusiveGroup,
+		Budget:         flow.Budget,
+		Nodes:          make([]*DocumentNode, 0, len(nodes)),
+		Edges:          edges,
+	}
+
+	if len(flow.Overflow) > 0 && string(flow.Overflow) != "null" {
+		doc.Overflow = json.RawMessage(flow.Overflow)
+	}
+
+	for _, n := range nodes {
+		doc.Nodes = append(doc.Nodes, &DocumentNode{
+			ID:        n.ID,
+			Type:      n.Type.String(),
+			Trigger:   n.Trigger,
+			Condition: n.Condition,
+			Action:    n.Action,
+			Wait:      n.Wait,
+			WaitEvent: n.WaitEvent,
+			Split:     n.Split,
+			Position:  n.Position,
+		})
+	}
+
+	return doc, nil
+}
+
+// Encode writes the document as JSON or YAML.
+func (d *FlowDocument) Encode(format string) ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(format) {
+	case "", DocumentJSON:
+		return b, nil
+	case DocumentYAML:
+		return yaml.JSONToYAML(b)
+	}
+
+	return nil, fmt.Errorf("unsupported document format %q, use json or yaml", format)
+}
+
+// ParseFlowDocument reads a document in JSON or YAML. Fields the format doesn't
+// know are refused, as are documents of another schema version.
+func ParseFlowDocument(data []byte) (*FlowDocument, error) {
+	b, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("document is neither JSON nor YAML: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	var doc FlowDocument
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	if doc.SchemaVersion != DocumentSchemaVersion {
+		return nil, fmt.Errorf("unsupported schema_version %q, want %s", doc.SchemaVersion, DocumentSchemaVersion)
+	}
+
+	return &doc, nil
+}
+
+// Import builds a new flow of the organization from the document. Every node and
+// edge gets a new ID, edges are pointed at the new node IDs, and the graph is
+// validated. The flow is INACTIVE and has no live graph; the graph is returned
+// apart, to be saved as the flow's draft, reviewed and published.
+func (d *FlowDocument) Import(orgID string) (*Flow, *Flow, []errutil.Detail) {
+	var details []errutil.Detail
+	report := func(field, format string, args ...any) {
+		details = append(details, errutil.Detail{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if d.Name == "" {
+		report("name", "name is required")
+	}
+
+	ids := make(map[string]string, len(d.Nodes))
+	nodes := make([]*Node, 0, len(d.Nodes))
+	for i, n := range d.Nodes {
+		typ, ok := workflowv1.NodeType_value[n.Type]
+		if !ok {
+			report(fmt.Sprintf("nodes[%d].type", i), "unsupported node type %s", n.Type)
+			continue
+		}
+
+		id := uuid.NewString()
+		if n.ID != "" {
+			ids[n.ID] = id
+		}
+
+		nodes = append(nodes, &Node{
+			ID:        id,
+			Type:      workflowv1.NodeType(typ),
+			Trigger:   n.Trigger,
+			Condition: n.Condition,
+			Action:    n.Action,
+			Wait:      n.Wait,
+			WaitEvent: n.WaitEvent,
+			Split:     n.Split,
+			Position:  n.Position,
+		})
+	}
+
+	edges := make([]*Edge, 0, len(d.Edges))
+	for _, e := range d.Edges {
+		// An edge to a node the document doesn't have keeps its ID, so validation
+		// reports it.
+		edge := &Edge{ID: uuid.NewString(), Type: e.Type, Source: e.Source, Target: e.Target}
+		if id, ok := ids[e.Source]; ok {
+			edge.Source = id
+		}
+		if id, ok := ids[e.Target]; ok {
+			edge.Target = id
+		}
+		edges = append(edges, edge)
+	}
+
+	details = append(details, ValidateGraph(nodes, edges)...)
+	details = append(details, ValidateBudget(d.Budget)...)
+	if len(details) > 0 {
+		return nil, nil, details
+	}
+
+	n, err := json.Marshal(nodes)
+	if err != nil {
+		report("nodes", "nodes are malformed")
+		return nil, nil, details
+	}
+
+	e, err := json.Marshal(edges)
+	if err != nil {
+		report("edges", "edges are malformed")
+		return nil, nil, details
+	}
+
+	overflow := []byte(d.Overflow)
+	if len(overflow) == 0 {
+		overflow = []byte(`{}`)
+	}
+
+	flow := NewFlow(FlowParams{OrganizationID: orgID, Name: d.Name})
+	flow.Description = d.Description
+	flow.Status = workflowv1.FlowStatus_INACTIVE.String()
+	flow.Priority, flow.ExclusiveGroup, flow.Budget = d.Priority, d.ExclusiveGroup, d.Budget
+	flow.Nodes, flow.Edges, flow.Overflow = []byte(`[]`), []byte(`[]`), []byte(`{}`)
+
+	graph := &Flow{ID: flow.ID, OrganizationID: orgID, Nodes: n, Edges: e, Overflow: overflow}
+	if trigger := graph.triggerNode(); trigger != nil && trigger.Trigger != nil {
+		graph.Trigger = trigger.Trigger.Key
+	}
+	flow.Trigger = graph.Trigger
+
+	return flow, graph, nil
+}
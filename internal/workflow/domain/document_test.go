@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func exportable(t *testing.T) *Flow {
+	t.Helper()
+
+	nodes, err := json.Marshal(validNodes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	edges, err := json.Marshal(validEdges())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &Flow{
+		ID:             "flow-id",
+		OrganizationID: "agency-org",
+		Name:           "Big spenders",
+		Trigger:        "TRANSACTION",
+		Nodes:          nodes,
+		Edges:          edges,
+		Overflow:       []byte(`{"x":10,"y":20,"zoom":1.5}`),
+		Version:        4,
+		Priority:       2,
+		Budget:         100000,
+	}
+}
+
+func TestFlowDocumentRoundTrip(t *testing.T) {
+	doc, err := ExportFlow(exportable(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := doc.Encode(DocumentYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(b), "type: TRIGGER") {
+		t.Fatalf("node types aren't written by name:\n%s", b)
+	}
+
+	parsed, err := ParseFlowDocument(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Version != 4 || parsed.Budget != 100000 || len(parsed.Nodes) != 4 {
+		t.Fatalf("parsed %+v, want the exported flow", parsed)
+	}
+
+	flow, graph, details := parsed.Import("merchant-org")
+	if len(details) > 0 {
+		t.Fatalf("unexpected details: %+v", details)
+	}
+
+	if flow.OrganizationID != "merchant-org" || flow.ID == "flow-id" || flow.Status != workflowv1.FlowStatus_INACTIVE.String() {
+		t.Fatalf("flow = %+v, want a new INACTIVE flow of merchant-org", flow)
+	}
+	if flow.Trigger != "TRANSACTION" || graph.Trigger != "TRANSACTION" {
+		t.Fatalf("trigger = %q, want TRANSACTION", flow.Trigger)
+	}
+	if flow.Version != 0 || string(flow.Nodes) != "[]" {
+		t.Fatalf("imported flow is live: version %d, nodes %s", flow.Version, flow.Nodes)
+	}
+
+	g, err := graph.BuildFlowGraph()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for id := range g.Nodes {
+		if id == "start" || id == "cond" || id == "yes" || id == "no" {
+			t.Fatalf("node ID %s wasn't remapped", id)
+		}
+	}
+	for source, edges := range g.Edges {
+		for _, e := range edges {
+			if g.Nodes[source] == nil || g.Nodes[e.Target] == nil {
+				t.Fatalf("edge %+v doesn't point at the new node IDs", e)
+			}
+		}
+	}
+
+	if details := graph.Validate(); len(details) > 0 {
+		t.Fatalf("imported graph is invalid: %+v", details)
+	}
+}
+
+func TestParseFlowDocumentRefuses(t *testing.T) {
+	for name, doc := range map[string]string{
+		"schema version": `{"schema_version":"workflow.smallbiznis.io/flow/v0","name":"x","nodes":[],"edges":[]}`,
+		"unknown field":  `{"schema_version":"workflow.smallbiznis.io/flow/v1","name":"x","owner":"me","nodes":[],"edges":[]}`,
+		"malformed":      "name: [x",
+	} {
+		if _, err := ParseFlowDocument([]byte(doc)); err == nil {
+			t.Fatalf("%s: document accepted", name)
+		}
+	}
+}
+
+func TestImportReportsInvalidDocument(t *testing.T) {
+	doc, err := ParseFlowDocument([]byte(`
+schema_version: workflow.smallbiznis.io/flow/v1
+name: Broken
+budget: -5
+nodes:
+  - id: start
+    type: TRIGGER
+    trigger: {key: TRANSACTION}
+  - id: later
+    type: SOMEDAY
+edges:
+  - {source: start, target: missing}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _, details := doc.Import("org-id")
+	for _, field := range []string{"nodes[1].type", "budget"} {
+		if detailFor(details, field) == "" {
+			t.Fatalf("%s not reported: %+v", field, details)
+		}
+	}
+	if len(details) < 3 {
+		t.Fatalf("the dangling edge isn't reported: %+v", details)
+	}
+}
+
+func TestDocumentSchemaMatchesVersion(t *testing.T) {
+	b, err := os.ReadFile("flow_document.schema.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var schema struct {
+		Properties struct {
+			SchemaVersion struct {
+				Const string `json:"const"`
+			} `json:"schema_version"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("schema isn't valid JSON: %v", err)
+	}
+
+	if schema.Properties.SchemaVersion.Const != DocumentSchemaVersion {
+		t.Fatalf("schema is for %q, documents are %q", schema.Properties.SchemaVersion.Const, DocumentSchemaVersion)
+	}
+}
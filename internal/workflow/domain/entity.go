@@ -3,11 +3,12 @@ package domain
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/celengine"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/structpb"
 	"gorm.io/datatypes"
@@ -18,10 +19,12 @@ type FlowTemplate struct {
 	Name        string         `gorm:"column:name"`
 	Description string         `gorm:"column:description"`
 	Trigger     string         `gorm:"column:trigger"`
+	Category    string         `gorm:"column:category"`
 	Status      string         `gorm:"column:status"`
 	Nodes       datatypes.JSON `gorm:"column:nodes"` // serialized []Node
 	Edges       datatypes.JSON `gorm:"column:edges"` // serialized []Edge
 	Overflow    datatypes.JSON `gorm:"column:overflow"`
+	Parameters  datatypes.JSON `gorm:"column:parameters"` // serialized []TemplateParameter
 
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
 	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
@@ -218,6 +221,57 @@ func (m *FlowTemplate) GetNodes() []*workflowv1.Node {
 				return nil
 			}
 
+			node.Data = obj
+		case workflowv1.NodeType_WAIT:
+			b, err := json.Marshal(&n.Wait)
+			if err != nil {
+				return nil
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil
+			}
+
+			obj, err := structpb.NewStruct(data)
+			if err != nil {
+				return nil
+			}
+
+			node.Data = obj
+		case workflowv1.NodeType_WAIT_FOR_EVENT:
+			b, err := json.Marshal(&n.WaitEvent)
+			if err != nil {
+				return nil
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil
+			}
+
+			obj, err := structpb.NewStruct(data)
+			if err != nil {
+				return nil
+			}
+
+			node.Data = obj
+		case workflowv1.NodeType_SPLIT:
+			b, err := json.Marshal(&n.Split)
+			if err != nil {
+				return nil
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil
+			}
+
+			obj, err := structpb.NewStruct(data)
+			if err != nil {
+				return nil
+			}
+
 			node.Data = obj
 		}
 
@@ -255,6 +309,11 @@ type Flow struct {
 	Nodes          datatypes.JSON `gorm:"column:nodes"`  // serialized []Node
 	Edges          datatypes.JSON `gorm:"column:edges"`  // serialized []Edge
 	Overflow       datatypes.JSON `gorm:"column:overflow"`
+	Version        int32          `gorm:"column:version"` // live published version
+	Budget         int64          `gorm:"column:budget"`  // points the flow may award; 0 is unlimited
+	BudgetConsumed int64          `gorm:"column:budget_consumed"`
+	Priority       int32          `gorm:"column:priority"`        // higher wins under the stacking policy
+	ExclusiveGroup string         `gorm:"column:exclusive_group"` // flows of one group don't stack
 
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
 	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
@@ -334,6 +393,45 @@ func (m *Flow) BuildFlowGraph() (*FlowGraph, error) {
 			}
 
 			node.Action = &act
+
+		case workflowv1.NodeType_WAIT:
+			b, err := n.Data.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+
+			var wait NodeWait
+			if err := json.Unmarshal(b, &wait); err != nil {
+				return nil, err
+			}
+
+			node.Wait = &wait
+
+		case workflowv1.NodeType_WAIT_FOR_EVENT:
+			b, err := n.Data.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+
+			var wait NodeWaitEvent
+			if err := json.Unmarshal(b, &wait); err != nil {
+				return nil, err
+			}
+
+			node.WaitEvent = &wait
+
+		case workflowv1.NodeType_SPLIT:
+			b, err := n.Data.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+
+			var split NodeSplit
+			if err := json.Unmarshal(b, &split); err != nil {
+				return nil, err
+			}
+
+			node.Split = &split
 		}
 
 		graph.Nodes[n.Id] = node
@@ -394,12 +492,6 @@ func (m *Flow) SetNodes(nodes []*workflowv1.Node) error {
 				return err
 			}
 
-			exp, err := generateCEL(cond.Conditions)
-			if err != nil {
-				return err
-			}
-			cond.Expression = exp
-
 			node.Condition = &cond
 
 		case workflowv1.NodeType_ACTION:
@@ -414,11 +506,65 @@ func (m *Flow) SetNodes(nodes []*workflowv1.Node) error {
 			}
 
 			node.Action = &act
+
+		case workflowv1.NodeType_WAIT:
+			b, err := n.Data.MarshalJSON()
+			if err != nil {
+				return err
+			}
+
+			var wait NodeWait
+			if err := json.Unmarshal(b, &wait); err != nil {
+				return err
+			}
+
+			node.Wait = &wait
+
+		case workflowv1.NodeType_WAIT_FOR_EVENT:
+			b, err := n.Data.MarshalJSON()
+			if err != nil {
+				return err
+			}
+
+			var wait NodeWaitEvent
+			if err := json.Unmarshal(b, &wait); err != nil {
+				return err
+			}
+
+			node.WaitEvent = &wait
+
+		case workflowv1.NodeType_SPLIT:
+			b, err := n.Data.MarshalJSON()
+			if err != nil {
+				return err
+			}
+
+			var split NodeSplit
+			if err := json.Unmarshal(b, &split); err != nil {
+				return err
+			}
+
+			node.Split = &split
 		}
 
 		internalNodes = append(internalNodes, node)
 	}
 
+	// Conditions are compiled once the trigger is known, since its schema decides
+	// which attributes they may reference.
+	for i, node := range internalNodes {
+		if node.Condition == nil {
+			continue
+		}
+
+		if err := node.Condition.compile(m.Trigger); err != nil {
+			return errutil.ValidationFailed("invalid condition", nil, errutil.WithDetails(errutil.Detail{
+				Field:   fmt.Sprintf("nodes[%d].condition", i),
+				Message: err.Error(),
+			}))
+		}
+	}
+
 	data, err := json.Marshal(internalNodes)
 	if err != nil {
 		zap.L().Error("failed to marshal internalNodes", zap.Error(err))
@@ -521,6 +667,57 @@ func (m *Flow) GetNodes() []*workflowv1.Node {
 				return nil
 			}
 
+			node.Data = obj
+		case workflowv1.NodeType_WAIT:
+			b, err := json.Marshal(&n.Wait)
+			if err != nil {
+				return nil
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil
+			}
+
+			obj, err := structpb.NewStruct(data)
+			if err != nil {
+				return nil
+			}
+
+			node.Data = obj
+		case workflowv1.NodeType_WAIT_FOR_EVENT:
+			b, err := json.Marshal(&n.WaitEvent)
+			if err != nil {
+				return nil
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil
+			}
+
+			obj, err := structpb.NewStruct(data)
+			if err != nil {
+				return nil
+			}
+
+			node.Data = obj
+		case workflowv1.NodeType_SPLIT:
+			b, err := json.Marshal(&n.Split)
+			if err != nil {
+				return nil
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil
+			}
+
+			obj, err := structpb.NewStruct(data)
+			if err != nil {
+				return nil
+			}
+
 			node.Data = obj
 		}
 
@@ -550,17 +747,23 @@ func (m *Flow) GetOverflow() *workflowv1.Overflow {
 
 type Node struct {
 	ID        string              `json:"id" validate:"required"`
-	Type      workflowv1.NodeType `json:"node_type" validate:"required"` // enum as string: TRIGGER, CONDITION, ACTION
+	Type      workflowv1.NodeType `json:"node_type" validate:"required"` // enum as string: TRIGGER, CONDITION, ACTION, WAIT, WAIT_FOR_EVENT, SPLIT
 	Trigger   *NodeTrigger        `json:"trigger,omitempty" validate:"required_if=NodeType NODE_TYPE_TRIGGER"`
 	Condition *NodeCondition      `json:"condition,omitempty" validate:"required_if=NodeType NODE_TYPE_CONDITION"`
 	Action    *NodeAction         `json:"action,omitempty" validate:"required_if=NodeType ACTION"`
+	Wait      *NodeWait           `json:"wait,omitempty"`
+	WaitEvent *NodeWaitEvent      `json:"wait_event,omitempty"`
+	Split     *NodeSplit          `json:"split,omitempty"`
 	Position  Position            `json:"position,omitempty" validate:"required"`
 }
 
 type NodeTrigger struct {
-	Key         string `json:"key"` // TriggerType as string
-	Label       string `json:"label,omitempty"`
-	Description string `json:"description,omitempty"`
+	Key         string    `json:"key"` // TriggerType as string
+	Label       string    `json:"label,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Schedule    *Schedule `json:"schedule,omitempty"`
+	// Cap limits how often the flow fires for a member.
+	Cap *FrequencyCap `json:"cap,omitempty"`
 }
 
 type Condition struct {
@@ -574,9 +777,34 @@ type NodeCondition struct {
 	Expression string       `json:"expression"`
 }
 
+// compile sets the expression from the structured conditions. A condition given
+// only as an expression is type-checked as written.
+func (c *NodeCondition) compile(trigger string) error {
+	if len(c.Conditions) > 0 {
+		expr, err := compileConditions(trigger, c.Conditions)
+		if err != nil {
+			return err
+		}
+		c.Expression = expr
+		return nil
+	}
+
+	if c.Expression == "" {
+		return nil
+	}
+
+	schema, err := celengine.SchemaFor(trigger)
+	if err != nil {
+		return err
+	}
+	return schema.Check(c.Expression)
+}
+
 type NodeAction struct {
 	Type       string         `json:"type" validate:"required"`
 	Parameters datatypes.JSON `json:"parameters" validate:"required"`
+	// Cap limits how often the action fires for a member.
+	Cap *FrequencyCap `json:"cap,omitempty"`
 }
 
 type Edge struct {
@@ -597,22 +825,21 @@ type Overflow struct {
 	Zoom float64 `json:"zoom"`
 }
 
-func generateCEL(conditions []*Condition) (string, error) {
-	exprs := make([]string, 0)
+// compileConditions compiles structured conditions into a CEL expression checked
+// against the attribute schema of the flow's trigger.
+func compileConditions(trigger string, conditions []*Condition) (string, error) {
+	schema, err := celengine.SchemaFor(trigger)
+	if err != nil {
+		return "", err
+	}
+
+	clauses := make([]celengine.Clause, 0, len(conditions))
 	for _, c := range conditions {
-		var valueStr string
-		switch c.Value.Kind.(type) {
-		case *structpb.Value_StringValue:
-			valueStr = fmt.Sprintf(`"%s"`, c.Value.GetStringValue()) // tambahkan tanda kutip
-		case *structpb.Value_NumberValue:
-			valueStr = fmt.Sprintf(`%v`, c.Value.GetNumberValue())
-		case *structpb.Value_BoolValue:
-			valueStr = fmt.Sprintf(`%t`, c.Value.GetBoolValue())
-		default:
-			return "", fmt.Errorf("unsupported value type: %T", c.Value)
+		if c == nil {
+			continue
 		}
-		part := fmt.Sprintf(`%s %s %s`, c.Field, c.Operator, valueStr)
-		exprs = append(exprs, part)
+		clauses = append(clauses, celengine.Clause{Field: c.Field, Operator: c.Operator, Value: c.Value})
 	}
-	return strings.Join(exprs, " && "), nil
+
+	return schema.Compile(clauses)
 }
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func protoNode(t *testing.T, id string, typ workflowv1.NodeType, data map[string]any) *workflowv1.Node {
+	t.Helper()
+	s, err := structpb.NewStruct(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &workflowv1.Node{Id: id, Type: typ, Data: s}
+}
+
+func conditionNode(t *testing.T, field, operator string, value any) *workflowv1.Node {
+	return protoNode(t, "cond", workflowv1.NodeType_CONDITION, map[string]any{
+		"conditions": []any{map[string]any{"field": field, "operator": operator, "value": value}},
+	})
+}
+
+func TestSetNodesCompilesConditions(t *testing.T) {
+	flow := &Flow{}
+	err := flow.SetNodes([]*workflowv1.Node{
+		conditionNode(t, "customer.tier", "in", []any{"GOLD", "PLATINUM"}),
+		protoNode(t, "start", workflowv1.NodeType_TRIGGER, map[string]any{"key": "TRANSACTION"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var nodes []*Node
+	if err := json.Unmarshal(flow.Nodes, &nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := nodes[0].Condition.Expression; got != `customer.tier in ["GOLD", "PLATINUM"]` {
+		t.Fatalf("unexpected expression %s", got)
+	}
+}
+
+func TestSetNodesRejectsInvalidConditions(t *testing.T) {
+	cases := []struct {
+		name string
+		cond *workflowv1.Node
+	}{
+		{"unknown field", conditionNode(t, "points", "==", 1.0)},
+		{"unknown operator", conditionNode(t, "amount", "matches", 1.0)},
+		{"wrong value type", conditionNode(t, "channel", "==", true)},
+		{"ill typed expression", protoNode(t, "cond", workflowv1.NodeType_CONDITION, map[string]any{"expression": "amount + 1"})},
+	}
+
+	for _, c := range cases {
+		flow := &Flow{}
+		err := flow.SetNodes([]*workflowv1.Node{
+			protoNode(t, "start", workflowv1.NodeType_TRIGGER, map[string]any{"key": "TRANSACTION"}),
+			c.cond,
+		})
+
+		var e errutil.BaseError
+		if !errors.As(err, &e) || len(e.Details) != 1 || e.Details[0].Field != "nodes[1].condition" {
+			t.Fatalf("%s: expected nodes[1].condition to be reported, got %v", c.name, err)
+		}
+	}
+}
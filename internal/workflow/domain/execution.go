@@ -0,0 +1,191 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	// ExecutionStatusEvaluated is a flow that ran and whose actions are being applied.
+	ExecutionStatusEvaluated = "EVALUATED"
+	// ExecutionStatusWaiting is a flow with paths paused at wait nodes.
+	ExecutionStatusWaiting   = "WAITING"
+	ExecutionStatusCompleted = "COMPLETED"
+	ExecutionStatusFailed    = "FAILED"
+	// ExecutionStatusCapped is a flow that had reached its frequency cap for the
+	// member, so it fired nothing. SkipReason says which cap.
+	ExecutionStatusCapped = "CAPPED"
+)
+
+// SettledExecutionStatuses are the statuses of records that no stage resumes any more.
+// Only settled records are purged: a WAITING record still has a wait to come back to,
+// however far off its timer is.
+var SettledExecutionStatuses = []string{
+	ExecutionStatusCompleted,
+	ExecutionStatusFailed,
+	ExecutionStatusCapped,
+	ExecutionStatusSuppressed,
+}
+
+// DefaultExecutionRetention is how long execution history is kept when no retention
+// is configured.
+const DefaultExecutionRetention = 90 * 24 * time.Hour
+
+// FlowExecution is the audit record of one flow evaluated for one event: what came
+// in, which version ran, the path it took, what it fired and what the ledger made of
+// it. A workflow run keeps one record per flow, so activity retries update it.
+type FlowExecution struct {
+	ID             string         `gorm:"column:id;primaryKey"`
+	OrganizationID string         `gorm:"column:organization_id"`
+	FlowID         string         `gorm:"column:flow_id"`
+	FlowVersion    int32          `gorm:"column:flow_version"`
+	WorkflowID     string         `gorm:"column:workflow_id"`
+	Trigger        string         `gorm:"column:trigger"`
+	UserID         string         `gorm:"column:user_id"`
+	ReferenceID    string         `gorm:"column:reference_id"`
+	Event          datatypes.JSON `gorm:"column:event"`   // trigger attributes
+	Trace          datatypes.JSON `gorm:"column:trace"`   // serialized []*TraceStep
+	Actions        datatypes.JSON `gorm:"column:actions"` // serialized []*NodeAction
+	Points         int64          `gorm:"column:points"`
+	LedgerEntryIDs datatypes.JSON `gorm:"column:ledger_entry_ids"` // serialized []string
+	Status         string         `gorm:"column:status"`
+	Error          string         `gorm:"column:error"`
+	SkipReason     string         `gorm:"column:skip_reason"`
+	DurationMs     int64          `gorm:"column:duration_ms"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+type FlowExecutionParams struct {
+	OrganizationID string
+	FlowID         string
+	FlowVersion    int32
+	WorkflowID     string
+	Trigger        string
+	UserID         string
+	ReferenceID    string
+	Event          map[string]any
+}
+
+func NewFlowExecution(p FlowExecutionParams) *FlowExecution {
+	event, _ := json.Marshal(p.Event)
+
+	return &FlowExecution{
+		ID:             uuid.NewString(),
+		OrganizationID: p.OrganizationID,
+		FlowID:         p.FlowID,
+		FlowVersion:    p.FlowVersion,
+		WorkflowID:     p.WorkflowID,
+		Trigger:        p.Trigger,
+		UserID:         p.UserID,
+		ReferenceID:    p.ReferenceID,
+		Event:          event,
+		Status:         ExecutionStatusEvaluated,
+	}
+}
+
+// Record stores the outcome of running the flow. A failed run keeps the trace up to
+// the node that failed.
+func (m *FlowExecution) Record(exec *Execution, err error, took time.Duration) {
+	m.DurationMs = took.Milliseconds()
+
+	if exec != nil {
+		m.Trace, _ = json.Marshal(exec.Trace)
+		m.Actions, _ = json.Marshal(exec.Actions)
+	}
+
+	if err != nil {
+		m.Fail(err.Error())
+	}
+}
+
+// Resume records a stage run after a wait: its trace and actions are appended to
+// those of the earlier stages.
+func (m *FlowExecution) Resume(exec *Execution, err error, took time.Duration) {
+	m.DurationMs += took.Milliseconds()
+
+	if exec != nil {
+		m.Trace, _ = json.Marshal(append(m.GetTrace(), exec.Trace...))
+		m.Actions, _ = json.Marshal(append(m.GetActions(), exec.Actions...))
+	}
+
+	if err != nil {
+		m.Fail(err.Error())
+	}
+}
+
+// Complete settles a stage of the record with the points its actions earned and the
+// ledger entry they were credited in. Stages add up; a ledger entry already recorded
+// isn't counted twice. A record with paths still waiting stays WAITING.
+func (m *FlowExecution) Complete(points int64, waiting bool, ledgerEntryIDs ...string) {
+	if m.Status == ExecutionStatusFailed || m.Status == ExecutionStatusCapped || m.Status == ExecutionStatusSuppressed {
+		return
+	}
+
+	ids := m.GetLedgerEntryIDs()
+	for _, id := range ledgerEntryIDs {
+		if slices.Contains(ids, id) {
+			return
+		}
+	}
+
+	m.Status, m.Points = ExecutionStatusCompleted, m.Points+points
+	if waiting {
+		m.Status = ExecutionStatusWaiting
+	}
+
+	if len(ledgerEntryIDs) > 0 {
+		m.LedgerEntryIDs, _ = json.Marshal(append(ids, ledgerEntryIDs...))
+	}
+}
+
+// Settled reports whether the record is in one of SettledExecutionStatuses.
+func (m *FlowExecution) Settled() bool {
+	return slices.Contains(SettledExecutionStatuses, m.Status)
+}
+
+// Cap records that the flow's frequency cap skipped the execution.
+func (m *FlowExecution) Cap(reason string) {
+	m.Status, m.SkipReason, m.Points = ExecutionStatusCapped, reason, 0
+}
+
+func (m *FlowExecution) Fail(reason string) {
+	m.Status, m.Error, m.Points = ExecutionStatusFailed, reason, 0
+}
+
+func (m *FlowExecution) GetTrace() []*TraceStep {
+	var trace []*TraceStep
+	if len(m.Trace) > 0 {
+		_ = json.Unmarshal(m.Trace, &trace)
+	}
+	return trace
+}
+
+func (m *FlowExecution) GetActions() []*NodeAction {
+	var actions []*NodeAction
+	if len(m.Actions) > 0 {
+		_ = json.Unmarshal(m.Actions, &actions)
+	}
+	return actions
+}
+
+func (m *FlowExecution) GetLedgerEntryIDs() []string {
+	var ids []string
+	if len(m.LedgerEntryIDs) > 0 {
+		_ = json.Unmarshal(m.LedgerEntryIDs, &ids)
+	}
+	return ids
+}
+
+func (m *FlowExecution) GetEvent() map[string]any {
+	var event map[string]any
+	if len(m.Event) > 0 {
+		_ = json.Unmarshal(m.Event, &event)
+	}
+	return event
+}
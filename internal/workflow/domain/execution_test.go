@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlowExecutionRecordsRun(t *testing.T) {
+	m := NewFlowExecution(FlowExecutionParams{FlowID: "flow-id", FlowVersion: 2, Event: map[string]any{"amount": 100}})
+
+	result := true
+	m.Record(&Execution{
+		Trace:   []*TraceStep{{NodeID: "cond", NodeType: "CONDITION", Result: &result}},
+		Actions: []*NodeAction{{Type: "REWARD_POINT", Parameters: []byte(`{}`)}},
+	}, nil, 15*time.Millisecond)
+
+	if m.Status != ExecutionStatusEvaluated || m.DurationMs != 15 {
+		t.Fatalf("unexpected record %+v", m)
+	}
+
+	if len(m.GetTrace()) != 1 || len(m.GetActions()) != 1 || m.GetEvent()["amount"] != float64(100) {
+		t.Fatalf("expected the run to be recorded, got %s %s %s", m.Trace, m.Actions, m.Event)
+	}
+
+	m.Complete(50, false, "entry-id")
+	if m.Status != ExecutionStatusCompleted || m.Points != 50 || m.GetLedgerEntryIDs()[0] != "entry-id" {
+		t.Fatalf("unexpected completed record %+v", m)
+	}
+}
+
+func TestFlowExecutionFailureSticks(t *testing.T) {
+	m := NewFlowExecution(FlowExecutionParams{FlowID: "flow-id"})
+	m.Record(nil, errors.New("no trigger node"), time.Millisecond)
+
+	if m.Status != ExecutionStatusFailed || m.Error != "no trigger node" {
+		t.Fatalf("unexpected record %+v", m)
+	}
+
+	m.Complete(50, false)
+	if m.Status != ExecutionStatusFailed || m.Points != 0 {
+		t.Fatalf("a failed execution must not complete, got %+v", m)
+	}
+}
+
+func TestFlowExecutionSettled(t *testing.T) {
+	m := NewFlowExecution(FlowExecutionParams{FlowID: "flow-id"})
+	m.Record(&Execution{}, nil, time.Millisecond)
+	if m.Settled() {
+		t.Fatalf("an %s record is still being applied", m.Status)
+	}
+
+	// A record waiting on a timer can't be purged, however old it is.
+	m.Complete(50, true)
+	if m.Settled() {
+		t.Fatalf("a %s record can still resume", m.Status)
+	}
+
+	m.Complete(20, false)
+	if !m.Settled() {
+		t.Fatalf("a %s record is settled", m.Status)
+	}
+
+	for _, status := range []string{ExecutionStatusFailed, ExecutionStatusCapped, ExecutionStatusSuppressed} {
+		if !(&FlowExecution{Status: status}).Settled() {
+			t.Fatalf("a %s record is settled", status)
+		}
+	}
+}
+
+func TestFlowBudget(t *testing.T) {
+	flow := &Flow{Budget: 1000, BudgetConsumed: 400}
+	if !flow.Budgeted() || flow.BudgetRemaining() != 600 {
+		t.Fatalf("remaining = %d, want 600", flow.BudgetRemaining())
+	}
+
+	flow.BudgetConsumed = 1200
+	if flow.BudgetRemaining() != 0 {
+		t.Fatalf("overspent budget has %d remaining, want 0", flow.BudgetRemaining())
+	}
+
+	if (&Flow{}).Budgeted() || len(ValidateBudget(-1)) != 1 || len(ValidateBudget(0)) != 0 {
+		t.Fatalf("unexpected budget checks")
+	}
+}
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+// Frequency cap periods. Windows are calendar periods in the flow's timezone; weeks
+// start on Monday.
+const (
+	CapLifetime = "LIFETIME"
+	CapDay      = "DAY"
+	CapWeek     = "WEEK"
+	CapMonth    = "MONTH"
+)
+
+// FrequencyCap limits how often a flow, or one of its actions, fires for a member:
+// at most Limit times per Period. On the trigger node it caps the flow, on an action
+// node that action.
+type FrequencyCap struct {
+	Limit  int    `json:"limit"`
+	Period string `json:"period"`
+}
+
+func validateCap(field string, c *FrequencyCap, report func(field, format string, args ...any)) {
+	if c == nil {
+		return
+	}
+
+	if c.Limit <= 0 {
+		report(field+".limit", "limit must be positive")
+	}
+
+	switch c.Period {
+	case CapLifetime, CapDay, CapWeek, CapMonth:
+	default:
+		report(field+".period", "unsupported period %q, use LIFETIME, DAY, WEEK or MONTH", c.Period)
+	}
+}
+
+// Window returns the window of the cap t falls in, read in loc, and when it ends.
+// A LIFETIME window never ends and its end is zero.
+func (c *FrequencyCap) Window(t time.Time, loc *time.Location) (string, time.Time) {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	switch c.Period {
+	case CapDay:
+		return day.Format("2006-01-02"), day.AddDate(0, 0, 1)
+	case CapWeek:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start.Format("2006-01-02") + "/P1W", start.AddDate(0, 0, 7)
+	case CapMonth:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start.Format("2006-01"), start.AddDate(0, 1, 0)
+	default:
+		return "lifetime", time.Time{}
+	}
+}
+
+// Reason says why a firing over the cap was skipped.
+func (c *FrequencyCap) Reason() string {
+	if c.Period == CapLifetime {
+		return fmt.Sprintf("frequency cap of %d per member reached", c.Limit)
+	}
+	return fmt.Sprintf("frequency cap of %d per member per %s reached", c.Limit, c.Period)
+}
+
+// FrequencyCap returns the cap on the flow; nil when it has none.
+func (m *Flow) FrequencyCap() *FrequencyCap {
+	node := m.triggerNode()
+	if node == nil || node.Trigger == nil {
+		return nil
+	}
+	return node.Trigger.Cap
+}
+
+// Location is the timezone of the flow's schedule, which its caps' windows follow.
+// Flows without one use UTC.
+func (m *Flow) Location() *time.Location {
+	if s := m.Schedule(); s != nil {
+		if loc, err := s.Location(); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// FrequencyUsage is one firing counted against a cap window. Member identifies the
+// firing, so a retried firing is counted once. The rows back the counters kept in
+// Redis and are purged once their window has ended.
+type FrequencyUsage struct {
+	ID             string     `gorm:"column:id;primaryKey"`
+	OrganizationID string     `gorm:"column:organization_id"`
+	UserID         string     `gorm:"column:user_id"`
+	CapKey         string     `gorm:"column:cap_key"`
+	Member         string     `gorm:"column:member"`
+	ExpiresAt      *time.Time `gorm:"column:expires_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+// CappedAction is an action of an execution that has a frequency cap.
+type CappedAction struct {
+	NodeID string
+	Cap    *FrequencyCap
+}
+
+// CappedActions returns the execution's actions that have a frequency cap.
+func (e *Execution) CappedActions() []CappedAction {
+	var capped []CappedAction
+	for i, step := range e.actionSteps() {
+		if i < len(e.Actions) && e.Actions[i].Cap != nil {
+			capped = append(capped, CappedAction{NodeID: step.NodeID, Cap: e.Actions[i].Cap})
+		}
+	}
+	return capped
+}
+
+// SkipAction drops the action of the node from the execution and records why on
+// its trace step.
+func (e *Execution) SkipAction(nodeID, reason string) {
+	for i, step := range e.actionSteps() {
+		if step.NodeID == nodeID {
+			step.Skipped = reason
+			e.Actions = append(e.Actions[:i:i], e.Actions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Skip drops everything the execution fired, as when its flow is capped or
+// suppressed: its actions, waits and split assignments. The trace is kept, with
+// every action step marked skipped.
+func (e *Execution) Skip(reason string) {
+	for _, step := range e.actionSteps() {
+		step.Skipped = reason
+	}
+	e.Actions, e.Waits, e.Assignments = nil, nil, nil
+}
+
+// Fired reports whether the execution fired an action or paused at a wait, which is
+// what a flow's cap counts.
+func (e *Execution) Fired() bool {
+	return len(e.Actions) > 0 || len(e.Waits) > 0
+}
+
+// actionSteps returns the trace steps of the actions still in Actions, in order.
+func (e *Execution) actionSteps() []*TraceStep {
+	var steps []*TraceStep
+	for _, step := range e.Trace {
+		if step.NodeType == workflowv1.NodeType_ACTION.String() && step.Skipped == "" {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
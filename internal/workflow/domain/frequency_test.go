@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func TestFrequencyCapWindow(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Thursday 2024-02-29 20:00 UTC is Friday 03:00 in Jakarta.
+	now := time.Date(2024, 2, 29, 20, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		period string
+		window string
+		end    time.Time
+	}{
+		{CapDay, "2024-03-01", time.Date(2024, 3, 2, 0, 0, 0, 0, jakarta)},
+		{CapWeek, "2024-02-26/P1W", time.Date(2024, 3, 4, 0, 0, 0, 0, jakarta)},
+		{CapMonth, "2024-03", time.Date(2024, 4, 1, 0, 0, 0, 0, jakarta)},
+		{CapLifetime, "lifetime", time.Time{}},
+	}
+
+	for _, c := range cases {
+		window, end := (&FrequencyCap{Limit: 1, Period: c.period}).Window(now, jakarta)
+		if window != c.window || !end.Equal(c.end) {
+			t.Fatalf("%s: window = %s ending %v, want %s ending %v", c.period, window, end, c.window, c.end)
+		}
+	}
+}
+
+func TestExecutionSkipsCappedActions(t *testing.T) {
+	capped := action("bonus", "REWARD_POINT")
+	capped.Action.Cap = &FrequencyCap{Limit: 1, Period: CapMonth}
+	g := graphOf([]*Node{trigger("start"), action("base", "REWARD_POINT"), capped},
+		edge("start", "base", ""), edge("start", "bonus", ""))
+
+	exec, err := g.Execute(map[string]any{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c := exec.CappedActions(); len(c) != 1 || c[0].NodeID != "bonus" {
+		t.Fatalf("capped actions = %+v, want bonus", c)
+	}
+
+	exec.SkipAction("bonus", "capped")
+	if len(exec.Actions) != 1 || exec.Actions[0].Cap != nil {
+		t.Fatalf("actions after skipping bonus = %+v", exec.Actions)
+	}
+
+	exec.Skip("flow capped")
+	if exec.Fired() {
+		t.Fatalf("capped execution still fires %+v", exec.Actions)
+	}
+
+	for _, step := range exec.Trace {
+		if step.NodeType == workflowv1.NodeType_ACTION.String() && step.Skipped == "" {
+			t.Fatalf("action step %s not marked skipped", step.NodeID)
+		}
+	}
+}
+
+func TestValidateGraphChecksCaps(t *testing.T) {
+	nodes := validNodes()
+	nodes[0].Trigger.Cap = &FrequencyCap{Limit: 0, Period: CapDay}
+	nodes[len(nodes)-1].Action.Cap = &FrequencyCap{Limit: 3, Period: "YEAR"}
+
+	details := ValidateGraph(nodes, validEdges())
+	if detailFor(details, "nodes[0].trigger.cap.limit") == "" {
+		t.Fatalf("zero limit not reported: %+v", details)
+	}
+	if detailFor(details, "nodes[3].action.cap.period") == "" {
+		t.Fatalf("unknown period not reported: %+v", details)
+	}
+}
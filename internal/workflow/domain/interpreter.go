@@ -0,0 +1,315 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/celengine"
+)
+
+// TraceStep records one node visited while executing a flow. Result is set for
+// CONDITION nodes only, Variant for SPLIT nodes only; Next lists the nodes the execution moved on to.
+type TraceStep struct {
+	NodeID     string   `json:"node_id"`
+	NodeType   string   `json:"node_type"`
+	Expression string   `json:"expression,omitempty"`
+	Result     *bool    `json:"result,omitempty"`
+	Variant    string   `json:"variant,omitempty"`
+	Skipped    string   `json:"skipped,omitempty"`
+	Next       []string `json:"next,omitempty"`
+}
+
+// Execution is what running a flow did. Waits are the paths paused at WAIT and
+// WAIT_FOR_EVENT nodes; each continues with Resume once its wait is over.
+// Assignments are the variants the SPLIT nodes on the path put the member in.
+type Execution struct {
+	Actions     []*NodeAction `json:"actions"`
+	Trace       []*TraceStep  `json:"trace"`
+	Waits       []*Wait       `json:"waits,omitempty"`
+	Assignments []*Assignment `json:"assignments,omitempty"`
+}
+
+// TriggerNode returns the graph's single TRIGGER node.
+func (g *FlowGraph) TriggerNode() (*Node, error) {
+	var trigger *Node
+	for _, n := range g.Nodes {
+		if n.Type != workflowv1.NodeType_TRIGGER {
+			continue
+		}
+
+		if trigger != nil {
+			return nil, fmt.Errorf("flow has more than one trigger node")
+		}
+		trigger = n
+	}
+
+	if trigger == nil {
+		return nil, fmt.Errorf("flow has no trigger node")
+	}
+
+	return trigger, nil
+}
+
+// edgeMatches reports whether an edge leaving a condition is taken for result.
+// Edge types are stored either as the enum name or without its prefix.
+func edgeMatches(edge *Edge, result bool) bool {
+	typ := strings.TrimPrefix(edge.Type, "EDGE_TYPE_")
+	if result {
+		return typ == "THEN"
+	}
+	return typ == "OTHERWISE"
+}
+
+type interpreter struct {
+	graph    *FlowGraph
+	trigger  string
+	eval     func(expr string) (bool, error)
+	now      time.Time
+	attrs    map[string]any
+	exec     *Execution
+	visited  map[string]bool
+	visiting map[string]bool
+}
+
+func (g *FlowGraph) interpreter(attrs map[string]any) (*interpreter, *Node, error) {
+	trigger, err := g.TriggerNode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &interpreter{
+		graph:    g,
+		trigger:  triggerKey(trigger),
+		eval:     evaluator(triggerKey(trigger), attrs),
+		now:      time.Now(),
+		attrs:    attrs,
+		exec:     &Execution{},
+		visited:  map[string]bool{},
+		visiting: map[string]bool{},
+	}, trigger, nil
+}
+
+// Execute runs the graph against the event attributes. It starts at the trigger,
+// evaluates every CONDITION it reaches and follows its THEN or OTHERWISE edges,
+// and collects the ACTION nodes on the taken paths in visiting order. A path stops
+// at a WAIT or WAIT_FOR_EVENT node and is returned as a wait. Nodes reached through
+// more than one path run once; a cycle is an error. A SPLIT follows the edges of the
+// member's variant, read from the user_id attribute.
+func (g *FlowGraph) Execute(attrs map[string]any) (*Execution, error) {
+	in, trigger, err := g.interpreter(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := in.visit(trigger); err != nil {
+		return nil, err
+	}
+
+	return in.exec, nil
+}
+
+// Resume continues an execution past the wait at nodeID with the same attributes.
+// received says whether a WAIT_FOR_EVENT got its event: THEN edges are taken if so,
+// OTHERWISE edges if it timed out. A WAIT follows all its edges.
+func (g *FlowGraph) Resume(attrs map[string]any, nodeID string, received bool) (*Execution, error) {
+	node, ok := g.Nodes[nodeID]
+	if !ok {
+		return nil, fmt.Errorf("wait node %s does not exist", nodeID)
+	}
+
+	in, _, err := g.interpreter(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	step := &TraceStep{NodeID: node.ID, NodeType: node.Type.String()}
+	in.exec.Trace = append(in.exec.Trace, step)
+	in.visited[node.ID] = true
+
+	edges := g.Edges[node.ID]
+	switch node.Type {
+	case workflowv1.NodeType_WAIT:
+
+	case workflowv1.NodeType_WAIT_FOR_EVENT:
+		step.Result = &received
+
+		var taken []*Edge
+		for _, e := range edges {
+			if edgeMatches(e, received) {
+				taken = append(taken, e)
+			}
+		}
+		edges = taken
+
+	default:
+		return nil, fmt.Errorf("node %s is not a wait node", node.ID)
+	}
+
+	if err := in.follow(step, edges); err != nil {
+		return nil, err
+	}
+
+	return in.exec, nil
+}
+
+func (in *interpreter) visit(node *Node) error {
+	if in.visiting[node.ID] {
+		return fmt.Errorf("flow has a cycle through node %s", node.ID)
+	}
+
+	if in.visited[node.ID] {
+		return nil
+	}
+
+	in.visiting[node.ID] = true
+	defer delete(in.visiting, node.ID)
+	in.visited[node.ID] = true
+
+	step := &TraceStep{NodeID: node.ID, NodeType: node.Type.String()}
+	in.exec.Trace = append(in.exec.Trace, step)
+
+	edges := in.graph.Edges[node.ID]
+
+	switch node.Type {
+	case workflowv1.NodeType_TRIGGER:
+
+	case workflowv1.NodeType_CONDITION:
+		result, expr, err := in.evaluate(node)
+		if err != nil {
+			return fmt.Errorf("condition node %s: %w", node.ID, err)
+		}
+		step.Expression, step.Result = expr, &result
+
+		var taken []*Edge
+		for _, e := range edges {
+			if edgeMatches(e, result) {
+				taken = append(taken, e)
+			}
+		}
+		edges = taken
+
+	case workflowv1.NodeType_ACTION:
+		if node.Action == nil {
+			return fmt.Errorf("action node %s has no action", node.ID)
+		}
+		in.exec.Actions = append(in.exec.Actions, node.Action)
+
+	case workflowv1.NodeType_SPLIT:
+		variant, err := in.assign(node)
+		if err != nil {
+			return err
+		}
+		step.Variant = variant
+
+		var taken []*Edge
+		for _, e := range edges {
+			if e.Type == variant {
+				taken = append(taken, e)
+			}
+		}
+		edges = taken
+
+	case workflowv1.NodeType_WAIT, workflowv1.NodeType_WAIT_FOR_EVENT:
+		wait, err := pause(node, in.attrs, in.now)
+		if err != nil {
+			return err
+		}
+
+		// A WAIT until a time already past doesn't pause.
+		if wait.ForEvent() || wait.Until.After(in.now) {
+			in.exec.Waits = append(in.exec.Waits, wait)
+			return nil
+		}
+
+	default:
+		return fmt.Errorf("node %s has unsupported type %s", node.ID, node.Type)
+	}
+
+	return in.follow(step, edges)
+}
+
+// follow visits the targets of the edges taken from step's node.
+func (in *interpreter) follow(step *TraceStep, edges []*Edge) error {
+	for _, e := range edges {
+		next, ok := in.graph.Nodes[e.Target]
+		if !ok {
+			return fmt.Errorf("edge %s points to unknown node %s", e.ID, e.Target)
+		}
+
+		step.Next = append(step.Next, next.ID)
+		if err := in.visit(next); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assign puts the member in a variant of the split and records the assignment.
+func (in *interpreter) assign(node *Node) (string, error) {
+	if node.Split == nil {
+		return "", fmt.Errorf("split node %s has no split", node.ID)
+	}
+
+	member, _ := in.attrs["user_id"].(string)
+	if member == "" {
+		return "", fmt.Errorf("split node %s: attribute user_id is missing", node.ID)
+	}
+
+	variant := node.Split.Assign(node.ID, member)
+	in.exec.Assignments = append(in.exec.Assignments, &Assignment{
+		NodeID:     node.ID,
+		Experiment: node.Split.experiment(node.ID),
+		Variant:    variant,
+	})
+
+	return variant, nil
+}
+
+func triggerKey(node *Node) string {
+	if node.Trigger == nil {
+		return ""
+	}
+	return node.Trigger.Key
+}
+
+// evaluator evaluates conditions against the trigger's attribute schema. A trigger
+// without a schema can't have its conditions typed, so they fail with an unknown
+// trigger schema error; flows of such a trigger only run unconditional paths.
+func evaluator(trigger string, attrs map[string]any) func(expr string) (bool, error) {
+	schema, err := celengine.SchemaFor(trigger)
+	if err != nil {
+		return func(string) (bool, error) {
+			return false, fmt.Errorf("unknown trigger schema: %w", err)
+		}
+	}
+
+	return func(expr string) (bool, error) { return schema.Evaluate(expr, attrs) }
+}
+
+// evaluate runs the condition's compiled expression, generating it from the
+// structured conditions when the node was stored without one. An empty
+// condition passes.
+func (in *interpreter) evaluate(node *Node) (bool, string, error) {
+	if node.Condition == nil {
+		return true, "", nil
+	}
+
+	expr := node.Condition.Expression
+	if expr == "" && len(node.Condition.Conditions) > 0 {
+		generated, err := compileConditions(in.trigger, node.Condition.Conditions)
+		if err != nil {
+			return false, "", err
+		}
+		expr = generated
+	}
+
+	if expr == "" {
+		return true, "", nil
+	}
+
+	result, err := in.eval(expr)
+	return result, expr, err
+}
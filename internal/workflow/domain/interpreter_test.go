@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func trigger(id string) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_TRIGGER, Trigger: &NodeTrigger{Key: "TRANSACTION"}}
+}
+
+func condition(id, expr string) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_CONDITION, Condition: &NodeCondition{Expression: expr}}
+}
+
+func action(id, typ string) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_ACTION, Action: &NodeAction{Type: typ}}
+}
+
+func graphOf(nodes []*Node, edges ...*Edge) *FlowGraph {
+	g := &FlowGraph{Nodes: map[string]*Node{}, Edges: map[string][]*Edge{}}
+	for _, n := range nodes {
+		g.Nodes[n.ID] = n
+	}
+	for _, e := range edges {
+		g.Edges[e.Source] = append(g.Edges[e.Source], e)
+	}
+	return g
+}
+
+func edge(source, target, typ string) *Edge {
+	return &Edge{ID: source + "-" + target, Type: typ, Source: source, Target: target}
+}
+
+// tieredGraph rewards GOLD members over 100 with a bonus, anyone else over 100
+// with base points, and nothing otherwise.
+func tieredGraph() *FlowGraph {
+	return graphOf(
+		[]*Node{
+			trigger("start"),
+			condition("big", "amount > 100"),
+			condition("gold", `customer.tier == "GOLD"`),
+			action("bonus", "REWARD_POINT_BONUS"),
+			action("base", "REWARD_POINT"),
+			action("notify", "NOTIFY"),
+		},
+		edge("start", "big", ""),
+		edge("big", "gold", "EDGE_TYPE_THEN"),
+		edge("gold", "bonus", "EDGE_TYPE_THEN"),
+		edge("gold", "base", "OTHERWISE"),
+		edge("bonus", "notify", ""),
+	)
+}
+
+func actionTypes(exec *Execution) string {
+	var types []string
+	for _, a := range exec.Actions {
+		types = append(types, a.Type)
+	}
+	return strings.Join(types, ",")
+}
+
+func TestExecuteFollowsConditionResults(t *testing.T) {
+	cases := []struct {
+		name    string
+		attrs   map[string]any
+		actions string
+		trace   int
+	}{
+		{"gold member", map[string]any{"amount": 150, "customer": map[string]any{"tier": "GOLD"}}, "REWARD_POINT_BONUS,NOTIFY", 5},
+		{"silver member", map[string]any{"amount": 150, "customer": map[string]any{"tier": "SILVER"}}, "REWARD_POINT", 4},
+		{"small purchase", map[string]any{"amount": 50, "customer": map[string]any{"tier": "GOLD"}}, "", 2},
+	}
+
+	for _, c := range cases {
+		exec, err := tieredGraph().Execute(c.attrs)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+
+		if got := actionTypes(exec); got != c.actions {
+			t.Fatalf("%s: expected actions %q, got %q", c.name, c.actions, got)
+		}
+
+		if len(exec.Trace) != c.trace {
+			t.Fatalf("%s: expected %d trace steps, got %d", c.name, c.trace, len(exec.Trace))
+		}
+	}
+}
+
+func TestExecuteTraceRecordsConditionResults(t *testing.T) {
+	exec, err := tieredGraph().Execute(map[string]any{"amount": 150, "customer": map[string]any{"tier": "SILVER"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		node   string
+		result *bool
+		next   string
+	}{
+		{"start", nil, "big"},
+		{"big", boolPtr(true), "gold"},
+		{"gold", boolPtr(false), "base"},
+		{"base", nil, ""},
+	}
+
+	for i, w := range want {
+		step := exec.Trace[i]
+		if step.NodeID != w.node || strings.Join(step.Next, ",") != w.next {
+			t.Fatalf("step %d: unexpected %+v", i, step)
+		}
+
+		if (w.result == nil) != (step.Result == nil) || (w.result != nil && *w.result != *step.Result) {
+			t.Fatalf("step %d: expected result %v, got %v", i, w.result, step.Result)
+		}
+	}
+
+	if exec.Trace[1].Expression != "amount > 100" {
+		t.Fatalf("expected expression in trace, got %q", exec.Trace[1].Expression)
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestExecuteGeneratesExpressionFromConditions(t *testing.T) {
+	cond := &Node{ID: "cond", Type: workflowv1.NodeType_CONDITION, Condition: &NodeCondition{
+		Conditions: []*Condition{{Field: "channel", Operator: "==", Value: structpb.NewStringValue("POS")}},
+	}}
+
+	g := graphOf(
+		[]*Node{trigger("start"), cond, action("reward", "REWARD_POINT")},
+		edge("start", "cond", ""),
+		edge("cond", "reward", "EDGE_TYPE_THEN"),
+	)
+
+	exec, err := g.Execute(map[string]any{"channel": "POS"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actionTypes(exec) != "REWARD_POINT" {
+		t.Fatalf("expected reward, got %q", actionTypes(exec))
+	}
+}
+
+func TestExecuteRunsMergedNodesOnce(t *testing.T) {
+	g := graphOf(
+		[]*Node{trigger("start"), action("a", "A"), action("b", "B"), action("done", "DONE")},
+		edge("start", "a", ""),
+		edge("start", "b", ""),
+		edge("a", "done", ""),
+		edge("b", "done", ""),
+	)
+
+	exec, err := g.Execute(map[string]any{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := actionTypes(exec); got != "A,DONE,B" {
+		t.Fatalf("unexpected actions %q", got)
+	}
+}
+
+func TestExecuteRejectsInvalidGraphs(t *testing.T) {
+	cases := []struct {
+		name  string
+		graph *FlowGraph
+		err   string
+	}{
+		{"no trigger", graphOf([]*Node{action("a", "A")}), "no trigger"},
+		{"two triggers", graphOf([]*Node{trigger("t1"), trigger("t2")}), "more than one trigger"},
+		{
+			"cycle",
+			graphOf([]*Node{trigger("start"), action("a", "A"), action("b", "B")},
+				edge("start", "a", ""), edge("a", "b", ""), edge("b", "a", "")),
+			"cycle",
+		},
+		{
+			"dangling edge",
+			graphOf([]*Node{trigger("start")}, edge("start", "missing", "")),
+			"unknown node",
+		},
+		{
+			"non boolean condition",
+			graphOf([]*Node{trigger("start"), condition("c", "amount + 1")}, edge("start", "c", "")),
+			"condition node c",
+		},
+		{
+			"condition of a trigger without schema",
+			graphOf([]*Node{
+				{ID: "start", Type: workflowv1.NodeType_TRIGGER, Trigger: &NodeTrigger{Key: "CUSTOM"}},
+				condition("c", "amount > 0"),
+			}, edge("start", "c", "")),
+			"unknown trigger schema",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := c.graph.Execute(map[string]any{"amount": 1})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%s: expected error containing %q, got %v", c.name, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+var (
+	statusActive   = workflowv1.FlowStatus_ACTIVE.String()
+	statusInactive = workflowv1.FlowStatus_INACTIVE.String()
+	statusPaused   = workflowv1.FlowStatus_PAUSED.String()
+	statusArchived = workflowv1.FlowStatus_ARCHIVED.String()
+)
+
+// flowTransitions are the statuses a flow may move to from each status. ARCHIVED is
+// final: an archived flow can only be cloned or deleted.
+var flowTransitions = map[string][]string{
+	statusActive:   {statusPaused, statusInactive, statusArchived},
+	statusPaused:   {statusActive, statusInactive, statusArchived},
+	statusInactive: {statusActive, statusArchived},
+	statusArchived: {},
+}
+
+// Transition moves the flow to status, if the lifecycle allows it. A flow only goes
+// ACTIVE with a published version to run and, when it has a budget, budget left.
+func (m *Flow) Transition(status string) error {
+	if !slices.Contains(flowTransitions[m.Status], status) {
+		return fmt.Errorf("a %s flow can't become %s", strings.ToLower(m.Status), strings.ToLower(status))
+	}
+
+	if status == statusActive {
+		if m.Version == 0 {
+			return fmt.Errorf("flow has no published version to run")
+		}
+
+		if m.Budgeted() && m.BudgetRemaining() == 0 {
+			return fmt.Errorf("flow's budget is exhausted, raise it before resuming the flow")
+		}
+	}
+
+	m.Status = status
+	return nil
+}
+
+// Archived reports whether the flow was archived.
+func (m *Flow) Archived() bool {
+	return m.Status == statusArchived
+}
+
+// Editable refuses changes to an archived flow: its settings, its draft and what it
+// runs are frozen.
+func (m *Flow) Editable() error {
+	if m.Archived() {
+		return fmt.Errorf("an archived flow can't be changed, clone it instead")
+	}
+	return nil
+}
+
+// Clone returns a new INACTIVE flow with the settings of the flow, named name, and
+// graph as its graph to be saved as the clone's draft. The clone has no live version
+// and nothing of the budget consumed.
+func (m *Flow) Clone(name string, graph *Flow) (*Flow, *Flow) {
+	clone := NewFlow(FlowParams{OrganizationID: m.OrganizationID, Name: name})
+	clone.Description = m.Description
+	clone.Status = statusInactive
+	clone.Trigger = graph.Trigger
+	clone.Priority, clone.ExclusiveGroup, clone.Budget = m.Priority, m.ExclusiveGroup, m.Budget
+	clone.Nodes, clone.Edges, clone.Overflow = []byte(`[]`), []byte(`[]`), []byte(`{}`)
+
+	return clone, &Flow{
+		ID:             clone.ID,
+		OrganizationID: m.OrganizationID,
+		Trigger:        graph.Trigger,
+		Nodes:          graph.Nodes,
+		Edges:          graph.Edges,
+		Overflow:       graph.Overflow,
+	}
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func TestFlowTransition(t *testing.T) {
+	active, inactive := workflowv1.FlowStatus_ACTIVE.String(), workflowv1.FlowStatus_INACTIVE.String()
+	paused, archived := workflowv1.FlowStatus_PAUSED.String(), workflowv1.FlowStatus_ARCHIVED.String()
+
+	cases := []struct {
+		from, to string
+		ok       bool
+	}{
+		{active, paused, true},
+		{active, archived, true},
+		{paused, active, true},
+		{paused, inactive, true},
+		{inactive, active, true},
+		{inactive, paused, false},
+		{archived, active, false},
+		{archived, inactive, false},
+		{active, active, false},
+	}
+
+	for _, c := range cases {
+		flow := &Flow{Status: c.from, Version: 1}
+		err := flow.Transition(c.to)
+		if (err == nil) != c.ok {
+			t.Fatalf("%s -> %s: err = %v, want allowed %v", c.from, c.to, err, c.ok)
+		}
+
+		want := c.from
+		if c.ok {
+			want = c.to
+		}
+		if flow.Status != want {
+			t.Fatalf("%s -> %s: status = %s, want %s", c.from, c.to, flow.Status, want)
+		}
+	}
+}
+
+func TestFlowEditable(t *testing.T) {
+	for _, status := range []string{workflowv1.FlowStatus_ACTIVE.String(), workflowv1.FlowStatus_PAUSED.String(), workflowv1.FlowStatus_INACTIVE.String()} {
+		if err := (&Flow{Status: status}).Editable(); err != nil {
+			t.Fatalf("%s flow can't be edited: %v", status, err)
+		}
+	}
+
+	archived := &Flow{Status: workflowv1.FlowStatus_ARCHIVED.String(), Version: 1}
+	if err := archived.Editable(); err == nil {
+		t.Fatalf("archived flow can be edited")
+	}
+}
+
+func TestFlowResumeNeedsVersionAndBudget(t *testing.T) {
+	paused := workflowv1.FlowStatus_PAUSED.String()
+
+	if err := (&Flow{Status: paused}).Transition(workflowv1.FlowStatus_ACTIVE.String()); err == nil {
+		t.Fatalf("flow without a published version resumed")
+	}
+
+	spent := &Flow{Status: paused, Version: 2, Budget: 1000, BudgetConsumed: 1000}
+	if err := spent.Transition(workflowv1.FlowStatus_ACTIVE.String()); err == nil {
+		t.Fatalf("flow with an exhausted budget resumed")
+	}
+
+	spent.Budget = 2000
+	if err := spent.Transition(workflowv1.FlowStatus_ACTIVE.String()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFlowClone(t *testing.T) {
+	flow := &Flow{
+		ID:             "flow-id",
+		OrganizationID: "org-id",
+		Status:         workflowv1.FlowStatus_ARCHIVED.String(),
+		Version:        3,
+		Priority:       4,
+		Budget:         500,
+		BudgetConsumed: 300,
+	}
+	draft := &Flow{Trigger: "TRANSACTION", Nodes: []byte(`[{"id":"start"}]`), Edges: []byte(`[]`)}
+
+	clone, graph := flow.Clone("Copy", draft)
+	if clone.ID == flow.ID || graph.ID != clone.ID {
+		t.Fatalf("clone %s, graph %s, want a new ID shared by both", clone.ID, graph.ID)
+	}
+	if clone.Status != workflowv1.FlowStatus_INACTIVE.String() || clone.Version != 0 {
+		t.Fatalf("clone is %s at version %d, want INACTIVE without a live version", clone.Status, clone.Version)
+	}
+	if clone.Budget != 500 || clone.BudgetConsumed != 0 || clone.Priority != 4 {
+		t.Fatalf("clone = %+v, want the settings without the consumed budget", clone)
+	}
+	if clone.Trigger != "TRANSACTION" || string(graph.Nodes) != string(draft.Nodes) {
+		t.Fatalf("graph = %+v, want the draft's", graph)
+	}
+}
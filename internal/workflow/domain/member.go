@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// MemberProfile is what scheduled flows know about a member: the dates relative
+// triggers fire on and the customer attributes last seen on the member's events.
+// The month-day keys (month*100+day) let a day's birthdays be looked up directly.
+// Tags, Properties and Tier are set by flow actions.
+type MemberProfile struct {
+	ID             string         `gorm:"column:id;primaryKey"`
+	OrganizationID string         `gorm:"column:organization_id"`
+	UserID         string         `gorm:"column:user_id"`
+	BirthDate      *time.Time     `gorm:"column:birth_date"`
+	BirthKey       int            `gorm:"column:birth_key"`
+	JoinedAt       *time.Time     `gorm:"column:joined_at"`
+	JoinedKey      int            `gorm:"column:joined_key"`
+	Customer       datatypes.JSON `gorm:"column:customer"`   // customer.* attributes
+	Tags           datatypes.JSON `gorm:"column:tags"`       // []string
+	Properties     datatypes.JSON `gorm:"column:properties"` // map[string]any
+	Tier           string         `gorm:"column:tier"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+// ProfileFromEvent picks the member's profile out of a trigger event. It returns nil
+// when the event has no user or nothing to remember.
+func ProfileFromEvent(event *TriggerEvent) *MemberProfile {
+	if event.UserID == "" {
+		return nil
+	}
+
+	m := &MemberProfile{
+		ID:             uuid.NewString(),
+		OrganizationID: event.OrganizationID,
+		UserID:         event.UserID,
+	}
+
+	customer, _ := event.Attributes["customer"].(map[string]any)
+	if len(customer) > 0 {
+		m.Customer, _ = json.Marshal(customer)
+	}
+
+	if t, ok := parseDate(event.Attributes["birth_date"]); ok {
+		m.SetBirthDate(t)
+	}
+
+	if t, ok := parseDate(customer["joined_at"]); ok {
+		m.SetJoinedAt(t)
+	} else if t, ok := parseDate(event.Attributes["signed_up_at"]); ok {
+		m.SetJoinedAt(t)
+	}
+
+	if m.Customer == nil && m.BirthDate == nil && m.JoinedAt == nil {
+		return nil
+	}
+
+	return m
+}
+
+func parseDate(v any) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+
+	t, err := time.Parse(windowDay, s)
+	return t, err == nil
+}
+
+func (m *MemberProfile) SetBirthDate(t time.Time) {
+	m.BirthDate, m.BirthKey = &t, dateKey(t)
+}
+
+func (m *MemberProfile) SetJoinedAt(t time.Time) {
+	m.JoinedAt, m.JoinedKey = &t, dateKey(t)
+}
+
+// Updates returns the columns of the profile to write over a stored one. What the
+// event didn't carry is left as stored.
+func (m *MemberProfile) Updates() map[string]any {
+	updates := map[string]any{}
+	if m.BirthDate != nil {
+		updates["birth_date"], updates["birth_key"] = m.BirthDate, m.BirthKey
+	}
+	if m.JoinedAt != nil {
+		updates["joined_at"], updates["joined_key"] = m.JoinedAt, m.JoinedKey
+	}
+	if m.Customer != nil {
+		updates["customer"] = m.Customer
+	}
+	return updates
+}
+
+// Attributes are the attributes a scheduled trigger runs the member's flows with.
+// on is the day the member's date falls on, firedAt when the schedule fired.
+func (m *MemberProfile) Attributes(trigger string, on, firedAt time.Time) map[string]any {
+	attrs := map[string]any{"user_id": m.UserID}
+
+	if len(m.Customer) > 0 {
+		var customer map[string]any
+		if err := json.Unmarshal(m.Customer, &customer); err == nil {
+			attrs["customer"] = customer
+		}
+	}
+
+	switch trigger {
+	case TriggerBirthday:
+		if m.BirthDate != nil {
+			attrs["birth_date"] = m.BirthDate.Format(time.RFC3339)
+			attrs["age"] = int64(on.Year() - m.BirthDate.Year())
+		}
+	case TriggerAnniversary:
+		if m.JoinedAt != nil {
+			attrs["joined_at"] = m.JoinedAt.Format(time.RFC3339)
+			attrs["years"] = int64(on.Year() - m.JoinedAt.Year())
+		}
+	case TriggerSchedule:
+		attrs["fired_at"] = firedAt.Format(time.RFC3339)
+	}
+
+	return attrs
+}
+
+// NewMemberProfile starts the profile of a member no event has been seen for yet.
+func NewMemberProfile(orgID, userID string) *MemberProfile {
+	return &MemberProfile{
+		ID:             uuid.NewString(),
+		OrganizationID: orgID,
+		UserID:         userID,
+	}
+}
+
+func (m *MemberProfile) GetTags() []string {
+	var tags []string
+	if len(m.Tags) > 0 {
+		_ = json.Unmarshal(m.Tags, &tags)
+	}
+	return tags
+}
+
+// Tag adds the tag to the member, or takes it off with remove. It reports whether
+// the tags changed.
+func (m *MemberProfile) Tag(tag string, remove bool) bool {
+	tags := m.GetTags()
+	i := slices.Index(tags, tag)
+
+	switch {
+	case remove && i >= 0:
+		tags = slices.Delete(tags, i, i+1)
+	case !remove && i < 0:
+		tags = append(tags, tag)
+	default:
+		return false
+	}
+
+	m.Tags, _ = json.Marshal(tags)
+	return true
+}
+
+func (m *MemberProfile) GetProperties() map[string]any {
+	properties := map[string]any{}
+	if len(m.Properties) > 0 {
+		_ = json.Unmarshal(m.Properties, &properties)
+	}
+	return properties
+}
+
+func (m *MemberProfile) SetProperty(key string, value any) {
+	properties := m.GetProperties()
+	properties[key] = value
+	m.Properties, _ = json.Marshal(properties)
+}
+
+// UpgradeTier moves the member to tier when their tier is one of from, or always
+// when from is empty. It reports whether the tier changed.
+func (m *MemberProfile) UpgradeTier(tier string, from []string) bool {
+	if m.Tier == tier || (len(from) > 0 && !slices.Contains(from, m.Tier)) {
+		return false
+	}
+
+	m.Tier = tier
+	return true
+}
@@ -0,0 +1,282 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+)
+
+// Scheduled triggers fire on their schedule instead of on events. BIRTHDAY and
+// ANNIVERSARY fire for the members whose date comes up, SCHEDULE for every member.
+const (
+	TriggerSchedule    = "SCHEDULE"
+	TriggerBirthday    = "BIRTHDAY"
+	TriggerAnniversary = "ANNIVERSARY"
+)
+
+// DefaultScheduleCron is when a scheduled flow without a cron fires: 09:00 local time.
+const DefaultScheduleCron = "0 9 * * *"
+
+var scheduledTriggers = []string{TriggerSchedule, TriggerBirthday, TriggerAnniversary}
+
+// ScheduledTriggers lists the triggers that fire on a schedule.
+func ScheduledTriggers() []string {
+	return scheduledTriggers
+}
+
+func IsScheduledTrigger(key string) bool {
+	for _, t := range scheduledTriggers {
+		if t == key {
+			return true
+		}
+	}
+	return false
+}
+
+func isRelativeTrigger(key string) bool {
+	return key == TriggerBirthday || key == TriggerAnniversary
+}
+
+// Window bounds are local times in the schedule's timezone, either a minute or a
+// whole day; a day-only end includes that day.
+const (
+	windowMinute = "2006-01-02T15:04"
+	windowDay    = "2006-01-02"
+)
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule says when a trigger fires. Cron applies to scheduled triggers and is read
+// in Timezone. OffsetDays moves a BIRTHDAY or ANNIVERSARY relative to the member's
+// date, e.g. -7 fires a week before. StartAt and EndAt bound the campaign window of
+// any trigger; outside it the flow doesn't run.
+//
+// Timezone is resolved when the flow is saved, from LocationID or the organization.
+type Schedule struct {
+	Cron       string `json:"cron,omitempty"`
+	OffsetDays int    `json:"offset_days,omitempty"`
+	StartAt    string `json:"start_at,omitempty"`
+	EndAt      string `json:"end_at,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+	LocationID string `json:"location_id,omitempty"`
+}
+
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+func (s *Schedule) spec() string {
+	if s.Cron == "" {
+		return DefaultScheduleCron
+	}
+	return s.Cron
+}
+
+// window returns the campaign window in loc. A zero bound leaves that side open.
+func (s *Schedule) window(loc *time.Location) (start, end time.Time, err error) {
+	if s.StartAt != "" {
+		if start, err = parseWindow(s.StartAt, loc, false); err != nil {
+			return start, end, err
+		}
+	}
+
+	if s.EndAt != "" {
+		if end, err = parseWindow(s.EndAt, loc, true); err != nil {
+			return start, end, err
+		}
+	}
+
+	return start, end, nil
+}
+
+func parseWindow(value string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(windowMinute, value, loc); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(windowDay, value, loc)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither %s nor %s", value, windowDay, windowMinute)
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Active reports whether t falls in the campaign window.
+func (s *Schedule) Active(t time.Time) bool {
+	loc, err := s.Location()
+	if err != nil {
+		return false
+	}
+
+	start, end, err := s.window(loc)
+	if err != nil {
+		return false
+	}
+
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+}
+
+// Due reports whether the schedule fires in the minute starting at minute.
+func (s *Schedule) Due(minute time.Time) bool {
+	loc, err := s.Location()
+	if err != nil {
+		return false
+	}
+
+	sched, err := cronParser.Parse(s.spec())
+	if err != nil {
+		return false
+	}
+
+	local := minute.In(loc).Truncate(time.Minute)
+	return sched.Next(local.Add(-time.Second)).Equal(local) && s.Active(local)
+}
+
+// DateKeys returns the month-day keys of the member dates the schedule fires for on
+// the local day of t. Leap-day dates come up on the 28th of February in other years.
+func (s *Schedule) DateKeys(t time.Time) []int {
+	loc, err := s.Location()
+	if err != nil {
+		loc = time.UTC
+	}
+
+	target := t.In(loc).AddDate(0, 0, -s.OffsetDays)
+	keys := []int{dateKey(target)}
+
+	if target.Month() == time.February && target.Day() == 28 && !isLeap(target.Year()) {
+		keys = append(keys, 229)
+	}
+
+	return keys
+}
+
+// Occurrence is the local day of t the schedule's member dates fall on.
+func (s *Schedule) Occurrence(t time.Time) time.Time {
+	loc, err := s.Location()
+	if err != nil {
+		loc = time.UTC
+	}
+
+	target := t.In(loc).AddDate(0, 0, -s.OffsetDays)
+	return time.Date(target.Year(), target.Month(), target.Day(), 0, 0, 0, 0, loc)
+}
+
+func dateKey(t time.Time) int {
+	return int(t.Month())*100 + t.Day()
+}
+
+func isLeap(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+func (s *Schedule) validate(trigger string) []errutil.Detail {
+	var details []errutil.Detail
+	report := func(field, format string, args ...any) {
+		details = append(details, errutil.Detail{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Cron != "" {
+		if !IsScheduledTrigger(trigger) {
+			report("cron", "cron only applies to scheduled triggers")
+		} else if _, err := cronParser.Parse(s.Cron); err != nil {
+			report("cron", "invalid cron expression: %s", err.Error())
+		}
+	}
+
+	if s.OffsetDays != 0 && !isRelativeTrigger(trigger) {
+		report("offset_days", "offset_days only applies to %s and %s triggers", TriggerBirthday, TriggerAnniversary)
+	}
+
+	if s.OffsetDays < -365 || s.OffsetDays > 365 {
+		report("offset_days", "offset_days must be within a year")
+	}
+
+	loc, err := s.Location()
+	if err != nil {
+		report("timezone", "unknown timezone %s", s.Timezone)
+		return details
+	}
+
+	start, end, err := s.window(loc)
+	if err != nil {
+		report("start_at", "%s", err.Error())
+		return details
+	}
+
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		report("end_at", "end_at must be after start_at")
+	}
+
+	return details
+}
+
+// Schedule returns the schedule of the flow's trigger; nil when it has none. A
+// scheduled trigger without one fires on the default schedule.
+func (m *Flow) Schedule() *Schedule {
+	node := m.triggerNode()
+	if node == nil || node.Trigger == nil {
+		return nil
+	}
+
+	if node.Trigger.Schedule == nil && IsScheduledTrigger(node.Trigger.Key) {
+		return &Schedule{}
+	}
+
+	return node.Trigger.Schedule
+}
+
+// SetScheduleTimezone sets the timezone of the trigger's schedule when it has none.
+func (m *Flow) SetScheduleTimezone(tz string) error {
+	var nodes []*Node
+	if err := json.Unmarshal(m.Nodes, &nodes); err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if n.Type != workflowv1.NodeType_TRIGGER || n.Trigger == nil {
+			continue
+		}
+
+		if n.Trigger.Schedule == nil {
+			n.Trigger.Schedule = &Schedule{}
+		}
+
+		if n.Trigger.Schedule.Timezone == "" {
+			n.Trigger.Schedule.Timezone = tz
+		}
+	}
+
+	b, err := json.Marshal(nodes)
+	if err != nil {
+		return err
+	}
+
+	m.Nodes = b
+	return nil
+}
+
+func (m *Flow) triggerNode() *Node {
+	var nodes []*Node
+	if err := json.Unmarshal(m.Nodes, &nodes); err != nil {
+		return nil
+	}
+
+	for _, n := range nodes {
+		if n.Type == workflowv1.NodeType_TRIGGER {
+			return n
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func TestScheduleDueInTimezone(t *testing.T) {
+	s := &Schedule{Cron: "0 9 * * *", Timezone: "Asia/Jakarta"}
+
+	// 09:00 in Jakarta is 02:00 UTC.
+	if !s.Due(time.Date(2026, 10, 18, 2, 0, 30, 0, time.UTC)) {
+		t.Fatalf("expected the schedule to be due at 09:00 local time")
+	}
+
+	if s.Due(time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the schedule not to be due at 09:00 UTC")
+	}
+}
+
+func TestScheduleWindow(t *testing.T) {
+	s := &Schedule{StartAt: "2026-10-23T18:00", EndAt: "2026-10-25", Timezone: "Asia/Jakarta"}
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+
+	cases := map[time.Time]bool{
+		time.Date(2026, 10, 23, 17, 59, 0, 0, loc): false,
+		time.Date(2026, 10, 23, 18, 0, 0, 0, loc):  true,
+		time.Date(2026, 10, 25, 23, 59, 0, 0, loc): true,
+		time.Date(2026, 10, 26, 0, 0, 0, 0, loc):   false,
+	}
+	for at, want := range cases {
+		if got := s.Active(at); got != want {
+			t.Fatalf("Active(%s) = %v, want %v", at, got, want)
+		}
+	}
+
+	if !s.Due(time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the default schedule to be due inside the window")
+	}
+
+	if s.Due(time.Date(2026, 10, 27, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the schedule not to be due after the window")
+	}
+}
+
+func TestScheduleDateKeys(t *testing.T) {
+	week := &Schedule{OffsetDays: -7}
+	if keys := week.DateKeys(time.Date(2026, 12, 28, 9, 0, 0, 0, time.UTC)); !slices.Equal(keys, []int{104}) {
+		t.Fatalf("expected birthdays a week later, got %v", keys)
+	}
+
+	// 2027 isn't a leap year, so leap-day birthdays come up on the 28th.
+	if keys := (&Schedule{}).DateKeys(time.Date(2027, 2, 28, 9, 0, 0, 0, time.UTC)); !slices.Equal(keys, []int{228, 229}) {
+		t.Fatalf("expected leap-day birthdays on the 28th, got %v", keys)
+	}
+}
+
+func TestValidateGraphChecksSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		trigger  string
+		schedule *Schedule
+		field    string
+	}{
+		{"bad cron", TriggerBirthday, &Schedule{Cron: "every day"}, "nodes[0].trigger.schedule.cron"},
+		{"cron on event trigger", "TRANSACTION", &Schedule{Cron: "0 9 * * *"}, "nodes[0].trigger.schedule.cron"},
+		{"offset on schedule", TriggerSchedule, &Schedule{OffsetDays: 3}, "nodes[0].trigger.schedule.offset_days"},
+		{"unknown timezone", TriggerBirthday, &Schedule{Timezone: "Mars/Olympus"}, "nodes[0].trigger.schedule.timezone"},
+		{"inverted window", "TRANSACTION", &Schedule{StartAt: "2026-10-25", EndAt: "2026-10-23"}, "nodes[0].trigger.schedule.end_at"},
+	}
+
+	for _, c := range cases {
+		nodes := validNodes()
+		nodes[0].Trigger = &NodeTrigger{Key: c.trigger, Schedule: c.schedule}
+
+		if msg := detailFor(ValidateGraph(nodes, validEdges()), c.field); msg == "" {
+			t.Fatalf("%s: expected a detail for %s", c.name, c.field)
+		}
+	}
+
+	nodes := validNodes()
+	nodes[0].Trigger = &NodeTrigger{Key: TriggerBirthday, Schedule: &Schedule{Cron: "0 8 * * *", OffsetDays: -7, Timezone: "Asia/Jakarta"}}
+	if details := ValidateGraph(nodes, validEdges()); len(details) != 0 {
+		t.Fatalf("unexpected details %+v", details)
+	}
+}
+
+func TestFlowScheduleTimezone(t *testing.T) {
+	nodes, _ := json.Marshal([]*Node{{ID: "start", Type: workflowv1.NodeType_TRIGGER, Trigger: &NodeTrigger{Key: TriggerBirthday}}})
+	flow := &Flow{Nodes: nodes}
+
+	if s := flow.Schedule(); s == nil || s.Timezone != "" {
+		t.Fatalf("expected the default schedule, got %+v", s)
+	}
+
+	if err := flow.SetScheduleTimezone("Asia/Jakarta"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s := flow.Schedule(); s.Timezone != "Asia/Jakarta" {
+		t.Fatalf("expected the timezone to be pinned, got %+v", s)
+	}
+}
+
+func TestMemberProfileFromEvent(t *testing.T) {
+	p := ProfileFromEvent(&TriggerEvent{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		Attributes: map[string]any{
+			"birth_date": "1990-10-25",
+			"customer":   map[string]any{"tier": "gold", "joined_at": "2020-03-01T10:00:00Z"},
+		},
+	})
+	if p == nil || p.BirthKey != 1025 || p.JoinedKey != 301 {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+
+	attrs := p.Attributes(TriggerBirthday, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC), time.Now())
+	if attrs["age"] != int64(36) || attrs["customer"].(map[string]any)["tier"] != "gold" {
+		t.Fatalf("unexpected attributes %+v", attrs)
+	}
+
+	if ProfileFromEvent(&TriggerEvent{OrganizationID: "org-id", UserID: "user-id", Attributes: map[string]any{"amount": 10}}) != nil {
+		t.Fatalf("expected no profile from an event without member data")
+	}
+}
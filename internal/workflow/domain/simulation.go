@@ -0,0 +1,79 @@
+package domain
+
+import (
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/reward"
+)
+
+// SimulatedAction is an action a flow would fire. Points is the reward it would
+// credit; Error is set when its parameters could not be applied to the event.
+type SimulatedAction struct {
+	NodeID string
+	Action *NodeAction
+	Points int64
+	Reason string
+	Error  string
+}
+
+type Simulation struct {
+	Trace       []*TraceStep
+	Actions     []*SimulatedAction
+	TotalPoints int64
+}
+
+// ActionPoints computes the points an action changes the member's balance by: what a
+// REWARD_POINT credits, less what a DEDUCT_POINTS takes. Other actions move no points.
+func ActionPoints(action *NodeAction, attrs map[string]any) (int64, string, error) {
+	switch action.Type {
+	case workflowv1.ActionType_REWARD_POINT.String():
+		rule, err := reward.Parse(action.Parameters)
+		if err != nil {
+			return 0, "", err
+		}
+
+		res, err := rule.Calculate(attrs)
+		if err != nil {
+			return 0, "", err
+		}
+		return res.Points, res.Reason, nil
+
+	case workflowv1.ActionType_DEDUCT_POINTS.String():
+		p, err := ParseActionParams[DeductPointsParams](action.Parameters)
+		if err != nil {
+			return 0, "", err
+		}
+		return -p.Points, "", nil
+	}
+
+	return 0, "", nil
+}
+
+// Simulate executes the graph and computes what its reward actions would credit,
+// without running any action.
+func (g *FlowGraph) Simulate(attrs map[string]any) (*Simulation, error) {
+	exec, err := g.Execute(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &Simulation{Trace: exec.Trace}
+	for _, step := range exec.Trace {
+		if step.NodeType != workflowv1.NodeType_ACTION.String() {
+			continue
+		}
+
+		action := &SimulatedAction{NodeID: step.NodeID, Action: g.Nodes[step.NodeID].Action}
+		sim.Actions = append(sim.Actions, action)
+
+		points, reason, err := ActionPoints(action.Action, attrs)
+		if err != nil {
+			action.Error = err.Error()
+			continue
+		}
+
+		action.Points, action.Reason = points, reason
+		sim.TotalPoints += points
+	}
+
+	return sim, nil
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func rewardNode(id, params string) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_ACTION, Action: &NodeAction{Type: "REWARD_POINT", Parameters: []byte(params)}}
+}
+
+func TestSimulateComputesRewards(t *testing.T) {
+	g := graphOf(
+		[]*Node{
+			trigger("start"),
+			condition("big", "amount > 100"),
+			rewardNode("bps", `{"reward_point_type":"PERCENT_BPS","reward_point_value":500}`),
+			rewardNode("fixed", `{"reward_point_type":"FIXED","reward_point_value":25}`),
+			rewardNode("broken", `{"reward_point_type":"FIXED"}`),
+			action("notify", "NOTIFY"),
+		},
+		edge("start", "big", ""),
+		edge("big", "bps", "EDGE_TYPE_THEN"),
+		edge("bps", "broken", ""),
+		edge("broken", "notify", ""),
+		edge("big", "fixed", "EDGE_TYPE_OTHERWISE"),
+	)
+
+	sim, err := g.Simulate(map[string]any{"amount": 2000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sim.Actions) != 3 || sim.TotalPoints != 100 {
+		t.Fatalf("expected 3 actions worth 100 points, got %d worth %d", len(sim.Actions), sim.TotalPoints)
+	}
+
+	if sim.Actions[0].NodeID != "bps" || sim.Actions[0].Points != 100 {
+		t.Fatalf("unexpected reward %+v", sim.Actions[0])
+	}
+
+	if !strings.Contains(sim.Actions[1].Error, "reward_point_value") || sim.Actions[1].Points != 0 {
+		t.Fatalf("expected invalid parameters to be reported, got %+v", sim.Actions[1])
+	}
+
+	if sim.Actions[2].Action.Type != "NOTIFY" || sim.Actions[2].Error != "" {
+		t.Fatalf("unexpected non reward action %+v", sim.Actions[2])
+	}
+
+	other, err := g.Simulate(map[string]any{"amount": 50})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(other.Actions) != 1 || other.Actions[0].NodeID != "fixed" || other.TotalPoints != 25 {
+		t.Fatalf("unexpected otherwise branch %+v", other.Actions)
+	}
+}
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// NodeSplit routes members between the variants of an experiment. A member is
+// assigned by hashing their user ID with the experiment, so they always get the same
+// variant, and each variant gets a share of members proportional to its weight.
+// Edges leaving the split are typed with the key of the variant they lead to; a
+// variant without edges is a control group.
+type NodeSplit struct {
+	Experiment string         `json:"experiment,omitempty"` // defaults to the node ID
+	Variants   []SplitVariant `json:"variants"`
+}
+
+type SplitVariant struct {
+	Key    string `json:"key"`
+	Weight int    `json:"weight"`
+}
+
+func (s *NodeSplit) experiment(nodeID string) string {
+	if s.Experiment == "" {
+		return nodeID
+	}
+	return s.Experiment
+}
+
+// Assign returns the variant of the split at nodeID the member falls in; empty when
+// the split has no weight.
+func (s *NodeSplit) Assign(nodeID, userID string) string {
+	total := 0
+	for _, v := range s.Variants {
+		total += max(v.Weight, 0)
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(s.experiment(nodeID) + ":" + userID))
+	bucket := int(h.Sum64() % uint64(total))
+
+	for _, v := range s.Variants {
+		if bucket < max(v.Weight, 0) {
+			return v.Key
+		}
+		bucket -= max(v.Weight, 0)
+	}
+
+	return ""
+}
+
+// Weight returns the weight of the variant with key; zero when it isn't one.
+func (s *NodeSplit) Weight(key string) int {
+	for _, v := range s.Variants {
+		if v.Key == key {
+			return v.Weight
+		}
+	}
+	return 0
+}
+
+// Assignment is the variant a split put the member of an execution in.
+type Assignment struct {
+	NodeID     string `json:"node_id"`
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// FlowAssignment records an execution's variant of an experiment, so outcomes can
+// be compared between variants.
+type FlowAssignment struct {
+	ID             string `gorm:"column:id;primaryKey"`
+	OrganizationID string `gorm:"column:organization_id"`
+	FlowID         string `gorm:"column:flow_id"`
+	ExecutionID    string `gorm:"column:execution_id"`
+	UserID         string `gorm:"column:user_id"`
+	NodeID         string `gorm:"column:node_id"`
+	Experiment     string `gorm:"column:experiment"`
+	Variant        string `gorm:"column:variant"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+func NewFlowAssignment(exec *FlowExecution, a *Assignment) *FlowAssignment {
+	return &FlowAssignment{
+		ID:             exec.ID + ":" + a.NodeID,
+		OrganizationID: exec.OrganizationID,
+		FlowID:         exec.FlowID,
+		ExecutionID:    exec.ID,
+		UserID:         exec.UserID,
+		NodeID:         a.NodeID,
+		Experiment:     a.Experiment,
+		Variant:        a.Variant,
+	}
+}
+
+func validateSplit(field string, split *NodeSplit, report func(field, format string, args ...any)) {
+	if split == nil {
+		report(field, "split is required")
+		return
+	}
+
+	if len(split.Variants) < 2 {
+		report(field+".variants", "a split needs at least two variants")
+	}
+
+	seen := map[string]bool{}
+	for i, v := range split.Variants {
+		switch {
+		case v.Key == "":
+			report(field+".variants", "variant %d has no key", i)
+		case seen[v.Key]:
+			report(field+".variants", "duplicate variant %s", v.Key)
+		}
+		seen[v.Key] = true
+
+		if v.Weight <= 0 {
+			report(field+".variants", "variant %s must have a positive weight", v.Key)
+		}
+	}
+}
+
+// VariantStats are the outcomes of the executions one variant of a split was
+// assigned to. RepeatMembers are the members with more than one such execution.
+type VariantStats struct {
+	NodeID             string `gorm:"column:node_id"`
+	Experiment         string `gorm:"column:experiment"`
+	Variant            string `gorm:"column:variant"`
+	Members            int64  `gorm:"column:members"`
+	Executions         int64  `gorm:"column:executions"`
+	RewardedExecutions int64  `gorm:"column:rewarded_executions"`
+	Points             int64  `gorm:"column:points"`
+	RepeatMembers      int64  `gorm:"column:repeat_members"`
+}
+
+func (s *VariantStats) PointsPerMember() float64 {
+	if s.Members == 0 {
+		return 0
+	}
+	return float64(s.Points) / float64(s.Members)
+}
+
+func (s *VariantStats) RepeatRate() float64 {
+	if s.Members == 0 {
+		return 0
+	}
+	return float64(s.RepeatMembers) / float64(s.Members)
+}
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func splitNode(id string, variants ...SplitVariant) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_SPLIT, Split: &NodeSplit{Experiment: "multiplier", Variants: variants}}
+}
+
+func TestSplitAssignIsStickyAndWeighted(t *testing.T) {
+	split := &NodeSplit{Experiment: "multiplier", Variants: []SplitVariant{{Key: "2X", Weight: 3}, {Key: "3X", Weight: 1}}}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		variant := split.Assign("split", user)
+		if again := split.Assign("split", user); again != variant {
+			t.Fatalf("%s assigned %s then %s", user, variant, again)
+		}
+		counts[variant]++
+	}
+
+	if counts["2X"]+counts["3X"] != 4000 {
+		t.Fatalf("members left unassigned: %v", counts)
+	}
+
+	// 3:1 weights put about 3000 members in 2X.
+	if counts["2X"] < 2800 || counts["2X"] > 3200 {
+		t.Fatalf("2X got %d of 4000 members, want about 3000", counts["2X"])
+	}
+}
+
+func TestExecuteFollowsSplitVariant(t *testing.T) {
+	g := graphOf(
+		[]*Node{
+			trigger("start"),
+			splitNode("split", SplitVariant{Key: "2X", Weight: 1}, SplitVariant{Key: "3X", Weight: 1}),
+			action("double", "REWARD_POINT_2X"),
+			action("triple", "REWARD_POINT_3X"),
+		},
+		edge("start", "split", ""),
+		edge("split", "double", "2X"),
+		edge("split", "triple", "3X"),
+	)
+
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		exec, err := g.Execute(map[string]any{"user_id": user})
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+
+		if len(exec.Assignments) != 1 {
+			t.Fatalf("assignments = %+v, want one", exec.Assignments)
+		}
+
+		a := exec.Assignments[0]
+		want := map[string]string{"2X": "REWARD_POINT_2X", "3X": "REWARD_POINT_3X"}[a.Variant]
+		if got := actionTypes(exec); got != want || a.Experiment != "multiplier" {
+			t.Fatalf("%s in %s fired %q, want %q", user, a.Variant, got, want)
+		}
+		seen[a.Variant] = true
+	}
+
+	if !seen["2X"] || !seen["3X"] {
+		t.Fatalf("20 members all fell in one variant: %v", seen)
+	}
+
+	if _, err := g.Execute(map[string]any{}); err == nil {
+		t.Fatalf("Execute without user_id succeeded")
+	}
+}
+
+func TestValidateGraphChecksSplits(t *testing.T) {
+	nodes := []*Node{
+		trigger("start"),
+		splitNode("split", SplitVariant{Key: "2X", Weight: 1}, SplitVariant{Key: "2X", Weight: 0}),
+		rewardNode("yes", fixedReward),
+	}
+	edges := []*Edge{
+		edge("start", "split", ""),
+		edge("split", "yes", "4X"),
+	}
+
+	details := ValidateGraph(nodes, edges)
+	if detailFor(details, "nodes[1].split.variants") == "" {
+		t.Fatalf("invalid variants not reported: %+v", details)
+	}
+	if detailFor(details, "edges[1].type") == "" {
+		t.Fatalf("edge to an unknown variant not reported: %+v", details)
+	}
+}
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+)
+
+// Stacking policies decide which of an organization's flows fire when several match
+// one event.
+const (
+	// StackingAll fires every flow that matches.
+	StackingAll = "ALL"
+	// StackingHighestPriority fires the matching flow of the highest priority only.
+	StackingHighestPriority = "HIGHEST_PRIORITY"
+	// StackingBestReward fires the matching flow that earns the member the most points.
+	StackingBestReward = "BEST_REWARD"
+	// StackingExclusiveGroups fires the highest priority flow of each exclusive group,
+	// and every matching flow outside a group.
+	StackingExclusiveGroups = "EXCLUSIVE_GROUPS"
+)
+
+// ExecutionStatusSuppressed is a flow that matched but lost to another flow under the
+// organization's stacking policy, so it fired nothing. SkipReason says which.
+const ExecutionStatusSuppressed = "SUPPRESSED"
+
+// FlowSettings are an organization's settings for running its flows. An organization
+// without settings stacks every flow that matches.
+type FlowSettings struct {
+	OrganizationID string `gorm:"column:organization_id;primaryKey"`
+	StackingPolicy string `gorm:"column:stacking_policy"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+// Policy returns the stacking policy, ALL when none is set.
+func (m *FlowSettings) Policy() string {
+	if m == nil || m.StackingPolicy == "" {
+		return StackingAll
+	}
+	return m.StackingPolicy
+}
+
+func (m *FlowSettings) Validate() []errutil.Detail {
+	switch m.StackingPolicy {
+	case StackingAll, StackingHighestPriority, StackingBestReward, StackingExclusiveGroups:
+		return nil
+	}
+
+	return []errutil.Detail{{
+		Field:   "stacking_policy",
+		Message: fmt.Sprintf("unsupported stacking policy %q, use ALL, HIGHEST_PRIORITY, BEST_REWARD or EXCLUSIVE_GROUPS", m.StackingPolicy),
+	}}
+}
+
+// StackingUpdates returns the stacking columns to write for an update naming paths in
+// its update mask. Only the fields named are written, so an update that doesn't know
+// about stacking, a rename say, leaves the flow's priority and group as they were.
+func StackingUpdates(paths []string, priority int32, group string) map[string]any {
+	updates := map[string]any{}
+	if slices.Contains(paths, "priority") {
+		updates["priority"] = priority
+	}
+	if slices.Contains(paths, "exclusive_group") {
+		updates["exclusive_group"] = group
+	}
+	return updates
+}
+
+// Contender is a flow that fired for an event and competes with the others under
+// the stacking policy. Points is what it would earn the member.
+type Contender struct {
+	FlowID   string
+	Priority int32
+	Group    string
+	Points   int64
+}
+
+// ResolveStacking picks the contenders that fire under policy and returns the others,
+// each mapped to the flow it lost to. Ties fall to the higher priority, then the
+// better reward, then the lower flow ID, so the outcome doesn't depend on the order
+// flows are found in.
+func ResolveStacking(policy string, contenders []Contender) map[string]string {
+	suppressed := map[string]string{}
+
+	byPriority := func(a, b Contender) int {
+		return cmp.Or(cmp.Compare(b.Priority, a.Priority), cmp.Compare(b.Points, a.Points), cmp.Compare(a.FlowID, b.FlowID))
+	}
+	byReward := func(a, b Contender) int {
+		return cmp.Or(cmp.Compare(b.Points, a.Points), cmp.Compare(b.Priority, a.Priority), cmp.Compare(a.FlowID, b.FlowID))
+	}
+
+	// keepFirst suppresses every contender but the best one of the set.
+	keepFirst := func(set []Contender, order func(a, b Contender) int) {
+		if len(set) < 2 {
+			return
+		}
+
+		set = slices.Clone(set)
+		slices.SortFunc(set, order)
+		for _, c := range set[1:] {
+			suppressed[c.FlowID] = set[0].FlowID
+		}
+	}
+
+	switch policy {
+	case StackingHighestPriority:
+		keepFirst(contenders, byPriority)
+
+	case StackingBestReward:
+		keepFirst(contenders, byReward)
+
+	case StackingExclusiveGroups:
+		groups := map[string][]Contender{}
+		for _, c := range contenders {
+			if c.Group != "" {
+				groups[c.Group] = append(groups[c.Group], c)
+			}
+		}
+		for _, set := range groups {
+			keepFirst(set, byPriority)
+		}
+	}
+
+	return suppressed
+}
+
+// SuppressedReason says why a flow was suppressed by the winner under policy.
+func SuppressedReason(policy, winner string) string {
+	return fmt.Sprintf("suppressed by flow %s under the %s stacking policy", winner, policy)
+}
+
+// RewardPoints is what the execution's actions would earn the member. Actions whose
+// points can't be computed count as zero.
+func (e *Execution) RewardPoints(attrs map[string]any) int64 {
+	var points int64
+	for _, action := range e.Actions {
+		if p, _, err := ActionPoints(action, attrs); err == nil {
+			points += p
+		}
+	}
+	return points
+}
+
+// Suppress records that the stacking policy suppressed the execution.
+func (m *FlowExecution) Suppress(reason string) {
+	m.Status, m.SkipReason, m.Points = ExecutionStatusSuppressed, reason, 0
+}
@@ -0,0 +1,60 @@
+package domain
+
+import "testing"
+
+func TestResolveStacking(t *testing.T) {
+	contenders := []Contender{
+		{FlowID: "welcome", Priority: 1, Points: 500, Group: "onboarding"},
+		{FlowID: "double", Priority: 5, Points: 200},
+		{FlowID: "signup", Priority: 3, Points: 100, Group: "onboarding"},
+		{FlowID: "birthday", Priority: 5, Points: 200},
+	}
+
+	cases := []struct {
+		policy     string
+		suppressed map[string]string
+	}{
+		{StackingAll, map[string]string{}},
+		{StackingHighestPriority, map[string]string{"welcome": "birthday", "double": "birthday", "signup": "birthday"}},
+		{StackingBestReward, map[string]string{"double": "welcome", "signup": "welcome", "birthday": "welcome"}},
+		{StackingExclusiveGroups, map[string]string{"welcome": "signup"}},
+	}
+
+	for _, c := range cases {
+		got := ResolveStacking(c.policy, contenders)
+		if len(got) != len(c.suppressed) {
+			t.Fatalf("%s: suppressed %v, want %v", c.policy, got, c.suppressed)
+		}
+		for flow, winner := range c.suppressed {
+			if got[flow] != winner {
+				t.Fatalf("%s: %s suppressed by %q, want %q", c.policy, flow, got[flow], winner)
+			}
+		}
+	}
+}
+
+func TestFlowSettingsPolicy(t *testing.T) {
+	var none *FlowSettings
+	if none.Policy() != StackingAll {
+		t.Fatalf("policy without settings = %s, want ALL", none.Policy())
+	}
+
+	if details := (&FlowSettings{StackingPolicy: "RANDOM"}).Validate(); len(details) != 1 {
+		t.Fatalf("unknown policy not reported: %+v", details)
+	}
+}
+
+func TestStackingUpdatesFollowTheMask(t *testing.T) {
+	if got := StackingUpdates(nil, 0, ""); len(got) != 0 {
+		t.Fatalf("update without a mask writes %v", got)
+	}
+
+	if got := StackingUpdates([]string{"name", "priority"}, 0, ""); len(got) != 1 || got["priority"] != int32(0) {
+		t.Fatalf("update masking priority writes %v", got)
+	}
+
+	got := StackingUpdates([]string{"priority", "exclusive_group"}, 7, "onboarding")
+	if got["priority"] != int32(7) || got["exclusive_group"] != "onboarding" {
+		t.Fatalf("update masking both writes %v", got)
+	}
+}
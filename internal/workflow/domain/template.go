@@ -0,0 +1,223 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"gorm.io/datatypes"
+)
+
+// Template categories group the catalog.
+const (
+	TemplateCategoryEarn       = "EARN"
+	TemplateCategoryEngagement = "ENGAGEMENT"
+	TemplateCategoryLifecycle  = "LIFECYCLE"
+)
+
+// Template parameter types.
+const (
+	ParameterNumber = "NUMBER"
+	ParameterString = "STRING"
+)
+
+// TemplateParameter is a value filled in when a flow is created from a template. The
+// template's nodes refer to it as {{key}}: a string that is just the placeholder
+// takes the value as is, a placeholder inside a longer string, such as a condition
+// expression, is replaced by its text.
+type TemplateParameter struct {
+	Key         string `json:"key"`
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required,omitempty"`
+	Default     any    `json:"default,omitempty"`
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// TemplateParameters returns the parameters of the template.
+func (m *FlowTemplate) TemplateParameters() []TemplateParameter {
+	var params []TemplateParameter
+	if len(m.Parameters) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(m.Parameters, &params); err != nil {
+		return nil
+	}
+	return params
+}
+
+// Fill returns the template's nodes with its parameters filled in from values, or
+// their defaults. Missing required parameters, unknown ones and values of the wrong
+// type are reported under parameters.<key>.
+func (m *FlowTemplate) Fill(values map[string]any) ([]*workflowv1.Node, []errutil.Detail) {
+	var details []errutil.Detail
+	report := func(key, format string, args ...any) {
+		details = append(details, errutil.Detail{Field: "parameters." + key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	params := m.TemplateParameters()
+	known := make(map[string]bool, len(params))
+	filled := make(map[string]any, len(params))
+	for _, p := range params {
+		known[p.Key] = true
+
+		v, ok := values[p.Key]
+		if !ok || v == nil {
+			if p.Required && p.Default == nil {
+				report(p.Key, "%s is required", p.Label)
+				continue
+			}
+			v = p.Default
+		}
+
+		switch v.(type) {
+		case float64, int, int64:
+			if p.Type != ParameterNumber {
+				report(p.Key, "%s must be a string", p.Label)
+				continue
+			}
+		case string:
+			if p.Type != ParameterString {
+				report(p.Key, "%s must be a number", p.Label)
+				continue
+			}
+		default:
+			report(p.Key, "%s must be a %s", p.Label, strings.ToLower(p.Type))
+			continue
+		}
+
+		filled[p.Key] = v
+	}
+
+	for key := range values {
+		if !known[key] {
+			report(key, "unknown parameter")
+		}
+	}
+
+	if len(details) > 0 {
+		return nil, details
+	}
+
+	var nodes any
+	if err := json.Unmarshal(m.Nodes, &nodes); err != nil {
+		return nil, []errutil.Detail{{Field: "nodes", Message: "template nodes are malformed"}}
+	}
+
+	b, err := json.Marshal(fill(nodes, filled))
+	if err != nil {
+		return nil, []errutil.Detail{{Field: "nodes", Message: "template nodes are malformed"}}
+	}
+
+	return (&FlowTemplate{Nodes: b}).GetNodes(), nil
+}
+
+// fill replaces the placeholders in the strings of a decoded JSON value.
+func fill(v any, values map[string]any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = fill(e, values)
+		}
+		return v
+
+	case []any:
+		for i, e := range v {
+			v[i] = fill(e, values)
+		}
+		return v
+
+	case string:
+		if m := placeholder.FindStringSubmatch(v); m != nil && m[0] == v {
+			if value, ok := values[m[1]]; ok {
+				return value
+			}
+			return v
+		}
+
+		return placeholder.ReplaceAllStringFunc(v, func(s string) string {
+			if value, ok := values[placeholder.FindStringSubmatch(s)[1]]; ok {
+				if f, ok := value.(float64); ok {
+					return strconv.FormatFloat(f, 'f', -1, 64)
+				}
+				return fmt.Sprint(value)
+			}
+			return s
+		})
+	}
+
+	return v
+}
+
+// BuiltinTemplates is the catalog every organization starts from. Their IDs are
+// stable, so seeding them again updates them in place.
+func BuiltinTemplates() []*FlowTemplate {
+	return []*FlowTemplate{
+		builtin("points-per-spend", "Points per spend",
+			"Reward members with points for every unit they spend above a minimum.",
+			"TRANSACTION", TemplateCategoryEarn,
+			[]TemplateParameter{
+				{Key: "multiplier", Label: "Points per unit", Type: ParameterNumber, Required: true},
+				{Key: "unit_amount", Label: "Unit amount", Description: "Spend in minor currency units that earns the points per unit.", Type: ParameterNumber, Default: 100},
+				{Key: "min_spend", Label: "Minimum spend", Description: "Spend in minor currency units below which nothing is earned.", Type: ParameterNumber, Required: true},
+			},
+			nil,
+			`{"reward_point_type":"MULTIPLE","reward_point_value":"{{multiplier}}","unit_amount":"{{unit_amount}}","min_spend":"{{min_spend}}"}`,
+		),
+		builtin("first-purchase-bonus", "First purchase bonus",
+			"Grant a one-time bonus on a member's first purchase.",
+			"TRANSACTION", TemplateCategoryEngagement,
+			[]TemplateParameter{
+				{Key: "points", Label: "Bonus points", Type: ParameterNumber, Required: true},
+			},
+			&FrequencyCap{Limit: 1, Period: CapLifetime},
+			`{"reward_point_type":"FIXED","reward_point_value":"{{points}}"}`,
+		),
+		builtin("birthday-bonus", "Birthday bonus",
+			"Grant members bonus points on their birthday.",
+			TriggerBirthday, TemplateCategoryLifecycle,
+			[]TemplateParameter{
+				{Key: "points", Label: "Bonus points", Type: ParameterNumber, Required: true},
+			},
+			nil,
+			`{"reward_point_type":"FIXED","reward_point_value":"{{points}}"}`,
+		),
+	}
+}
+
+// builtin builds a template that rewards points whenever trigger fires, at most limit
+// times when it has one. reward is the parameters of the reward.
+func builtin(id, name, description, trigger, category string, params []TemplateParameter, limit *FrequencyCap, reward string) *FlowTemplate {
+	nodes := []Node{
+		{ID: "trigger", Type: workflowv1.NodeType_TRIGGER, Trigger: &NodeTrigger{Key: trigger, Label: name, Cap: limit}},
+		{ID: "reward", Type: workflowv1.NodeType_ACTION, Action: &NodeAction{
+			Type:       workflowv1.ActionType_REWARD_POINT.String(),
+			Parameters: datatypes.JSON(reward),
+		}, Position: Position{Y: 120}},
+	}
+	edges := []*Edge{{ID: "trigger-reward", Source: "trigger", Target: "reward"}}
+
+	n, _ := json.Marshal(nodes)
+	e, _ := json.Marshal(edges)
+	p, _ := json.Marshal(params)
+
+	return &FlowTemplate{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		Trigger:     trigger,
+		Category:    category,
+		Status:      workflowv1.FlowStatus_ACTIVE.String(),
+		Nodes:       n,
+		Edges:       e,
+		Overflow:    datatypes.JSON(`{}`),
+		Parameters:  p,
+	}
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/smallbiznis/smallbiznis-apps/pkg/reward"
+)
+
+// instantiate fills the template and builds the flow it creates.
+func instantiate(t *testing.T, template *FlowTemplate, values map[string]any) *Flow {
+	t.Helper()
+
+	nodes, details := template.Fill(values)
+	if len(details) > 0 {
+		t.Fatalf("%s: unexpected details: %+v", template.ID, details)
+	}
+
+	flow := &Flow{}
+	if err := flow.SetNodes(nodes); err != nil {
+		t.Fatalf("%s: unexpected error: %v", template.ID, err)
+	}
+	if err := flow.SetEdges(template.GetEdges()); err != nil {
+		t.Fatalf("%s: unexpected error: %v", template.ID, err)
+	}
+	return flow
+}
+
+func TestBuiltinTemplatesInstantiate(t *testing.T) {
+	values := map[string]map[string]any{
+		"points-per-spend":     {"multiplier": float64(2), "min_spend": float64(5000)},
+		"first-purchase-bonus": {"points": float64(250)},
+		"birthday-bonus":       {"points": float64(500)},
+	}
+
+	for _, template := range BuiltinTemplates() {
+		flow := instantiate(t, template, values[template.ID])
+		if details := flow.Validate(); len(details) > 0 {
+			t.Fatalf("%s: invalid flow: %+v", template.ID, details)
+		}
+		if flow.Trigger != template.Trigger {
+			t.Fatalf("%s: trigger = %s, want %s", template.ID, flow.Trigger, template.Trigger)
+		}
+	}
+}
+
+func TestTemplateFillsParameters(t *testing.T) {
+	flow := instantiate(t, BuiltinTemplates()[0], map[string]any{"multiplier": 1.5, "min_spend": float64(5000)})
+
+	graph, err := flow.BuildFlowGraph()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rule, err := reward.Parse(graph.Nodes["reward"].Action.Parameters)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rule.Value != 1.5 || rule.MinSpend != 5000 || rule.UnitAmount != 100 {
+		t.Fatalf("rule = %+v, want 1.5 points per 100 over 5000", rule)
+	}
+}
+
+func TestTemplateReportsParameters(t *testing.T) {
+	_, details := BuiltinTemplates()[0].Fill(map[string]any{"multiplier": "two", "bonus": float64(1)})
+
+	for field, want := range map[string]string{
+		"parameters.multiplier": "Points per unit must be a number",
+		"parameters.min_spend":  "Minimum spend is required",
+		"parameters.bonus":      "unknown parameter",
+	} {
+		if got := detailFor(details, field); got != want {
+			t.Fatalf("%s = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestFillPlaceholderInText(t *testing.T) {
+	got := fill("amount >= {{ min_spend }} && tier == '{{tier}}'", map[string]any{"min_spend": float64(10000000)})
+	if want := "amount >= 10000000 && tier == '{{tier}}'"; got != want {
+		t.Fatalf("fill = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// TriggerEvent is the envelope of an event published on a trigger topic. ID is the
+// producer's event ID; redeliveries of the same event carry the same ID.
+type TriggerEvent struct {
+	ID             string         `json:"id"`
+	OrganizationID string         `json:"organization_id"`
+	UserID         string         `json:"user_id"`
+	ReferenceID    string         `json:"reference_id"`
+	Attributes     map[string]any `json:"attributes"`
+}
+
+// ParseTriggerEvent decodes an event from a trigger topic. Events without an ID or
+// an organization can never be dispatched.
+func ParseTriggerEvent(value []byte) (*TriggerEvent, error) {
+	var event TriggerEvent
+	if err := json.Unmarshal(value, &event); err != nil {
+		return nil, fmt.Errorf("invalid trigger event: %w", err)
+	}
+
+	if event.ID == "" {
+		return nil, errors.New("trigger event has no id")
+	}
+
+	if event.OrganizationID == "" {
+		return nil, errors.New("trigger event has no organization_id")
+	}
+
+	if event.ReferenceID == "" {
+		event.ReferenceID = event.ID
+	}
+
+	return &event, nil
+}
+
+// WorkflowID is the ID the event's execution runs under. It is derived from the
+// event alone, so a redelivered event maps onto the execution it already started.
+func (e *TriggerEvent) WorkflowID(trigger string) string {
+	return fmt.Sprintf("trigger:%s:%s:%s", e.OrganizationID, trigger, e.ID)
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "testing"
+
+func TestParseTriggerEvent(t *testing.T) {
+	event, err := ParseTriggerEvent([]byte(`{"id":"evt-1","organization_id":"org-id","user_id":"user-id","attributes":{"amount":100}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.ReferenceID != "evt-1" {
+		t.Fatalf("expected the event ID to stand in for the reference, got %q", event.ReferenceID)
+	}
+
+	if got := event.WorkflowID("TRANSACTION"); got != "trigger:org-id:TRANSACTION:evt-1" {
+		t.Fatalf("unexpected workflow ID %q", got)
+	}
+}
+
+func TestParseTriggerEventRejectsPoison(t *testing.T) {
+	for name, value := range map[string]string{
+		"not json":        `amount=100`,
+		"no id":           `{"organization_id":"org-id"}`,
+		"no organization": `{"id":"evt-1"}`,
+	} {
+		if _, err := ParseTriggerEvent([]byte(value)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
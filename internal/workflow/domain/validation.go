@@ -0,0 +1,248 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+)
+
+// ValidateGraph checks the structure of a flow graph. Fields are reported by their
+// position in the request, e.g. nodes[2].action.parameters or edges[0].target.
+//
+// A valid graph has exactly one trigger, every edge joins existing nodes, every node
+// is reachable from the trigger, there is no cycle, actions are leaves, conditions
+// branch on both THEN and OTHERWISE, action parameters match their type, waits say
+// how long they wait, splits lead to their own variants and frequency caps have a
+// positive limit and a known period.
+func ValidateGraph(nodes []*Node, edges []*Edge) []errutil.Detail {
+	var details []errutil.Detail
+	report := func(field, format string, args ...any) {
+		details = append(details, errutil.Detail{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	index := make(map[string]int, len(nodes))
+	trigger := ""
+	for i, n := range nodes {
+		field := fmt.Sprintf("nodes[%d]", i)
+
+		if n.ID == "" {
+			report(field+".id", "id is required")
+			continue
+		}
+
+		if _, ok := index[n.ID]; ok {
+			report(field+".id", "duplicate node id %s", n.ID)
+			continue
+		}
+		index[n.ID] = i
+
+		switch n.Type {
+		case workflowv1.NodeType_TRIGGER:
+			if trigger != "" {
+				report(field+".type", "only one trigger node is allowed")
+				continue
+			}
+			trigger = n.ID
+			validateTrigger(field+".trigger", n.Trigger, report)
+
+		case workflowv1.NodeType_CONDITION:
+
+		case workflowv1.NodeType_ACTION:
+			validateAction(field+".action", n.Action, report)
+
+		case workflowv1.NodeType_WAIT:
+			validateWait(field+".wait", n.Wait, report)
+
+		case workflowv1.NodeType_WAIT_FOR_EVENT:
+			validateWaitEvent(field+".wait_event", n.WaitEvent, report)
+
+		case workflowv1.NodeType_SPLIT:
+			validateSplit(field+".split", n.Split, report)
+
+		default:
+			report(field+".type", "unsupported node type %s", n.Type)
+		}
+	}
+
+	if trigger == "" {
+		report("nodes", "a trigger node is required")
+	}
+
+	adjacency := map[string][]string{}
+	branches := map[string]map[string]bool{}
+	for i, e := range edges {
+		field := fmt.Sprintf("edges[%d]", i)
+
+		source, okSource := index[e.Source]
+		if !okSource {
+			report(field+".source", "node %s does not exist", e.Source)
+		}
+
+		if _, ok := index[e.Target]; !ok {
+			report(field+".target", "node %s does not exist", e.Target)
+			continue
+		}
+
+		if !okSource {
+			continue
+		}
+
+		switch nodes[source].Type {
+		case workflowv1.NodeType_ACTION:
+			report(field+".source", "action node %s can't have outgoing edges", e.Source)
+			continue
+
+		case workflowv1.NodeType_CONDITION, workflowv1.NodeType_WAIT_FOR_EVENT:
+			typ := strings.TrimPrefix(e.Type, "EDGE_TYPE_")
+			if typ != "THEN" && typ != "OTHERWISE" {
+				report(field+".type", "edges leaving a %s node must be THEN or OTHERWISE", strings.ToLower(nodes[source].Type.String()))
+				continue
+			}
+
+			if branches[e.Source] == nil {
+				branches[e.Source] = map[string]bool{}
+			}
+			branches[e.Source][typ] = true
+
+		case workflowv1.NodeType_SPLIT:
+			if split := nodes[source].Split; split != nil && split.Weight(e.Type) <= 0 {
+				report(field+".type", "edges leaving a split node must be typed with one of its variants")
+				continue
+			}
+		}
+
+		adjacency[e.Source] = append(adjacency[e.Source], e.Target)
+	}
+
+	for i, n := range nodes {
+		if n.Type != workflowv1.NodeType_CONDITION || n.ID == "" {
+			continue
+		}
+
+		if !branches[n.ID]["THEN"] || !branches[n.ID]["OTHERWISE"] {
+			report(fmt.Sprintf("nodes[%d]", i), "condition node %s requires both THEN and OTHERWISE branches", n.ID)
+		}
+	}
+
+	if trigger == "" {
+		return details
+	}
+
+	// Walk from the trigger: grey nodes are on the current path, so reaching one
+	// again closes a cycle; nodes never coloured are unreachable.
+	const (
+		white = iota
+		grey
+		black
+	)
+	color := map[string]int{}
+	var walk func(id string)
+	walk = func(id string) {
+		color[id] = grey
+		for _, next := range adjacency[id] {
+			switch color[next] {
+			case grey:
+				report(fmt.Sprintf("nodes[%d]", index[next]), "node %s is part of a cycle", next)
+			case white:
+				walk(next)
+			}
+		}
+		color[id] = black
+	}
+	walk(trigger)
+
+	for i, n := range nodes {
+		if n.ID != "" && color[n.ID] == white && index[n.ID] == i {
+			report(fmt.Sprintf("nodes[%d]", i), "node %s is not reachable from the trigger", n.ID)
+		}
+	}
+
+	return details
+}
+
+func validateTrigger(field string, trigger *NodeTrigger, report func(field, format string, args ...any)) {
+	if trigger == nil {
+		return
+	}
+
+	validateCap(field+".cap", trigger.Cap, report)
+	if trigger.Schedule == nil {
+		return
+	}
+
+	for _, d := range trigger.Schedule.validate(trigger.Key) {
+		report(field+".schedule."+d.Field, "%s", d.Message)
+	}
+}
+
+func validateWait(field string, wait *NodeWait, report func(field, format string, args ...any)) {
+	if wait == nil {
+		report(field, "wait is required")
+		return
+	}
+
+	switch {
+	case wait.Duration != "" && wait.Until != "":
+		report(field, "set either duration or until, not both")
+	case wait.Until != "":
+	case wait.Duration == "":
+		report(field, "duration or until is required")
+	default:
+		if d, err := ParseWaitDuration(wait.Duration); err != nil || d <= 0 {
+			report(field+".duration", "duration must be a positive duration such as 7d or 36h")
+		}
+	}
+}
+
+func validateWaitEvent(field string, wait *NodeWaitEvent, report func(field, format string, args ...any)) {
+	if wait == nil {
+		report(field, "wait_event is required")
+		return
+	}
+
+	if wait.Event == "" {
+		report(field+".event", "event is required")
+	}
+
+	if d, err := ParseWaitDuration(wait.Timeout); err != nil || d <= 0 {
+		report(field+".timeout", "timeout must be a positive duration such as 7d or 36h")
+	}
+}
+
+func validateAction(field string, action *NodeAction, report func(field, format string, args ...any)) {
+	if action == nil {
+		report(field, "action is required")
+		return
+	}
+
+	if _, ok := actionSchemas[action.Type]; !ok {
+		report(field+".type", "unsupported action type %s", action.Type)
+		return
+	}
+
+	if err := ValidateActionParameters(action.Type, action.Parameters); err != nil {
+		report(field+".parameters", "%s", err.Error())
+	}
+
+	validateCap(field+".cap", action.Cap, report)
+}
+
+// Validate checks the flow's stored graph with ValidateGraph.
+func (m *Flow) Validate() []errutil.Detail {
+	var nodes []*Node
+	if err := json.Unmarshal(m.Nodes, &nodes); err != nil {
+		return []errutil.Detail{{Field: "nodes", Message: "nodes are malformed"}}
+	}
+
+	var edges []*Edge
+	if len(m.Edges) > 0 {
+		if err := json.Unmarshal(m.Edges, &edges); err != nil {
+			return []errutil.Detail{{Field: "edges", Message: "edges are malformed"}}
+		}
+	}
+
+	return ValidateGraph(nodes, edges)
+}
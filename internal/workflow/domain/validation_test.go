@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+)
+
+const fixedReward = `{"reward_point_type":"FIXED","reward_point_value":10}`
+
+func validNodes() []*Node {
+	return []*Node{
+		trigger("start"),
+		condition("cond", "amount > 100"),
+		rewardNode("yes", fixedReward),
+		rewardNode("no", `{"reward_point_type":"FIXED","reward_point_value":1}`),
+	}
+}
+
+func validEdges() []*Edge {
+	return []*Edge{
+		edge("start", "cond", ""),
+		edge("cond", "yes", "EDGE_TYPE_THEN"),
+		edge("cond", "no", "OTHERWISE"),
+	}
+}
+
+func detailFor(details []errutil.Detail, field string) string {
+	for _, d := range details {
+		if d.Field == field {
+			return d.Message
+		}
+	}
+	return ""
+}
+
+func TestValidateGraphAcceptsValidGraph(t *testing.T) {
+	if details := ValidateGraph(validNodes(), validEdges()); len(details) != 0 {
+		t.Fatalf("unexpected details %+v", details)
+	}
+}
+
+func TestValidateGraphRejectsInvalidGraphs(t *testing.T) {
+	cases := []struct {
+		name    string
+		mutate  func(nodes []*Node, edges []*Edge) ([]*Node, []*Edge)
+		field   string
+		message string
+	}{
+		{
+			"missing trigger",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return n[1:], e[1:] },
+			"nodes", "trigger node is required",
+		},
+		{
+			"second trigger",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return append(n, trigger("again")), e },
+			"nodes[4].type", "only one trigger",
+		},
+		{
+			"duplicate id",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return append(n, rewardNode("yes", fixedReward)), e },
+			"nodes[4].id", "duplicate node id",
+		},
+		{
+			"missing target",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return n, append(e, edge("cond", "ghost", "THEN")) },
+			"edges[3].target", "does not exist",
+		},
+		{
+			"missing source",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return n, append(e, edge("ghost", "yes", "")) },
+			"edges[3].source", "does not exist",
+		},
+		{
+			"unreachable node",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return append(n, rewardNode("orphan", fixedReward)), e },
+			"nodes[4]", "not reachable",
+		},
+		{
+			"cycle",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) {
+				n = append(n, condition("loop", "amount > 5"))
+				e[1] = edge("cond", "loop", "THEN")
+				return n, append(e, edge("loop", "cond", "THEN"), edge("loop", "yes", "OTHERWISE"))
+			},
+			"nodes[1]", "part of a cycle",
+		},
+		{
+			"action with outgoing edge",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return n, append(e, edge("yes", "no", "")) },
+			"edges[3].source", "can't have outgoing edges",
+		},
+		{
+			"condition without otherwise",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { return n, e[:2] },
+			"nodes[1]", "both THEN and OTHERWISE",
+		},
+		{
+			"untyped condition edge",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { e[2].Type = ""; return n, e },
+			"edges[2].type", "THEN or OTHERWISE",
+		},
+		{
+			"invalid reward parameters",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) {
+				n[2] = rewardNode("yes", `{"reward_point_type":"MULTIPLE","reward_point_value":1}`)
+				return n, e
+			},
+			"nodes[2].action.parameters", "unit_amount",
+		},
+		{
+			"unsupported action type",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) { n[2] = action("yes", "TELEPORT"); return n, e },
+			"nodes[2].action.type", "unsupported action type",
+		},
+		{
+			"action without data",
+			func(n []*Node, e []*Edge) ([]*Node, []*Edge) {
+				n[2] = &Node{ID: "yes", Type: workflowv1.NodeType_ACTION}
+				return n, e
+			},
+			"nodes[2].action", "action is required",
+		},
+	}
+
+	for _, c := range cases {
+		nodes, edges := c.mutate(validNodes(), validEdges())
+		details := ValidateGraph(nodes, edges)
+
+		if got := detailFor(details, c.field); !strings.Contains(got, c.message) || got == "" {
+			t.Fatalf("%s: expected %s to report %q, got %+v", c.name, c.field, c.message, details)
+		}
+	}
+}
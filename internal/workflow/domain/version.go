@@ -0,0 +1,285 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	VersionStatusDraft      = "DRAFT"
+	VersionStatusPublished  = "PUBLISHED"
+	VersionStatusSuperseded = "SUPERSEDED"
+)
+
+// FlowVersion is a snapshot of a flow's graph. A flow has at most one DRAFT, which
+// edits overwrite; publishing numbers it and makes it immutable. The flow row keeps
+// a copy of the PUBLISHED version's graph, which is what executions run.
+type FlowVersion struct {
+	ID             string         `gorm:"column:id;primaryKey"`
+	FlowID         string         `gorm:"column:flow_id"`
+	OrganizationID string         `gorm:"column:organization_id"`
+	Version        int32          `gorm:"column:version"` // 0 while a draft
+	Status         string         `gorm:"column:status"`
+	Trigger        string         `gorm:"column:trigger"`
+	Nodes          datatypes.JSON `gorm:"column:nodes"`
+	Edges          datatypes.JSON `gorm:"column:edges"`
+	Overflow       datatypes.JSON `gorm:"column:overflow"`
+	// SourceVersion is the version a rollback restored.
+	SourceVersion int32      `gorm:"column:source_version"`
+	PublishedAt   *time.Time `gorm:"column:published_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+// NewDraft snapshots the graph of flow as a draft of flowID.
+func NewDraft(flowID string, graph *Flow) *FlowVersion {
+	return &FlowVersion{
+		ID:             uuid.NewString(),
+		FlowID:         flowID,
+		OrganizationID: graph.OrganizationID,
+		Status:         VersionStatusDraft,
+		Trigger:        graph.Trigger,
+		Nodes:          graph.Nodes,
+		Edges:          graph.Edges,
+		Overflow:       graph.Overflow,
+	}
+}
+
+func (v *FlowVersion) IsDraft() bool {
+	return v.Status == VersionStatusDraft
+}
+
+// SetGraph replaces the draft's graph with the graph of flow.
+func (v *FlowVersion) SetGraph(graph *Flow) error {
+	if !v.IsDraft() {
+		return fmt.Errorf("version %d is published and can't be changed", v.Version)
+	}
+
+	v.Trigger, v.Nodes, v.Edges, v.Overflow = graph.Trigger, graph.Nodes, graph.Edges, graph.Overflow
+	return nil
+}
+
+// Publish numbers the draft and freezes it.
+func (v *FlowVersion) Publish(version int32, now time.Time) error {
+	if !v.IsDraft() {
+		return fmt.Errorf("version %d is already published", v.Version)
+	}
+
+	v.Version, v.Status, v.PublishedAt = version, VersionStatusPublished, &now
+	return nil
+}
+
+// Restore returns a new published version carrying the graph of v, for rolling a
+// flow back without rewriting its history.
+func (v *FlowVersion) Restore(version int32, now time.Time) *FlowVersion {
+	return &FlowVersion{
+		ID:             uuid.NewString(),
+		FlowID:         v.FlowID,
+		OrganizationID: v.OrganizationID,
+		Version:        version,
+		Status:         VersionStatusPublished,
+		Trigger:        v.Trigger,
+		Nodes:          v.Nodes,
+		Edges:          v.Edges,
+		Overflow:       v.Overflow,
+		SourceVersion:  v.Version,
+		PublishedAt:    &now,
+	}
+}
+
+// Graph returns the version as a flow, so it can be validated and executed like one.
+func (v *FlowVersion) Graph() *Flow {
+	return &Flow{
+		ID:             v.FlowID,
+		OrganizationID: v.OrganizationID,
+		Trigger:        v.Trigger,
+		Nodes:          v.Nodes,
+		Edges:          v.Edges,
+		Overflow:       v.Overflow,
+		Version:        v.Version,
+	}
+}
+
+// GoLive copies a published version's graph onto the flow executions read.
+func (m *Flow) GoLive(v *FlowVersion) {
+	m.Trigger, m.Nodes, m.Edges, m.Overflow, m.Version = v.Trigger, v.Nodes, v.Edges, v.Overflow, v.Version
+}
+
+const (
+	ChangeKindNode = "NODE"
+	ChangeKindEdge = "EDGE"
+
+	ChangeAdded   = "ADDED"
+	ChangeRemoved = "REMOVED"
+	ChangeChanged = "CHANGED"
+)
+
+// GraphChange is one structural difference between two versions. Fields lists the
+// attributes of a CHANGED node or edge that differ.
+type GraphChange struct {
+	Kind   string
+	Change string
+	ID     string
+	Fields []string
+}
+
+// DiffVersions compares the graphs of two versions. Node positions are layout, not
+// structure, and are ignored. Changes are ordered nodes first, in the order of to,
+// followed by what from had and to lost.
+func DiffVersions(from, to *FlowVersion) ([]GraphChange, error) {
+	fromNodes, fromEdges, err := versionGraph(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toNodes, toEdges, err := versionGraph(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []GraphChange
+
+	before := map[string]*Node{}
+	for _, n := range fromNodes {
+		before[n.ID] = n
+	}
+	after := map[string]bool{}
+	for _, n := range toNodes {
+		after[n.ID] = true
+
+		old, ok := before[n.ID]
+		if !ok {
+			changes = append(changes, GraphChange{Kind: ChangeKindNode, Change: ChangeAdded, ID: n.ID})
+			continue
+		}
+
+		if fields := nodeFields(old, n); len(fields) > 0 {
+			changes = append(changes, GraphChange{Kind: ChangeKindNode, Change: ChangeChanged, ID: n.ID, Fields: fields})
+		}
+	}
+	for _, n := range fromNodes {
+		if !after[n.ID] {
+			changes = append(changes, GraphChange{Kind: ChangeKindNode, Change: ChangeRemoved, ID: n.ID})
+		}
+	}
+
+	beforeEdges := map[string]*Edge{}
+	for _, e := range fromEdges {
+		beforeEdges[edgeKey(e)] = e
+	}
+	afterEdges := map[string]bool{}
+	for _, e := range toEdges {
+		key := edgeKey(e)
+		afterEdges[key] = true
+
+		old, ok := beforeEdges[key]
+		if !ok {
+			changes = append(changes, GraphChange{Kind: ChangeKindEdge, Change: ChangeAdded, ID: key})
+			continue
+		}
+
+		if fields := edgeFields(old, e); len(fields) > 0 {
+			changes = append(changes, GraphChange{Kind: ChangeKindEdge, Change: ChangeChanged, ID: key, Fields: fields})
+		}
+	}
+	for _, e := range fromEdges {
+		if key := edgeKey(e); !afterEdges[key] {
+			changes = append(changes, GraphChange{Kind: ChangeKindEdge, Change: ChangeRemoved, ID: key})
+		}
+	}
+
+	return changes, nil
+}
+
+func versionGraph(v *FlowVersion) ([]*Node, []*Edge, error) {
+	var nodes []*Node
+	if len(v.Nodes) > 0 {
+		if err := json.Unmarshal(v.Nodes, &nodes); err != nil {
+			return nil, nil, fmt.Errorf("version %d has malformed nodes: %w", v.Version, err)
+		}
+	}
+
+	var edges []*Edge
+	if len(v.Edges) > 0 {
+		if err := json.Unmarshal(v.Edges, &edges); err != nil {
+			return nil, nil, fmt.Errorf("version %d has malformed edges: %w", v.Version, err)
+		}
+	}
+
+	return nodes, edges, nil
+}
+
+// edgeKey identifies an edge by its id, or by its endpoints when it has none.
+func edgeKey(e *Edge) string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.Source + "->" + e.Target
+}
+
+func nodeFields(a, b *Node) []string {
+	var fields []string
+	if a.Type != b.Type {
+		fields = append(fields, "type")
+	}
+	if !sameJSON(a.Trigger, b.Trigger) {
+		fields = append(fields, "trigger")
+	}
+	if !sameJSON(a.Condition, b.Condition) {
+		fields = append(fields, "condition")
+	}
+
+	switch {
+	case a.Action == nil || b.Action == nil:
+		if a.Action != b.Action {
+			fields = append(fields, "action")
+		}
+	case a.Action.Type != b.Action.Type:
+		fields = append(fields, "action.type")
+	case !sameJSON(json.RawMessage(a.Action.Parameters), json.RawMessage(b.Action.Parameters)):
+		fields = append(fields, "action.parameters")
+	}
+
+	return fields
+}
+
+func edgeFields(a, b *Edge) []string {
+	var fields []string
+	if a.Source != b.Source {
+		fields = append(fields, "source")
+	}
+	if a.Target != b.Target {
+		fields = append(fields, "target")
+	}
+	if a.Type != b.Type {
+		fields = append(fields, "type")
+	}
+	return fields
+}
+
+// sameJSON compares values by their canonical JSON, so key order and whitespace in
+// stored parameters don't count as changes.
+func sameJSON(a, b any) bool {
+	ca, errA := canonicalJSON(a)
+	cb, errB := canonicalJSON(b)
+	return errA == nil && errB == nil && bytes.Equal(ca, cb)
+}
+
+func canonicalJSON(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
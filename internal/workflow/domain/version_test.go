@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func versionOf(t *testing.T, version int32, nodes []*Node, edges []*Edge) *FlowVersion {
+	t.Helper()
+
+	n, err := json.Marshal(nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	e, err := json.Marshal(edges)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &FlowVersion{FlowID: "flow-id", Version: version, Status: VersionStatusPublished, Nodes: n, Edges: e}
+}
+
+func TestDraftLifecycle(t *testing.T) {
+	flow := &Flow{OrganizationID: "org-id", Trigger: "TRANSACTION", Nodes: []byte(`[]`)}
+	draft := NewDraft("flow-id", flow)
+
+	if !draft.IsDraft() || draft.Version != 0 {
+		t.Fatalf("expected an unnumbered draft, got %+v", draft)
+	}
+
+	if err := draft.SetGraph(&Flow{Trigger: "SIGNUP"}); err != nil || draft.Trigger != "SIGNUP" {
+		t.Fatalf("expected draft graph to be replaced, got %v %+v", err, draft)
+	}
+
+	now := time.Now()
+	if err := draft.Publish(4, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if draft.Version != 4 || draft.Status != VersionStatusPublished || !draft.PublishedAt.Equal(now) {
+		t.Fatalf("unexpected published version %+v", draft)
+	}
+
+	if err := draft.SetGraph(flow); err == nil {
+		t.Fatalf("expected published version to be immutable")
+	}
+
+	if err := draft.Publish(5, now); err == nil {
+		t.Fatalf("expected second publish to fail")
+	}
+
+	live := &Flow{}
+	live.GoLive(draft)
+	if live.Version != 4 || live.Trigger != "SIGNUP" {
+		t.Fatalf("expected flow to run version 4, got %+v", live)
+	}
+}
+
+func TestRestoreAppendsNewVersion(t *testing.T) {
+	old := versionOf(t, 2, validNodes(), validEdges())
+	restored := old.Restore(7, time.Now())
+
+	if restored.ID == old.ID || restored.Version != 7 || restored.SourceVersion != 2 || restored.Status != VersionStatusPublished {
+		t.Fatalf("unexpected restored version %+v", restored)
+	}
+
+	if string(restored.Nodes) != string(old.Nodes) || string(restored.Edges) != string(old.Edges) {
+		t.Fatalf("expected the graph of version 2 to be restored")
+	}
+}
+
+func TestDiffVersions(t *testing.T) {
+	from := versionOf(t, 1, validNodes(), validEdges())
+
+	nodes := validNodes()
+	nodes[0].Position = Position{X: 40, Y: 80}
+	nodes[1] = condition("cond", "amount > 500")
+	nodes[2] = rewardNode("yes", `{"reward_point_value": 10, "reward_point_type": "FIXED"}`)
+	nodes[3] = rewardNode("no", `{"reward_point_type":"FIXED","reward_point_value":2}`)
+	nodes = append(nodes, action("notify", "NOTIFY"))
+
+	edges := validEdges()
+	edges[2].Target = "notify"
+	edges = append(edges[:1], edges[2:]...)
+
+	to := versionOf(t, 2, nodes, edges)
+
+	changes, err := DiffVersions(from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []GraphChange{
+		{Kind: ChangeKindNode, Change: ChangeChanged, ID: "cond", Fields: []string{"condition"}},
+		{Kind: ChangeKindNode, Change: ChangeChanged, ID: "no", Fields: []string{"action.parameters"}},
+		{Kind: ChangeKindNode, Change: ChangeAdded, ID: "notify"},
+		{Kind: ChangeKindEdge, Change: ChangeChanged, ID: "cond-no", Fields: []string{"target"}},
+		{Kind: ChangeKindEdge, Change: ChangeRemoved, ID: "cond-yes"},
+	}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("unexpected changes\n got %+v\nwant %+v", changes, want)
+	}
+
+	if same, _ := DiffVersions(from, from); len(same) != 0 {
+		t.Fatalf("expected no changes between identical versions, got %+v", same)
+	}
+}
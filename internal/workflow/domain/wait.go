@@ -0,0 +1,193 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// NodeWait pauses its path for Duration, or until the timestamp attribute Until of
+// the trigger event. An Until already past doesn't pause.
+type NodeWait struct {
+	Duration string `json:"duration,omitempty"` // e.g. "7d", "36h", "90m"
+	Until    string `json:"until,omitempty"`    // attribute path, e.g. "return_deadline"
+}
+
+// NodeWaitEvent pauses its path until the member's next event on the Event trigger
+// whose Match attributes equal the trigger event's, or until Timeout passes. THEN
+// edges are taken when the event arrives, OTHERWISE edges on timeout.
+type NodeWaitEvent struct {
+	Event   string   `json:"event"`
+	Match   []string `json:"match,omitempty"`
+	Timeout string   `json:"timeout"`
+}
+
+// ParseWaitDuration reads a wait duration: a Go duration, or a whole number of days
+// such as "7d".
+func ParseWaitDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// Wait is a path of an execution paused at a WAIT or WAIT_FOR_EVENT node. Until is
+// when a WAIT resumes or a WAIT_FOR_EVENT times out. ID is set once the wait is
+// registered for its execution.
+type Wait struct {
+	ID     string         `json:"id,omitempty"`
+	NodeID string         `json:"node_id"`
+	Until  time.Time      `json:"until"`
+	Event  string         `json:"event,omitempty"`
+	Match  map[string]any `json:"match,omitempty"`
+}
+
+func (w *Wait) ForEvent() bool {
+	return w.Event != ""
+}
+
+// pause works out the wait of a WAIT or WAIT_FOR_EVENT node at now.
+func pause(node *Node, attrs map[string]any, now time.Time) (*Wait, error) {
+	wait := &Wait{NodeID: node.ID}
+
+	switch {
+	case node.Wait != nil && node.Wait.Until != "":
+		v, ok := attribute(attrs, node.Wait.Until)
+		if !ok {
+			return nil, fmt.Errorf("wait node %s: attribute %s is missing", node.ID, node.Wait.Until)
+		}
+
+		s, _ := v.(string)
+		until, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("wait node %s: attribute %s is not a timestamp", node.ID, node.Wait.Until)
+		}
+		wait.Until = until
+
+	case node.Wait != nil:
+		d, err := ParseWaitDuration(node.Wait.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("wait node %s: %w", node.ID, err)
+		}
+		wait.Until = now.Add(d)
+
+	case node.WaitEvent != nil:
+		d, err := ParseWaitDuration(node.WaitEvent.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("wait node %s: %w", node.ID, err)
+		}
+
+		wait.Until, wait.Event, wait.Match = now.Add(d), node.WaitEvent.Event, map[string]any{}
+		for _, path := range node.WaitEvent.Match {
+			v, ok := attribute(attrs, path)
+			if !ok {
+				return nil, fmt.Errorf("wait node %s: attribute %s is missing", node.ID, path)
+			}
+			wait.Match[path] = v
+		}
+
+	default:
+		return nil, fmt.Errorf("wait node %s has no wait", node.ID)
+	}
+
+	return wait, nil
+}
+
+const (
+	WaitStatusWaiting  = "WAITING"
+	WaitStatusResolved = "RESOLVED"
+)
+
+// WaitID identifies the wait of an execution at a node.
+func WaitID(executionID, nodeID string) string {
+	return executionID + ":" + nodeID
+}
+
+// WaitSignal is the name of the signal a waiting execution resumes on.
+func WaitSignal(waitID string) string {
+	return "flow-event:" + waitID
+}
+
+// FlowWait registers an execution waiting for a member's event, so the event can be
+// routed to it.
+type FlowWait struct {
+	ID             string         `gorm:"column:id;primaryKey"`
+	OrganizationID string         `gorm:"column:organization_id"`
+	UserID         string         `gorm:"column:user_id"`
+	ExecutionID    string         `gorm:"column:execution_id"`
+	WorkflowID     string         `gorm:"column:workflow_id"`
+	Event          string         `gorm:"column:event"`
+	Match          datatypes.JSON `gorm:"column:match"` // serialized map[string]any
+	Status         string         `gorm:"column:status"`
+	ExpiresAt      time.Time      `gorm:"column:expires_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+func NewFlowWait(exec *FlowExecution, wait *Wait) *FlowWait {
+	match, _ := json.Marshal(wait.Match)
+
+	return &FlowWait{
+		ID:             WaitID(exec.ID, wait.NodeID),
+		OrganizationID: exec.OrganizationID,
+		UserID:         exec.UserID,
+		ExecutionID:    exec.ID,
+		WorkflowID:     exec.WorkflowID,
+		Event:          wait.Event,
+		Match:          match,
+		Status:         WaitStatusWaiting,
+		ExpiresAt:      wait.Until,
+	}
+}
+
+// Matches reports whether an event's attributes resume the wait at now.
+func (w *FlowWait) Matches(attrs map[string]any, now time.Time) bool {
+	if w.Status != WaitStatusWaiting || !now.Before(w.ExpiresAt) {
+		return false
+	}
+
+	var match map[string]any
+	if len(w.Match) > 0 {
+		if err := json.Unmarshal(w.Match, &match); err != nil {
+			return false
+		}
+	}
+
+	for path, want := range match {
+		got, ok := attribute(attrs, path)
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// attribute reads a dotted attribute path, e.g. customer.tier, from event attributes.
+func attribute(attrs map[string]any, path string) (any, bool) {
+	var v any = attrs
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
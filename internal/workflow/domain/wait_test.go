@@ -0,0 +1,188 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+func waitNode(id string, wait *NodeWait) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_WAIT, Wait: wait}
+}
+
+func waitEventNode(id string, wait *NodeWaitEvent) *Node {
+	return &Node{ID: id, Type: workflowv1.NodeType_WAIT_FOR_EVENT, WaitEvent: wait}
+}
+
+func TestParseWaitDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+		"90m": 90 * time.Minute,
+	}
+
+	for in, want := range cases {
+		got, err := ParseWaitDuration(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseWaitDuration(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "xd", "soon"} {
+		if _, err := ParseWaitDuration(in); err == nil {
+			t.Fatalf("ParseWaitDuration(%q) succeeded", in)
+		}
+	}
+}
+
+func TestExecutePausesAtWait(t *testing.T) {
+	g := graphOf(
+		[]*Node{
+			trigger("start"),
+			action("now", "REWARD_POINT"),
+			waitNode("wait", &NodeWait{Duration: "7d"}),
+			action("later", "REWARD_POINT_BONUS"),
+		},
+		edge("start", "now", ""),
+		edge("start", "wait", ""),
+		edge("wait", "later", ""),
+	)
+
+	before := time.Now()
+	exec, err := g.Execute(map[string]any{"amount": 10})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if got := actionTypes(exec); got != "REWARD_POINT" {
+		t.Fatalf("actions = %q, want REWARD_POINT", got)
+	}
+	if len(exec.Waits) != 1 || exec.Waits[0].NodeID != "wait" || exec.Waits[0].ForEvent() {
+		t.Fatalf("waits = %+v, want one WAIT at wait", exec.Waits)
+	}
+	if until := exec.Waits[0].Until; until.Before(before.Add(7 * 24 * time.Hour)) {
+		t.Fatalf("until = %v, want a week out", until)
+	}
+
+	resumed, err := g.Resume(map[string]any{"amount": 10}, "wait", false)
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if got := actionTypes(resumed); got != "REWARD_POINT_BONUS" {
+		t.Fatalf("resumed actions = %q, want REWARD_POINT_BONUS", got)
+	}
+}
+
+func TestExecuteSkipsWaitUntilPast(t *testing.T) {
+	g := graphOf(
+		[]*Node{
+			trigger("start"),
+			waitNode("wait", &NodeWait{Until: "return_deadline"}),
+			action("later", "REWARD_POINT"),
+		},
+		edge("start", "wait", ""),
+		edge("wait", "later", ""),
+	)
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	exec, err := g.Execute(map[string]any{"return_deadline": past})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(exec.Waits) != 0 || actionTypes(exec) != "REWARD_POINT" {
+		t.Fatalf("waits = %d, actions = %q, want no wait and REWARD_POINT", len(exec.Waits), actionTypes(exec))
+	}
+
+	if _, err := g.Execute(map[string]any{}); err == nil {
+		t.Fatalf("Execute without the until attribute succeeded")
+	}
+}
+
+func TestResumeWaitForEventTakesBranch(t *testing.T) {
+	g := graphOf(
+		[]*Node{
+			trigger("start"),
+			waitEventNode("review", &NodeWaitEvent{Event: "REVIEW", Match: []string{"order_id"}, Timeout: "3d"}),
+			action("thanks", "REWARD_POINT"),
+			action("nudge", "NOTIFY"),
+		},
+		edge("start", "review", ""),
+		edge("review", "thanks", "EDGE_TYPE_THEN"),
+		edge("review", "nudge", "OTHERWISE"),
+	)
+
+	attrs := map[string]any{"order_id": "o-1"}
+	exec, err := g.Execute(attrs)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(exec.Waits) != 1 || exec.Waits[0].Event != "REVIEW" || exec.Waits[0].Match["order_id"] != "o-1" {
+		t.Fatalf("waits = %+v, want a REVIEW wait on order o-1", exec.Waits)
+	}
+
+	cases := map[bool]string{true: "REWARD_POINT", false: "NOTIFY"}
+	for received, want := range cases {
+		resumed, err := g.Resume(attrs, "review", received)
+		if err != nil {
+			t.Fatalf("Resume(%v): %v", received, err)
+		}
+		if got := actionTypes(resumed); got != want {
+			t.Fatalf("Resume(%v) actions = %q, want %q", received, got, want)
+		}
+	}
+
+	if _, err := g.Resume(attrs, "thanks", true); err == nil {
+		t.Fatalf("Resume at an action node succeeded")
+	}
+}
+
+func TestFlowWaitMatches(t *testing.T) {
+	now := time.Now()
+	match, _ := json.Marshal(map[string]any{"order_id": "o-1", "customer.tier": "GOLD"})
+	w := &FlowWait{Status: WaitStatusWaiting, Match: match, ExpiresAt: now.Add(time.Hour)}
+
+	attrs := map[string]any{"order_id": "o-1", "customer": map[string]any{"tier": "GOLD"}}
+	if !w.Matches(attrs, now) {
+		t.Fatalf("wait doesn't match its event")
+	}
+
+	if w.Matches(map[string]any{"order_id": "o-2", "customer": map[string]any{"tier": "GOLD"}}, now) {
+		t.Fatalf("wait matches another order")
+	}
+
+	if w.Matches(attrs, now.Add(2*time.Hour)) {
+		t.Fatalf("expired wait matches")
+	}
+
+	w.Status = WaitStatusResolved
+	if w.Matches(attrs, now) {
+		t.Fatalf("resolved wait matches")
+	}
+}
+
+func TestValidateGraphChecksWaits(t *testing.T) {
+	nodes := []*Node{
+		trigger("start"),
+		waitNode("wait", &NodeWait{Duration: "soon"}),
+		waitEventNode("review", &NodeWaitEvent{Timeout: "3d"}),
+		rewardNode("yes", fixedReward),
+	}
+	edges := []*Edge{
+		edge("start", "wait", ""),
+		edge("wait", "review", ""),
+		edge("review", "yes", ""),
+	}
+
+	details := ValidateGraph(nodes, edges)
+	if detailFor(details, "nodes[1].wait.duration") == "" {
+		t.Fatalf("invalid duration not reported: %+v", details)
+	}
+	if detailFor(details, "nodes[2].wait_event.event") == "" {
+		t.Fatalf("missing event not reported: %+v", details)
+	}
+	if detailFor(details, "edges[2].type") == "" {
+		t.Fatalf("untyped edge leaving a wait for event not reported: %+v", details)
+	}
+}
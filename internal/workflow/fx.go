@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
 	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	consumer_handler "github.com/smallbiznis/smallbiznis-apps/internal/workflow/interfaces/consumer"
 	grpc_handler "github.com/smallbiznis/smallbiznis-apps/internal/workflow/interfaces/grpc"
+	task_handler "github.com/smallbiznis/smallbiznis-apps/internal/workflow/interfaces/task"
 	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/usecase"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/message"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/server"
 	"go.uber.org/fx"
@@ -39,6 +43,78 @@ func RegisterServiceHandlerFromEndpoint(lc fx.Lifecycle, mux *runtime.ServeMux,
 	})
 }
 
+// SeedFlowTemplates writes the built-in flow templates on start. A failure is logged,
+// the service starts with the templates it has.
+func SeedFlowTemplates(lc fx.Lifecycle, u *usecase.FlowUsecase) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := u.SeedFlowTemplates(ctx); err != nil {
+				zap.L().Error("failed to seed flow templates", zap.Error(err))
+			}
+			return nil
+		},
+	})
+}
+
+func newConsumerConfig(cfg *config.Config) *kafka.ConfigMap {
+	return &kafka.ConfigMap{
+		"bootstrap.servers": cfg.Kafka.Addrs,
+		"group.id":          fmt.Sprintf("%s.workflow.trigger", cfg.AppName),
+		"auto.offset.reset": "earliest",
+	}
+}
+
+func newDeadLetterPublisher(cfg *config.Config) (message.Publisher, error) {
+	return message.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers": cfg.Kafka.Addrs,
+	})
+}
+
+func StartConsumer(lc fx.Lifecycle, c *message.Consumer, p message.Publisher) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			c.Start(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			if err := c.Close(); err != nil {
+				zap.L().Error("failed to close trigger consumer", zap.Error(err))
+			}
+			return p.Close()
+		},
+	})
+}
+
+// Trigger consumes the configured Kafka topics and runs every event through the
+// flows of its organization listening on the topic's trigger. Install it alongside
+// Server and the temporal client.
+var Trigger = fx.Module("workflow.trigger",
+	fx.Provide(
+		newConsumerConfig,
+		newDeadLetterPublisher,
+		usecase.NewDispatcher,
+		consumer_handler.NewTriggerHandlers,
+		message.NewConsumer,
+	),
+	fx.Invoke(
+		StartConsumer,
+	),
+)
+
+// Schedule fires the flows on scheduled triggers, BIRTHDAY, ANNIVERSARY and SCHEDULE,
+// from a per-minute asynq tick. Install it alongside Server and the temporal client.
+var Schedule = fx.Module("workflow.schedule",
+	fx.Provide(
+		usecase.NewScheduler,
+	),
+	fx.Invoke(
+		task_handler.RegisterScheduleTasks,
+	),
+)
+
 var Server = fx.Module("workflow.service.server",
 	fx.Provide(
 		server.NewListener,
@@ -49,6 +125,12 @@ var Server = fx.Module("workflow.service.server",
 	fx.Provide(
 		repository.ProvideStore[domain.FlowTemplate],
 		repository.ProvideStore[domain.Flow],
+		repository.ProvideStore[domain.FlowVersion],
+		repository.ProvideStore[domain.FlowExecution],
+		repository.ProvideStore[domain.MemberProfile],
+		repository.ProvideStore[domain.FlowWait],
+		repository.ProvideStore[domain.FlowAssignment],
+		repository.ProvideStore[domain.FlowSettings],
 		repository.ProvideStore[domain.Node],
 		repository.ProvideStore[domain.Edge],
 		usecase.NewFlowUsecase,
@@ -57,6 +139,8 @@ var Server = fx.Module("workflow.service.server",
 	fx.Invoke(
 		RegisterServiceServer,
 		RegisterServiceHandlerFromEndpoint,
+		SeedFlowTemplates,
+		task_handler.RegisterRetentionTasks,
 		server.StartGRPCServer,
 	),
 	server.NewServer,
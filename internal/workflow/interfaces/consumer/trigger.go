@@ -0,0 +1,99 @@
+package consumer_handler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/message"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// DeadLetter is what a trigger event that couldn't be parsed is parked as. Value
+// is the original message, kept verbatim so it can be fixed and replayed.
+type DeadLetter struct {
+	Topic    string    `json:"topic"`
+	Trigger  string    `json:"trigger"`
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// TriggerHandler dispatches the events of one topic as executions of one trigger.
+type TriggerHandler struct {
+	topic           string
+	trigger         string
+	dispatcher      *usecase.Dispatcher
+	deadLetter      message.Publisher
+	deadLetterTopic string
+}
+
+func (h *TriggerHandler) Topic() string {
+	return h.topic
+}
+
+// Handle dispatches one event. An event that can't be parsed will never dispatch, so
+// it is sent to the dead-letter topic; its error is returned only when that fails.
+// Dispatch errors are returned for the consumer to retry the event, which holds the
+// partition until it goes through.
+func (h *TriggerHandler) Handle(ctx context.Context, key []byte, value []byte) error {
+	event, err := domain.ParseTriggerEvent(value)
+	if err != nil {
+		zap.L().Warn("dead-lettering trigger event", zap.Error(err), zap.String("topic", h.topic), zap.String("key", string(key)))
+		return h.deadLetter.Publish(ctx, h.deadLetterTopic, string(key), DeadLetter{
+			Topic:    h.topic,
+			Trigger:  h.trigger,
+			Key:      string(key),
+			Value:    string(value),
+			Error:    err.Error(),
+			FailedAt: time.Now(),
+		})
+	}
+
+	return h.dispatcher.Dispatch(ctx, h.trigger, event)
+}
+
+type TriggerParams struct {
+	fx.In
+	Config     *config.Config
+	Dispatcher *usecase.Dispatcher
+	DeadLetter message.Publisher
+}
+
+// NewTriggerHandlers builds a handler for every configured trigger topic.
+func NewTriggerHandlers(p TriggerParams) ([]message.ConsumerHandler, error) {
+	cfg := p.Config.Workflow
+	if len(cfg.TriggerTopics) == 0 {
+		return nil, errors.New("no workflow trigger topics configured")
+	}
+
+	if cfg.DeadLetterTopic == "" {
+		return nil, errors.New("no workflow dead-letter topic configured")
+	}
+
+	triggers := make([]string, 0, len(cfg.TriggerTopics))
+	for trigger := range cfg.TriggerTopics {
+		triggers = append(triggers, trigger)
+	}
+	sort.Strings(triggers)
+
+	handlers := make([]message.ConsumerHandler, 0, len(triggers))
+	for _, trigger := range triggers {
+		handlers = append(handlers, &TriggerHandler{
+			topic:           cfg.TriggerTopics[trigger],
+			trigger:         strings.ToUpper(trigger),
+			dispatcher:      p.Dispatcher,
+			deadLetter:      p.DeadLetter,
+			deadLetterTopic: cfg.DeadLetterTopic,
+		})
+	}
+
+	return handlers, nil
+}
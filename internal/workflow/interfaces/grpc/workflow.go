@@ -5,6 +5,7 @@ import (
 
 	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
 	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
 	"go.uber.org/fx"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -27,11 +28,38 @@ func NewFlowHandler(p Params) *FlowHandler {
 }
 
 func (h *FlowHandler) ListFlowTemplate(ctx context.Context, req *workflowv1.ListFlowTemplatesRequest) (*workflowv1.ListFlowTemplatesResponse, error) {
-	return h.workflowUsecase.ListFlowTemplate(ctx, req)
+	res, err := h.workflowUsecase.ListFlowTemplate(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
 }
 
 func (h *FlowHandler) GetFlowTemplate(ctx context.Context, req *workflowv1.GetFlowTemplateRequest) (*workflowv1.FlowTemplate, error) {
-	return h.workflowUsecase.GetFlowTemplate(ctx, req)
+	res, err := h.workflowUsecase.GetFlowTemplate(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) InstantiateFlowTemplate(ctx context.Context, req *workflowv1.InstantiateFlowTemplateRequest) (*workflowv1.Flow, error) {
+	if req.TemplateId == "" {
+		return nil, status.Error(codes.InvalidArgument, "templateId is required")
+	}
+
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.workflowUsecase.InstantiateFlowTemplate(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
 }
 
 func (h *FlowHandler) CreateFlow(ctx context.Context, req *workflowv1.CreateFlowRequest) (*workflowv1.Flow, error) {
@@ -59,7 +87,12 @@ func (h *FlowHandler) CreateFlow(ctx context.Context, req *workflowv1.CreateFlow
 		return nil, status.Error(codes.InvalidArgument, "overflow can't empty")
 	}
 
-	return h.workflowUsecase.CreateFlow(ctx, req)
+	res, err := h.workflowUsecase.CreateFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
 }
 
 func (h *FlowHandler) GetFlow(ctx context.Context, req *workflowv1.GetFlowRequest) (*workflowv1.Flow, error) {
@@ -91,5 +124,292 @@ func (h *FlowHandler) Updateflow(ctx context.Context, req *workflowv1.UpdateFlow
 		return nil, status.Error(codes.InvalidArgument, "overflow can't empty")
 	}
 
-	return h.workflowUsecase.Updateflow(ctx, req)
+	res, err := h.workflowUsecase.Updateflow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) SimulateFlow(ctx context.Context, req *workflowv1.SimulateFlowRequest) (*workflowv1.SimulateFlowResponse, error) {
+	if req.FlowId == "" && len(req.Nodes) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "flowId or nodes is required")
+	}
+
+	if req.GetAttributes() == nil {
+		return nil, status.Error(codes.InvalidArgument, "attributes is required")
+	}
+
+	res, err := h.workflowUsecase.SimulateFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) ListFlowVersions(ctx context.Context, req *workflowv1.ListFlowVersionsRequest) (*workflowv1.ListFlowVersionsResponse, error) {
+	if req.FlowId == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId and organizationId are required")
+	}
+
+	res, err := h.workflowUsecase.ListFlowVersions(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) GetFlowVersion(ctx context.Context, req *workflowv1.GetFlowVersionRequest) (*workflowv1.FlowVersion, error) {
+	if req.FlowId == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId and organizationId are required")
+	}
+
+	res, err := h.workflowUsecase.GetFlowVersion(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) PublishFlow(ctx context.Context, req *workflowv1.PublishFlowRequest) (*workflowv1.FlowVersion, error) {
+	if req.FlowId == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId and organizationId are required")
+	}
+
+	res, err := h.workflowUsecase.PublishFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) RollbackFlow(ctx context.Context, req *workflowv1.RollbackFlowRequest) (*workflowv1.FlowVersion, error) {
+	if req.FlowId == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId and organizationId are required")
+	}
+
+	if req.Version <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "version must be a published version")
+	}
+
+	res, err := h.workflowUsecase.RollbackFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) DiffFlowVersions(ctx context.Context, req *workflowv1.DiffFlowVersionsRequest) (*workflowv1.DiffFlowVersionsResponse, error) {
+	if req.FlowId == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId and organizationId are required")
+	}
+
+	if req.FromVersion < 0 || req.ToVersion < 0 {
+		return nil, status.Error(codes.InvalidArgument, "versions can't be negative")
+	}
+
+	res, err := h.workflowUsecase.DiffFlowVersions(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) ListFlowExecutions(ctx context.Context, req *workflowv1.ListFlowExecutionsRequest) (*workflowv1.ListFlowExecutionsResponse, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "pageSize can't be negative")
+	}
+
+	res, err := h.workflowUsecase.ListFlowExecutions(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) GetFlowExecution(ctx context.Context, req *workflowv1.GetFlowExecutionRequest) (*workflowv1.FlowExecution, error) {
+	if req.Id == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and organizationId are required")
+	}
+
+	res, err := h.workflowUsecase.GetFlowExecution(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) GetExperimentReport(ctx context.Context, req *workflowv1.GetExperimentReportRequest) (*workflowv1.ExperimentReport, error) {
+	if req.FlowId == "" || req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId and organizationId are required")
+	}
+
+	if req.StartTime != nil && req.EndTime != nil && !req.EndTime.AsTime().After(req.StartTime.AsTime()) {
+		return nil, status.Error(codes.InvalidArgument, "endTime must be after startTime")
+	}
+
+	res, err := h.workflowUsecase.GetExperimentReport(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) GetFlowSettings(ctx context.Context, req *workflowv1.GetFlowSettingsRequest) (*workflowv1.FlowSettings, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.workflowUsecase.GetFlowSettings(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) UpdateFlowSettings(ctx context.Context, req *workflowv1.UpdateFlowSettingsRequest) (*workflowv1.FlowSettings, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	res, err := h.workflowUsecase.UpdateFlowSettings(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) ExportFlow(ctx context.Context, req *workflowv1.ExportFlowRequest) (*workflowv1.ExportFlowResponse, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.FlowId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId is required")
+	}
+
+	res, err := h.workflowUsecase.ExportFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) ImportFlow(ctx context.Context, req *workflowv1.ImportFlowRequest) (*workflowv1.ImportFlowResponse, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.Document == "" {
+		return nil, status.Error(codes.InvalidArgument, "document is required")
+	}
+
+	res, err := h.workflowUsecase.ImportFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) PauseFlow(ctx context.Context, req *workflowv1.PauseFlowRequest) (*workflowv1.Flow, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.FlowId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId is required")
+	}
+
+	res, err := h.workflowUsecase.PauseFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) ResumeFlow(ctx context.Context, req *workflowv1.ResumeFlowRequest) (*workflowv1.Flow, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.FlowId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId is required")
+	}
+
+	res, err := h.workflowUsecase.ResumeFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) ArchiveFlow(ctx context.Context, req *workflowv1.ArchiveFlowRequest) (*workflowv1.Flow, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.FlowId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId is required")
+	}
+
+	res, err := h.workflowUsecase.ArchiveFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) CloneFlow(ctx context.Context, req *workflowv1.CloneFlowRequest) (*workflowv1.Flow, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.FlowId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId is required")
+	}
+
+	res, err := h.workflowUsecase.CloneFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (h *FlowHandler) DeleteFlow(ctx context.Context, req *workflowv1.DeleteFlowRequest) (*workflowv1.DeleteFlowResponse, error) {
+	if req.OrganizationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "organizationId is required")
+	}
+
+	if req.FlowId == "" {
+		return nil, status.Error(codes.InvalidArgument, "flowId is required")
+	}
+
+	res, err := h.workflowUsecase.DeleteFlow(ctx, req)
+	if err != nil {
+		return nil, errutil.ToGRPCError(err)
+	}
+
+	return res, nil
 }
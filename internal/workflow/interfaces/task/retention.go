@@ -0,0 +1,40 @@
+package task_handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/usecase"
+	asynqx "github.com/smallbiznis/smallbiznis-apps/pkg/asynq"
+	"go.uber.org/fx"
+)
+
+// retentionSchedule runs at 03:00 UTC every day.
+const retentionSchedule = "0 3 * * *"
+
+type RetentionParams struct {
+	fx.In
+	Mux       *asynq.ServeMux  `optional:"true"`
+	Scheduler *asynq.Scheduler `optional:"true"`
+	Flow      *usecase.FlowUsecase
+}
+
+// RegisterRetentionTasks handles the execution history purge when an asynq server is
+// installed and schedules it when an asynq scheduler is installed.
+func RegisterRetentionTasks(p RetentionParams) error {
+	if p.Mux != nil {
+		p.Mux.HandleFunc(asynqx.FlowExecutionRetentionTask, func(ctx context.Context, t *asynq.Task) error {
+			_, err := p.Flow.PurgeExecutions(ctx, time.Now())
+			return err
+		})
+	}
+
+	if p.Scheduler != nil {
+		if _, err := p.Scheduler.Register(retentionSchedule, asynq.NewTask(asynqx.FlowExecutionRetentionTask, nil), asynq.Unique(time.Hour)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package task_handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/usecase"
+	asynqx "github.com/smallbiznis/smallbiznis-apps/pkg/asynq"
+	"go.uber.org/fx"
+)
+
+// scheduleTick runs every minute; each flow's own cron decides whether it fires.
+const scheduleTick = "* * * * *"
+
+type ScheduleParams struct {
+	fx.In
+	Mux       *asynq.ServeMux  `optional:"true"`
+	Scheduler *asynq.Scheduler `optional:"true"`
+	Flows     *usecase.Scheduler
+}
+
+// RegisterScheduleTasks handles the schedule tick when an asynq server is installed
+// and schedules it when an asynq scheduler is installed.
+func RegisterScheduleTasks(p ScheduleParams) error {
+	if p.Mux != nil {
+		p.Mux.HandleFunc(asynqx.FlowScheduleTask, func(ctx context.Context, t *asynq.Task) error {
+			return p.Flows.Tick(ctx, time.Now())
+		})
+	}
+
+	if p.Scheduler != nil {
+		if _, err := p.Scheduler.Register(scheduleTick, asynq.NewTask(asynqx.FlowScheduleTask, nil), asynq.Unique(time.Minute)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	wf "github.com/smallbiznis/smallbiznis-apps/pkg/workflow"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/activities"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Dispatcher turns trigger events into flow executions.
+type Dispatcher struct {
+	flow     repository.Repository[domain.Flow]
+	profile  repository.Repository[domain.MemberProfile]
+	wait     repository.Repository[domain.FlowWait]
+	temporal client.Client
+}
+
+type DispatcherParams struct {
+	fx.In
+	Flow     repository.Repository[domain.Flow]
+	Profile  repository.Repository[domain.MemberProfile]
+	Wait     repository.Repository[domain.FlowWait]
+	Temporal client.Client
+}
+
+func NewDispatcher(p DispatcherParams) *Dispatcher {
+	return &Dispatcher{
+		flow:     p.Flow,
+		profile:  p.Profile,
+		wait:     p.Wait,
+		temporal: p.Temporal,
+	}
+}
+
+// Dispatch starts the EarnPoint execution of an event when its organization has an
+// active flow on the trigger. The execution runs under an ID derived from the event
+// and IDs are never reused, so a redelivered event is dropped as a duplicate.
+//
+// The event first resumes the member's executions waiting for it.
+func (d *Dispatcher) Dispatch(ctx context.Context, trigger string, event *domain.TriggerEvent) error {
+	fields := []zap.Field{
+		zap.String("organization_id", event.OrganizationID),
+		zap.String("trigger", trigger),
+		zap.String("event_id", event.ID),
+	}
+
+	if err := d.recordProfile(ctx, event); err != nil {
+		zap.L().With(fields...).Error("failed to record member profile", zap.Error(err))
+		return err
+	}
+
+	if err := d.resumeWaits(ctx, trigger, event); err != nil {
+		zap.L().With(fields...).Error("failed to resume waiting executions", zap.Error(err))
+		return err
+	}
+
+	active, err := d.flow.Count(ctx, &domain.Flow{
+		OrganizationID: event.OrganizationID,
+		Trigger:        trigger,
+		Status:         workflowv1.FlowStatus_ACTIVE.String(),
+	})
+	if err != nil {
+		zap.L().With(fields...).Error("failed to count active flows", zap.Error(err))
+		return err
+	}
+
+	if active == 0 {
+		zap.L().With(fields...).Debug("no active flow on trigger")
+		return nil
+	}
+
+	started, err := startEarnPoint(ctx, d.temporal, event.WorkflowID(trigger), &activities.EarnPointRequest{
+		OrganizationID: event.OrganizationID,
+		UserID:         event.UserID,
+		ReferenceID:    event.ReferenceID,
+		Trigger:        trigger,
+		Attributes:     event.Attributes,
+	})
+	if err != nil {
+		zap.L().With(fields...).Error("failed to start flow execution", zap.Error(err))
+		return err
+	}
+
+	if !started {
+		zap.L().With(fields...).Info("duplicate trigger event dropped")
+	}
+
+	return nil
+}
+
+// recordProfile keeps the member's dates and customer attributes for scheduled flows.
+func (d *Dispatcher) recordProfile(ctx context.Context, event *domain.TriggerEvent) error {
+	profile := domain.ProfileFromEvent(event)
+	if profile == nil {
+		return nil
+	}
+
+	exist, err := d.profile.FindOne(ctx, &domain.MemberProfile{
+		OrganizationID: profile.OrganizationID,
+		UserID:         profile.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if exist == nil {
+		return d.profile.Create(ctx, profile)
+	}
+
+	return d.profile.Update(ctx, exist.ID, profile.Updates())
+}
+
+// resumeWaits signals the executions of the member waiting for the event. A wait
+// whose execution is gone is left to expire.
+func (d *Dispatcher) resumeWaits(ctx context.Context, trigger string, event *domain.TriggerEvent) error {
+	if event.UserID == "" {
+		return nil
+	}
+
+	waits, err := d.wait.Find(ctx, &domain.FlowWait{
+		OrganizationID: event.OrganizationID,
+		UserID:         event.UserID,
+		Event:          trigger,
+		Status:         domain.WaitStatusWaiting,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, w := range waits {
+		if !w.Matches(event.Attributes, now) {
+			continue
+		}
+
+		if err := d.temporal.SignalWorkflow(ctx, w.WorkflowID, "", domain.WaitSignal(w.ID), event.Attributes); err != nil {
+			zap.L().Warn("failed to signal waiting execution", zap.Error(err), zap.String("wait_id", w.ID), zap.String("workflow_id", w.WorkflowID))
+			continue
+		}
+
+		zap.L().Info("waiting execution resumed", zap.String("wait_id", w.ID), zap.String("event_id", event.ID))
+	}
+
+	return nil
+}
+
+// startEarnPoint starts an EarnPoint execution under id. IDs are never reused, so it
+// reports false when an execution with the id was already started.
+func startEarnPoint(ctx context.Context, c client.Client, id string, req *activities.EarnPointRequest) (bool, error) {
+	run, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:                                       id,
+		TaskQueue:                                wf.POINT_TASK_QUEUE.String(),
+		WorkflowIDReusePolicy:                    enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+		WorkflowExecutionErrorWhenAlreadyStarted: true,
+	}, wf.WorkflowEarnPoint, req)
+	if temporal.IsWorkflowExecutionAlreadyStartedError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	zap.L().Info("flow execution started", zap.String("workflow_id", run.GetID()), zap.String("run_id", run.GetRunID()))
+	return true, nil
+}
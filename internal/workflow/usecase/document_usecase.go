@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	webhook "github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ExportFlow writes the flow's live version as a flow document, in JSON unless YAML
+// is asked for.
+func (u *FlowUsecase) ExportFlow(ctx context.Context, req *workflowv1.ExportFlowRequest) (*workflowv1.ExportFlowResponse, error) {
+	flow, err := u.ownedFlow(ctx, req.FlowId, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if flow.Version == 0 {
+		return nil, errutil.BadRequest("flow has no published version to export", nil)
+	}
+
+	doc, err := domain.ExportFlow(flow)
+	if err != nil {
+		zap.L().Error("failed to export flow", zap.Error(err), zap.String("flow_id", flow.ID))
+		return nil, err
+	}
+
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		format = domain.DocumentJSON
+	}
+
+	b, err := doc.Encode(format)
+	if err != nil {
+		return nil, errutil.BadRequest("invalid format", nil, errutil.WithErr(err))
+	}
+
+	return &workflowv1.ExportFlowResponse{
+		Document: string(b),
+		Format:   format,
+	}, nil
+}
+
+// ImportFlow creates a flow of the organization from a flow document in JSON or
+// YAML. The flow is created INACTIVE with the document's graph as its draft, under
+// new node and edge IDs; it runs once the draft is published and the flow is
+// activated.
+func (u *FlowUsecase) ImportFlow(ctx context.Context, req *workflowv1.ImportFlowRequest) (*workflowv1.ImportFlowResponse, error) {
+	doc, err := domain.ParseFlowDocument([]byte(req.Document))
+	if err != nil {
+		return nil, errutil.BadRequest("invalid flow document", nil, errutil.WithErr(err))
+	}
+
+	if req.Name != "" {
+		doc.Name = req.Name
+	}
+
+	flow, graph, details := doc.Import(req.OrganizationId)
+	if len(details) > 0 {
+		return nil, errutil.ValidationFailed("invalid flow document", nil, errutil.WithDetails(details...))
+	}
+
+	if err := u.resolveTimezone(ctx, graph); err != nil {
+		return nil, err
+	}
+
+	draft := domain.NewDraft(flow.ID, graph)
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := u.flow.WithTrx(tx).Create(ctx, flow); err != nil {
+			return err
+		}
+		return u.version.WithTrx(tx).Create(ctx, draft)
+	}); err != nil {
+		zap.L().Error("failed import flow", zap.Error(err), zap.String("organization_id", req.OrganizationId))
+		return nil, err
+	}
+
+	u.publish(ctx, webhook.TopicFlowCreated, flow)
+
+	created, err := u.GetFlow(ctx, &workflowv1.GetFlowRequest{Id: flow.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &workflowv1.ImportFlowResponse{
+		Flow:  created,
+		Draft: toFlowVersionProto(draft),
+	}, nil
+}
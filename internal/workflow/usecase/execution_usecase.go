@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/pagination"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultExecutionPage = 50
+	maxExecutionPage     = 250
+
+	// purgeBatch bounds each delete of the retention purge, so it never holds a long
+	// lock on the table.
+	purgeBatch = 1000
+)
+
+// ListFlowExecutions lists the organization's execution history, newest first,
+// narrowed down to a flow, a user or a reference when given.
+func (u *FlowUsecase) ListFlowExecutions(ctx context.Context, req *workflowv1.ListFlowExecutionsRequest) (*workflowv1.ListFlowExecutionsResponse, error) {
+	limit := int(req.PageSize)
+	if limit <= 0 {
+		limit = defaultExecutionPage
+	}
+	limit = min(limit, maxExecutionPage)
+
+	executions, err := u.execution.Find(ctx, &domain.FlowExecution{
+		OrganizationID: req.OrganizationId,
+		FlowID:         req.FlowId,
+		UserID:         req.UserId,
+		ReferenceID:    req.ReferenceId,
+	},
+		option.WithSortBy(option.QuerySortBy{OrderBy: "desc"}),
+		option.ApplyPagination(pagination.Pagination{Limit: limit}),
+	)
+	if err != nil {
+		zap.L().Error("failed to query flow executions", zap.Error(err), zap.String("organization_id", req.OrganizationId))
+		return nil, err
+	}
+
+	if len(executions) > limit {
+		executions = executions[:limit]
+	}
+
+	res := &workflowv1.ListFlowExecutionsResponse{}
+	for _, e := range executions {
+		exec, err := toFlowExecutionProto(e)
+		if err != nil {
+			return nil, err
+		}
+		res.Data = append(res.Data, exec)
+	}
+
+	return res, nil
+}
+
+func (u *FlowUsecase) GetFlowExecution(ctx context.Context, req *workflowv1.GetFlowExecutionRequest) (*workflowv1.FlowExecution, error) {
+	exec, err := u.execution.FindOne(ctx, &domain.FlowExecution{
+		ID:             req.Id,
+		OrganizationID: req.OrganizationId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if exec == nil {
+		return nil, errutil.NotFound("flow execution not found", nil)
+	}
+
+	return toFlowExecutionProto(exec)
+}
+
+// PurgeExecutions deletes the settled execution history last touched before the
+// retention period and returns how many records went. Records that can still resume,
+// WAITING ones and any with an event wait open, are kept whatever their age. Waits
+// expired before the cutoff and older split assignments go too, as does the usage of
+// cap windows that have ended.
+func (u *FlowUsecase) PurgeExecutions(ctx context.Context, now time.Time) (int64, error) {
+	cutoff := now.Add(-u.retention)
+
+	waiting := u.db.WithContext(ctx).Model(&domain.FlowWait{}).
+		Select("1").
+		Where("flow_waits.execution_id = flow_executions.id").
+		Where("flow_waits.status = ?", domain.WaitStatusWaiting)
+
+	var purged int64
+	for {
+		batch := u.db.WithContext(ctx).Model(&domain.FlowExecution{}).
+			Select("id").
+			Where("updated_at < ?", cutoff).
+			Where("status IN ?", domain.SettledExecutionStatuses).
+			Where("NOT EXISTS (?)", waiting).
+			Limit(purgeBatch)
+
+		result := u.db.WithContext(ctx).Where("id IN (?)", batch).Delete(&domain.FlowExecution{})
+		if result.Error != nil {
+			zap.L().Error("failed to purge flow executions", zap.Error(result.Error), zap.Time("cutoff", cutoff))
+			return purged, result.Error
+		}
+
+		purged += result.RowsAffected
+		if result.RowsAffected < purgeBatch {
+			break
+		}
+	}
+
+	if err := u.db.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&domain.FlowWait{}).Error; err != nil {
+		zap.L().Error("failed to purge flow waits", zap.Error(err), zap.Time("cutoff", cutoff))
+		return purged, err
+	}
+
+	if err := u.db.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&domain.FlowAssignment{}).Error; err != nil {
+		zap.L().Error("failed to purge flow assignments", zap.Error(err), zap.Time("cutoff", cutoff))
+		return purged, err
+	}
+
+	if err := u.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&domain.FrequencyUsage{}).Error; err != nil {
+		zap.L().Error("failed to purge frequency usage", zap.Error(err), zap.Time("now", now))
+		return purged, err
+	}
+
+	zap.L().Info("purged flow executions", zap.Int64("count", purged), zap.Time("cutoff", cutoff))
+	return purged, nil
+}
+
+func toFlowExecutionProto(e *domain.FlowExecution) (*workflowv1.FlowExecution, error) {
+	event, err := structpb.NewStruct(e.GetEvent())
+	if err != nil {
+		return nil, errutil.BadRequest("invalid execution event", nil, errutil.WithErr(err))
+	}
+
+	res := &workflowv1.FlowExecution{
+		Id:             e.ID,
+		OrganizationId: e.OrganizationID,
+		FlowId:         e.FlowID,
+		FlowVersion:    e.FlowVersion,
+		WorkflowId:     e.WorkflowID,
+		Trigger:        e.Trigger,
+		UserId:         e.UserID,
+		ReferenceId:    e.ReferenceID,
+		Event:          event,
+		Points:         e.Points,
+		LedgerEntryIds: e.GetLedgerEntryIDs(),
+		Status:         e.Status,
+		Error:          e.Error,
+		SkipReason:     e.SkipReason,
+		DurationMs:     e.DurationMs,
+		CreatedAt:      timestamppb.New(e.CreatedAt),
+		UpdatedAt:      timestamppb.New(e.UpdatedAt),
+	}
+
+	for _, step := range e.GetTrace() {
+		res.Steps = append(res.Steps, toStepProto(step))
+	}
+
+	for _, a := range e.GetActions() {
+		params, err := actionParameters(a)
+		if err != nil {
+			return nil, err
+		}
+		res.Actions = append(res.Actions, &workflowv1.ExecutionAction{Type: a.Type, Parameters: params})
+	}
+
+	return res, nil
+}
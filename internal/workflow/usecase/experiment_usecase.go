@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// GetExperimentReport compares the outcomes of the variants of the flow's splits:
+// how many members and executions each got, how many were rewarded and with how
+// many points, and how many members came back. Variants of the current version come
+// in their declared order, variants only earlier versions had after them.
+func (u *FlowUsecase) GetExperimentReport(ctx context.Context, req *workflowv1.GetExperimentReportRequest) (*workflowv1.ExperimentReport, error) {
+	flow, err := u.flow.FindOne(ctx, &domain.Flow{
+		ID:             req.FlowId,
+		OrganizationID: req.OrganizationId,
+	})
+	if err != nil {
+		zap.L().Error("failed to query get flow", zap.Error(err))
+		return nil, err
+	}
+
+	if flow == nil {
+		return nil, errutil.NotFound("flow not found", nil)
+	}
+
+	graph, err := flow.BuildFlowGraph()
+	if err != nil {
+		return nil, errutil.BadRequest("invalid flow graph", nil, errutil.WithErr(err))
+	}
+
+	stats, err := u.variantStats(ctx, req)
+	if err != nil {
+		zap.L().Error("failed to query experiment outcomes", zap.Error(err), zap.String("flow_id", flow.ID))
+		return nil, err
+	}
+
+	byVariant := map[[2]string]*domain.VariantStats{}
+	for _, s := range stats {
+		byVariant[[2]string{s.NodeID, s.Variant}] = s
+	}
+
+	res := &workflowv1.ExperimentReport{FlowId: flow.ID}
+	experiments := map[string]*workflowv1.ExperimentResult{}
+	experiment := func(nodeID, name string) *workflowv1.ExperimentResult {
+		if e, ok := experiments[nodeID]; ok {
+			return e
+		}
+		e := &workflowv1.ExperimentResult{NodeId: nodeID, Experiment: name}
+		experiments[nodeID] = e
+		res.Experiments = append(res.Experiments, e)
+		return e
+	}
+
+	var splits []*domain.Node
+	for _, n := range graph.Nodes {
+		if n.Type == workflowv1.NodeType_SPLIT && n.Split != nil {
+			splits = append(splits, n)
+		}
+	}
+	sort.Slice(splits, func(i, j int) bool { return splits[i].ID < splits[j].ID })
+
+	for _, n := range splits {
+		e := experiment(n.ID, n.Split.Experiment)
+		if e.Experiment == "" {
+			e.Experiment = n.ID
+		}
+
+		for _, v := range n.Split.Variants {
+			s, ok := byVariant[[2]string{n.ID, v.Key}]
+			if !ok {
+				s = &domain.VariantStats{NodeID: n.ID, Variant: v.Key}
+			}
+			delete(byVariant, [2]string{n.ID, v.Key})
+
+			e.Variants = append(e.Variants, toVariantOutcome(s, v.Weight))
+		}
+	}
+
+	for _, s := range stats {
+		if _, ok := byVariant[[2]string{s.NodeID, s.Variant}]; !ok {
+			continue
+		}
+
+		e := experiment(s.NodeID, s.Experiment)
+		e.Variants = append(e.Variants, toVariantOutcome(s, 0))
+	}
+
+	return res, nil
+}
+
+// variantStats aggregates the outcomes of the flow's assignments in the report's
+// period, one row per split and variant.
+func (u *FlowUsecase) variantStats(ctx context.Context, req *workflowv1.GetExperimentReportRequest) ([]*domain.VariantStats, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("a.organization_id = ? AND a.flow_id = ?", req.OrganizationId, req.FlowId)
+		if req.StartTime != nil {
+			db = db.Where("a.created_at >= ?", req.StartTime.AsTime())
+		}
+		if req.EndTime != nil {
+			db = db.Where("a.created_at < ?", req.EndTime.AsTime())
+		}
+		return db
+	}
+
+	var stats []*domain.VariantStats
+	if err := u.db.WithContext(ctx).Table("flow_assignments AS a").
+		Select(`a.node_id, MAX(a.experiment) AS experiment, a.variant,
+			COUNT(DISTINCT a.user_id) AS members,
+			COUNT(*) AS executions,
+			SUM(CASE WHEN e.points > 0 THEN 1 ELSE 0 END) AS rewarded_executions,
+			COALESCE(SUM(e.points), 0) AS points`).
+		Joins("JOIN flow_executions e ON e.id = a.execution_id").
+		Scopes(scope).
+		Group("a.node_id, a.variant").
+		Order("a.node_id, a.variant").
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	members := u.db.WithContext(ctx).Table("flow_assignments AS a").
+		Select("a.node_id, a.variant, a.user_id").
+		Scopes(scope).
+		Group("a.node_id, a.variant, a.user_id").
+		Having("COUNT(*) > 1")
+
+	var repeats []*domain.VariantStats
+	if err := u.db.WithContext(ctx).Table("(?) AS r", members).
+		Select("r.node_id, r.variant, COUNT(*) AS repeat_members").
+		Group("r.node_id, r.variant").
+		Scan(&repeats).Error; err != nil {
+		return nil, err
+	}
+
+	for _, r := range repeats {
+		for _, s := range stats {
+			if s.NodeID == r.NodeID && s.Variant == r.Variant {
+				s.RepeatMembers = r.RepeatMembers
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func toVariantOutcome(s *domain.VariantStats, weight int) *workflowv1.VariantOutcome {
+	return &workflowv1.VariantOutcome{
+		Variant:            s.Variant,
+		Weight:             int32(weight),
+		Members:            s.Members,
+		Executions:         s.Executions,
+		RewardedExecutions: s.RewardedExecutions,
+		Points:             s.Points,
+		PointsPerMember:    s.PointsPerMember(),
+		RepeatMembers:      s.RepeatMembers,
+		RepeatRate:         s.RepeatRate(),
+	}
+}
@@ -2,40 +2,117 @@ package usecase
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"time"
 
 	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	webhook "github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	webhook_usecase "github.com/smallbiznis/smallbiznis-apps/internal/webhook/usecase"
 	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
 	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
 )
 
 type FlowUsecase struct {
-	db       *gorm.DB
-	template repository.Repository[domain.FlowTemplate]
-	flow     repository.Repository[domain.Flow]
+	db        *gorm.DB
+	template  repository.Repository[domain.FlowTemplate]
+	flow      repository.Repository[domain.Flow]
+	version   repository.Repository[domain.FlowVersion]
+	execution repository.Repository[domain.FlowExecution]
+	settings  repository.Repository[domain.FlowSettings]
+	webhook   webhook_usecase.Publisher
+	retention time.Duration
 }
 
 type Params struct {
 	fx.In
-	DB       *gorm.DB
-	Template repository.Repository[domain.FlowTemplate]
-	Flow     repository.Repository[domain.Flow]
+	DB        *gorm.DB
+	Template  repository.Repository[domain.FlowTemplate]
+	Flow      repository.Repository[domain.Flow]
+	Version   repository.Repository[domain.FlowVersion]
+	Execution repository.Repository[domain.FlowExecution]
+	Settings  repository.Repository[domain.FlowSettings]
+	Webhook   webhook_usecase.Publisher `optional:"true"`
+	Config    *config.Config            `optional:"true"`
 }
 
 func NewFlowUsecase(p Params) *FlowUsecase {
+	retention := domain.DefaultExecutionRetention
+	if p.Config != nil && p.Config.Workflow.ExecutionRetention > 0 {
+		retention = p.Config.Workflow.ExecutionRetention
+	}
+
 	return &FlowUsecase{
-		db:       p.DB,
-		template: p.Template,
-		flow:     p.Flow,
+		db:        p.DB,
+		template:  p.Template,
+		flow:      p.Flow,
+		version:   p.Version,
+		execution: p.Execution,
+		settings:  p.Settings,
+		webhook:   p.Webhook,
+		retention: retention,
 	}
 }
 
+type flowEvent struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	Name           string `json:"name"`
+	Trigger        string `json:"trigger"`
+	Status         string `json:"status"`
+	Version        int32  `json:"version"`
+}
+
+// publish notifies the flow's organization. Failures are logged, the flow change stands.
+func (u *FlowUsecase) publish(ctx context.Context, topic string, flow *domain.Flow) {
+	if u.webhook == nil {
+		return
+	}
+
+	if err := u.webhook.Publish(ctx, flow.OrganizationID, topic, flowEvent{
+		ID:             flow.ID,
+		OrganizationID: flow.OrganizationID,
+		Name:           flow.Name,
+		Trigger:        flow.Trigger,
+		Status:         flow.Status,
+		Version:        flow.Version,
+	}); err != nil {
+		zap.L().Error("failed to publish flow event", zap.Error(err), zap.String("flow_id", flow.ID))
+	}
+}
+
+// ListFlowTemplate lists the template catalog, narrowed by trigger, category and
+// status when they are set.
 func (u *FlowUsecase) ListFlowTemplate(ctx context.Context, req *workflowv1.ListFlowTemplatesRequest) (*workflowv1.ListFlowTemplatesResponse, error) {
-	return &workflowv1.ListFlowTemplatesResponse{}, nil
+	filter := domain.FlowTemplate{
+		Trigger:  req.Trigger,
+		Category: req.Category,
+	}
+	if req.Status != workflowv1.FlowStatus_FLOW_STATUS_UNSPECIFIED {
+		filter.Status = req.Status.String()
+	}
+
+	templates, err := u.template.Find(ctx, &filter)
+	if err != nil {
+		zap.L().Error("failed to query list template", zap.Error(err))
+		return nil, err
+	}
+
+	var result []*workflowv1.FlowTemplate
+	for _, template := range templates {
+		result = append(result, toFlowTemplateProto(template))
+	}
+
+	return &workflowv1.ListFlowTemplatesResponse{
+		Data: result,
+	}, nil
 }
 
 func (u *FlowUsecase) GetFlowTemplate(ctx context.Context, req *workflowv1.GetFlowTemplateRequest) (*workflowv1.FlowTemplate, error) {
@@ -47,15 +124,11 @@ func (u *FlowUsecase) GetFlowTemplate(ctx context.Context, req *workflowv1.GetFl
 		return nil, err
 	}
 
-	return &workflowv1.FlowTemplate{
-		Id:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		Status:      workflowv1.FlowStatus(workflowv1.FlowStatus_value[template.Status]),
-		Nodes:       template.GetNodes(),
-		Edges:       template.GetEdges(),
-		Overflow:    template.GetOverflow(),
-	}, nil
+	if template == nil {
+		return nil, errutil.NotFound("flow template not found", nil)
+	}
+
+	return toFlowTemplateProto(template), nil
 }
 
 func (u *FlowUsecase) CreateFlow(ctx context.Context, req *workflowv1.CreateFlowRequest) (*workflowv1.Flow, error) {
@@ -69,6 +142,8 @@ func (u *FlowUsecase) CreateFlow(ctx context.Context, req *workflowv1.CreateFlow
 		OrganizationID: req.OrganizationId,
 		Name:           req.Name,
 	})
+	flow.Budget = req.Budget
+	flow.Priority, flow.ExclusiveGroup = req.Priority, req.ExclusiveGroup
 
 	if err := flow.SetNodes(req.Nodes); err != nil {
 		zap.L().With(fields...).Error("failed setNodes", zap.Error(err))
@@ -85,11 +160,33 @@ func (u *FlowUsecase) CreateFlow(ctx context.Context, req *workflowv1.CreateFlow
 		return nil, err
 	}
 
-	if err := u.flow.Create(ctx, flow); err != nil {
+	if details := append(flow.Validate(), domain.ValidateBudget(flow.Budget)...); len(details) > 0 {
+		return nil, errutil.ValidationFailed("invalid flow graph", nil, errutil.WithDetails(details...))
+	}
+
+	if err := u.resolveTimezone(ctx, flow); err != nil {
+		return nil, err
+	}
+
+	// A new flow goes live as version 1; later edits go through drafts.
+	first := domain.NewDraft(flow.ID, flow)
+	if err := first.Publish(1, time.Now()); err != nil {
+		return nil, err
+	}
+	flow.GoLive(first)
+
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := u.flow.WithTrx(tx).Create(ctx, flow); err != nil {
+			return err
+		}
+		return u.version.WithTrx(tx).Create(ctx, first)
+	}); err != nil {
 		zap.L().With(fields...).Error("failed create flow", zap.Error(err))
 		return nil, err
 	}
 
+	u.publish(ctx, webhook.TopicFlowCreated, flow)
+
 	return u.GetFlow(ctx, &workflowv1.GetFlowRequest{Id: flow.ID})
 }
 
@@ -113,9 +210,26 @@ func (u *FlowUsecase) GetFlow(ctx context.Context, req *workflowv1.GetFlowReques
 		Overflow:       flow.GetOverflow(),
 		CreatedAt:      timestamppb.New(flow.CreatedAt),
 		UpdatedAt:      timestamppb.New(flow.UpdatedAt),
+		Version:        flow.Version,
+		Budget:         toBudgetProto(flow),
+		Priority:       flow.Priority,
+		ExclusiveGroup: flow.ExclusiveGroup,
 	}, nil
 }
 
+// toBudgetProto reports the flow's budget; nil for a flow without one.
+func toBudgetProto(flow *domain.Flow) *workflowv1.FlowBudget {
+	if !flow.Budgeted() {
+		return nil
+	}
+
+	return &workflowv1.FlowBudget{
+		Total:     flow.Budget,
+		Consumed:  flow.BudgetConsumed,
+		Remaining: flow.BudgetRemaining(),
+	}
+}
+
 func (u *FlowUsecase) ListFlow(ctx context.Context, req *workflowv1.ListFlowsRequest) (*workflowv1.ListFlowsResponse, error) {
 	flows, err := u.flow.Find(ctx, &domain.Flow{
 		OrganizationID: req.OrganizationId,
@@ -139,6 +253,10 @@ func (u *FlowUsecase) ListFlow(ctx context.Context, req *workflowv1.ListFlowsReq
 			Overflow:       flow.GetOverflow(),
 			CreatedAt:      timestamppb.New(flow.CreatedAt),
 			UpdatedAt:      timestamppb.New(flow.UpdatedAt),
+			Version:        flow.Version,
+			Budget:         toBudgetProto(flow),
+			Priority:       flow.Priority,
+			ExclusiveGroup: flow.ExclusiveGroup,
 		})
 	}
 
@@ -147,45 +265,239 @@ func (u *FlowUsecase) ListFlow(ctx context.Context, req *workflowv1.ListFlowsReq
 	}, nil
 }
 
+// Updateflow changes the flow's name, description, status, budget and stacking
+// priority in place and saves its graph as the flow's draft. The live graph only
+// changes when the draft is published, and the status only where the lifecycle
+// allows. A budget of zero removes the flow's budget; what it consumed is kept.
+// Priority and exclusive group change only when the update mask names them. An
+// archived flow can't be updated.
 func (u *FlowUsecase) Updateflow(ctx context.Context, req *workflowv1.UpdateFlowRequest) (*workflowv1.Flow, error) {
-	exist, err := u.flow.FindOne(ctx, &domain.Flow{
-		ID: req.Id,
+	update := domain.Flow{
+		Name:        req.Flow.Name,
+		Description: req.Flow.Description,
+	}
+
+	graph := domain.Flow{OrganizationID: req.Flow.OrganizationId}
+	if err := graph.SetNodes(req.Flow.Nodes); err != nil {
+		return nil, invalidNodes(err)
+	}
+
+	if err := graph.SetEdges(req.Flow.Edges); err != nil {
+		return nil, errutil.BadRequest("invalid edges", nil, errutil.WithErr(err))
+	}
+
+	if err := graph.SetOverview(req.Flow.Overflow); err != nil {
+		return nil, errutil.BadRequest("invalid overflow", nil, errutil.WithErr(err))
+	}
+
+	details := graph.Validate()
+	if b := req.Flow.GetBudget(); b != nil {
+		details = append(details, domain.ValidateBudget(b.GetTotal())...)
+	}
+
+	if len(details) > 0 {
+		return nil, errutil.ValidationFailed("invalid flow graph", nil, errutil.WithDetails(details...))
+	}
+
+	if err := u.resolveTimezone(ctx, &graph); err != nil {
+		return nil, err
+	}
+
+	var updated *domain.Flow
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		exist, err := u.lockFlow(ctx, tx, req.Id, req.Flow.OrganizationId)
+		if err != nil {
+			return err
+		}
+
+		if err := exist.Editable(); err != nil {
+			return errutil.Conflict("flow is archived", nil, errutil.WithErr(err))
+		}
+
+		// A status change goes through the lifecycle, as with PauseFlow and the like.
+		if status := req.Flow.Status; status != workflowv1.FlowStatus_FLOW_STATUS_UNSPECIFIED && status.String() != exist.Status {
+			if err := exist.Transition(status.String()); err != nil {
+				return errutil.UnprocessableEntity("invalid status change", nil, errutil.WithErr(err))
+			}
+			update.Status = exist.Status
+		}
+
+		if err := u.flow.WithTrx(tx).Update(ctx, exist.ID, &update); err != nil {
+			return err
+		}
+
+		// Set apart from the update above, which skips zero values, and only when the
+		// update mask names them.
+		stacking := domain.StackingUpdates(req.GetUpdateMask().GetPaths(), req.Flow.Priority, req.Flow.ExclusiveGroup)
+		if len(stacking) > 0 {
+			if err := u.flow.WithTrx(tx).Update(ctx, exist.ID, stacking); err != nil {
+				return err
+			}
+		}
+		if _, ok := stacking["priority"]; ok {
+			exist.Priority = req.Flow.Priority
+		}
+		if _, ok := stacking["exclusive_group"]; ok {
+			exist.ExclusiveGroup = req.Flow.ExclusiveGroup
+		}
+
+		if b := req.Flow.GetBudget(); b != nil {
+			if err := u.flow.WithTrx(tx).Update(ctx, exist.ID, map[string]any{"budget": b.GetTotal()}); err != nil {
+				return err
+			}
+			exist.Budget = b.GetTotal()
+		}
+
+		draft, err := u.version.WithTrx(tx).FindOne(ctx, &domain.FlowVersion{
+			FlowID: exist.ID,
+			Status: domain.VersionStatusDraft,
+		})
+		if err != nil {
+			return err
+		}
+
+		if draft == nil {
+			if err := u.version.WithTrx(tx).Create(ctx, domain.NewDraft(exist.ID, &graph)); err != nil {
+				return err
+			}
+		} else {
+			if err := draft.SetGraph(&graph); err != nil {
+				return err
+			}
+
+			if err := u.version.WithTrx(tx).Update(ctx, draft.ID, draftUpdates(draft)); err != nil {
+				return err
+			}
+		}
+
+		exist.Name, exist.Description = update.Name, update.Description
+		updated = exist
+		return nil
+	}); err != nil {
+		zap.L().Error("failed to update flow", zap.Error(err), zap.String("flow_id", req.Id))
+		return nil, err
+	}
+
+	u.publish(ctx, webhook.TopicFlowUpdated, updated)
+
+	return u.GetFlow(ctx, &workflowv1.GetFlowRequest{Id: updated.ID})
+}
+
+// simulationFlow loads the stored flow to simulate, or builds one from the inline graph.
+func (u *FlowUsecase) simulationFlow(ctx context.Context, req *workflowv1.SimulateFlowRequest) (*domain.Flow, error) {
+	if req.FlowId == "" {
+		flow := &domain.Flow{OrganizationID: req.OrganizationId}
+		if err := flow.SetNodes(req.Nodes); err != nil {
+			return nil, invalidNodes(err)
+		}
+
+		if err := flow.SetEdges(req.Edges); err != nil {
+			return nil, errutil.BadRequest("invalid edges", err)
+		}
+
+		return flow, nil
+	}
+
+	flow, err := u.flow.FindOne(ctx, &domain.Flow{
+		ID:             req.FlowId,
+		OrganizationID: req.OrganizationId,
 	})
 	if err != nil {
-		zap.L().Error("failed to query get flow", zap.Error(err))
 		return nil, err
 	}
 
-	if exist == nil {
-		zap.L().Error("flow not found")
-		return nil, fmt.Errorf("flow not found")
+	if flow == nil {
+		return nil, errutil.NotFound("flow not found", nil)
 	}
 
-	update := domain.Flow{
-		Name:        req.Flow.Name,
-		Description: req.Flow.Description,
-		Status:      req.Flow.Status.String(),
-	}
+	return flow, nil
+}
 
-	update.SetNodes(req.Flow.Nodes)
-	update.SetEdges(req.Flow.Edges)
-	update.SetOverview(req.Flow.Overflow)
+// SimulateFlow runs a flow against sample attributes and reports the path taken, the
+// actions that would fire and the points they would credit. Nothing is written.
+func (u *FlowUsecase) SimulateFlow(ctx context.Context, req *workflowv1.SimulateFlowRequest) (*workflowv1.SimulateFlowResponse, error) {
+	fields := []zap.Field{
+		zap.String("organization_id", req.OrganizationId),
+		zap.String("flow_id", req.FlowId),
+	}
 
-	if err := u.flow.Update(ctx, exist.ID, &update); err != nil {
-		zap.L().Error("failed to update flow", zap.Error(err), zap.String("flow_id", exist.ID))
+	flow, err := u.simulationFlow(ctx, req)
+	if err != nil {
+		zap.L().With(fields...).Error("failed to load flow to simulate", zap.Error(err))
 		return nil, err
 	}
 
-	return &workflowv1.Flow{
-		Id:             exist.ID,
-		OrganizationId: exist.OrganizationID,
-		Name:           exist.Name,
-		Description:    exist.Description,
-		Status:         workflowv1.FlowStatus(workflowv1.ActionType_value[exist.Status]),
-		Nodes:          exist.GetNodes(),
-		Edges:          exist.GetEdges(),
-		Overflow:       exist.GetOverflow(),
-		CreatedAt:      timestamppb.New(exist.CreatedAt),
-		UpdatedAt:      timestamppb.New(exist.UpdatedAt),
-	}, nil
+	graph, err := flow.BuildFlowGraph()
+	if err != nil {
+		return nil, errutil.BadRequest("invalid flow graph", err)
+	}
+
+	sim, err := graph.Simulate(req.GetAttributes().AsMap())
+	if err != nil {
+		return nil, errutil.BadRequest(err.Error(), nil)
+	}
+
+	res := &workflowv1.SimulateFlowResponse{TotalPoints: sim.TotalPoints}
+	for _, step := range sim.Trace {
+		res.Steps = append(res.Steps, toStepProto(step))
+	}
+
+	for _, a := range sim.Actions {
+		obj, err := actionParameters(a.Action)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Actions = append(res.Actions, &workflowv1.SimulatedAction{
+			NodeId:     a.NodeID,
+			Type:       a.Action.Type,
+			Parameters: obj,
+			Points:     a.Points,
+			Reason:     a.Reason,
+			Error:      a.Error,
+		})
+	}
+
+	return res, nil
+}
+
+func toStepProto(step *domain.TraceStep) *workflowv1.SimulationStep {
+	s := &workflowv1.SimulationStep{
+		NodeId:     step.NodeID,
+		NodeType:   workflowv1.NodeType(workflowv1.NodeType_value[step.NodeType]),
+		Expression: step.Expression,
+		Next:       step.Next,
+		Variant:    step.Variant,
+		Skipped:    step.Skipped,
+	}
+	if step.Result != nil {
+		s.Evaluated, s.Result = true, *step.Result
+	}
+	return s
+}
+
+func actionParameters(action *domain.NodeAction) (*structpb.Struct, error) {
+	var params map[string]any
+	if len(action.Parameters) > 0 {
+		if err := json.Unmarshal(action.Parameters, &params); err != nil {
+			return nil, errutil.BadRequest("invalid action parameters", nil, errutil.WithErr(err))
+		}
+	}
+
+	obj, err := structpb.NewStruct(params)
+	if err != nil {
+		return nil, errutil.BadRequest("invalid action parameters", nil, errutil.WithErr(err))
+	}
+
+	return obj, nil
+}
+
+// invalidNodes keeps the field details of a rejected condition and reports any
+// other SetNodes failure as a malformed request.
+func invalidNodes(err error) error {
+	var be errutil.BaseError
+	if errors.As(err, &be) {
+		return err
+	}
+	return errutil.BadRequest("invalid nodes", nil, errutil.WithErr(err))
 }
@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	webhook "github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// transition moves the flow to status where the lifecycle allows it, and notifies the
+// organization on topic.
+func (u *FlowUsecase) transition(ctx context.Context, orgID, flowID string, status workflowv1.FlowStatus, topic string) (*workflowv1.Flow, error) {
+	var flow *domain.Flow
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if flow, err = u.lockFlow(ctx, tx, flowID, orgID); err != nil {
+			return err
+		}
+
+		if err := flow.Transition(status.String()); err != nil {
+			return errutil.UnprocessableEntity("invalid status change", nil, errutil.WithErr(err))
+		}
+
+		return u.flow.WithTrx(tx).Update(ctx, flow.ID, map[string]any{"status": flow.Status})
+	}); err != nil {
+		zap.L().Error("failed to change flow status", zap.Error(err), zap.String("flow_id", flowID), zap.String("status", status.String()))
+		return nil, err
+	}
+
+	u.publish(ctx, topic, flow)
+
+	return u.GetFlow(ctx, &workflowv1.GetFlowRequest{Id: flow.ID})
+}
+
+// PauseFlow stops an active flow from firing until it is resumed.
+func (u *FlowUsecase) PauseFlow(ctx context.Context, req *workflowv1.PauseFlowRequest) (*workflowv1.Flow, error) {
+	return u.transition(ctx, req.OrganizationId, req.FlowId, workflowv1.FlowStatus_PAUSED, webhook.TopicFlowPaused)
+}
+
+// ResumeFlow makes a paused or inactive flow fire again. It needs a published
+// version, and budget left when the flow has a budget.
+func (u *FlowUsecase) ResumeFlow(ctx context.Context, req *workflowv1.ResumeFlowRequest) (*workflowv1.Flow, error) {
+	return u.transition(ctx, req.OrganizationId, req.FlowId, workflowv1.FlowStatus_ACTIVE, webhook.TopicFlowResumed)
+}
+
+// ArchiveFlow retires the flow for good, keeping it and its history. An archived
+// flow can still be read, cloned and, without history, deleted.
+func (u *FlowUsecase) ArchiveFlow(ctx context.Context, req *workflowv1.ArchiveFlowRequest) (*workflowv1.Flow, error) {
+	return u.transition(ctx, req.OrganizationId, req.FlowId, workflowv1.FlowStatus_ARCHIVED, webhook.TopicFlowArchived)
+}
+
+// CloneFlow copies the flow into a new INACTIVE flow of the organization. The copy's
+// draft is the flow's draft if it has one, else its live graph; it runs once the
+// draft is published and the copy resumed.
+func (u *FlowUsecase) CloneFlow(ctx context.Context, req *workflowv1.CloneFlowRequest) (*workflowv1.Flow, error) {
+	flow, err := u.ownedFlow(ctx, req.FlowId, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := flow
+	draft, err := u.version.FindOne(ctx, &domain.FlowVersion{FlowID: flow.ID, Status: domain.VersionStatusDraft})
+	if err != nil {
+		return nil, err
+	}
+	if draft != nil {
+		graph = draft.Graph()
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Copy of " + flow.Name
+	}
+
+	clone, cloneGraph := flow.Clone(name, graph)
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := u.flow.WithTrx(tx).Create(ctx, clone); err != nil {
+			return err
+		}
+		return u.version.WithTrx(tx).Create(ctx, domain.NewDraft(clone.ID, cloneGraph))
+	}); err != nil {
+		zap.L().Error("failed to clone flow", zap.Error(err), zap.String("flow_id", flow.ID))
+		return nil, err
+	}
+
+	u.publish(ctx, webhook.TopicFlowCreated, clone)
+
+	return u.GetFlow(ctx, &workflowv1.GetFlowRequest{Id: clone.ID})
+}
+
+// DeleteFlow removes the flow and its versions. A flow that has run keeps its
+// executions' history and can only be archived.
+func (u *FlowUsecase) DeleteFlow(ctx context.Context, req *workflowv1.DeleteFlowRequest) (*workflowv1.DeleteFlowResponse, error) {
+	var flow *domain.Flow
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if flow, err = u.lockFlow(ctx, tx, req.FlowId, req.OrganizationId); err != nil {
+			return err
+		}
+
+		executions, err := u.execution.WithTrx(tx).Count(ctx, &domain.FlowExecution{FlowID: flow.ID})
+		if err != nil {
+			return err
+		}
+
+		if executions > 0 {
+			return errutil.UnprocessableEntity("flow has execution history, archive it instead", nil)
+		}
+
+		if err := tx.WithContext(ctx).Where("flow_id = ?", flow.ID).Delete(&domain.FlowVersion{}).Error; err != nil {
+			return err
+		}
+
+		return u.flow.WithTrx(tx).Delete(ctx, flow.ID)
+	}); err != nil {
+		zap.L().Error("failed to delete flow", zap.Error(err), zap.String("flow_id", req.FlowId))
+		return nil, err
+	}
+
+	u.publish(ctx, webhook.TopicFlowDeleted, flow)
+
+	return &workflowv1.DeleteFlowResponse{}, nil
+}
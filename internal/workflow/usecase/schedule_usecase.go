@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/activities"
+	"go.temporal.io/sdk/client"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// profileBatch bounds how many members a schedule loads at a time.
+const profileBatch = 500
+
+// Scheduler fires the flows on scheduled triggers.
+type Scheduler struct {
+	db       *gorm.DB
+	temporal client.Client
+}
+
+type SchedulerParams struct {
+	fx.In
+	DB       *gorm.DB
+	Temporal client.Client
+}
+
+func NewScheduler(p SchedulerParams) *Scheduler {
+	return &Scheduler{
+		db:       p.DB,
+		temporal: p.Temporal,
+	}
+}
+
+// Tick starts the executions of every active scheduled flow due in the minute of now:
+// one per member the schedule fires for. Executions are keyed by flow, minute and
+// member, so a repeated tick starts nothing twice.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) error {
+	minute := now.Truncate(time.Minute)
+
+	var flows []*domain.Flow
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND trigger IN ?", workflowv1.FlowStatus_ACTIVE.String(), domain.ScheduledTriggers()).
+		Find(&flows).Error; err != nil {
+		zap.L().Error("failed to query scheduled flows", zap.Error(err))
+		return err
+	}
+
+	var errs []error
+	for _, flow := range flows {
+		schedule := flow.Schedule()
+		if schedule == nil || !schedule.Due(minute) {
+			continue
+		}
+
+		if err := s.fire(ctx, flow, schedule, minute); err != nil {
+			zap.L().Error("failed to fire scheduled flow", zap.Error(err), zap.String("flow_id", flow.ID))
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Scheduler) fire(ctx context.Context, flow *domain.Flow, schedule *domain.Schedule, minute time.Time) error {
+	query := s.db.WithContext(ctx).Where("organization_id = ?", flow.OrganizationID)
+	switch flow.Trigger {
+	case domain.TriggerBirthday:
+		query = query.Where("birth_key IN ?", schedule.DateKeys(minute))
+	case domain.TriggerAnniversary:
+		query = query.Where("joined_key IN ?", schedule.DateKeys(minute))
+	}
+	query = query.Session(&gorm.Session{})
+
+	on := schedule.Occurrence(minute)
+
+	var started int
+	for last := ""; ; {
+		var profiles []*domain.MemberProfile
+		if err := query.
+			Where("id > ?", last).
+			Order("id").
+			Limit(profileBatch).
+			Find(&profiles).Error; err != nil {
+			return err
+		}
+
+		for _, p := range profiles {
+			id := fmt.Sprintf("schedule:%s:%s:%s", flow.ID, minute.UTC().Format("200601021504"), p.UserID)
+			ok, err := startEarnPoint(ctx, s.temporal, id, &activities.EarnPointRequest{
+				OrganizationID: flow.OrganizationID,
+				UserID:         p.UserID,
+				ReferenceID:    id,
+				Trigger:        flow.Trigger,
+				FlowID:         flow.ID,
+				Attributes:     p.Attributes(flow.Trigger, on, minute),
+			})
+			if err != nil {
+				return err
+			}
+			if ok {
+				started++
+			}
+		}
+
+		if len(profiles) < profileBatch {
+			break
+		}
+		last = profiles[len(profiles)-1].ID
+	}
+
+	zap.L().Info("scheduled flow fired", zap.String("flow_id", flow.ID), zap.Int("executions", started))
+	return nil
+}
+
+// resolveTimezone pins the timezone the flow's schedule is read in: the timezone of
+// its location, else of the organization's country, else UTC. A timezone set on the
+// schedule is kept.
+func (u *FlowUsecase) resolveTimezone(ctx context.Context, flow *domain.Flow) error {
+	schedule := flow.Schedule()
+	if schedule == nil || schedule.Timezone != "" {
+		return nil
+	}
+
+	var tz string
+	if schedule.LocationID != "" {
+		if err := u.db.WithContext(ctx).Table("locations").Select("timezone").
+			Where("id = ? AND org_id = ?", schedule.LocationID, flow.OrganizationID).
+			Scan(&tz).Error; err != nil {
+			return err
+		}
+
+		if tz == "" {
+			return errutil.ValidationFailed("invalid flow graph", nil, errutil.WithDetails(errutil.Detail{
+				Field:   "nodes.trigger.schedule.location_id",
+				Message: fmt.Sprintf("location %s not found", schedule.LocationID),
+			}))
+		}
+	} else if err := u.db.WithContext(ctx).Table("timezones").Select("timezones.tz").
+		Joins("JOIN organizations ON organizations.country_code = timezones.country_code").
+		Where("organizations.id = ?", flow.OrganizationID).
+		Limit(1).
+		Scan(&tz).Error; err != nil {
+		return err
+	}
+
+	if tz == "" {
+		tz = time.UTC.String()
+	}
+
+	return flow.SetScheduleTimezone(tz)
+}
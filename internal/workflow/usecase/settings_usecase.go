@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GetFlowSettings returns the organization's flow settings. An organization that
+// never changed them stacks every flow that matches.
+func (u *FlowUsecase) GetFlowSettings(ctx context.Context, req *workflowv1.GetFlowSettingsRequest) (*workflowv1.FlowSettings, error) {
+	settings, err := u.settings.FindOne(ctx, &domain.FlowSettings{OrganizationID: req.OrganizationId})
+	if err != nil {
+		zap.L().Error("failed to query flow settings", zap.Error(err), zap.String("organization_id", req.OrganizationId))
+		return nil, err
+	}
+
+	if settings == nil {
+		settings = &domain.FlowSettings{OrganizationID: req.OrganizationId}
+	}
+
+	return toFlowSettingsProto(settings), nil
+}
+
+// UpdateFlowSettings sets the stacking policy the organization's flows are resolved
+// with when several match one event.
+func (u *FlowUsecase) UpdateFlowSettings(ctx context.Context, req *workflowv1.UpdateFlowSettingsRequest) (*workflowv1.FlowSettings, error) {
+	settings := &domain.FlowSettings{
+		OrganizationID: req.OrganizationId,
+		StackingPolicy: req.StackingPolicy,
+	}
+
+	if details := settings.Validate(); len(details) > 0 {
+		return nil, errutil.ValidationFailed("invalid flow settings", nil, errutil.WithDetails(details...))
+	}
+
+	exist, err := u.settings.FindOne(ctx, &domain.FlowSettings{OrganizationID: req.OrganizationId})
+	if err != nil {
+		return nil, err
+	}
+
+	if exist == nil {
+		err = u.settings.Create(ctx, settings)
+	} else {
+		// Settings are keyed by organization, not by id.
+		err = u.db.WithContext(ctx).Model(&domain.FlowSettings{}).
+			Where("organization_id = ?", req.OrganizationId).
+			Update("stacking_policy", settings.StackingPolicy).Error
+	}
+	if err != nil {
+		zap.L().Error("failed to save flow settings", zap.Error(err), zap.String("organization_id", req.OrganizationId))
+		return nil, err
+	}
+
+	return u.GetFlowSettings(ctx, &workflowv1.GetFlowSettingsRequest{OrganizationId: req.OrganizationId})
+}
+
+func toFlowSettingsProto(m *domain.FlowSettings) *workflowv1.FlowSettings {
+	res := &workflowv1.FlowSettings{
+		OrganizationId: m.OrganizationID,
+		StackingPolicy: m.Policy(),
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = timestamppb.New(m.UpdatedAt)
+	}
+	return res
+}
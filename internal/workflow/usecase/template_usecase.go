@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"context"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm/clause"
+)
+
+// InstantiateFlowTemplate creates a flow for the organization from a template, with
+// the template's parameters filled in from the request. The flow is created as any
+// other, so it is validated and goes live as version 1.
+func (u *FlowUsecase) InstantiateFlowTemplate(ctx context.Context, req *workflowv1.InstantiateFlowTemplateRequest) (*workflowv1.Flow, error) {
+	template, err := u.template.FindOne(ctx, &domain.FlowTemplate{
+		ID: req.TemplateId,
+	})
+	if err != nil {
+		zap.L().Error("failed to query get template", zap.Error(err))
+		return nil, err
+	}
+
+	if template == nil {
+		return nil, errutil.NotFound("flow template not found", nil)
+	}
+
+	if template.Status != workflowv1.FlowStatus_ACTIVE.String() {
+		return nil, errutil.BadRequest("flow template is not active", nil)
+	}
+
+	nodes, details := template.Fill(req.GetParameters().AsMap())
+	if len(details) > 0 {
+		return nil, errutil.ValidationFailed("invalid template parameters", nil, errutil.WithDetails(details...))
+	}
+
+	name := req.Name
+	if name == "" {
+		name = template.Name
+	}
+
+	overflow := template.GetOverflow()
+	if overflow == nil {
+		overflow = &workflowv1.Overflow{}
+	}
+
+	return u.CreateFlow(ctx, &workflowv1.CreateFlowRequest{
+		OrganizationId: req.OrganizationId,
+		Name:           name,
+		Nodes:          nodes,
+		Edges:          template.GetEdges(),
+		Overflow:       overflow,
+	})
+}
+
+// SeedFlowTemplates writes the built-in templates, replacing earlier releases of
+// them. Templates added by hand are left alone.
+func (u *FlowUsecase) SeedFlowTemplates(ctx context.Context) error {
+	return u.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "trigger", "category", "status", "nodes", "edges", "overflow", "parameters", "updated_at"}),
+	}).Create(domain.BuiltinTemplates()).Error
+}
+
+func toFlowTemplateProto(template *domain.FlowTemplate) *workflowv1.FlowTemplate {
+	var params []*workflowv1.FlowTemplateParameter
+	for _, p := range template.TemplateParameters() {
+		param := &workflowv1.FlowTemplateParameter{
+			Key:         p.Key,
+			Label:       p.Label,
+			Description: p.Description,
+			Type:        p.Type,
+			Required:    p.Required,
+		}
+
+		if p.Default != nil {
+			if v, err := structpb.NewValue(p.Default); err == nil {
+				param.Default = v
+			}
+		}
+
+		params = append(params, param)
+	}
+
+	return &workflowv1.FlowTemplate{
+		Id:          template.ID,
+		Name:        template.Name,
+		Description: template.Description,
+		Trigger:     template.Trigger,
+		Category:    template.Category,
+		Status:      workflowv1.FlowStatus(workflowv1.FlowStatus_value[template.Status]),
+		Nodes:       template.GetNodes(),
+		Edges:       template.GetEdges(),
+		Overflow:    template.GetOverflow(),
+		Parameters:  params,
+	}
+}
@@ -0,0 +1,306 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	webhook "github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/errutil"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// lockFlow loads the flow for update, so publishes, rollbacks and draft edits of
+// one flow are serialised.
+func (u *FlowUsecase) lockFlow(ctx context.Context, tx *gorm.DB, flowID, orgID string) (*domain.Flow, error) {
+	flow, err := u.flow.WithTrx(tx).FindOne(ctx, &domain.Flow{
+		ID:             flowID,
+		OrganizationID: orgID,
+	}, option.WithLockingUpdate())
+	if err != nil {
+		return nil, err
+	}
+
+	if flow == nil {
+		return nil, errutil.NotFound("flow not found", nil)
+	}
+
+	return flow, nil
+}
+
+func draftUpdates(v *domain.FlowVersion) map[string]any {
+	return map[string]any{
+		"trigger":  v.Trigger,
+		"nodes":    v.Nodes,
+		"edges":    v.Edges,
+		"overflow": v.Overflow,
+	}
+}
+
+func liveUpdates(flow *domain.Flow) map[string]any {
+	return map[string]any{
+		"trigger":  flow.Trigger,
+		"nodes":    flow.Nodes,
+		"edges":    flow.Edges,
+		"overflow": flow.Overflow,
+		"version":  flow.Version,
+	}
+}
+
+// findVersion loads one version of a flow. Version 0 is the flow's draft.
+func (u *FlowUsecase) findVersion(ctx context.Context, tx *gorm.DB, flowID string, version int32) (*domain.FlowVersion, error) {
+	query := &domain.FlowVersion{FlowID: flowID, Version: version}
+	if version == 0 {
+		query.Status = domain.VersionStatusDraft
+	}
+
+	repo := u.version
+	if tx != nil {
+		repo = repo.WithTrx(tx)
+	}
+
+	found, err := repo.FindOne(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		if version == 0 {
+			return nil, errutil.NotFound("flow has no draft", nil)
+		}
+		return nil, errutil.NotFound(fmt.Sprintf("version %d not found", version), nil)
+	}
+
+	return found, nil
+}
+
+// goLive supersedes the flow's current version and makes next the one executions run.
+func (u *FlowUsecase) goLive(ctx context.Context, tx *gorm.DB, flow *domain.Flow, next *domain.FlowVersion) error {
+	if err := tx.WithContext(ctx).Model(&domain.FlowVersion{}).
+		Where("flow_id = ? AND status = ?", flow.ID, domain.VersionStatusPublished).
+		Update("status", domain.VersionStatusSuperseded).Error; err != nil {
+		return err
+	}
+
+	flow.GoLive(next)
+	return u.flow.WithTrx(tx).Update(ctx, flow.ID, liveUpdates(flow))
+}
+
+// PublishFlow promotes the flow's draft to the next version and makes it live in one
+// transaction. The draft is validated again, since schemas may have changed since
+// it was saved. An archived flow publishes nothing.
+func (u *FlowUsecase) PublishFlow(ctx context.Context, req *workflowv1.PublishFlowRequest) (*workflowv1.FlowVersion, error) {
+	fields := []zap.Field{
+		zap.String("organization_id", req.OrganizationId),
+		zap.String("flow_id", req.FlowId),
+	}
+
+	var (
+		flow  *domain.Flow
+		draft *domain.FlowVersion
+	)
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if flow, err = u.lockFlow(ctx, tx, req.FlowId, req.OrganizationId); err != nil {
+			return err
+		}
+
+		if err := flow.Editable(); err != nil {
+			return errutil.Conflict("flow is archived", nil, errutil.WithErr(err))
+		}
+
+		if draft, err = u.findVersion(ctx, tx, flow.ID, 0); err != nil {
+			return err
+		}
+
+		if details := draft.Graph().Validate(); len(details) > 0 {
+			return errutil.ValidationFailed("invalid flow graph", nil, errutil.WithDetails(details...))
+		}
+
+		if err := draft.Publish(flow.Version+1, time.Now()); err != nil {
+			return err
+		}
+
+		if err := u.version.WithTrx(tx).Update(ctx, draft.ID, map[string]any{
+			"version":      draft.Version,
+			"status":       draft.Status,
+			"published_at": draft.PublishedAt,
+		}); err != nil {
+			return err
+		}
+
+		return u.goLive(ctx, tx, flow, draft)
+	}); err != nil {
+		zap.L().With(fields...).Error("failed to publish flow", zap.Error(err))
+		return nil, err
+	}
+
+	u.publish(ctx, webhook.TopicFlowPublished, flow)
+
+	return toFlowVersionProto(draft), nil
+}
+
+// RollbackFlow republishes the graph of an earlier version as a new version, so the
+// history stays append-only. The draft, if any, is left alone. An archived flow
+// can't be rolled back.
+func (u *FlowUsecase) RollbackFlow(ctx context.Context, req *workflowv1.RollbackFlowRequest) (*workflowv1.FlowVersion, error) {
+	fields := []zap.Field{
+		zap.String("organization_id", req.OrganizationId),
+		zap.String("flow_id", req.FlowId),
+		zap.Int32("version", req.Version),
+	}
+
+	var (
+		flow     *domain.Flow
+		restored *domain.FlowVersion
+	)
+	if err := u.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if flow, err = u.lockFlow(ctx, tx, req.FlowId, req.OrganizationId); err != nil {
+			return err
+		}
+
+		if err := flow.Editable(); err != nil {
+			return errutil.Conflict("flow is archived", nil, errutil.WithErr(err))
+		}
+
+		target, err := u.findVersion(ctx, tx, flow.ID, req.Version)
+		if err != nil {
+			return err
+		}
+
+		if target.Version == flow.Version {
+			return errutil.Conflict(fmt.Sprintf("version %d is already live", target.Version), nil)
+		}
+
+		restored = target.Restore(flow.Version+1, time.Now())
+
+		// The rules have moved on since the version was published; it goes live again
+		// only if it still passes them.
+		if details := restored.Graph().Validate(); len(details) > 0 {
+			return errutil.ValidationFailed("invalid flow graph", nil, errutil.WithDetails(details...))
+		}
+
+		if err := u.version.WithTrx(tx).Create(ctx, restored); err != nil {
+			return err
+		}
+
+		return u.goLive(ctx, tx, flow, restored)
+	}); err != nil {
+		zap.L().With(fields...).Error("failed to roll back flow", zap.Error(err))
+		return nil, err
+	}
+
+	u.publish(ctx, webhook.TopicFlowPublished, flow)
+
+	return toFlowVersionProto(restored), nil
+}
+
+func (u *FlowUsecase) ListFlowVersions(ctx context.Context, req *workflowv1.ListFlowVersionsRequest) (*workflowv1.ListFlowVersionsResponse, error) {
+	versions, err := u.version.Find(ctx, &domain.FlowVersion{
+		FlowID:         req.FlowId,
+		OrganizationID: req.OrganizationId,
+	}, option.WithSortBy(option.QuerySortBy{
+		SortBy:  "version",
+		OrderBy: "desc",
+		Allow:   map[string]bool{"version": true},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &workflowv1.ListFlowVersionsResponse{}
+	for _, v := range versions {
+		res.Data = append(res.Data, toFlowVersionProto(v))
+	}
+
+	return res, nil
+}
+
+// GetFlowVersion returns one version of a flow; version 0 returns its draft.
+func (u *FlowUsecase) GetFlowVersion(ctx context.Context, req *workflowv1.GetFlowVersionRequest) (*workflowv1.FlowVersion, error) {
+	if _, err := u.ownedFlow(ctx, req.FlowId, req.OrganizationId); err != nil {
+		return nil, err
+	}
+
+	v, err := u.findVersion(ctx, nil, req.FlowId, req.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return toFlowVersionProto(v), nil
+}
+
+// DiffFlowVersions lists the structural changes from one version to another;
+// version 0 stands for the draft.
+func (u *FlowUsecase) DiffFlowVersions(ctx context.Context, req *workflowv1.DiffFlowVersionsRequest) (*workflowv1.DiffFlowVersionsResponse, error) {
+	if _, err := u.ownedFlow(ctx, req.FlowId, req.OrganizationId); err != nil {
+		return nil, err
+	}
+
+	from, err := u.findVersion(ctx, nil, req.FlowId, req.FromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := u.findVersion(ctx, nil, req.FlowId, req.ToVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := domain.DiffVersions(from, to)
+	if err != nil {
+		return nil, errutil.BadRequest("invalid flow version", nil, errutil.WithErr(err))
+	}
+
+	res := &workflowv1.DiffFlowVersionsResponse{}
+	for _, c := range changes {
+		res.Changes = append(res.Changes, &workflowv1.FlowChange{
+			Kind:   c.Kind,
+			Change: c.Change,
+			Id:     c.ID,
+			Fields: c.Fields,
+		})
+	}
+
+	return res, nil
+}
+
+func (u *FlowUsecase) ownedFlow(ctx context.Context, flowID, orgID string) (*domain.Flow, error) {
+	flow, err := u.flow.FindOne(ctx, &domain.Flow{ID: flowID, OrganizationID: orgID})
+	if err != nil {
+		return nil, err
+	}
+
+	if flow == nil {
+		return nil, errutil.NotFound("flow not found", nil)
+	}
+
+	return flow, nil
+}
+
+func toFlowVersionProto(v *domain.FlowVersion) *workflowv1.FlowVersion {
+	graph := v.Graph()
+	res := &workflowv1.FlowVersion{
+		Id:            v.ID,
+		FlowId:        v.FlowID,
+		Version:       v.Version,
+		Status:        v.Status,
+		Nodes:         graph.GetNodes(),
+		Edges:         graph.GetEdges(),
+		Overflow:      graph.GetOverflow(),
+		SourceVersion: v.SourceVersion,
+		CreatedAt:     timestamppb.New(v.CreatedAt),
+	}
+
+	if v.PublishedAt != nil {
+		res.PublishedAt = timestamppb.New(*v.PublishedAt)
+	}
+
+	return res
+}
@@ -66,3 +66,35 @@ func registerAsynqServer(lc fx.Lifecycle, cfg *config.Config, client *asynq.Clie
 		},
 	})
 }
+
+// Scheduler enqueues periodic tasks registered on *asynq.Scheduler. Only one replica
+// should install it, otherwise every replica enqueues its own copy of each task.
+var Scheduler = fx.Module("asynq:scheduler",
+	fx.Provide(registerScheduler),
+)
+
+func registerScheduler(lc fx.Lifecycle, cfg *config.Config) *asynq.Scheduler {
+	scheduler := asynq.NewScheduler(
+		asynq.RedisClientOpt{
+			Addr: cfg.Redis.Addr,
+			DB:   cfg.Redis.DB,
+		},
+		&asynq.SchedulerOpts{
+			EnqueueErrorHandler: func(task *asynq.Task, opts []asynq.Option, err error) {
+				zap.L().Error("asynq failed to enqueue periodic task", zap.String("task_type", task.Type()), zap.Error(err))
+			},
+		},
+	)
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return scheduler.Start()
+		},
+		OnStop: func(ctx context.Context) error {
+			scheduler.Shutdown()
+			return nil
+		},
+	})
+
+	return scheduler
+}
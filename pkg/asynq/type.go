@@ -29,3 +29,28 @@ type TranscodePayload struct {
 	Resolution string // "1080p", "720p", etc
 	OutputPath string // optional jika mau custom naming
 }
+
+const (
+	// SettlementStatementTask generates last month's coalition settlement statements.
+	SettlementStatementTask = "ledger:settlement_statement"
+
+	// PointsExpiryTask expires the points earned longer ago than the configured expiry.
+	PointsExpiryTask = "ledger:points_expiry"
+)
+
+const (
+	// WebhookDeliveryTask makes one attempt of a webhook delivery.
+	WebhookDeliveryTask = "webhook:deliver"
+)
+
+type WebhookDeliveryPayload struct {
+	DeliveryID string
+}
+
+const (
+	// FlowExecutionRetentionTask purges flow execution history past its retention.
+	FlowExecutionRetentionTask = "workflow:execution_retention"
+
+	// FlowScheduleTask fires the scheduled flows due in the current minute.
+	FlowScheduleTask = "workflow:schedule_tick"
+)
@@ -3,7 +3,6 @@ package celengine
 import (
 	"encoding/json"
 	"fmt"
-	"reflect"
 
 	"github.com/google/cel-go/cel"
 )
@@ -26,15 +25,12 @@ func BuildCelEnvFromAttributes(attrs map[string]interface{}) (*cel.Env, error) {
 		case []interface{}:
 			// Try to inspect the first item
 			if len(v) > 0 {
-				elem := v[0]
-				elemType := reflect.TypeOf(elem)
-				switch elem.(type) {
+				switch v[0].(type) {
 				case map[string]interface{}:
 					// List of maps, e.g. items
 					variables = append(variables, cel.Variable(key, cel.ListType(cel.MapType(cel.StringType, cel.DynType))))
 				default:
 					// Generic list
-					fmt.Printf("Generic list with element type: %v\n", elemType)
 					variables = append(variables, cel.Variable(key, cel.ListType(cel.DynType)))
 				}
 			} else {
@@ -49,7 +45,6 @@ func BuildCelEnvFromAttributes(attrs map[string]interface{}) (*cel.Env, error) {
 			variables = append(variables, cel.Variable(key, cel.MapType(cel.StringType, cel.DynType)))
 
 		default:
-			fmt.Printf("Unhandled type for key: %s -> %T\n", key, val)
 			variables = append(variables, cel.Variable(key, cel.DynType))
 		}
 	}
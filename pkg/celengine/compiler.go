@@ -0,0 +1,249 @@
+package celengine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpIn           = "in"
+	OpNotIn        = "not_in"
+	OpContains     = "contains"
+	OpStartsWith   = "startsWith"
+	OpEndsWith     = "endsWith"
+)
+
+// operators lists the attribute types each operator accepts.
+var operators = map[string][]Type{
+	OpEqual:        {TypeString, TypeInt, TypeDouble, TypeBool, TypeTimestamp},
+	OpNotEqual:     {TypeString, TypeInt, TypeDouble, TypeBool, TypeTimestamp},
+	OpLess:         {TypeInt, TypeDouble, TypeTimestamp},
+	OpLessEqual:    {TypeInt, TypeDouble, TypeTimestamp},
+	OpGreater:      {TypeInt, TypeDouble, TypeTimestamp},
+	OpGreaterEqual: {TypeInt, TypeDouble, TypeTimestamp},
+	OpIn:           {TypeString, TypeInt, TypeDouble, TypeStringList},
+	OpNotIn:        {TypeString, TypeInt, TypeDouble, TypeStringList},
+	OpContains:     {TypeString, TypeStringList},
+	OpStartsWith:   {TypeString},
+	OpEndsWith:     {TypeString},
+}
+
+var fieldPath = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// Clause is one structured condition: an attribute, an operator and a literal.
+type Clause struct {
+	Field    string
+	Operator string
+	Value    *structpb.Value
+}
+
+// Compile turns clauses into one CEL expression joined with &&. Every field must be
+// declared by the schema, operators are limited to the supported set, literals are
+// escaped, and the result is type-checked to a bool against the schema's env.
+func (s *Schema) Compile(clauses []Clause) (string, error) {
+	parts := make([]string, 0, len(clauses))
+	for i, c := range clauses {
+		part, err := s.compileClause(c)
+		if err != nil {
+			return "", fmt.Errorf("conditions[%d]: %w", i, err)
+		}
+		parts = append(parts, part)
+	}
+
+	expr := strings.Join(parts, " && ")
+	if expr == "" {
+		return "", nil
+	}
+
+	if err := s.Check(expr); err != nil {
+		return "", err
+	}
+
+	return expr, nil
+}
+
+// Check type-checks a hand written expression against the schema.
+func (s *Schema) Check(expr string) error {
+	_, err := s.Program(expr)
+	return err
+}
+
+func check(env *cel.Env, expr string) (*cel.Ast, error) {
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("expression must evaluate to bool, got %s", ast.OutputType())
+	}
+
+	return ast, nil
+}
+
+func (s *Schema) compileClause(c Clause) (string, error) {
+	if !fieldPath.MatchString(c.Field) {
+		return "", fmt.Errorf("invalid field %q", c.Field)
+	}
+
+	typ, ok := s.Lookup(c.Field)
+	if !ok {
+		return "", fmt.Errorf("field %s is not an attribute of %s events", c.Field, s.Trigger)
+	}
+
+	accepted, ok := operators[c.Operator]
+	if !ok {
+		return "", fmt.Errorf("unsupported operator %q", c.Operator)
+	}
+
+	if !containsType(accepted, typ) {
+		return "", fmt.Errorf("operator %s can't be applied to %s field %s", c.Operator, typ, c.Field)
+	}
+
+	if c.Value == nil {
+		return "", fmt.Errorf("value is required")
+	}
+
+	switch c.Operator {
+	case OpIn, OpNotIn:
+		list, err := listLiteral(c.Value, elementType(typ))
+		if err != nil {
+			return "", err
+		}
+
+		expr := fmt.Sprintf("%s in %s", c.Field, list)
+		if typ == TypeStringList {
+			expr = fmt.Sprintf("%s.exists(v, v in %s)", c.Field, list)
+		}
+
+		if c.Operator == OpNotIn {
+			return fmt.Sprintf("!(%s)", expr), nil
+		}
+		return expr, nil
+
+	case OpContains:
+		lit, err := literal(c.Value, TypeString)
+		if err != nil {
+			return "", err
+		}
+
+		if typ == TypeStringList {
+			return fmt.Sprintf("%s in %s", lit, c.Field), nil
+		}
+		return fmt.Sprintf("%s.contains(%s)", c.Field, lit), nil
+
+	case OpStartsWith, OpEndsWith:
+		lit, err := literal(c.Value, TypeString)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s.%s(%s)", c.Field, c.Operator, lit), nil
+
+	default:
+		lit, err := literal(c.Value, typ)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", c.Field, c.Operator, lit), nil
+	}
+}
+
+func containsType(types []Type, t Type) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func elementType(t Type) Type {
+	if t == TypeStringList {
+		return TypeString
+	}
+	return t
+}
+
+func listLiteral(v *structpb.Value, typ Type) (string, error) {
+	list := v.GetListValue()
+	if list == nil || len(list.Values) == 0 {
+		return "", fmt.Errorf("value must be a non-empty list")
+	}
+
+	items := make([]string, 0, len(list.Values))
+	for _, item := range list.Values {
+		lit, err := literal(item, typ)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, lit)
+	}
+
+	return "[" + strings.Join(items, ", ") + "]", nil
+}
+
+// literal renders a value as a CEL literal of the field's type.
+func literal(v *structpb.Value, typ Type) (string, error) {
+	switch typ {
+	case TypeString:
+		s, ok := v.Kind.(*structpb.Value_StringValue)
+		if !ok {
+			return "", fmt.Errorf("value must be a string")
+		}
+		// Go quoting escapes quotes, backslashes and control characters the way
+		// CEL string literals expect them.
+		return strconv.Quote(s.StringValue), nil
+
+	case TypeInt:
+		n, ok := v.Kind.(*structpb.Value_NumberValue)
+		if !ok || n.NumberValue != math.Trunc(n.NumberValue) || math.IsInf(n.NumberValue, 0) {
+			return "", fmt.Errorf("value must be an integer")
+		}
+		return strconv.FormatInt(int64(n.NumberValue), 10), nil
+
+	case TypeDouble:
+		n, ok := v.Kind.(*structpb.Value_NumberValue)
+		if !ok || math.IsNaN(n.NumberValue) || math.IsInf(n.NumberValue, 0) {
+			return "", fmt.Errorf("value must be a number")
+		}
+
+		lit := strconv.FormatFloat(n.NumberValue, 'f', -1, 64)
+		if !strings.Contains(lit, ".") {
+			lit += ".0"
+		}
+		return lit, nil
+
+	case TypeBool:
+		b, ok := v.Kind.(*structpb.Value_BoolValue)
+		if !ok {
+			return "", fmt.Errorf("value must be a bool")
+		}
+		return strconv.FormatBool(b.BoolValue), nil
+
+	case TypeTimestamp:
+		ts, ok := v.Kind.(*structpb.Value_StringValue)
+		if !ok {
+			return "", fmt.Errorf("value must be an RFC 3339 timestamp")
+		}
+		if _, err := time.Parse(time.RFC3339, ts.StringValue); err != nil {
+			return "", fmt.Errorf("value must be an RFC 3339 timestamp")
+		}
+		return fmt.Sprintf("timestamp(%s)", strconv.Quote(ts.StringValue)), nil
+
+	default:
+		return "", fmt.Errorf("unsupported value type %s", typ)
+	}
+}
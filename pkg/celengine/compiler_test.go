@@ -0,0 +1,134 @@
+package celengine
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func transaction(t *testing.T) *Schema {
+	t.Helper()
+	schema, err := SchemaFor("TRANSACTION")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return schema
+}
+
+func list(values ...any) *structpb.Value {
+	v, err := structpb.NewList(values)
+	if err != nil {
+		panic(err)
+	}
+	return structpb.NewListValue(v)
+}
+
+func TestCompileClauses(t *testing.T) {
+	cases := []struct {
+		name   string
+		clause Clause
+		want   string
+	}{
+		{"equal", Clause{"channel", "==", structpb.NewStringValue("POS")}, `channel == "POS"`},
+		{"compare", Clause{"amount", ">=", structpb.NewNumberValue(100)}, `amount >= 100.0`},
+		{"escaped", Clause{"channel", "==", structpb.NewStringValue(`POS" || true || "`)}, `channel == "POS\" || true || \""`},
+		{"in", Clause{"currency", "in", list("IDR", "USD")}, `currency in ["IDR", "USD"]`},
+		{"not in", Clause{"payment_method", "not_in", list("CASH")}, `!(payment_method in ["CASH"])`},
+		{"contains", Clause{"customer.email", "contains", structpb.NewStringValue("@acme")}, `customer.email.contains("@acme")`},
+		{"list contains", Clause{"customer.tags", "contains", structpb.NewStringValue("vip")}, `"vip" in customer.tags`},
+		{"list overlap", Clause{"customer.tags", "in", list("vip", "staff")}, `customer.tags.exists(v, v in ["vip", "staff"])`},
+		{"starts with", Clause{"store_id", "startsWith", structpb.NewStringValue("JKT-")}, `store_id.startsWith("JKT-")`},
+	}
+
+	schema := transaction(t)
+	for _, c := range cases {
+		got, err := schema.Compile([]Clause{c.clause})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCompileJoinsClauses(t *testing.T) {
+	got, err := transaction(t).Compile([]Clause{
+		{"amount", ">", structpb.NewNumberValue(100)},
+		{"customer.tier", "==", structpb.NewStringValue("GOLD")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got != `amount > 100.0 && customer.tier == "GOLD"` {
+		t.Fatalf("unexpected expression %s", got)
+	}
+}
+
+func TestCompileRejectsInvalidClauses(t *testing.T) {
+	cases := []struct {
+		name    string
+		clause  Clause
+		message string
+	}{
+		{"unknown field", Clause{"discount", "==", structpb.NewNumberValue(1)}, "not an attribute"},
+		{"injected field", Clause{"amount > 0 || true", "==", structpb.NewNumberValue(1)}, "invalid field"},
+		{"unknown operator", Clause{"amount", "=~", structpb.NewNumberValue(1)}, "unsupported operator"},
+		{"injected operator", Clause{"amount", "> 0 || amount", structpb.NewNumberValue(1)}, "unsupported operator"},
+		{"operator type", Clause{"channel", ">", structpb.NewStringValue("A")}, "can't be applied"},
+		{"value type", Clause{"amount", "==", structpb.NewStringValue("100")}, "must be a number"},
+		{"fractional int", Clause{"quantity", ">", structpb.NewNumberValue(1.5)}, "must be an integer"},
+		{"empty list", Clause{"currency", "in", list()}, "non-empty list"},
+		{"missing value", Clause{"currency", "==", nil}, "value is required"},
+	}
+
+	schema := transaction(t)
+	for _, c := range cases {
+		_, err := schema.Compile([]Clause{c.clause})
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Fatalf("%s: expected error %q, got %v", c.name, c.message, err)
+		}
+	}
+}
+
+func TestCompiledExpressionEvaluates(t *testing.T) {
+	expr, err := transaction(t).Compile([]Clause{
+		{"channel", "==", structpb.NewStringValue(`say "hi"`)},
+		{"customer.tags", "contains", structpb.NewStringValue("vip")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ok, err := transaction(t).Evaluate(expr, map[string]any{
+		"channel":  `say "hi"`,
+		"customer": map[string]any{"tags": []any{"vip"}},
+	})
+	if err != nil || !ok {
+		t.Fatalf("expected %s to match, got %v %v", expr, ok, err)
+	}
+}
+
+func TestCheckRequiresBoolExpression(t *testing.T) {
+	schema := transaction(t)
+
+	if err := schema.Check("amount + 1.0"); err == nil || !strings.Contains(err.Error(), "bool") {
+		t.Fatalf("expected non bool expression to be rejected, got %v", err)
+	}
+
+	if err := schema.Check("discount > 1"); err == nil {
+		t.Fatalf("expected undeclared attribute to be rejected")
+	}
+
+	if err := schema.Check(`amount > 100.0 && customer.tier == "GOLD"`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSchemaForUnknownTrigger(t *testing.T) {
+	if _, err := SchemaFor("TELEPORT"); err == nil {
+		t.Fatalf("expected unknown trigger to be rejected")
+	}
+}
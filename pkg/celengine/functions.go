@@ -0,0 +1,76 @@
+package celengine
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+// functions are the custom functions available to every schema:
+//
+//	days_since(ts)           whole days elapsed since a timestamp
+//	sum(items, 'price')      sum of a numeric field over a list of objects
+var functions = cel.Lib(library{})
+
+type library struct{}
+
+func (library) LibraryName() string { return "smallbiznis.celengine" }
+
+func (library) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("days_since",
+			cel.Overload("days_since_timestamp", []*cel.Type{cel.TimestampType}, cel.IntType,
+				cel.UnaryBinding(daysSince),
+			),
+		),
+		cel.Function("sum",
+			cel.Overload("sum_list_string", []*cel.Type{cel.ListType(cel.DynType), cel.StringType}, cel.DoubleType,
+				cel.BinaryBinding(sum),
+			),
+		),
+	}
+}
+
+func (library) ProgramOptions() []cel.ProgramOption { return nil }
+
+func daysSince(v ref.Val) ref.Val {
+	ts, ok := v.(types.Timestamp)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(v)
+	}
+	return types.Int(now().Sub(ts.Time) / (24 * time.Hour))
+}
+
+func sum(list, field ref.Val) ref.Val {
+	items, ok := list.(traits.Lister)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(list)
+	}
+
+	var total float64
+	for it := items.Iterator(); it.HasNext() == types.True; {
+		item, ok := it.Next().(traits.Indexer)
+		if !ok {
+			return types.NewErr("sum: items must be objects")
+		}
+
+		switch n := item.Get(field).(type) {
+		case types.Double:
+			total += float64(n)
+		case types.Int:
+			total += float64(n)
+		case types.Uint:
+			total += float64(n)
+		default:
+			return types.NewErr("sum: %v is not a number on every item", field)
+		}
+	}
+
+	return types.Double(total)
+}
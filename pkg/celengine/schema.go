@@ -0,0 +1,340 @@
+package celengine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Type is the declared type of an event attribute.
+type Type string
+
+const (
+	TypeString     Type = "string"
+	TypeInt        Type = "int"
+	TypeDouble     Type = "double"
+	TypeBool       Type = "bool"
+	TypeTimestamp  Type = "timestamp"
+	TypeStringList Type = "list<string>"
+	TypeObjectList Type = "list<object>"
+)
+
+func (t Type) celType() *cel.Type {
+	switch t {
+	case TypeString:
+		return cel.StringType
+	case TypeInt:
+		return cel.IntType
+	case TypeDouble:
+		return cel.DoubleType
+	case TypeBool:
+		return cel.BoolType
+	case TypeTimestamp:
+		return cel.TimestampType
+	case TypeStringList:
+		return cel.ListType(cel.StringType)
+	case TypeObjectList:
+		return cel.ListType(cel.MapType(cel.StringType, cel.DynType))
+	default:
+		return cel.DynType
+	}
+}
+
+// Field is an attribute an event carries. Nested attributes use dotted paths such
+// as customer.tier.
+type Field struct {
+	Path string
+	Type Type
+}
+
+// Schema declares the attributes of the events of one trigger. Its env is built
+// once and compiled programs are cached by expression.
+type Schema struct {
+	Trigger string
+	Fields  []Field
+
+	once     sync.Once
+	env      *cel.Env
+	envErr   error
+	programs sync.Map
+}
+
+func (s *Schema) Lookup(path string) (Type, bool) {
+	for _, f := range s.Fields {
+		if f.Path == path {
+			return f.Type, true
+		}
+	}
+	return "", false
+}
+
+// Env declares the schema's top-level attributes and the custom functions. A
+// nested path declares its root as a map, so customer.tier type-checks as a field
+// selection.
+func (s *Schema) Env() (*cel.Env, error) {
+	s.once.Do(func() {
+		s.env, s.envErr = s.newEnv()
+	})
+	return s.env, s.envErr
+}
+
+func (s *Schema) newEnv() (*cel.Env, error) {
+	roots := map[string]*cel.Type{}
+	for _, f := range s.Fields {
+		root, _, nested := strings.Cut(f.Path, ".")
+		if nested {
+			roots[root] = cel.MapType(cel.StringType, cel.DynType)
+			continue
+		}
+		roots[root] = f.Type.celType()
+	}
+
+	names := make([]string, 0, len(roots))
+	for name := range roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	opts := []cel.EnvOption{cel.CrossTypeNumericComparisons(true), functions}
+	for _, name := range names {
+		opts = append(opts, cel.Variable(name, roots[name]))
+	}
+
+	return cel.NewEnv(opts...)
+}
+
+// Program returns the compiled program of a bool expression, compiling it on
+// first use.
+func (s *Schema) Program(expr string) (cel.Program, error) {
+	if prg, ok := s.programs.Load(expr); ok {
+		return prg.(cel.Program), nil
+	}
+
+	env, err := s.Env()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, err := check(env, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	s.programs.Store(expr, prg)
+	return prg, nil
+}
+
+// Evaluate runs an expression against event attributes converted to their
+// declared types.
+func (s *Schema) Evaluate(expr string, attrs map[string]any) (bool, error) {
+	prg, err := s.Program(expr)
+	if err != nil {
+		return false, err
+	}
+
+	activation, err := s.Activation(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := prg.Eval(activation)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool from expression, got %T (%v)", out.Value(), out.Value())
+	}
+
+	return b, nil
+}
+
+// Activation copies the attributes, converting declared fields to their types:
+// JSON numbers become ints or doubles and RFC 3339 strings become timestamps.
+// Attributes the schema doesn't declare are passed through.
+func (s *Schema) Activation(attrs map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(attrs))
+	for k, v := range attrs {
+		out[k] = v
+	}
+
+	for _, f := range s.Fields {
+		if err := convertPath(out, strings.Split(f.Path, "."), f.Type); err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", f.Path, err)
+		}
+	}
+
+	return out, nil
+}
+
+// convertPath converts the value at path in place, copying nested maps on the way
+// so the caller's attributes are never modified.
+func convertPath(m map[string]any, path []string, typ Type) error {
+	v, ok := m[path[0]]
+	if !ok || v == nil {
+		return nil
+	}
+
+	if len(path) == 1 {
+		converted, err := convert(v, typ)
+		if err != nil {
+			return err
+		}
+		m[path[0]] = converted
+		return nil
+	}
+
+	nested, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s is not an object", path[0])
+	}
+
+	copied := make(map[string]any, len(nested))
+	for k, v := range nested {
+		copied[k] = v
+	}
+	m[path[0]] = copied
+
+	return convertPath(copied, path[1:], typ)
+}
+
+func convert(v any, typ Type) (any, error) {
+	switch typ {
+	case TypeInt:
+		n, ok := toFloat(v)
+		if !ok || n != math.Trunc(n) {
+			return nil, fmt.Errorf("expected an integer, got %v", v)
+		}
+		return int64(n), nil
+
+	case TypeDouble:
+		n, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %v", v)
+		}
+		return n, nil
+
+	case TypeTimestamp:
+		return toTime(v)
+
+	default:
+		return v, nil
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp, got %q", t)
+		}
+		return parsed, nil
+	default:
+		return time.Time{}, fmt.Errorf("expected a timestamp, got %v", v)
+	}
+}
+
+var customer = []Field{
+	{Path: "customer.id", Type: TypeString},
+	{Path: "customer.tier", Type: TypeString},
+	{Path: "customer.email", Type: TypeString},
+	{Path: "customer.tags", Type: TypeStringList},
+	{Path: "customer.joined_at", Type: TypeTimestamp},
+}
+
+var schemas = map[string]*Schema{
+	"TRANSACTION": {
+		Trigger: "TRANSACTION",
+		Fields: append([]Field{
+			{Path: "amount", Type: TypeDouble},
+			{Path: "quantity", Type: TypeInt},
+			{Path: "currency", Type: TypeString},
+			{Path: "channel", Type: TypeString},
+			{Path: "store_id", Type: TypeString},
+			{Path: "payment_method", Type: TypeString},
+			{Path: "reference_id", Type: TypeString},
+			{Path: "items", Type: TypeObjectList},
+			{Path: "occurred_at", Type: TypeTimestamp},
+		}, customer...),
+	},
+	"SIGNUP": {
+		Trigger: "SIGNUP",
+		Fields: append([]Field{
+			{Path: "user_id", Type: TypeString},
+			{Path: "email", Type: TypeString},
+			{Path: "phone", Type: TypeString},
+			{Path: "channel", Type: TypeString},
+			{Path: "referral_code", Type: TypeString},
+			{Path: "signed_up_at", Type: TypeTimestamp},
+		}, customer...),
+	},
+	"BIRTHDAY": {
+		Trigger: "BIRTHDAY",
+		Fields: append([]Field{
+			{Path: "user_id", Type: TypeString},
+			{Path: "birth_date", Type: TypeTimestamp},
+			{Path: "age", Type: TypeInt},
+		}, customer...),
+	},
+	"ANNIVERSARY": {
+		Trigger: "ANNIVERSARY",
+		Fields: append([]Field{
+			{Path: "user_id", Type: TypeString},
+			{Path: "joined_at", Type: TypeTimestamp},
+			{Path: "years", Type: TypeInt},
+		}, customer...),
+	},
+	"SCHEDULE": {
+		Trigger: "SCHEDULE",
+		Fields: append([]Field{
+			{Path: "user_id", Type: TypeString},
+			{Path: "fired_at", Type: TypeTimestamp},
+		}, customer...),
+	},
+}
+
+// SchemaFor returns the attribute schema of a trigger.
+func SchemaFor(trigger string) (*Schema, error) {
+	schema, ok := schemas[trigger]
+	if !ok {
+		return nil, fmt.Errorf("no attribute schema for trigger %q", trigger)
+	}
+	return schema, nil
+}
@@ -0,0 +1,142 @@
+package celengine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateComparesFractionalAmounts(t *testing.T) {
+	schema := transaction(t)
+
+	cases := []struct {
+		expr   string
+		amount any
+		want   bool
+	}{
+		{"amount > 10.5", 10.75, true},
+		{"amount > 10.5", 10, false},
+		{"amount > 10", 10.25, true},
+		{"amount == 100.0", 100, true},
+		{"amount >= 100", int64(100), true},
+	}
+
+	for _, c := range cases {
+		got, err := schema.Evaluate(c.expr, map[string]any{"amount": c.amount})
+		if err != nil {
+			t.Fatalf("%s with %v: unexpected error: %v", c.expr, c.amount, err)
+		}
+		if got != c.want {
+			t.Fatalf("%s with %v: expected %v, got %v", c.expr, c.amount, c.want, got)
+		}
+	}
+}
+
+func TestActivationConvertsDeclaredAttributes(t *testing.T) {
+	customer := map[string]any{"joined_at": "2024-01-02T03:04:05Z"}
+	attrs := map[string]any{"amount": 100, "quantity": 2.0, "customer": customer, "note": "kept"}
+
+	out, err := transaction(t).Activation(attrs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if out["amount"] != 100.0 || out["quantity"] != int64(2) || out["note"] != "kept" {
+		t.Fatalf("unexpected activation %+v", out)
+	}
+
+	joined, ok := out["customer"].(map[string]any)["joined_at"].(time.Time)
+	if !ok || !joined.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("expected joined_at to be a timestamp, got %+v", out["customer"])
+	}
+
+	if _, ok := customer["joined_at"].(string); !ok {
+		t.Fatalf("expected the caller's attributes to be left untouched")
+	}
+}
+
+func TestActivationRejectsMistypedAttributes(t *testing.T) {
+	cases := []map[string]any{
+		{"amount": "100"},
+		{"quantity": 1.5},
+		{"occurred_at": "yesterday"},
+		{"customer": "GOLD"},
+	}
+
+	for _, attrs := range cases {
+		if _, err := transaction(t).Activation(attrs); err == nil {
+			t.Fatalf("expected %+v to be rejected", attrs)
+		}
+	}
+}
+
+func TestCustomFunctions(t *testing.T) {
+	defer func(original func() time.Time) { now = original }(now)
+	now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	schema := transaction(t)
+	attrs := map[string]any{
+		"occurred_at": "2024-02-20T13:00:00Z",
+		"items": []any{
+			map[string]any{"sku": "A", "price": 12.5},
+			map[string]any{"sku": "B", "price": 30},
+		},
+	}
+
+	for _, expr := range []string{
+		"days_since(occurred_at) == 9",
+		"sum(items, 'price') == 42.5",
+		"sum(items, 'price') > 40",
+	} {
+		ok, err := schema.Evaluate(expr, attrs)
+		if err != nil || !ok {
+			t.Fatalf("expected %s to hold, got %v %v", expr, ok, err)
+		}
+	}
+
+	if err := schema.Check("days_since(channel) > 1"); err == nil {
+		t.Fatalf("expected days_since on a string to be rejected")
+	}
+
+	_, err := schema.Evaluate("sum(items, 'sku') > 0", attrs)
+	if err == nil || !strings.Contains(err.Error(), "not a number") {
+		t.Fatalf("expected non numeric sum to fail, got %v", err)
+	}
+}
+
+func TestProgramsAreCached(t *testing.T) {
+	schema, err := SchemaFor("SIGNUP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const expr = `channel == "APP" && referral_code != ""`
+	if _, err := schema.Program(expr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := schema.programs.Load(expr); !ok {
+		t.Fatalf("expected the program to be cached")
+	}
+
+	first, _ := schema.Env()
+	second, _ := schema.Env()
+	if first != second {
+		t.Fatalf("expected one env per schema")
+	}
+}
+
+func TestBirthdaySchema(t *testing.T) {
+	schema, err := SchemaFor("BIRTHDAY")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ok, err := schema.Evaluate(`age >= 17 && customer.tier == "GOLD"`, map[string]any{
+		"age":      17,
+		"customer": map[string]any{"tier": "GOLD"},
+	})
+	if err != nil || !ok {
+		t.Fatalf("expected birthday condition to hold, got %v %v", ok, err)
+	}
+}
@@ -108,6 +108,15 @@ type Config struct {
 		Addr      string `mapstructure:"ADDR"`
 		Namespace string `mapstructure:"NAMESPACE"`
 	} `mapstructure:"TEMPORAL"`
+	Workflow struct {
+		ExecutionRetention time.Duration     `mapstructure:"EXECUTION_RETENTION"`
+		TriggerTopics      map[string]string `mapstructure:"TRIGGER_TOPICS"` // trigger type -> Kafka topic
+		DeadLetterTopic    string            `mapstructure:"DEAD_LETTER_TOPIC"`
+		NotificationTopic  string            `mapstructure:"NOTIFICATION_TOPIC"`
+	} `mapstructure:"WORKFLOW"`
+	Ledger struct {
+		PointsExpiry time.Duration `mapstructure:"POINTS_EXPIRY"` // 0 keeps points forever
+	} `mapstructure:"LEDGER"`
 	RuleEngineURL string `mapstructure:"RULE_ENGINE_URL"`
 	LedgerURL     string `mapstructure:"LEDGER_URL"`
 }
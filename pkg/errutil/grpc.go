@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -63,7 +64,22 @@ func ToGRPCError(err error) error {
 
 	var base BaseError
 	if errors.As(err, &base) {
-		return status.Error(base.Code.GRPCCode(), base.messageWithErr())
+		st := status.New(base.Code.GRPCCode(), base.messageWithErr())
+		if len(base.Details) == 0 {
+			return st.Err()
+		}
+
+		// Field details travel as a BadRequest detail so clients can map them back to inputs.
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(base.Details))
+		for _, d := range base.Details {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: d.Field, Description: d.Message})
+		}
+
+		withDetails, detailErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+		if detailErr != nil {
+			return st.Err()
+		}
+		return withDetails.Err()
 	}
 
 	var coder interface{ Status() CoreStatus }
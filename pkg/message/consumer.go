@@ -2,6 +2,8 @@ package message
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"go.uber.org/fx"
@@ -10,44 +12,101 @@ import (
 
 var ConsumerMessage = fx.Module("confluent.consumer", fx.Provide(NewConsumer))
 
+// ConsumerHandler handles the messages of a topic. A message is done once Handle
+// returns nil; an error is retried, holding back the messages after it on the
+// partition, so a handler skips a message it can never handle by returning nil.
 type ConsumerHandler interface {
 	Topic() string
 	Handle(ctx context.Context, key []byte, value []byte) error
 }
 
+// Backoff between attempts of a failing message.
+const (
+	retryInitialInterval = time.Second
+	retryMaximumInterval = time.Minute
+)
+
+// pollInterval bounds how long a poll blocks, so the consumer notices ctx and retries
+// that are due.
+const pollInterval = 100 * time.Millisecond
+
+// client is the part of *kafka.Consumer the consumer drives.
+type client interface {
+	Poll(timeoutMs int) kafka.Event
+	StoreMessage(m *kafka.Message) ([]kafka.TopicPartition, error)
+	Seek(partition kafka.TopicPartition, timeoutMs int) error
+	Pause(partitions []kafka.TopicPartition) error
+	Resume(partitions []kafka.TopicPartition) error
+	Close() error
+}
+
+// retry is a message whose handler failed. Its partition stays paused until the
+// message is done.
+type retry struct {
+	msg     *kafka.Message
+	handler ConsumerHandler
+	backoff time.Duration
+	next    time.Time
+}
+
 type Consumer struct {
-	consumer *kafka.Consumer
+	consumer client
 	handlers map[string]ConsumerHandler
-	topic    string
+	// retries holds the failing message of each paused partition.
+	retries map[string]*retry
+	backoff time.Duration
+	done    chan struct{}
 }
 
+// NewConsumer subscribes to the topics of handlers. Offsets are committed only for
+// messages their handler is done with, so a message is redelivered after a restart
+// until it is.
 func NewConsumer(cfg *kafka.ConfigMap, handlers []ConsumerHandler) (*Consumer, error) {
+	if err := cfg.SetKey("enable.auto.offset.store", false); err != nil {
+		return nil, err
+	}
+
 	c, err := kafka.NewConsumer(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	handlerMap := make(map[string]ConsumerHandler)
-	topics := []string{}
+	consumer := newConsumer(c, handlers)
 
+	topics := []string{}
 	for _, h := range handlers {
-		handlerMap[h.Topic()] = h
 		topics = append(topics, h.Topic())
 	}
 
-	if err := c.SubscribeTopics(topics, nil); err != nil {
+	if err := c.SubscribeTopics(topics, consumer.rebalance); err != nil {
 		return nil, err
 	}
 
+	return consumer, nil
+}
+
+func newConsumer(c client, handlers []ConsumerHandler) *Consumer {
+	handlerMap := make(map[string]ConsumerHandler)
+	for _, h := range handlers {
+		handlerMap[h.Topic()] = h
+	}
+
 	return &Consumer{
 		consumer: c,
 		handlers: handlerMap,
-	}, nil
-
+		retries:  map[string]*retry{},
+		backoff:  retryInitialInterval,
+	}
 }
 
+// Start polls in the background until ctx is done. A failing message pauses its
+// partition and is retried with backoff while the other partitions go on, so the
+// consumer keeps polling and stays in its group however long the retries take.
 func (c *Consumer) Start(ctx context.Context) {
+	c.done = make(chan struct{})
+
 	go func() {
+		defer close(c.done)
 		zap.L().Info("Kafka consumer started")
 
 		for {
@@ -57,28 +116,130 @@ func (c *Consumer) Start(ctx context.Context) {
 				return
 
 			default:
-				msg, err := c.consumer.ReadMessage(-1)
-				if err != nil {
-					zap.L().Error("Kafka read error", zap.Error(err))
-					continue
-				}
+				c.retryDue(ctx)
 
-				handler, ok := c.handlers[*msg.TopicPartition.Topic]
-				if !ok {
-					zap.L().Warn("No handler for topic", zap.String("topic", *msg.TopicPartition.Topic))
-					continue
+				switch e := c.consumer.Poll(c.pollTimeout()).(type) {
+				case *kafka.Message:
+					c.receive(ctx, e)
+				case kafka.Error:
+					zap.L().Error("Kafka read error", zap.Error(e))
 				}
-
-				go func(m *kafka.Message) {
-					if err := handler.Handle(ctx, m.Key, m.Value); err != nil {
-						zap.L().Error("Handler error", zap.String("topic", *m.TopicPartition.Topic), zap.Error(err))
-					}
-				}(msg)
 			}
 		}
 	}()
 }
 
+// pollTimeout is pollInterval, or less when a retry is due sooner.
+func (c *Consumer) pollTimeout() int {
+	timeout := pollInterval
+	for _, r := range c.retries {
+		timeout = min(timeout, max(time.Until(r.next), 0))
+	}
+	return int(timeout.Milliseconds())
+}
+
+func (c *Consumer) receive(ctx context.Context, msg *kafka.Message) {
+	if msg.TopicPartition.Error != nil {
+		zap.L().Error("Kafka read error", zap.Error(msg.TopicPartition.Error))
+		return
+	}
+
+	// Messages fetched before the partition paused are read again once it resumes.
+	if _, ok := c.retries[partitionKey(msg.TopicPartition)]; ok {
+		return
+	}
+
+	handler, ok := c.handlers[*msg.TopicPartition.Topic]
+	if !ok {
+		zap.L().Warn("No handler for topic", zap.String("topic", *msg.TopicPartition.Topic))
+		return
+	}
+
+	if err := handler.Handle(ctx, msg.Key, msg.Value); err != nil {
+		c.pause(&retry{msg: msg, handler: handler, backoff: c.backoff}, err)
+		return
+	}
+
+	c.store(msg)
+}
+
+// retryDue runs the retries whose backoff is over. A message that succeeds resumes its
+// partition from the message after it.
+func (c *Consumer) retryDue(ctx context.Context) {
+	now := time.Now()
+	for key, r := range c.retries {
+		if now.Before(r.next) {
+			continue
+		}
+
+		if err := r.handler.Handle(ctx, r.msg.Key, r.msg.Value); err != nil {
+			r.backoff = min(r.backoff*2, retryMaximumInterval)
+			c.pause(r, err)
+			continue
+		}
+
+		delete(c.retries, key)
+		c.store(r.msg)
+
+		next := r.msg.TopicPartition
+		next.Offset++
+		if err := c.consumer.Seek(next, 0); err != nil {
+			zap.L().Error("failed to seek partition", zap.String("topic", *next.Topic), zap.Int32("partition", next.Partition), zap.Error(err))
+		}
+
+		if err := c.consumer.Resume([]kafka.TopicPartition{next}); err != nil {
+			zap.L().Error("failed to resume partition", zap.String("topic", *next.Topic), zap.Int32("partition", next.Partition), zap.Error(err))
+		}
+	}
+}
+
+// pause holds back the partition of r's message until the message is done.
+func (c *Consumer) pause(r *retry, err error) {
+	tp := r.msg.TopicPartition
+	zap.L().Error("Handler error, retrying",
+		zap.String("topic", *tp.Topic),
+		zap.Int32("partition", tp.Partition),
+		zap.Duration("backoff", r.backoff),
+		zap.Error(err),
+	)
+
+	key := partitionKey(tp)
+	if _, paused := c.retries[key]; !paused {
+		if err := c.consumer.Pause([]kafka.TopicPartition{tp}); err != nil {
+			zap.L().Error("failed to pause partition", zap.String("topic", *tp.Topic), zap.Int32("partition", tp.Partition), zap.Error(err))
+		}
+	}
+
+	r.next = time.Now().Add(r.backoff)
+	c.retries[key] = r
+}
+
+// store records the message's offset for the next commit.
+func (c *Consumer) store(msg *kafka.Message) {
+	if _, err := c.consumer.StoreMessage(msg); err != nil {
+		zap.L().Error("failed to store message offset", zap.String("topic", *msg.TopicPartition.Topic), zap.Error(err))
+	}
+}
+
+// rebalance drops the retries of revoked partitions: their messages aren't done, so
+// they are redelivered to the partitions' next owner.
+func (c *Consumer) rebalance(_ *kafka.Consumer, ev kafka.Event) error {
+	if revoked, ok := ev.(kafka.RevokedPartitions); ok {
+		for _, tp := range revoked.Partitions {
+			delete(c.retries, partitionKey(tp))
+		}
+	}
+	return nil
+}
+
+func partitionKey(tp kafka.TopicPartition) string {
+	return fmt.Sprintf("%s/%d", *tp.Topic, tp.Partition)
+}
+
+// Close waits for a started consumer to stop polling, then closes it.
 func (c *Consumer) Close() error {
+	if c.done != nil {
+		<-c.done
+	}
 	return c.consumer.Close()
 }
@@ -0,0 +1,179 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// fakeClient serves the messages of each partition in order from its position,
+// skipping paused partitions, as the broker would.
+type fakeClient struct {
+	mu         sync.Mutex
+	partitions map[int32][]*kafka.Message
+	position   map[int32]int
+	paused     map[int32]bool
+	pauses     int
+	stored     []string
+}
+
+func newFakeClient(topic string, partitions map[int32][]string) *fakeClient {
+	c := &fakeClient{
+		partitions: map[int32][]*kafka.Message{},
+		position:   map[int32]int{},
+		paused:     map[int32]bool{},
+	}
+
+	for p, values := range partitions {
+		for i, v := range values {
+			c.partitions[p] = append(c.partitions[p], &kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: p, Offset: kafka.Offset(i)},
+				Value:          []byte(v),
+			})
+		}
+	}
+	return c
+}
+
+func (c *fakeClient) Poll(timeoutMs int) kafka.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for p, msgs := range c.partitions {
+		if !c.paused[p] && c.position[p] < len(msgs) {
+			c.position[p]++
+			return msgs[c.position[p]-1]
+		}
+	}
+
+	c.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	c.mu.Lock()
+	return nil
+}
+
+func (c *fakeClient) StoreMessage(m *kafka.Message) ([]kafka.TopicPartition, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stored = append(c.stored, string(m.Value))
+	return nil, nil
+}
+
+func (c *fakeClient) Seek(tp kafka.TopicPartition, _ int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.position[tp.Partition] = int(tp.Offset)
+	return nil
+}
+
+func (c *fakeClient) Pause(partitions []kafka.TopicPartition) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tp := range partitions {
+		c.paused[tp.Partition] = true
+	}
+	c.pauses++
+	return nil
+}
+
+func (c *fakeClient) Resume(partitions []kafka.TopicPartition) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tp := range partitions {
+		c.paused[tp.Partition] = false
+	}
+	return nil
+}
+
+func (c *fakeClient) Close() error { return nil }
+
+// flakyHandler fails each value listed in failures that many times.
+type flakyHandler struct {
+	mu       sync.Mutex
+	failures map[string]int
+	handled  []string
+}
+
+func (h *flakyHandler) Topic() string { return "events" }
+
+func (h *flakyHandler) Handle(_ context.Context, _ []byte, value []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failures[string(value)] > 0 {
+		h.failures[string(value)]--
+		return errors.New("downstream unavailable")
+	}
+	h.handled = append(h.handled, string(value))
+	return nil
+}
+
+func (h *flakyHandler) done(n int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.handled) == n
+}
+
+func TestConsumerPausesFailingPartition(t *testing.T) {
+	client := newFakeClient("events", map[int32][]string{
+		0: {"a1", "a2"},
+		1: {"b1"},
+	})
+	handler := &flakyHandler{failures: map[string]int{"a1": 2}}
+
+	c := newConsumer(client, []ConsumerHandler{handler})
+	c.backoff = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !handler.done(3) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The other partition goes on while a1 backs off, and a2 waits for a1.
+	want := []string{"b1", "a1", "a2"}
+	if len(handler.handled) != len(want) {
+		t.Fatalf("handled %v, want %v", handler.handled, want)
+	}
+	for i := range want {
+		if handler.handled[i] != want[i] || client.stored[i] != want[i] {
+			t.Fatalf("handled %v and stored %v, want %v", handler.handled, client.stored, want)
+		}
+	}
+
+	if client.pauses != 1 || client.paused[0] {
+		t.Fatalf("partition paused %d times and still paused: %v", client.pauses, client.paused[0])
+	}
+}
+
+func TestConsumerDropsRetriesOfRevokedPartitions(t *testing.T) {
+	topic := "events"
+	client := newFakeClient(topic, map[int32][]string{0: {"a1"}})
+	handler := &flakyHandler{failures: map[string]int{"a1": 1}}
+
+	c := newConsumer(client, []ConsumerHandler{handler})
+	msg := client.partitions[0][0]
+	c.receive(context.Background(), msg)
+	if len(c.retries) != 1 {
+		t.Fatalf("expected a1 to be retried, got %d retries", len(c.retries))
+	}
+
+	_ = c.rebalance(nil, kafka.RevokedPartitions{Partitions: []kafka.TopicPartition{{Topic: &topic, Partition: 0}}})
+	if len(c.retries) != 0 || len(client.stored) != 0 {
+		t.Fatalf("revoked partition kept %d retries and stored %v", len(c.retries), client.stored)
+	}
+}
@@ -48,18 +48,20 @@ func (p *Publish) Publish(ctx context.Context, topic, key string, value any) err
 		return err
 	}
 
-	go func() {
-		defer close(deliveryChan)
-		e := <-deliveryChan
+	// Wait for the broker to acknowledge the message, so a nil error means it was stored.
+	select {
+	case e := <-deliveryChan:
 		m := e.(*kafka.Message)
 		if m.TopicPartition.Error != nil {
 			zap.L().Error("Kafka delivery failed", zap.Error(m.TopicPartition.Error))
-		} else {
-			zap.L().Debug("Kafka message delivered", zap.String("topic", *m.TopicPartition.Topic))
+			return m.TopicPartition.Error
 		}
-	}()
+		zap.L().Debug("Kafka message delivered", zap.String("topic", *m.TopicPartition.Topic))
+		return nil
 
-	return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (p *Publish) Close() error {
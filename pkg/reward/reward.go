@@ -0,0 +1,354 @@
+// Package reward computes the points a REWARD_POINT action grants for an event.
+//
+// A Rule is decoded from the action's parameters. Amounts are read from the event
+// attributes in minor currency units: "amount" for the transaction total and
+// "items" for its line items, each a map with sku, category, price, quantity and
+// amount keys.
+package reward
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+)
+
+type Type string
+
+const (
+	// TypeFixed grants Value points per qualifying transaction or item.
+	TypeFixed Type = "FIXED"
+	// TypeMultiple grants Value points per currency unit for every whole UnitAmount spent.
+	TypeMultiple Type = "MULTIPLE"
+	// TypePercentBPS grants Value basis points of the amount spent.
+	TypePercentBPS Type = "PERCENT_BPS"
+	// TypePerUnit grants Value points per item quantity.
+	TypePerUnit Type = "PER_UNIT"
+)
+
+// UnmarshalJSON accepts the enum name or the RewardPointType number, as action
+// parameters are written by both the dashboard and protobuf encoders.
+func (t *Type) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = Type(name)
+		return nil
+	}
+
+	var number int32
+	if err := json.Unmarshal(b, &number); err != nil {
+		return fmt.Errorf("invalid reward_point_type %s", b)
+	}
+
+	*t = Type(workflowv1.RewardPointType(number).String())
+	return nil
+}
+
+type Rounding string
+
+const (
+	RoundingFloor    Rounding = "FLOOR"
+	RoundingCeil     Rounding = "CEIL"
+	RoundingHalfUp   Rounding = "HALF_UP"
+	RoundingHalfEven Rounding = "HALF_EVEN"
+)
+
+// snap drops binary floating point noise below a millionth of a point, so
+// 0.29 * 100 floors to 29 and not 28.
+func snap(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+func (r Rounding) apply(v float64) int64 {
+	v = snap(v)
+	switch r {
+	case RoundingCeil:
+		return int64(math.Ceil(v))
+	case RoundingHalfUp:
+		return int64(math.Floor(v + 0.5))
+	case RoundingHalfEven:
+		return int64(math.RoundToEven(v))
+	default:
+		return int64(math.Floor(v))
+	}
+}
+
+// ItemFilter selects the line items a rule rewards. An empty list matches any value.
+type ItemFilter struct {
+	SKUs       []string `json:"skus,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+func (f *ItemFilter) match(item Item) bool {
+	return matchAny(f.SKUs, item.SKU) && matchAny(f.Categories, item.Category)
+}
+
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type Rule struct {
+	Type       Type    `json:"reward_point_type"`
+	UnitAmount int64   `json:"unit_amount,omitempty"`
+	Value      float64 `json:"reward_point_value"`
+	// MaxPoints caps the points of one transaction; zero means uncapped.
+	MaxPoints int64 `json:"max_points,omitempty"`
+	// MinSpend is the eligible spend below which nothing is granted.
+	MinSpend int64    `json:"min_spend,omitempty"`
+	Rounding Rounding `json:"rounding,omitempty"`
+	// Items makes the rule item-level: it is applied to each matching line item and
+	// the rounded results are added up.
+	Items *ItemFilter `json:"items,omitempty"`
+}
+
+// Parse decodes and validates action parameters.
+func Parse(params []byte) (*Rule, error) {
+	var rule Rule
+	if err := json.Unmarshal(params, &rule); err != nil {
+		return nil, fmt.Errorf("invalid reward parameters: %w", err)
+	}
+
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func (r *Rule) Validate() error {
+	switch r.Type {
+	case TypeFixed, TypePercentBPS, TypePerUnit:
+	case TypeMultiple:
+		if r.UnitAmount <= 0 {
+			return fmt.Errorf("unit_amount must be greater than 0 for %s rewards", r.Type)
+		}
+	case "", Type(workflowv1.RewardPointType_REWARD_POINT_TYPE_UNSPECIFIED.String()):
+		return fmt.Errorf("reward_point_type is required")
+	default:
+		return fmt.Errorf("unsupported reward_point_type %s", r.Type)
+	}
+
+	if r.Value <= 0 {
+		return fmt.Errorf("reward_point_value must be greater than 0")
+	}
+
+	if r.MaxPoints < 0 || r.MinSpend < 0 {
+		return fmt.Errorf("max_points and min_spend must not be negative")
+	}
+
+	switch r.Rounding {
+	case "", RoundingFloor, RoundingCeil, RoundingHalfUp, RoundingHalfEven:
+	default:
+		return fmt.Errorf("unsupported rounding %s", r.Rounding)
+	}
+
+	return nil
+}
+
+// Item is one line item of a transaction.
+type Item struct {
+	SKU      string
+	Category string
+	Price    float64
+	Quantity float64
+	Amount   float64
+}
+
+// Line is the reward of one line item.
+type Line struct {
+	SKU    string `json:"sku"`
+	Spend  int64  `json:"spend"`
+	Points int64  `json:"points"`
+}
+
+type Result struct {
+	Points int64 `json:"points"`
+	// Spend is the amount the rule applied to: the transaction amount, or the
+	// matching items' total for item-level rules.
+	Spend int64 `json:"spend"`
+	// Uncapped is the number of points before MaxPoints was applied.
+	Uncapped int64  `json:"uncapped"`
+	Lines    []Line `json:"lines,omitempty"`
+	// Reason explains a zero result, e.g. a spend under MinSpend.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Calculate applies the rule to the event attributes.
+func (r *Rule) Calculate(attrs map[string]any) (*Result, error) {
+	if r.Items != nil {
+		return r.calculateItems(attrs)
+	}
+
+	amount := number(attrs["amount"])
+	quantity := number(attrs["quantity"])
+	if _, ok := attrs["quantity"]; !ok && r.Type == TypePerUnit {
+		items, err := Items(attrs)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			quantity += item.Quantity
+		}
+	}
+
+	res := &Result{Spend: int64(math.Round(amount))}
+	if amount < float64(r.MinSpend) {
+		res.Reason = fmt.Sprintf("spend %d is below the minimum of %d", res.Spend, r.MinSpend)
+		return res, nil
+	}
+
+	res.Uncapped = r.Rounding.apply(r.raw(amount, quantity))
+	res.Points = r.capped(res.Uncapped)
+	return res, nil
+}
+
+func (r *Rule) calculateItems(attrs map[string]any) (*Result, error) {
+	items, err := Items(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+
+	var spend float64
+	var matched []Item
+	for _, item := range items {
+		if r.Items.match(item) {
+			matched = append(matched, item)
+			spend += item.Amount
+		}
+	}
+
+	res.Spend = int64(math.Round(spend))
+	if len(matched) == 0 {
+		res.Reason = "no line item matches the rule"
+		return res, nil
+	}
+
+	if spend < float64(r.MinSpend) {
+		res.Reason = fmt.Sprintf("spend %d is below the minimum of %d", res.Spend, r.MinSpend)
+		return res, nil
+	}
+
+	for _, item := range matched {
+		points := r.Rounding.apply(r.raw(item.Amount, item.Quantity))
+		res.Lines = append(res.Lines, Line{SKU: item.SKU, Spend: int64(math.Round(item.Amount)), Points: points})
+		res.Uncapped += points
+	}
+
+	res.Points = r.capped(res.Uncapped)
+	return res, nil
+}
+
+// raw is the unrounded reward for an amount and a quantity.
+func (r *Rule) raw(amount, quantity float64) float64 {
+	switch r.Type {
+	case TypeMultiple:
+		units := math.Floor(snap(amount / float64(r.UnitAmount)))
+		return units * float64(r.UnitAmount) * r.Value
+	case TypePercentBPS:
+		return amount * r.Value / 10000
+	case TypePerUnit:
+		return quantity * r.Value
+	default:
+		return r.Value
+	}
+}
+
+func (r *Rule) capped(points int64) int64 {
+	if points < 0 {
+		return 0
+	}
+
+	if r.MaxPoints > 0 && points > r.MaxPoints {
+		return r.MaxPoints
+	}
+	return points
+}
+
+// Items reads the "items" attribute. A line without an amount is priced as
+// price * quantity, and a line without a quantity counts as one.
+func Items(attrs map[string]any) ([]Item, error) {
+	raw, ok := attrs["items"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	var list []map[string]any
+	switch v := raw.(type) {
+	case []map[string]any:
+		list = v
+	case []any:
+		for i, e := range v {
+			m, ok := e.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("items[%d] is not an object", i)
+			}
+			list = append(list, m)
+		}
+	default:
+		return nil, fmt.Errorf("items must be a list, got %T", raw)
+	}
+
+	items := make([]Item, 0, len(list))
+	for _, m := range list {
+		item := Item{
+			SKU:      text(m["sku"]),
+			Category: text(m["category"]),
+			Price:    number(m["price"]),
+			Quantity: 1,
+		}
+		if _, ok := m["quantity"]; ok {
+			item.Quantity = number(m["quantity"])
+		}
+
+		item.Amount = item.Price * item.Quantity
+		if _, ok := m["amount"]; ok {
+			item.Amount = number(m["amount"])
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func text(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// number reads a numeric attribute. Attributes decoded from JSON are float64,
+// attributes built in Go may be any integer type.
+func number(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	default:
+		return 0
+	}
+}
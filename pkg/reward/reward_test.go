@@ -0,0 +1,253 @@
+package reward
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		params string
+		want   Type
+		err    string
+	}{
+		{"enum name", `{"reward_point_type":"MULTIPLE","unit_amount":1000,"reward_point_value":0.01}`, TypeMultiple, ""},
+		{"enum number", `{"reward_point_type":3,"reward_point_value":150}`, TypePercentBPS, ""},
+		{"fixed", `{"reward_point_type":"FIXED","reward_point_value":10}`, TypeFixed, ""},
+		{"per unit", `{"reward_point_type":"PER_UNIT","reward_point_value":5}`, TypePerUnit, ""},
+		{"missing type", `{"reward_point_value":10}`, "", "reward_point_type is required"},
+		{"unspecified type", `{"reward_point_type":0,"reward_point_value":10}`, "", "reward_point_type is required"},
+		{"unknown type", `{"reward_point_type":"DOUBLE","reward_point_value":10}`, "", "unsupported reward_point_type"},
+		{"multiple without unit", `{"reward_point_type":"MULTIPLE","reward_point_value":1}`, "", "unit_amount"},
+		{"zero value", `{"reward_point_type":"FIXED","reward_point_value":0}`, "", "reward_point_value"},
+		{"negative cap", `{"reward_point_type":"FIXED","reward_point_value":1,"max_points":-1}`, "", "must not be negative"},
+		{"negative min spend", `{"reward_point_type":"FIXED","reward_point_value":1,"min_spend":-1}`, "", "must not be negative"},
+		{"unknown rounding", `{"reward_point_type":"FIXED","reward_point_value":1,"rounding":"BANKERS"}`, "", "unsupported rounding"},
+		{"malformed", `{"reward_point_type":true}`, "", "invalid reward"},
+	}
+
+	for _, c := range cases {
+		rule, err := Parse([]byte(c.params))
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("%s: expected error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+
+		if rule.Type != c.want {
+			t.Fatalf("%s: expected type %s, got %s", c.name, c.want, rule.Type)
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	cases := []struct {
+		value float64
+		mode  Rounding
+		want  int64
+	}{
+		{2.5, "", 2},
+		{2.5, RoundingFloor, 2},
+		{2.5, RoundingCeil, 3},
+		{2.5, RoundingHalfUp, 3},
+		{2.5, RoundingHalfEven, 2},
+		{3.5, RoundingHalfEven, 4},
+		{2.4, RoundingHalfUp, 2},
+		{2.6, RoundingHalfEven, 3},
+		{2.0, RoundingCeil, 2},
+		{0.29 * 100, RoundingFloor, 29},
+		{1.1 * 3, RoundingCeil, 4},
+		{0.1 + 0.2, RoundingCeil, 1},
+		{0, RoundingCeil, 0},
+	}
+
+	for _, c := range cases {
+		if got := c.mode.apply(c.value); got != c.want {
+			t.Fatalf("%v rounded %q: expected %d, got %d", c.value, c.mode, c.want, got)
+		}
+	}
+}
+
+func TestCalculateTransaction(t *testing.T) {
+	cases := []struct {
+		name     string
+		rule     Rule
+		attrs    map[string]any
+		points   int64
+		uncapped int64
+		reason   string
+	}{
+		{"fixed", Rule{Type: TypeFixed, Value: 50}, map[string]any{"amount": 100}, 50, 50, ""},
+		{"fixed without amount", Rule{Type: TypeFixed, Value: 50}, map[string]any{}, 50, 50, ""},
+		{"fixed fraction floors", Rule{Type: TypeFixed, Value: 10.7}, map[string]any{}, 10, 10, ""},
+
+		{"multiple whole units", Rule{Type: TypeMultiple, UnitAmount: 10000, Value: 0.001}, map[string]any{"amount": 25000}, 20, 20, ""},
+		{"multiple exact unit", Rule{Type: TypeMultiple, UnitAmount: 10000, Value: 0.001}, map[string]any{"amount": 10000}, 10, 10, ""},
+		{"multiple below unit", Rule{Type: TypeMultiple, UnitAmount: 10000, Value: 0.001}, map[string]any{"amount": 9999}, 0, 0, ""},
+		{"multiple json amount", Rule{Type: TypeMultiple, UnitAmount: 1000, Value: 0.01}, map[string]any{"amount": 5500.0}, 50, 50, ""},
+		{"multiple int64 amount", Rule{Type: TypeMultiple, UnitAmount: 1000, Value: 0.01}, map[string]any{"amount": int64(5500)}, 50, 50, ""},
+
+		{"bps floor", Rule{Type: TypePercentBPS, Value: 150}, map[string]any{"amount": 12345}, 185, 185, ""},
+		{"bps half up", Rule{Type: TypePercentBPS, Value: 150, Rounding: RoundingHalfUp}, map[string]any{"amount": 12345}, 185, 185, ""},
+		{"bps ceil", Rule{Type: TypePercentBPS, Value: 150, Rounding: RoundingCeil}, map[string]any{"amount": 12345}, 186, 186, ""},
+		{"bps half even tie", Rule{Type: TypePercentBPS, Value: 100, Rounding: RoundingHalfEven}, map[string]any{"amount": 250}, 2, 2, ""},
+		{"bps half up tie", Rule{Type: TypePercentBPS, Value: 100, Rounding: RoundingHalfUp}, map[string]any{"amount": 250}, 3, 3, ""},
+		{"bps full", Rule{Type: TypePercentBPS, Value: 10000}, map[string]any{"amount": 999}, 999, 999, ""},
+
+		{"per unit quantity", Rule{Type: TypePerUnit, Value: 5}, map[string]any{"quantity": 3}, 15, 15, ""},
+		{"per unit from items", Rule{Type: TypePerUnit, Value: 5}, map[string]any{"items": []any{
+			map[string]any{"sku": "a", "quantity": 2.0},
+			map[string]any{"sku": "b"},
+		}}, 15, 15, ""},
+		{"per unit nothing bought", Rule{Type: TypePerUnit, Value: 5}, map[string]any{"amount": 100}, 0, 0, ""},
+
+		{"cap", Rule{Type: TypePercentBPS, Value: 1000, MaxPoints: 500}, map[string]any{"amount": 100000}, 500, 10000, ""},
+		{"cap not reached", Rule{Type: TypePercentBPS, Value: 1000, MaxPoints: 500}, map[string]any{"amount": 1000}, 100, 100, ""},
+
+		{"min spend met", Rule{Type: TypeFixed, Value: 50, MinSpend: 1000}, map[string]any{"amount": 1000}, 50, 50, ""},
+		{"min spend missed", Rule{Type: TypeFixed, Value: 50, MinSpend: 1000}, map[string]any{"amount": 999}, 0, 0, "below the minimum"},
+		{"min spend without amount", Rule{Type: TypeFixed, Value: 50, MinSpend: 1}, map[string]any{}, 0, 0, "below the minimum"},
+
+		{"refund earns nothing", Rule{Type: TypePercentBPS, Value: 100}, map[string]any{"amount": -5000}, 0, 0, "below the minimum"},
+	}
+
+	for _, c := range cases {
+		res, err := c.rule.Calculate(c.attrs)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+
+		if res.Points != c.points || res.Uncapped != c.uncapped {
+			t.Fatalf("%s: expected %d points (%d uncapped), got %d (%d)", c.name, c.points, c.uncapped, res.Points, res.Uncapped)
+		}
+
+		if !strings.Contains(res.Reason, c.reason) || (c.reason == "" && res.Reason != "") {
+			t.Fatalf("%s: expected reason %q, got %q", c.name, c.reason, res.Reason)
+		}
+	}
+}
+
+func basket() map[string]any {
+	return map[string]any{
+		"amount": 47000,
+		"items": []any{
+			map[string]any{"sku": "COFFEE", "category": "drinks", "price": 15000.0, "quantity": 2.0},
+			map[string]any{"sku": "TEA", "category": "drinks", "price": 8000.0},
+			map[string]any{"sku": "CAKE", "category": "food", "price": 9000.0, "amount": 9000.0},
+		},
+	}
+}
+
+func TestCalculateItems(t *testing.T) {
+	cases := []struct {
+		name   string
+		rule   Rule
+		attrs  map[string]any
+		points int64
+		spend  int64
+		lines  []Line
+		reason string
+	}{
+		{
+			"bps per category",
+			Rule{Type: TypePercentBPS, Value: 250, Items: &ItemFilter{Categories: []string{"DRINKS"}}},
+			basket(), 950, 38000,
+			[]Line{{SKU: "COFFEE", Spend: 30000, Points: 750}, {SKU: "TEA", Spend: 8000, Points: 200}},
+			"",
+		},
+		{
+			"per unit by sku",
+			Rule{Type: TypePerUnit, Value: 7, Items: &ItemFilter{SKUs: []string{"COFFEE", "CAKE"}}},
+			basket(), 21, 39000,
+			[]Line{{SKU: "COFFEE", Spend: 30000, Points: 14}, {SKU: "CAKE", Spend: 9000, Points: 7}},
+			"",
+		},
+		{
+			"fixed per matching line",
+			Rule{Type: TypeFixed, Value: 10, Items: &ItemFilter{}},
+			basket(), 30, 47000, nil, "",
+		},
+		{
+			"multiple rounds per line",
+			Rule{Type: TypeMultiple, UnitAmount: 10000, Value: 0.001, Items: &ItemFilter{}},
+			basket(), 30, 47000,
+			[]Line{{SKU: "COFFEE", Spend: 30000, Points: 30}, {SKU: "TEA", Spend: 8000, Points: 0}, {SKU: "CAKE", Spend: 9000, Points: 0}},
+			"",
+		},
+		{
+			"ceil per line",
+			Rule{Type: TypePercentBPS, Value: 1, Rounding: RoundingCeil, Items: &ItemFilter{}},
+			basket(), 5, 47000, nil, "",
+		},
+		{
+			"cap on total",
+			Rule{Type: TypePercentBPS, Value: 250, MaxPoints: 900, Items: &ItemFilter{Categories: []string{"drinks"}}},
+			basket(), 900, 38000, nil, "",
+		},
+		{
+			"min spend on matching items",
+			Rule{Type: TypeFixed, Value: 10, MinSpend: 10000, Items: &ItemFilter{Categories: []string{"food"}}},
+			basket(), 0, 9000, nil, "below the minimum",
+		},
+		{
+			"no match",
+			Rule{Type: TypeFixed, Value: 10, Items: &ItemFilter{SKUs: []string{"BREAD"}}},
+			basket(), 0, 0, nil, "no line item",
+		},
+		{
+			"no items",
+			Rule{Type: TypeFixed, Value: 10, Items: &ItemFilter{}},
+			map[string]any{"amount": 1000}, 0, 0, nil, "no line item",
+		},
+		{
+			"typed items",
+			Rule{Type: TypePerUnit, Value: 1, Items: &ItemFilter{}},
+			map[string]any{"items": []map[string]any{{"sku": "A", "quantity": 4}}}, 4, 0, nil, "",
+		},
+	}
+
+	for _, c := range cases {
+		res, err := c.rule.Calculate(c.attrs)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+
+		if res.Points != c.points || res.Spend != c.spend {
+			t.Fatalf("%s: expected %d points on %d, got %d on %d", c.name, c.points, c.spend, res.Points, res.Spend)
+		}
+
+		if c.lines != nil {
+			if len(res.Lines) != len(c.lines) {
+				t.Fatalf("%s: expected %d lines, got %+v", c.name, len(c.lines), res.Lines)
+			}
+			for i, l := range c.lines {
+				if res.Lines[i] != l {
+					t.Fatalf("%s: line %d: expected %+v, got %+v", c.name, i, l, res.Lines[i])
+				}
+			}
+		}
+
+		if !strings.Contains(res.Reason, c.reason) || (c.reason == "" && res.Reason != "") {
+			t.Fatalf("%s: expected reason %q, got %q", c.name, c.reason, res.Reason)
+		}
+	}
+}
+
+func TestCalculateRejectsMalformedItems(t *testing.T) {
+	rule := Rule{Type: TypeFixed, Value: 1, Items: &ItemFilter{}}
+
+	for _, attrs := range []map[string]any{
+		{"items": "COFFEE"},
+		{"items": []any{"COFFEE"}},
+	} {
+		if _, err := rule.Calculate(attrs); err == nil {
+			t.Fatalf("expected error for %v", attrs)
+		}
+	}
+}
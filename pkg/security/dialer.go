@@ -0,0 +1,43 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// PublicDialer returns a dialer that only connects to public addresses. The check
+// runs on the address actually dialed, after DNS resolution, so a hostname that
+// resolves to a private, loopback or link-local address is refused too.
+func PublicDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("refusing to dial %s: %w", address, err)
+			}
+
+			if !PublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("refusing to dial non-public address %s", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+}
+
+// PublicAddr reports whether addr is routable on the public internet.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private in all but name.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
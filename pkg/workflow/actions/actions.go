@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/config"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/message"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.temporal.io/sdk/temporal"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// DefaultNotificationTopic is where SEND_NOTIFICATION publishes when no topic is
+// configured.
+const DefaultNotificationTopic = "workflow.notifications"
+
+// webhookTimeout bounds one CALL_WEBHOOK attempt.
+const webhookTimeout = 10 * time.Second
+
+// Request is one action an execution fired. Key identifies it across the retries of
+// its activity and the replays of its workflow.
+type Request struct {
+	Key            string         `json:"key"`
+	Type           string         `json:"type"`
+	OrganizationID string         `json:"organization_id"`
+	UserID         string         `json:"user_id"`
+	ReferenceID    string         `json:"reference_id"`
+	Parameters     []byte         `json:"parameters"`
+	Attributes     map[string]any `json:"attributes"`
+}
+
+// Result is what an action did, e.g. the code of the coupon it issued.
+type Result struct {
+	Output map[string]string `json:"output,omitempty"`
+}
+
+// Handler runs the actions of one type. Run is called again with the same request
+// until it succeeds, so it must take effect once per request Key.
+type Handler interface {
+	Type() string
+	Run(ctx context.Context, req *Request) (*Result, error)
+}
+
+// Registry routes actions to the handler of their type.
+type Registry struct {
+	handlers map[string]Handler
+}
+
+// NewRegistry registers the handlers. Every action type flows can fire needs one,
+// except REWARD_POINT, which the EarnPoint workflow credits itself.
+func NewRegistry(handlers ...Handler) (*Registry, error) {
+	r := &Registry{handlers: map[string]Handler{}}
+	for _, h := range handlers {
+		if _, ok := r.handlers[h.Type()]; ok {
+			return nil, fmt.Errorf("action type %s has more than one handler", h.Type())
+		}
+		r.handlers[h.Type()] = h
+	}
+
+	for _, t := range domain.ActionTypes() {
+		if _, ok := r.handlers[t]; !ok && t != workflowv1.ActionType_REWARD_POINT.String() {
+			return nil, fmt.Errorf("action type %s has no handler", t)
+		}
+	}
+
+	return r, nil
+}
+
+// Run runs the action through its handler. Actions that can never succeed, of an
+// unknown type or with invalid parameters, fail without retries.
+func (r *Registry) Run(ctx context.Context, req *Request) (*Result, error) {
+	h, ok := r.handlers[req.Type]
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("no handler for action type %s", req.Type), "UnsupportedAction", nil)
+	}
+
+	if err := domain.ValidateActionParameters(req.Type, req.Parameters); err != nil {
+		return nil, temporal.NewNonRetryableApplicationError("invalid action parameters", "InvalidParameters", err)
+	}
+
+	return h.Run(ctx, req)
+}
+
+type Params struct {
+	fx.In
+	DB        *gorm.DB
+	Ledger    ledgerv1.LedgerServiceClient
+	Publisher message.Publisher `optional:"true"`
+	Config    *config.Config    `optional:"true"`
+}
+
+// New builds the registry of the built-in action handlers.
+func New(p Params) (*Registry, error) {
+	topic := DefaultNotificationTopic
+	if p.Config != nil && p.Config.Workflow.NotificationTopic != "" {
+		topic = p.Config.Workflow.NotificationTopic
+	}
+
+	profile := repository.ProvideStore[domain.MemberProfile](p.DB)
+
+	return NewRegistry(
+		&Coupon{Store: repository.ProvideStore[domain.MemberCoupon](p.DB)},
+		&MemberTag{Profile: profile},
+		&MemberAttribute{Profile: profile},
+		&Tier{Profile: profile},
+		&Notification{Publisher: p.Publisher, Topic: topic},
+		&Webhook{Client: &http.Client{Timeout: webhookTimeout}},
+		&DeductPoints{Ledger: p.Ledger},
+	)
+}
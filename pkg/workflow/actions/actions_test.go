@@ -0,0 +1,145 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.temporal.io/sdk/temporal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeCoupons keeps issued coupons in memory, keyed by ID.
+type fakeCoupons struct {
+	repository.Repository[domain.MemberCoupon]
+	coupons map[string]*domain.MemberCoupon
+}
+
+func (f *fakeCoupons) FindOne(ctx context.Context, query *domain.MemberCoupon, opts ...option.QueryOption) (*domain.MemberCoupon, error) {
+	return f.coupons[query.ID], nil
+}
+
+func (f *fakeCoupons) Create(ctx context.Context, c *domain.MemberCoupon) error {
+	f.coupons[c.ID] = c
+	return nil
+}
+
+// fakeLedger keeps entries in memory and, like the ledger, refuses a reference it
+// already has.
+type fakeLedger struct {
+	ledgerv1.LedgerServiceClient
+	entries []*ledgerv1.LedgerEntry
+}
+
+func (f *fakeLedger) AddEntry(ctx context.Context, in *ledgerv1.AddEntryRequest, opts ...grpc.CallOption) (*ledgerv1.LedgerEntry, error) {
+	for _, e := range f.entries {
+		if e.ReferenceId == in.ReferenceId {
+			return nil, status.Error(codes.InvalidArgument, "failed to create new entry; reference_id already exists")
+		}
+	}
+
+	entry := &ledgerv1.LedgerEntry{Id: "entry-" + in.ReferenceId, OrgId: in.OrgId, UserId: in.UserId, Type: in.Type, Amount: in.Amount, ReferenceId: in.ReferenceId}
+	f.entries = append(f.entries, entry)
+	return entry, nil
+}
+
+func (f *fakeLedger) ListEntries(ctx context.Context, in *ledgerv1.ListEntriesRequest, opts ...grpc.CallOption) (*ledgerv1.ListEntriesResponse, error) {
+	return &ledgerv1.ListEntriesResponse{Data: f.entries}, nil
+}
+
+func TestNewRegistryRequiresEveryHandler(t *testing.T) {
+	if _, err := NewRegistry(&Coupon{}); err == nil || !strings.Contains(err.Error(), "has no handler") {
+		t.Fatalf("error = %v, want a missing handler", err)
+	}
+
+	if _, err := NewRegistry(&Coupon{}, &Coupon{}); err == nil || !strings.Contains(err.Error(), "more than one handler") {
+		t.Fatalf("error = %v, want a duplicate handler", err)
+	}
+}
+
+func TestRegistryRejectsInvalidParameters(t *testing.T) {
+	r := &Registry{handlers: map[string]Handler{"ISSUE_COUPON": &Coupon{}}}
+
+	_, err := r.Run(context.Background(), &Request{Type: "ISSUE_COUPON", Parameters: []byte(`{}`)})
+	var appErr *temporal.ApplicationError
+	if err == nil || !errors.As(err, &appErr) || !appErr.NonRetryable() {
+		t.Fatalf("error = %v, want a non-retryable error", err)
+	}
+}
+
+func TestCouponIssuesOncePerKey(t *testing.T) {
+	h := &Coupon{Store: &fakeCoupons{coupons: map[string]*domain.MemberCoupon{}}}
+	req := &Request{Key: "exec-1:0", OrganizationID: "org-id", UserID: "user-id", Parameters: []byte(`{"campaign":"welcome","prefix":"W-"}`)}
+
+	first, err := h.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	again, err := h.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.Output["code"] == "" || first.Output["code"] != again.Output["code"] {
+		t.Fatalf("codes = %q then %q, want one code", first.Output["code"], again.Output["code"])
+	}
+}
+
+func TestWebhookRetriesOnlyTransientFailures(t *testing.T) {
+	status := http.StatusOK
+	var key string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get(HeaderIdempotencyKey)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	h := &Webhook{Client: srv.Client()}
+	req := &Request{Key: "exec-1:2", Parameters: []byte(`{"url":"` + srv.URL + `"}`)}
+
+	if _, err := h.Run(context.Background(), req); err != nil || key != "exec-1:2" {
+		t.Fatalf("error = %v, key = %q, want a call keyed exec-1:2", err, key)
+	}
+
+	cases := map[int]bool{http.StatusBadGateway: false, http.StatusTooManyRequests: false, http.StatusBadRequest: true}
+	for code, final := range cases {
+		status = code
+		_, err := h.Run(context.Background(), req)
+
+		var appErr *temporal.ApplicationError
+		gotFinal := errors.As(err, &appErr) && appErr.NonRetryable()
+		if err == nil || gotFinal != final {
+			t.Fatalf("status %d: error = %v, non-retryable = %v, want %v", code, err, gotFinal, final)
+		}
+	}
+}
+
+func TestDeductPointsRetryFindsItsDebit(t *testing.T) {
+	ledger := &fakeLedger{}
+	h := &DeductPoints{Ledger: ledger}
+	req := &Request{Key: "exec-1:3", OrganizationID: "org-id", UserID: "user-id", Parameters: []byte(`{"points":50}`)}
+
+	first, err := h.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	again, err := h.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retry: unexpected error: %v", err)
+	}
+
+	if len(ledger.entries) != 1 || again.Output["ledger_entry_id"] != first.Output["ledger_entry_id"] {
+		t.Fatalf("entries = %d, ids %q then %q, want one debit", len(ledger.entries), first.Output["ledger_entry_id"], again.Output["ledger_entry_id"])
+	}
+}
@@ -0,0 +1,158 @@
+package actions
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"go.uber.org/zap"
+)
+
+// Coupon issues ISSUE_COUPON codes. A coupon is stored under the action's key and its
+// code derived from it, so a retried action hands out the code it issued before.
+type Coupon struct {
+	Store repository.Repository[domain.MemberCoupon]
+}
+
+func (h *Coupon) Type() string {
+	return workflowv1.ActionType_ISSUE_COUPON.String()
+}
+
+func (h *Coupon) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.IssueCouponParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon, err := h.Store.FindOne(ctx, &domain.MemberCoupon{ID: req.Key})
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon == nil {
+		coupon = domain.NewMemberCoupon(req.Key, req.OrganizationID, req.UserID, params, time.Now())
+		if err := h.Store.Create(ctx, coupon); err != nil {
+			return nil, err
+		}
+
+		zap.L().Info("coupon issued", zap.String("campaign", coupon.Campaign), zap.String("user_id", req.UserID))
+	}
+
+	return &Result{Output: map[string]string{"code": coupon.Code}}, nil
+}
+
+// profile loads the member's profile, or starts one when the member has none yet.
+func profile(ctx context.Context, store repository.Repository[domain.MemberProfile], req *Request) (*domain.MemberProfile, bool, error) {
+	m, err := store.FindOne(ctx, &domain.MemberProfile{
+		OrganizationID: req.OrganizationID,
+		UserID:         req.UserID,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if m == nil {
+		return domain.NewMemberProfile(req.OrganizationID, req.UserID), true, nil
+	}
+
+	return m, false, nil
+}
+
+func saveProfile(ctx context.Context, store repository.Repository[domain.MemberProfile], m *domain.MemberProfile, created bool, updates map[string]any) error {
+	if created {
+		return store.Create(ctx, m)
+	}
+	return store.Update(ctx, m.ID, updates)
+}
+
+// MemberTag runs SET_MEMBER_TAG. Tags are a set, so setting one twice changes nothing.
+type MemberTag struct {
+	Profile repository.Repository[domain.MemberProfile]
+}
+
+func (h *MemberTag) Type() string {
+	return workflowv1.ActionType_SET_MEMBER_TAG.String()
+}
+
+func (h *MemberTag) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.MemberTagParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	m, created, err := profile(ctx, h.Profile, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Tag(params.Tag, params.Remove) {
+		if err := saveProfile(ctx, h.Profile, m, created, map[string]any{"tags": m.Tags}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{}, nil
+}
+
+// MemberAttribute runs SET_MEMBER_ATTRIBUTE.
+type MemberAttribute struct {
+	Profile repository.Repository[domain.MemberProfile]
+}
+
+func (h *MemberAttribute) Type() string {
+	return workflowv1.ActionType_SET_MEMBER_ATTRIBUTE.String()
+}
+
+func (h *MemberAttribute) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.MemberAttributeParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	m, created, err := profile(ctx, h.Profile, req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.SetProperty(params.Attribute, params.Value)
+	if err := saveProfile(ctx, h.Profile, m, created, map[string]any{"properties": m.Properties}); err != nil {
+		return nil, err
+	}
+
+	return &Result{}, nil
+}
+
+// Tier runs UPGRADE_TIER. A member already in the tier isn't moved again.
+type Tier struct {
+	Profile repository.Repository[domain.MemberProfile]
+}
+
+func (h *Tier) Type() string {
+	return workflowv1.ActionType_UPGRADE_TIER.String()
+}
+
+func (h *Tier) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.UpgradeTierParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	m, created, err := profile(ctx, h.Profile, req)
+	if err != nil {
+		return nil, err
+	}
+
+	upgraded := m.UpgradeTier(params.Tier, params.From)
+	if upgraded {
+		if err := saveProfile(ctx, h.Profile, m, created, map[string]any{"tier": m.Tier}); err != nil {
+			return nil, err
+		}
+
+		zap.L().Info("member tier upgraded", zap.String("tier", m.Tier), zap.String("user_id", req.UserID))
+	}
+
+	return &Result{Output: map[string]string{"tier": m.Tier, "upgraded": strconv.FormatBool(upgraded)}}, nil
+}
@@ -0,0 +1,191 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/message"
+	"go.temporal.io/sdk/temporal"
+)
+
+// HeaderIdempotencyKey carries the action's key on CALL_WEBHOOK requests, so the
+// receiver can drop the repeats of a retried call.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// NotificationMessage asks the notification service to send a member a template.
+// ID is the action's key; the service sends a message once per ID.
+type NotificationMessage struct {
+	ID             string            `json:"id"`
+	OrganizationID string            `json:"organization_id"`
+	UserID         string            `json:"user_id"`
+	Template       string            `json:"template"`
+	Channel        string            `json:"channel"`
+	Data           map[string]string `json:"data,omitempty"`
+	Attributes     map[string]any    `json:"attributes,omitempty"`
+}
+
+// Notification runs SEND_NOTIFICATION by publishing to the notification topic, keyed
+// by the action's key.
+type Notification struct {
+	Publisher message.Publisher
+	Topic     string
+}
+
+func (h *Notification) Type() string {
+	return workflowv1.ActionType_SEND_NOTIFICATION.String()
+}
+
+func (h *Notification) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.NotificationParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Publisher == nil {
+		return nil, temporal.NewNonRetryableApplicationError("notifications aren't configured", "Unavailable", nil)
+	}
+
+	if err := h.Publisher.Publish(ctx, h.Topic, req.Key, NotificationMessage{
+		ID:             req.Key,
+		OrganizationID: req.OrganizationID,
+		UserID:         req.UserID,
+		Template:       params.Template,
+		Channel:        params.Channel,
+		Data:           params.Data,
+		Attributes:     req.Attributes,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Result{}, nil
+}
+
+type webhookPayload struct {
+	ID             string         `json:"id"`
+	OrganizationID string         `json:"organization_id"`
+	UserID         string         `json:"user_id"`
+	ReferenceID    string         `json:"reference_id"`
+	Attributes     map[string]any `json:"attributes"`
+}
+
+// Webhook runs CALL_WEBHOOK. Server errors, timeouts and 429s are retried; other
+// client errors fail the action for good.
+type Webhook struct {
+	Client *http.Client
+}
+
+func (h *Webhook) Type() string {
+	return workflowv1.ActionType_CALL_WEBHOOK.String()
+}
+
+func (h *Webhook) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.WebhookParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		ID:             req.Key,
+		OrganizationID: req.OrganizationID,
+		UserID:         req.UserID,
+		ReferenceID:    req.ReferenceID,
+		Attributes:     req.Attributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, params.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range params.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(HeaderIdempotencyKey, req.Key)
+
+	res, err := h.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return &Result{Output: map[string]string{"status": res.Status}}, nil
+	case res.StatusCode >= 500, res.StatusCode == http.StatusTooManyRequests, res.StatusCode == http.StatusRequestTimeout:
+		return nil, fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	default:
+		return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("webhook responded with status %d", res.StatusCode), "WebhookRejected", nil)
+	}
+}
+
+// DeductPoints runs DEDUCT_POINTS as a ledger debit referenced by the action's key,
+// so a retried action finds the debit of its earlier attempt instead of adding one.
+type DeductPoints struct {
+	Ledger ledgerv1.LedgerServiceClient
+}
+
+func (h *DeductPoints) Type() string {
+	return workflowv1.ActionType_DEDUCT_POINTS.String()
+}
+
+func (h *DeductPoints) Run(ctx context.Context, req *Request) (*Result, error) {
+	params, err := domain.ParseActionParams[domain.DeductPointsParams](req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Ledger == nil {
+		return nil, errors.New("ledger isn't configured")
+	}
+
+	entry, err := addEntryOnce(ctx, h.Ledger, &ledgerv1.AddEntryRequest{
+		OrgId:       req.OrganizationID,
+		UserId:      req.UserID,
+		ReferenceId: req.Key,
+		Type:        ledgerv1.EntryType_DEBIT,
+		Amount:      params.Points,
+		Description: "Points deducted",
+		Metadata:    map[string]string{"reference_id": req.ReferenceID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Output: map[string]string{"ledger_entry_id": entry.GetId()}}, nil
+}
+
+// addEntryOnce adds the entry, or returns the one an earlier attempt already added
+// under its reference when the ledger refuses the repeat. Any other failure is
+// returned as is.
+func addEntryOnce(ctx context.Context, ledger ledgerv1.LedgerServiceClient, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error) {
+	entry, err := ledger.AddEntry(ctx, req)
+	if err == nil {
+		return entry, nil
+	}
+
+	entries, listErr := ledger.ListEntries(ctx, &ledgerv1.ListEntriesRequest{OrgId: req.OrgId, UserId: req.UserId})
+	if listErr != nil {
+		return nil, err
+	}
+
+	for _, e := range entries.Data {
+		if e.ReferenceId == req.ReferenceId && e.Type == req.Type {
+			return e, nil
+		}
+	}
+
+	return nil, err
+}
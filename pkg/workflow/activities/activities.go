@@ -1,108 +1,738 @@
 package activities
 
+import (
+	"context"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	webhook "github.com/smallbiznis/smallbiznis-apps/internal/webhook/domain"
+	webhook_usecase "github.com/smallbiznis/smallbiznis-apps/internal/webhook/usecase"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/actions"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/budget"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/frequency"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
 const (
-	CallEvaluateRule  = "CallEvaluateRule"
-	CreateLedgerEntry = "CreateLedgerEntry"
+	CallEvaluateRule       = "CallEvaluateRule"
+	ResumeFlow             = "ResumeFlow"
+	RunAction              = "RunAction"
+	ReserveBudget          = "ReserveBudget"
+	ReleaseBudget          = "ReleaseBudget"
+	CreateLedgerEntry      = "CreateLedgerEntry"
+	RecordExecutionOutcome = "RecordExecutionOutcome"
 )
 
-// type Activities struct {
-// 	Ledger ledgerv1.LedgerServiceClient
-// 	Flow   repository.Repository[domain.Flow]
-// }
-
-// func (a *Activities) CallEvaluateRule(ctx context.Context, req *pointv1.EarningRequest) ([]*domain.NodeAction, error) {
-// 	flow, err := a.Flow.FindOne(ctx, &domain.Flow{
-// 		OrganizationID: req.OrganizationId,
-// 		Trigger:        workflowv1.TriggerType_TRANSACTION.String(),
-// 		Status:         workflowv1.FlowStatus_ACTIVE.String(),
-// 	})
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	if flow == nil {
-// 		return nil, fmt.Errorf("workflow not found")
-// 	}
-
-// 	attr := celengine.StructToMap(req.GetTransaction())
-// 	graph, err := flow.BuildFlowGraph()
-// 	if err != nil {
-// 		return nil, status.Error(codes.Internal, err.Error())
-// 	}
-
-// 	triggerNode := FindTriggerNode(graph.Nodes)
-// 	actions, err := ExecuteFlow(ctx, graph, triggerNode, attr)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return actions, nil
-// }
-
-// func FindTriggerNode(nodes map[string]*domain.Node) *domain.Node {
-// 	for _, node := range nodes {
-// 		if node.Type == workflowv1.NodeType_TRIGGER {
-// 			return node
-// 		}
-// 	}
-// 	return nil
-// }
-
-// func ExecuteFlow(ctx context.Context, graph *domain.FlowGraph, currentNode *domain.Node, input map[string]interface{}) ([]*domain.NodeAction, error) {
-// 	var actions []*domain.NodeAction
-// 	switch currentNode.Type {
-// 	case workflowv1.NodeType_TRIGGER:
-// 		pass, err := EvaluateCEL(currentNode.Condition.Expression, input)
-// 		if err != nil {
-// 			zap.L().Error("failed evaluate cel", zap.Error(err))
-// 			return nil, err
-// 		}
-
-// 		edges := graph.Edges[currentNode.ID]
-// 		for _, edge := range edges {
-// 			if (pass && edge.Type == workflowv1.EdgeType_EDGE_TYPE_THEN.String()) || (!pass && edge.Type == workflowv1.EdgeType_EDGE_TYPE_OTHERWISE.String()) {
-// 				return ExecuteFlow(ctx, graph, graph.Nodes[edge.Target], input)
-// 			}
-// 		}
-
-// 	case workflowv1.NodeType_ACTION:
-// 		actions = append(actions, currentNode.Action)
-// 	case workflowv1.NodeType_CONDITION:
-// 		edges := graph.Edges[currentNode.ID]
-// 		for _, edge := range edges {
-// 			return ExecuteFlow(ctx, graph, graph.Nodes[edge.Target], input)
-// 		}
-// 	}
-
-// 	return actions, nil
-// }
-
-// func EvaluateCEL(expr string, attrs map[string]interface{}) (bool, error) {
-// 	env, err := celengine.BuildCelEnvFromAttributes(attrs)
-// 	if err != nil {
-// 		return false, status.Errorf(codes.Internal, "failed to BuildCelEnvFromAttributes: %v", err)
-// 	}
-
-// 	ast, issues := env.Compile(expr)
-// 	if issues != nil && issues.Err() != nil {
-// 		return false, issues.Err()
-// 	}
-
-// 	prg, err := env.Program(ast)
-// 	if err != nil {
-// 		return false, err
-// 	}
-
-// 	out, _, err := prg.Eval(attrs)
-// 	if err != nil {
-// 		return false, err
-// 	}
-
-// 	return out.Value().(bool), nil
-// }
-
-// func (a *Activities) CreateLedgerEntry(ctx context.Context, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error) {
-// 	return a.Ledger.AddEntry(ctx, req)
-// }
-
-// func (a *Activities) Reward(ctx context.Context) {}
+// EarnPointRequest is the input of the EarnPoint workflow. Attributes are the event
+// attributes the flows' conditions are evaluated against. FlowID narrows the run to
+// one flow, as a schedule fires a single flow.
+type EarnPointRequest struct {
+	OrganizationID string         `json:"organization_id"`
+	UserID         string         `json:"user_id"`
+	ReferenceID    string         `json:"reference_id"`
+	Trigger        string         `json:"trigger"`
+	FlowID         string         `json:"flow_id,omitempty"`
+	Attributes     map[string]any `json:"attributes"`
+}
+
+// EarnPointResult is what an EarnPoint run did: the flows that fired and those that
+// matched but were suppressed, each with the reason.
+type EarnPointResult struct {
+	Fired      []FlowOutcome `json:"fired"`
+	Suppressed []FlowOutcome `json:"suppressed"`
+}
+
+type FlowOutcome struct {
+	ExecutionID string `json:"execution_id"`
+	FlowID      string `json:"flow_id"`
+	Version     int32  `json:"version"`
+	Points      int64  `json:"points,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// FlowExecution is the outcome of one flow for an event: the actions it fired, the
+// paths it paused, the published version of the flow that ran and the audit record
+// of the run. Budgeted flows charge their rewards to the flow's budget. Skipped says
+// why a flow that matched fired nothing: its cap or the stacking policy.
+type FlowExecution struct {
+	ExecutionID string               `json:"execution_id"`
+	FlowID      string               `json:"flow_id"`
+	Version     int32                `json:"version"`
+	Actions     []*domain.NodeAction `json:"actions"`
+	Waits       []*domain.Wait       `json:"waits,omitempty"`
+	Failed      bool                 `json:"failed"`
+	Budgeted    bool                 `json:"budgeted,omitempty"`
+	Skipped     string               `json:"skipped,omitempty"`
+}
+
+// ResumeRequest continues a flow execution past the wait at NodeID. Received says
+// whether a WAIT_FOR_EVENT got its event before timing out.
+type ResumeRequest struct {
+	ExecutionID string         `json:"execution_id"`
+	FlowID      string         `json:"flow_id"`
+	Version     int32          `json:"version"`
+	NodeID      string         `json:"node_id"`
+	Received    bool           `json:"received"`
+	Attributes  map[string]any `json:"attributes"`
+}
+
+// ExecutionOutcome settles the audit records of a workflow run: the points each flow
+// earned and the ledger entry they were credited in, or why the run failed.
+type ExecutionOutcome struct {
+	LedgerEntryID string            `json:"ledger_entry_id"`
+	Error         string            `json:"error"`
+	Results       []ExecutionResult `json:"results"`
+}
+
+// ExecutionResult settles one record. Skipped says why some of its rewards weren't
+// credited.
+type ExecutionResult struct {
+	ExecutionID string `json:"execution_id"`
+	Points      int64  `json:"points"`
+	Waiting     bool   `json:"waiting"`
+	Skipped     string `json:"skipped,omitempty"`
+}
+
+// BudgetRequest charges reward actions to their flows' budgets before they are
+// credited, or releases the charges when the credit fails. Each spend is keyed by its
+// action's key.
+type BudgetRequest struct {
+	Spends []*domain.BudgetSpend `json:"spends"`
+}
+
+type Activities struct {
+	Ledger     ledgerv1.LedgerServiceClient
+	Flow       repository.Repository[domain.Flow]
+	Version    repository.Repository[domain.FlowVersion]
+	Execution  repository.Repository[domain.FlowExecution]
+	Wait       repository.Repository[domain.FlowWait]
+	Assignment repository.Repository[domain.FlowAssignment]
+	Settings   repository.Repository[domain.FlowSettings]
+	Actions    *actions.Registry
+	// Caps enforces frequency caps; without it flows fire uncapped.
+	Caps *frequency.Limiter
+	// Budget charges budgeted flows' rewards; without it budgets aren't enforced.
+	Budget  budget.Store
+	Webhook webhook_usecase.Publisher
+}
+
+type Params struct {
+	fx.In
+	DB      *gorm.DB
+	Ledger  ledgerv1.LedgerServiceClient
+	Actions *actions.Registry
+	Caps    *frequency.Limiter        `optional:"true"`
+	Budget  budget.Store              `optional:"true"`
+	Webhook webhook_usecase.Publisher `optional:"true"`
+}
+
+func New(p Params) *Activities {
+	return &Activities{
+		Ledger:     p.Ledger,
+		Flow:       repository.ProvideStore[domain.Flow](p.DB),
+		Version:    repository.ProvideStore[domain.FlowVersion](p.DB),
+		Execution:  repository.ProvideStore[domain.FlowExecution](p.DB),
+		Wait:       repository.ProvideStore[domain.FlowWait](p.DB),
+		Assignment: repository.ProvideStore[domain.FlowAssignment](p.DB),
+		Settings:   repository.ProvideStore[domain.FlowSettings](p.DB),
+		Actions:    p.Actions,
+		Caps:       p.Caps,
+		Budget:     p.Budget,
+		Webhook:    p.Webhook,
+	}
+}
+
+// CallEvaluateRule runs the live version of every active flow of the organization
+// listening on the request's trigger and returns what each of them fired. Flows
+// outside their campaign window are skipped. Every run
+// is recorded; a flow that fails to run is recorded as failed and fires nothing, so
+// one broken flow doesn't hold back the others. A flow over its frequency cap, or
+// whose budget can't cover any of its rewards, is recorded as capped. When several of
+// the others fire, the organization's stacking policy decides which of them do; the
+// rest are recorded as suppressed. Neither capped nor suppressed flows fire anything.
+func (a *Activities) CallEvaluateRule(ctx context.Context, req *EarnPointRequest) ([]*FlowExecution, error) {
+	trigger := req.Trigger
+	if trigger == "" {
+		trigger = workflowv1.TriggerType_TRANSACTION.String()
+	}
+
+	flows, err := a.Flow.Find(ctx, &domain.Flow{
+		ID:             req.FlowID,
+		OrganizationID: req.OrganizationID,
+		Trigger:        trigger,
+		Status:         workflowv1.FlowStatus_ACTIVE.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workflowID := activity.GetInfo(ctx).WorkflowExecution.ID
+	now := time.Now()
+
+	var runs []*flowRun
+	for _, flow := range flows {
+		if schedule := flow.Schedule(); schedule != nil && !schedule.Active(now) {
+			continue
+		}
+
+		record, err := a.execution(ctx, workflowID, flow.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if record == nil {
+			record = domain.NewFlowExecution(domain.FlowExecutionParams{
+				OrganizationID: req.OrganizationID,
+				FlowID:         flow.ID,
+				FlowVersion:    flow.Version,
+				WorkflowID:     workflowID,
+				Trigger:        trigger,
+				UserID:         req.UserID,
+				ReferenceID:    req.ReferenceID,
+				Event:          req.Attributes,
+			})
+		}
+
+		start := time.Now()
+		exec, err := run(flow, req.UserID, req.Attributes)
+		runs = append(runs, &flowRun{flow: flow, record: record, exec: exec, err: err, took: time.Since(start)})
+	}
+
+	policy, err := a.stackingPolicy(ctx, req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only flows that can still fire contend, so a capped or out-of-budget flow doesn't
+	// suppress the others.
+	var contenders []domain.Contender
+	for _, r := range runs {
+		if r.err != nil || !r.exec.Fired() {
+			continue
+		}
+
+		points, reason, err := a.eligible(ctx, r.flow, r.record, r.exec, req.Attributes)
+		if err != nil {
+			return nil, err
+		}
+
+		if reason == domain.BudgetExhausted {
+			if err := a.pauseExhausted(ctx, r.flow); err != nil {
+				return nil, err
+			}
+		}
+
+		if reason != "" {
+			r.ineligible = reason
+			continue
+		}
+
+		contenders = append(contenders, domain.Contender{
+			FlowID:   r.flow.ID,
+			Priority: r.flow.Priority,
+			Group:    r.flow.ExclusiveGroup,
+			Points:   points,
+		})
+	}
+	suppressed := domain.ResolveStacking(policy, contenders)
+
+	var executions []*FlowExecution
+	for _, r := range runs {
+		flow, record, exec, err := r.flow, r.record, r.exec, r.err
+
+		skipped := r.ineligible
+		if winner, ok := suppressed[flow.ID]; ok {
+			skipped = domain.SuppressedReason(policy, winner)
+			exec.Skip(skipped)
+		} else if skipped != "" {
+			exec.Skip(skipped)
+		} else if err == nil {
+			if skipped, err = a.applyCaps(ctx, flow, record, exec, true); err != nil {
+				return nil, err
+			}
+		}
+
+		record.Record(exec, err, r.took)
+		if err != nil {
+			zap.L().Error("failed to execute flow", zap.Error(err), zap.String("flow_id", flow.ID))
+		}
+
+		switch {
+		case suppressed[flow.ID] != "":
+			record.Suppress(skipped)
+		case skipped != "":
+			record.Cap(skipped)
+		}
+
+		if err := a.saveExecution(ctx, record); err != nil {
+			return nil, err
+		}
+
+		result := &FlowExecution{
+			ExecutionID: record.ID,
+			FlowID:      flow.ID,
+			Version:     flow.Version,
+			Failed:      err != nil,
+			Budgeted:    flow.Budgeted(),
+			Skipped:     skipped,
+		}
+		if err == nil {
+			result.Actions = exec.Actions
+			if err := a.recordAssignments(ctx, record, exec.Assignments); err != nil {
+				return nil, err
+			}
+			if result.Waits, err = a.registerWaits(ctx, record, exec.Waits); err != nil {
+				return nil, err
+			}
+		}
+		executions = append(executions, result)
+	}
+
+	return executions, nil
+}
+
+// flowRun is one flow run for an event, before the stacking policy and caps apply.
+// ineligible is why the flow can't fire and stays out of the stacking contest.
+type flowRun struct {
+	flow       *domain.Flow
+	record     *domain.FlowExecution
+	exec       *domain.Execution
+	err        error
+	took       time.Duration
+	ineligible string
+}
+
+// eligible checks, before the stacking contest, whether what the execution fired can
+// go through: the flow's cap has room and, when budgets are enforced, its budget
+// grants some of its rewards.
+// Actions over their own caps are dropped from the execution. Nothing is counted; the
+// contest's winners claim their caps after it. It returns the points the flow can
+// award, or why it can't fire.
+func (a *Activities) eligible(ctx context.Context, flow *domain.Flow, record *domain.FlowExecution, exec *domain.Execution, attrs map[string]any) (int64, string, error) {
+	if a.Caps != nil && record.UserID != "" {
+		claim := frequency.Claim{
+			OrganizationID: record.OrganizationID,
+			UserID:         record.UserID,
+			Location:       flow.Location(),
+			Now:            time.Now(),
+		}
+
+		if c := flow.FrequencyCap(); c != nil {
+			claim.Scope, claim.Member, claim.Cap = record.FlowID, record.ID, c
+			allowed, err := a.Caps.Check(ctx, claim)
+			if err != nil {
+				return 0, "", err
+			}
+
+			if !allowed {
+				return 0, c.Reason(), nil
+			}
+		}
+
+		for _, action := range exec.CappedActions() {
+			claim.Scope, claim.Member, claim.Cap = record.FlowID+":"+action.NodeID, record.ID+":"+action.NodeID, action.Cap
+			allowed, err := a.Caps.Check(ctx, claim)
+			if err != nil {
+				return 0, "", err
+			}
+
+			if !allowed {
+				exec.SkipAction(action.NodeID, action.Cap.Reason())
+			}
+		}
+	}
+
+	if a.Budget == nil || !flow.Budgeted() {
+		return exec.RewardPoints(attrs), "", nil
+	}
+
+	var rewards []int64
+	for _, action := range exec.Actions {
+		if p, _, err := domain.ActionPoints(action, attrs); err == nil && p > 0 {
+			rewards = append(rewards, p)
+		}
+	}
+
+	points := flow.BudgetGrants(rewards)
+	if len(rewards) > 0 && points == 0 {
+		return 0, domain.BudgetExhausted, nil
+	}
+
+	return points, "", nil
+}
+
+// stackingPolicy returns the organization's stacking policy; ALL without settings.
+func (a *Activities) stackingPolicy(ctx context.Context, orgID string) (string, error) {
+	if a.Settings == nil {
+		return domain.StackingAll, nil
+	}
+
+	settings, err := a.Settings.FindOne(ctx, &domain.FlowSettings{OrganizationID: orgID})
+	if err != nil {
+		return "", err
+	}
+	return settings.Policy(), nil
+}
+
+// ResumeFlow runs the rest of an execution once the wait at the request's node is
+// over. It runs the version the execution started on, so publishing a new version
+// doesn't change executions already waiting.
+func (a *Activities) ResumeFlow(ctx context.Context, req *ResumeRequest) (*FlowExecution, error) {
+	record, err := a.Execution.FindOne(ctx, &domain.FlowExecution{ID: req.ExecutionID})
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, temporal.NewNonRetryableApplicationError("flow execution not found", "NotFound", nil)
+	}
+
+	version, err := a.Version.FindOne(ctx, &domain.FlowVersion{FlowID: req.FlowID, Version: req.Version})
+	if err != nil {
+		return nil, err
+	}
+
+	if version == nil {
+		return nil, temporal.NewNonRetryableApplicationError("flow version not found", "NotFound", nil)
+	}
+
+	start := time.Now()
+	exec, err := resume(version.Graph(), record.UserID, req)
+	took := time.Since(start)
+
+	if err == nil {
+		if _, err := a.applyCaps(ctx, version.Graph(), record, exec, false); err != nil {
+			return nil, err
+		}
+	}
+
+	record.Resume(exec, err, took)
+	if err != nil {
+		zap.L().Error("failed to resume flow", zap.Error(err), zap.String("flow_id", req.FlowID), zap.String("node_id", req.NodeID))
+	}
+
+	if err := a.saveExecution(ctx, record); err != nil {
+		return nil, err
+	}
+
+	if err := a.Wait.Update(ctx, domain.WaitID(record.ID, req.NodeID), map[string]any{"status": domain.WaitStatusResolved}); err != nil {
+		return nil, err
+	}
+
+	result := &FlowExecution{
+		ExecutionID: record.ID,
+		FlowID:      req.FlowID,
+		Version:     req.Version,
+		Failed:      err != nil,
+	}
+
+	// The budget belongs to the flow, not the version the execution runs.
+	flow, findErr := a.Flow.FindOne(ctx, &domain.Flow{ID: req.FlowID})
+	if findErr != nil {
+		return nil, findErr
+	}
+	result.Budgeted = flow != nil && flow.Budgeted()
+
+	if err == nil {
+		result.Actions = exec.Actions
+		if err := a.recordAssignments(ctx, record, exec.Assignments); err != nil {
+			return nil, err
+		}
+		if result.Waits, err = a.registerWaits(ctx, record, exec.Waits); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func resume(flow *domain.Flow, userID string, req *ResumeRequest) (*domain.Execution, error) {
+	graph, err := flow.BuildFlowGraph()
+	if err != nil {
+		return nil, err
+	}
+	return graph.Resume(memberAttributes(userID, req.Attributes), req.NodeID, req.Received)
+}
+
+// applyCaps counts what the execution fired against the frequency caps of the flow,
+// when capFlow is set, and of its actions. It returns the reason when the flow's cap
+// is reached: the execution then fires nothing. An action over its cap is skipped.
+// Firings are claimed by execution, so retries aren't counted twice.
+func (a *Activities) applyCaps(ctx context.Context, flow *domain.Flow, record *domain.FlowExecution, exec *domain.Execution, capFlow bool) (string, error) {
+	if a.Caps == nil || record.UserID == "" || !exec.Fired() {
+		return "", nil
+	}
+
+	claim := frequency.Claim{
+		OrganizationID: record.OrganizationID,
+		UserID:         record.UserID,
+		Location:       flow.Location(),
+		Now:            time.Now(),
+	}
+
+	if c := flow.FrequencyCap(); capFlow && c != nil {
+		claim.Scope, claim.Member, claim.Cap = record.FlowID, record.ID, c
+		allowed, err := a.Caps.Allow(ctx, claim)
+		if err != nil {
+			return "", err
+		}
+
+		if !allowed {
+			exec.Skip(c.Reason())
+			return c.Reason(), nil
+		}
+	}
+
+	for _, action := range exec.CappedActions() {
+		claim.Scope, claim.Member, claim.Cap = record.FlowID+":"+action.NodeID, record.ID+":"+action.NodeID, action.Cap
+		allowed, err := a.Caps.Allow(ctx, claim)
+		if err != nil {
+			return "", err
+		}
+
+		if !allowed {
+			exec.SkipAction(action.NodeID, action.Cap.Reason())
+		}
+	}
+
+	return "", nil
+}
+
+// recordAssignments records the variants the execution's splits assigned, once per
+// split however often the activity is retried.
+func (a *Activities) recordAssignments(ctx context.Context, record *domain.FlowExecution, assignments []*domain.Assignment) error {
+	for _, as := range assignments {
+		assignment := domain.NewFlowAssignment(record, as)
+
+		exist, err := a.Assignment.FindOne(ctx, &domain.FlowAssignment{ID: assignment.ID})
+		if err != nil {
+			return err
+		}
+
+		if exist != nil {
+			continue
+		}
+
+		if err := a.Assignment.Create(ctx, assignment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerWaits names the execution's waits and registers those waiting for an
+// event, so the event can be routed to the execution.
+func (a *Activities) registerWaits(ctx context.Context, record *domain.FlowExecution, waits []*domain.Wait) ([]*domain.Wait, error) {
+	for _, w := range waits {
+		w.ID = domain.WaitID(record.ID, w.NodeID)
+		if !w.ForEvent() {
+			continue
+		}
+
+		exist, err := a.Wait.FindOne(ctx, &domain.FlowWait{ID: w.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		if exist != nil {
+			continue
+		}
+
+		if err := a.Wait.Create(ctx, domain.NewFlowWait(record, w)); err != nil {
+			return nil, err
+		}
+	}
+
+	return waits, nil
+}
+
+func run(flow *domain.Flow, userID string, attrs map[string]any) (*domain.Execution, error) {
+	graph, err := flow.BuildFlowGraph()
+	if err != nil {
+		return nil, err
+	}
+	return graph.Execute(memberAttributes(userID, attrs))
+}
+
+// memberAttributes adds the member's user_id to the event attributes when the event
+// doesn't carry it, so splits can assign the member.
+func memberAttributes(userID string, attrs map[string]any) map[string]any {
+	if _, ok := attrs["user_id"]; ok || userID == "" {
+		return attrs
+	}
+
+	out := make(map[string]any, len(attrs)+1)
+	for k, v := range attrs {
+		out[k] = v
+	}
+	out["user_id"] = userID
+	return out
+}
+
+// execution finds the record a previous attempt of this activity left for the flow.
+func (a *Activities) execution(ctx context.Context, workflowID, flowID string) (*domain.FlowExecution, error) {
+	return a.Execution.FindOne(ctx, &domain.FlowExecution{WorkflowID: workflowID, FlowID: flowID})
+}
+
+func (a *Activities) saveExecution(ctx context.Context, record *domain.FlowExecution) error {
+	exist, err := a.Execution.FindOne(ctx, &domain.FlowExecution{ID: record.ID})
+	if err != nil {
+		return err
+	}
+
+	if exist == nil {
+		return a.Execution.Create(ctx, record)
+	}
+
+	return a.Execution.Update(ctx, record.ID, map[string]any{
+		"trace":            record.Trace,
+		"actions":          record.Actions,
+		"points":           record.Points,
+		"ledger_entry_ids": record.LedgerEntryIDs,
+		"status":           record.Status,
+		"error":            record.Error,
+		"skip_reason":      record.SkipReason,
+		"duration_ms":      record.DurationMs,
+	})
+}
+
+// RecordExecutionOutcome settles the run's execution records once the points are
+// credited, or marks them failed.
+func (a *Activities) RecordExecutionOutcome(ctx context.Context, req *ExecutionOutcome) error {
+	for _, result := range req.Results {
+		record, err := a.Execution.FindOne(ctx, &domain.FlowExecution{ID: result.ExecutionID})
+		if err != nil {
+			return err
+		}
+
+		if record == nil {
+			continue
+		}
+
+		if result.Skipped != "" {
+			record.SkipReason = result.Skipped
+		}
+
+		switch {
+		case req.Error != "":
+			record.Fail(req.Error)
+		case result.Points > 0 && req.LedgerEntryID != "":
+			record.Complete(result.Points, result.Waiting, req.LedgerEntryID)
+		default:
+			record.Complete(result.Points, result.Waiting)
+		}
+
+		if err := a.saveExecution(ctx, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReserveBudget charges each spend to its flow's budget and returns whether it was
+// granted, by key. A flow whose budget runs out is paused and its organization
+// notified.
+func (a *Activities) ReserveBudget(ctx context.Context, req *BudgetRequest) (map[string]bool, error) {
+	granted := make(map[string]bool, len(req.Spends))
+	for _, spend := range req.Spends {
+		if a.Budget == nil {
+			granted[spend.ID] = true
+			continue
+		}
+
+		res, err := a.Budget.Reserve(ctx, spend)
+		if err != nil {
+			return nil, err
+		}
+		granted[spend.ID] = res.Granted
+
+		if res.Paused != nil {
+			a.budgetExhausted(ctx, res.Paused)
+		}
+	}
+
+	return granted, nil
+}
+
+// ReleaseBudget gives the spends back to their flows' budgets when their rewards
+// weren't credited. A flow the release makes room in again after its budget paused
+// it is resumed.
+func (a *Activities) ReleaseBudget(ctx context.Context, req *BudgetRequest) error {
+	if a.Budget == nil {
+		return nil
+	}
+
+	for _, spend := range req.Spends {
+		resumed, err := a.Budget.Release(ctx, spend.ID)
+		if err != nil {
+			return err
+		}
+
+		if resumed != nil {
+			zap.L().Info("flow budget released, flow resumed", zap.String("flow_id", resumed.ID), zap.Int64("budget_consumed", resumed.BudgetConsumed))
+		}
+	}
+
+	return nil
+}
+
+type budgetEvent struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	Budget         int64  `json:"budget"`
+	BudgetConsumed int64  `json:"budget_consumed"`
+}
+
+// pauseExhausted pauses an active flow whose budget can't cover its rewards, as
+// reserving them would have, and notifies its organization.
+func (a *Activities) pauseExhausted(ctx context.Context, flow *domain.Flow) error {
+	if err := a.Flow.Update(ctx, flow.ID, map[string]any{"status": workflowv1.FlowStatus_PAUSED.String()}); err != nil {
+		return err
+	}
+
+	flow.Status = workflowv1.FlowStatus_PAUSED.String()
+	a.budgetExhausted(ctx, flow)
+	return nil
+}
+
+// budgetExhausted notifies the organization that the flow was paused. Failures are
+// logged; the flow stays paused.
+func (a *Activities) budgetExhausted(ctx context.Context, flow *domain.Flow) {
+	zap.L().Warn("flow budget exhausted, flow paused", zap.String("flow_id", flow.ID), zap.Int64("budget", flow.Budget))
+	if a.Webhook == nil {
+		return
+	}
+
+	if err := a.Webhook.Publish(ctx, flow.OrganizationID, webhook.TopicFlowBudgetExhausted, budgetEvent{
+		ID:             flow.ID,
+		OrganizationID: flow.OrganizationID,
+		Name:           flow.Name,
+		Status:         flow.Status,
+		Budget:         flow.Budget,
+		BudgetConsumed: flow.BudgetConsumed,
+	}); err != nil {
+		zap.L().Error("failed to publish budget exhausted event", zap.Error(err), zap.String("flow_id", flow.ID))
+	}
+}
+
+// RunAction runs one action an execution fired through the handler of its type.
+func (a *Activities) RunAction(ctx context.Context, req *actions.Request) (*actions.Result, error) {
+	return a.Actions.Run(ctx, req)
+}
+
+// CreateLedgerEntry adds the entry to the ledger. The ledger returns the entry it
+// already wrote for a repeated reference, so a retried attempt doesn't credit twice.
+func (a *Activities) CreateLedgerEntry(ctx context.Context, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error) {
+	return a.Ledger.AddEntry(ctx, req)
+}
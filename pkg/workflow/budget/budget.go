@@ -0,0 +1,160 @@
+// Package budget charges reward actions to their flow's points budget and pauses a
+// flow once its budget is spent. A charge whose reward isn't credited is released.
+package budget
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reservation is the outcome of a spend. Paused is the flow when this spend is the
+// one that exhausted its budget and paused it; nil otherwise.
+type Reservation struct {
+	Granted bool
+	Paused  *domain.Flow
+}
+
+type Store interface {
+	// Reserve charges the spend's points to its flow's budget unless they would
+	// overrun it. A spend reserved before gets the outcome it got then, unless it was
+	// released since; it is charged again.
+	Reserve(ctx context.Context, spend *domain.BudgetSpend) (*Reservation, error)
+	// Release voids a granted spend whose reward wasn't credited and gives its points
+	// back to the budget. When the spend is the one that paused the flow and the
+	// budget has room again, the flow is resumed and returned. Releasing a spend
+	// again, or one never granted, does nothing.
+	Release(ctx context.Context, spendID string) (*domain.Flow, error)
+}
+
+type Params struct {
+	fx.In
+	DB *gorm.DB
+}
+
+func New(p Params) Store {
+	return &store{db: p.DB}
+}
+
+type store struct {
+	db *gorm.DB
+}
+
+func (s *store) Reserve(ctx context.Context, spend *domain.BudgetSpend) (*Reservation, error) {
+	res := &Reservation{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var exist domain.BudgetSpend
+		err := tx.Where("id = ?", spend.ID).Take(&exist).Error
+		if err == nil && exist.VoidedAt == nil {
+			res.Granted = exist.Granted
+			return nil
+		}
+
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// The check and the charge are one statement, so concurrent runs can't both
+		// spend the last of the budget.
+		charge := tx.Model(&domain.Flow{}).
+			Where("id = ? AND budget > 0 AND budget_consumed + ? <= budget", spend.FlowID, spend.Points).
+			UpdateColumn("budget_consumed", gorm.Expr("budget_consumed + ?", spend.Points))
+		if charge.Error != nil {
+			return charge.Error
+		}
+		spend.Granted = charge.RowsAffected == 1
+		res.Granted = spend.Granted
+
+		// A budget is exhausted once it is spent or can't cover a reward.
+		pause := tx.Model(&domain.Flow{}).Where("id = ? AND status = ?", spend.FlowID, workflowv1.FlowStatus_ACTIVE.String())
+		if spend.Granted {
+			pause = pause.Where("budget_consumed >= budget")
+		}
+
+		paused := pause.UpdateColumn("status", workflowv1.FlowStatus_PAUSED.String())
+		if paused.Error != nil {
+			return paused.Error
+		}
+		spend.Paused = paused.RowsAffected == 1
+
+		// A released spend is charged again in place.
+		spend.VoidedAt = nil
+		if err := tx.Save(spend).Error; err != nil {
+			return err
+		}
+
+		if spend.Paused {
+			var flow domain.Flow
+			if err := tx.Where("id = ?", spend.FlowID).Take(&flow).Error; err != nil {
+				return err
+			}
+			res.Paused = &flow
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *store) Release(ctx context.Context, spendID string) (*domain.Flow, error) {
+	var resumed *domain.Flow
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var spend domain.BudgetSpend
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", spendID).Take(&spend).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !spend.Granted || spend.VoidedAt != nil {
+			return nil
+		}
+
+		if err := tx.Model(&domain.BudgetSpend{}).Where("id = ?", spend.ID).UpdateColumn("voided_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&domain.Flow{}).Where("id = ?", spend.FlowID).
+			UpdateColumn("budget_consumed", gorm.Expr("GREATEST(budget_consumed - ?, 0)", spend.Points)).Error; err != nil {
+			return err
+		}
+
+		if !spend.Paused {
+			return nil
+		}
+
+		resume := tx.Model(&domain.Flow{}).
+			Where("id = ? AND status = ? AND budget_consumed < budget", spend.FlowID, workflowv1.FlowStatus_PAUSED.String()).
+			UpdateColumn("status", workflowv1.FlowStatus_ACTIVE.String())
+		if resume.Error != nil {
+			return resume.Error
+		}
+
+		if resume.RowsAffected == 1 {
+			var flow domain.Flow
+			if err := tx.Where("id = ?", spend.FlowID).Take(&flow).Error; err != nil {
+				return err
+			}
+			resumed = &flow
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resumed, nil
+}
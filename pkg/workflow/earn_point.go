@@ -1,138 +1,475 @@
 package workflow
 
-// pointv1 "github.com/smallbiznis/go-genproto/smallbiznis/loyalty/point/v1"
-
-// func EarnPoint(ctx workflow.Context, req *pointv1.EarningRequest) error {
-// 	fields := []zap.Field{
-// 		zap.String("organization_id", req.OrganizationId),
-// 		zap.String("user_id", req.UserId),
-// 		zap.String("reference_id", req.ReferenceId),
-// 		zap.Any("attributes", req.Attributes),
-// 	}
-
-// 	zap.L().With(fields...).Info("Incoming Request")
-
-// 	info := workflow.GetInfo(ctx)
-
-// 	ao := workflow.ActivityOptions{
-// 		StartToCloseTimeout: 30 * time.Second,
-// 		RetryPolicy: &temporal.RetryPolicy{
-// 			InitialInterval:    time.Second,
-// 			BackoffCoefficient: 2.0,
-// 			MaximumAttempts:    3,
-// 		},
-// 	}
-
-// 	ctx = workflow.WithActivityOptions(ctx, ao)
-
-// 	var actions []*domain.NodeAction
-// 	if err := workflow.ExecuteActivity(ctx, "CallEvaluateRule", req).Get(ctx, &actions); err != nil {
-// 		zap.L().With(fields...).Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", "CallEvaluateRule"))
-// 		return err
-// 	}
-
-// 	if len(actions) == 0 {
-// 		zap.L().With(fields...).Info("action not available")
-// 		return fmt.Errorf("action not available")
-// 	}
-
-// 	transaction := req.GetTransaction()
-// 	for _, action := range actions {
-// 		switch workflowv1.ActionType(workflowv1.ActionType_value[action.Type]) {
-// 		case workflowv1.ActionType_REWARD_POINT:
-
-// 			b, err := action.Parameters.MarshalJSON()
-// 			if err != nil {
-// 				return err
-// 			}
-
-// 			var param workflowv1.RewardPoint
-// 			if err := json.Unmarshal(b, &param); err != nil {
-// 				return err
-// 			}
-
-// 			point := ValidationRewardPointType(&param, transaction)
-// 			if point == 0 {
-// 				return fmt.Errorf("reward point calculation result is zero: rule ineligible or invalid configuration")
-// 			}
-
-// 			childOpts := workflow.ChildWorkflowOptions{
-// 				WorkflowID:        fmt.Sprintf("%s-%s", info.WorkflowExecution.ID, uuid.NewString()),
-// 				ParentClosePolicy: enums.PARENT_CLOSE_POLICY_ABANDON,
-// 			}
-
-// 			// Create a flow for the reward point
-// 			b, _ = json.Marshal(req)
-// 			var metadata map[string]string
-// 			if err := json.Unmarshal(b, &metadata); err != nil {
-// 				return err
-// 			}
-
-// 			ctxChild := workflow.WithChildOptions(ctx, childOpts)
-// 			if err := workflow.ExecuteChildWorkflow(ctx, WorkflowLedgerEntry, &ledgerv1.AddEntryRequest{
-// 				OrganizationId: req.OrganizationId,
-// 				UserId:         req.UserId,
-// 				ReferenceId:    req.ReferenceId,
-// 				Type:           ledgerv1.EntryType_CREDIT,
-// 				Amount:         point,
-// 				Metadata:       metadata,
-// 			}).Get(ctxChild, nil); err != nil {
-// 				return err
-// 			}
-
-// 		}
-// 	}
-
-// 	return nil
-// }
-
-// func ValidationRewardPointType(p *workflowv1.RewardPoint, input *pointv1.TransactionAttributes) int64 {
-// 	switch p.RewardPointType {
-// 	case workflowv1.RewardPointType_MULTIPLE:
-
-// 		unitAmount := p.UnitAmount
-// 		amount := input.Amount
-// 		rewardValue := p.RewardPointValue
-
-// 		units := math.Floor(float64(amount) / float64(unitAmount))
-// 		pointsPerUnit := math.Floor(float64(unitAmount) * rewardValue)
-
-// 		return int64(units * pointsPerUnit)
-// 	case workflowv1.RewardPointType_PERCENT_BPS:
-// 		return 0
-// 	case workflowv1.RewardPointType_PER_UNIT:
-// 		return 0
-// 	default:
-// 		return int64(p.RewardPointValue)
-// 	}
-// }
-
-// func LedgerEntry(ctx workflow.Context, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error) {
-// 	fields := []zap.Field{
-// 		zap.String("organization_id", req.OrganizationId),
-// 		zap.String("user_id", req.UserId),
-// 		zap.String("reference_id", req.ReferenceId),
-// 		zap.String("type", req.Type.String()),
-// 		zap.Int64("amount", req.Amount),
-// 		zap.Any("metadata", req.Metadata),
-// 	}
-
-// 	ao := workflow.ActivityOptions{
-// 		StartToCloseTimeout: 30 * time.Second,
-// 		RetryPolicy: &temporal.RetryPolicy{
-// 			InitialInterval:    time.Second,
-// 			BackoffCoefficient: 2.0,
-// 			MaximumAttempts:    3,
-// 		},
-// 	}
-
-// 	ctx = workflow.WithActivityOptions(ctx, ao)
-
-// 	var entry *ledgerv1.LedgerEntry
-// 	if err := workflow.ExecuteActivity(ctx, activities.CreateLedgerEntry, req).Get(ctx, &entry); err != nil {
-// 		zap.L().With(fields...).Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.CreateLedgerEntry))
-// 		return nil, err
-// 	}
-
-// 	return entry, nil
-// }
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/reward"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/actions"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/activities"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+	"go.uber.org/zap"
+)
+
+var activityOptions = workflow.ActivityOptions{
+	StartToCloseTimeout: 30 * time.Second,
+	RetryPolicy: &temporal.RetryPolicy{
+		InitialInterval:    time.Second,
+		BackoffCoefficient: 2.0,
+		MaximumAttempts:    3,
+	},
+}
+
+// EarnPoint evaluates the organization's active flows against the event and credits
+// the points of every REWARD_POINT action they fire as one ledger entry. A repeated
+// reference gets back the entry the ledger already wrote, so retries and replays
+// never credit twice.
+//
+// Paths paused at wait nodes continue on durable timers and signals: each resumed
+// stage is credited as its own entry, referenced by the event and the wait node.
+//
+// The result lists the flows that fired for the event and those that matched but
+// were suppressed by the stacking policy or their frequency cap.
+func EarnPoint(ctx workflow.Context, req *activities.EarnPointRequest) (*activities.EarnPointResult, error) {
+	fields := []zap.Field{
+		zap.String("organization_id", req.OrganizationID),
+		zap.String("user_id", req.UserID),
+		zap.String("reference_id", req.ReferenceID),
+		zap.Any("attributes", req.Attributes),
+	}
+
+	zap.L().With(fields...).Info("Incoming Request")
+
+	ctx = workflow.WithActivityOptions(ctx, activityOptions)
+
+	var executions []*activities.FlowExecution
+	if err := workflow.ExecuteActivity(ctx, activities.CallEvaluateRule, req).Get(ctx, &executions); err != nil {
+		zap.L().With(fields...).Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.CallEvaluateRule))
+		return nil, err
+	}
+
+	outcome, err := credit(ctx, req, "", executions)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &waiter{req: req, wg: workflow.NewWaitGroup(ctx)}
+	for _, exec := range executions {
+		w.spawn(ctx, exec)
+	}
+	w.wg.Wait(ctx)
+
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	return combine(executions, outcome), nil
+}
+
+// combine lists what the flows did for the event: the flows that fired, with the
+// points their first stage earned, and the flows that were suppressed or capped.
+func combine(executions []*activities.FlowExecution, outcome *activities.ExecutionOutcome) *activities.EarnPointResult {
+	points := map[string]int64{}
+	for _, r := range outcome.Results {
+		points[r.ExecutionID] = r.Points
+	}
+
+	res := &activities.EarnPointResult{}
+	for _, exec := range executions {
+		flow := activities.FlowOutcome{ExecutionID: exec.ExecutionID, FlowID: exec.FlowID, Version: exec.Version}
+		switch {
+		case exec.Skipped != "":
+			flow.Reason = exec.Skipped
+			res.Suppressed = append(res.Suppressed, flow)
+		case !exec.Failed && (len(exec.Actions) > 0 || len(exec.Waits) > 0):
+			flow.Points = points[exec.ExecutionID]
+			res.Fired = append(res.Fired, flow)
+		}
+	}
+
+	return res
+}
+
+// waiter runs the paused paths of a run, each in its own coroutine.
+type waiter struct {
+	req *activities.EarnPointRequest
+	wg  workflow.WaitGroup
+	err error
+}
+
+func (w *waiter) spawn(ctx workflow.Context, exec *activities.FlowExecution) {
+	for _, wait := range exec.Waits {
+		w.wg.Add(1)
+		workflow.Go(ctx, func(ctx workflow.Context) {
+			defer w.wg.Done()
+
+			if err := w.resume(ctx, exec, wait); err != nil && w.err == nil {
+				w.err = err
+			}
+		})
+	}
+}
+
+// resume waits out one paused path, runs the rest of the flow from it and credits
+// what that fired.
+func (w *waiter) resume(ctx workflow.Context, exec *activities.FlowExecution, wait *domain.Wait) error {
+	received := false
+	if wait.ForEvent() {
+		timerCtx, cancel := workflow.WithCancel(ctx)
+		defer cancel()
+
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(workflow.GetSignalChannel(ctx, domain.WaitSignal(wait.ID)), func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			received = true
+		})
+		selector.AddFuture(workflow.NewTimer(timerCtx, wait.Until.Sub(workflow.Now(ctx))), func(f workflow.Future) {})
+		selector.Select(ctx)
+	} else if d := wait.Until.Sub(workflow.Now(ctx)); d > 0 {
+		if err := workflow.Sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	var next *activities.FlowExecution
+	if err := workflow.ExecuteActivity(ctx, activities.ResumeFlow, &activities.ResumeRequest{
+		ExecutionID: exec.ExecutionID,
+		FlowID:      exec.FlowID,
+		Version:     exec.Version,
+		NodeID:      wait.NodeID,
+		Received:    received,
+		Attributes:  w.req.Attributes,
+	}).Get(ctx, &next); err != nil {
+		zap.L().Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.ResumeFlow))
+		return err
+	}
+
+	if _, err := credit(ctx, w.req, wait.NodeID, []*activities.FlowExecution{next}); err != nil {
+		return err
+	}
+
+	w.spawn(ctx, next)
+	return nil
+}
+
+// credit credits the points the executions' actions earned as one ledger entry, runs
+// their other actions and settles their records. stage is the wait node a resumed stage continued from; it
+// keeps the entry's reference apart from the event's first entry. Rewards of budgeted
+// flows are charged to the budget first; those it can't cover are skipped, and the
+// charges are released when the credit fails. It returns the outcome the records
+// were settled with.
+func credit(ctx workflow.Context, req *activities.EarnPointRequest, stage string, executions []*activities.FlowExecution) (*activities.ExecutionOutcome, error) {
+	fields := []zap.Field{
+		zap.String("organization_id", req.OrganizationID),
+		zap.String("user_id", req.UserID),
+		zap.String("reference_id", req.ReferenceID),
+		zap.String("stage", stage),
+	}
+
+	var (
+		point    int64
+		versions []string
+		outcome  = &activities.ExecutionOutcome{}
+		rewards  = make([][]int64, len(executions))
+	)
+	for i, exec := range executions {
+		if exec.Failed {
+			continue
+		}
+
+		points, err := rewardPoints(exec.Actions, req.Attributes)
+		if err != nil {
+			outcome.Error = err.Error()
+			recordOutcome(ctx, executions, outcome)
+			return nil, err
+		}
+		rewards[i] = points
+	}
+
+	skipped, charged, err := chargeBudgets(ctx, req, stage, executions, rewards)
+	if err != nil {
+		outcome.Error = err.Error()
+		recordOutcome(ctx, executions, outcome)
+		return nil, err
+	}
+
+	for i, exec := range executions {
+		if exec.Failed {
+			continue
+		}
+
+		var earned int64
+		for _, p := range rewards[i] {
+			earned += p
+		}
+
+		outcome.Results = append(outcome.Results, activities.ExecutionResult{
+			ExecutionID: exec.ExecutionID,
+			Points:      earned,
+			Waiting:     len(exec.Waits) > 0,
+			Skipped:     skipped[exec.ExecutionID],
+		})
+		if earned > 0 {
+			point += earned
+			versions = append(versions, fmt.Sprintf("%s@%d", exec.FlowID, exec.Version))
+		}
+	}
+
+	if point <= 0 {
+		zap.L().With(fields...).Info("no reward earned", zap.Int("flows", len(executions)))
+	} else {
+		entry, err := creditPoints(ctx, req, stage, point, versions)
+		if err != nil {
+			zap.L().With(fields...).Error("failed to ExecuteChildWorkflow", zap.Error(err), zap.String("workflow", WorkflowLedgerEntry))
+			releaseBudgets(ctx, charged)
+			outcome.Error = err.Error()
+			recordOutcome(ctx, executions, outcome)
+			return nil, err
+		}
+
+		if entry != nil {
+			outcome.LedgerEntryID = entry.Id
+		}
+	}
+
+	if err := runActions(ctx, req, stage, executions); err != nil {
+		outcome.Error = err.Error()
+		recordOutcome(ctx, executions, outcome)
+		return nil, err
+	}
+
+	return outcome, recordOutcome(ctx, executions, outcome)
+}
+
+// chargeBudgets charges the rewards of budgeted executions to their flows' budgets,
+// one spend per reward action keyed like the action, and zeroes the rewards that
+// weren't granted. It returns why rewards were skipped, by execution, and the spends
+// that were granted.
+func chargeBudgets(ctx workflow.Context, req *activities.EarnPointRequest, stage string, executions []*activities.FlowExecution, rewards [][]int64) (map[string]string, []*domain.BudgetSpend, error) {
+	charge := &activities.BudgetRequest{}
+	for i, exec := range executions {
+		if exec.Failed || !exec.Budgeted {
+			continue
+		}
+
+		for j, p := range rewards[i] {
+			if p > 0 {
+				charge.Spends = append(charge.Spends, &domain.BudgetSpend{
+					ID:             actionKey(exec, stage, j),
+					OrganizationID: req.OrganizationID,
+					FlowID:         exec.FlowID,
+					ExecutionID:    exec.ExecutionID,
+					Points:         p,
+				})
+			}
+		}
+	}
+
+	if len(charge.Spends) == 0 {
+		return nil, nil, nil
+	}
+
+	var granted map[string]bool
+	if err := workflow.ExecuteActivity(ctx, activities.ReserveBudget, charge).Get(ctx, &granted); err != nil {
+		zap.L().Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.ReserveBudget))
+		return nil, nil, err
+	}
+
+	skipped := map[string]string{}
+	for i, exec := range executions {
+		if exec.Failed || !exec.Budgeted {
+			continue
+		}
+
+		for j, p := range rewards[i] {
+			if p > 0 && !granted[actionKey(exec, stage, j)] {
+				rewards[i][j] = 0
+				skipped[exec.ExecutionID] = domain.BudgetExhausted
+			}
+		}
+	}
+
+	var charged []*domain.BudgetSpend
+	for _, spend := range charge.Spends {
+		if granted[spend.ID] {
+			charged = append(charged, spend)
+		}
+	}
+
+	return skipped, charged, nil
+}
+
+// releaseBudgets gives the charged spends back to their budgets after the credit of
+// their rewards failed, on a context of its own so it runs even when the workflow is
+// cancelled. A failed release is logged: it leaves a budget overcharged, no member
+// overpaid.
+func releaseBudgets(ctx workflow.Context, spends []*domain.BudgetSpend) {
+	if len(spends) == 0 {
+		return
+	}
+
+	ctx, _ = workflow.NewDisconnectedContext(ctx)
+	if err := workflow.ExecuteActivity(ctx, activities.ReleaseBudget, &activities.BudgetRequest{Spends: spends}).Get(ctx, nil); err != nil {
+		zap.L().Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.ReleaseBudget))
+	}
+}
+
+// actionKey identifies the action at index i of an execution's stage. It stays the
+// same when the workflow is replayed.
+func actionKey(exec *activities.FlowExecution, stage string, i int) string {
+	prefix := exec.ExecutionID
+	if stage != "" {
+		prefix += ":" + stage
+	}
+	return fmt.Sprintf("%s:%d", prefix, i)
+}
+
+// creditPoints credits point as one ledger entry through the LedgerEntry child
+// workflow. versions are the flow versions that earned the points.
+func creditPoints(ctx workflow.Context, req *activities.EarnPointRequest, stage string, point int64, versions []string) (*ledgerv1.LedgerEntry, error) {
+	info := workflow.GetInfo(ctx)
+
+	reference, childID := req.ReferenceID, fmt.Sprintf("%s-%s", info.WorkflowExecution.ID, WorkflowLedgerEntry)
+	if stage != "" {
+		reference, childID = req.ReferenceID+":"+stage, childID+"-"+stage
+	}
+
+	// flow_versions records which version of each rewarding flow the entry came from.
+	metadata := map[string]string{
+		"workflow_id":   info.WorkflowExecution.ID,
+		"flow_versions": strings.Join(versions, ","),
+	}
+	if req.Trigger != "" {
+		metadata["trigger"] = req.Trigger
+	}
+	if stage != "" {
+		metadata["resumed_from"] = stage
+	}
+
+	childOpts := workflow.ChildWorkflowOptions{
+		WorkflowID:        childID,
+		ParentClosePolicy: enums.PARENT_CLOSE_POLICY_ABANDON,
+	}
+
+	var entry *ledgerv1.LedgerEntry
+	ctxChild := workflow.WithChildOptions(ctx, childOpts)
+	err := workflow.ExecuteChildWorkflow(ctxChild, WorkflowLedgerEntry, &ledgerv1.AddEntryRequest{
+		OrgId:       req.OrganizationID,
+		UserId:      req.UserID,
+		ReferenceId: reference,
+		Type:        ledgerv1.EntryType_CREDIT,
+		Amount:      point,
+		Description: "Points earned",
+		Metadata:    metadata,
+	}).Get(ctxChild, &entry)
+
+	return entry, err
+}
+
+// runActions runs the executions' actions other than REWARD_POINT through their
+// handlers, in the order the flows fired them. Each is keyed by its execution, stage
+// and position, which stay the same when the workflow is replayed.
+func runActions(ctx workflow.Context, req *activities.EarnPointRequest, stage string, executions []*activities.FlowExecution) error {
+	for _, exec := range executions {
+		if exec.Failed {
+			continue
+		}
+
+		for i, action := range exec.Actions {
+			if action.Type == workflowv1.ActionType_REWARD_POINT.String() {
+				continue
+			}
+
+			var result *actions.Result
+			if err := workflow.ExecuteActivity(ctx, activities.RunAction, &actions.Request{
+				Key:            actionKey(exec, stage, i),
+				Type:           action.Type,
+				OrganizationID: req.OrganizationID,
+				UserID:         req.UserID,
+				ReferenceID:    req.ReferenceID,
+				Parameters:     action.Parameters,
+				Attributes:     req.Attributes,
+			}).Get(ctx, &result); err != nil {
+				zap.L().Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.RunAction), zap.String("type", action.Type))
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordOutcome settles the execution records of the run. A failed run fails every
+// record that was still being applied.
+func recordOutcome(ctx workflow.Context, executions []*activities.FlowExecution, outcome *activities.ExecutionOutcome) error {
+	if outcome.Error != "" {
+		outcome.Results = outcome.Results[:0]
+		for _, exec := range executions {
+			if !exec.Failed {
+				outcome.Results = append(outcome.Results, activities.ExecutionResult{ExecutionID: exec.ExecutionID})
+			}
+		}
+	}
+
+	if len(outcome.Results) == 0 {
+		return nil
+	}
+
+	if err := workflow.ExecuteActivity(ctx, activities.RecordExecutionOutcome, outcome).Get(ctx, nil); err != nil {
+		zap.L().Error("failed to record execution outcome", zap.Error(err), zap.String("activities", activities.RecordExecutionOutcome))
+		return err
+	}
+
+	return nil
+}
+
+// rewardPoints computes the points of the REWARD_POINT actions one flow fired, by
+// position. Other actions run through their handlers and earn nothing here.
+func rewardPoints(actions []*domain.NodeAction, attrs map[string]any) ([]int64, error) {
+	points := make([]int64, len(actions))
+	for i, action := range actions {
+		switch workflowv1.ActionType(workflowv1.ActionType_value[action.Type]) {
+		case workflowv1.ActionType_REWARD_POINT:
+			rule, err := reward.Parse(action.Parameters)
+			if err != nil {
+				return nil, temporal.NewNonRetryableApplicationError("invalid reward point parameters", "InvalidParameters", err)
+			}
+
+			res, err := rule.Calculate(attrs)
+			if err != nil {
+				return nil, temporal.NewNonRetryableApplicationError("invalid event attributes", "InvalidAttributes", err)
+			}
+
+			points[i] = res.Points
+		}
+	}
+
+	return points, nil
+}
+
+func LedgerEntry(ctx workflow.Context, req *ledgerv1.AddEntryRequest) (*ledgerv1.LedgerEntry, error) {
+	fields := []zap.Field{
+		zap.String("organization_id", req.OrgId),
+		zap.String("user_id", req.UserId),
+		zap.String("reference_id", req.ReferenceId),
+		zap.String("type", req.Type.String()),
+		zap.Int64("amount", req.Amount),
+		zap.Any("metadata", req.Metadata),
+	}
+
+	ctx = workflow.WithActivityOptions(ctx, activityOptions)
+
+	var entry *ledgerv1.LedgerEntry
+	if err := workflow.ExecuteActivity(ctx, activities.CreateLedgerEntry, req).Get(ctx, &entry); err != nil {
+		zap.L().With(fields...).Error("failed to ExecuteActivity", zap.Error(err), zap.String("activities", activities.CreateLedgerEntry))
+		return nil, err
+	}
+
+	return entry, nil
+}
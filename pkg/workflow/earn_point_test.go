@@ -0,0 +1,908 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ledgerv1 "github.com/smallbiznis/go-genproto/smallbiznis/ledger/v1"
+	workflowv1 "github.com/smallbiznis/go-genproto/smallbiznis/workflow/v1"
+	"github.com/smallbiznis/smallbiznis-apps/internal/workflow/domain"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/db/option"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/repository"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/actions"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/activities"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/budget"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/frequency"
+	"go.temporal.io/sdk/testsuite"
+	"google.golang.org/grpc"
+	"gorm.io/datatypes"
+)
+
+type fakeLedger struct {
+	ledgerv1.LedgerServiceClient
+	requests []*ledgerv1.AddEntryRequest
+	err      error // returned by every AddEntry when set
+}
+
+func (f *fakeLedger) AddEntry(ctx context.Context, in *ledgerv1.AddEntryRequest, opts ...grpc.CallOption) (*ledgerv1.LedgerEntry, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	f.requests = append(f.requests, in)
+	return &ledgerv1.LedgerEntry{Id: "entry-" + in.ReferenceId, Amount: in.Amount}, nil
+}
+
+type fakeFlows struct {
+	repository.Repository[domain.Flow]
+	flows []*domain.Flow
+}
+
+func (f *fakeFlows) Find(ctx context.Context, query *domain.Flow, opts ...option.QueryOption) ([]*domain.Flow, error) {
+	return f.flows, nil
+}
+
+func (f *fakeFlows) FindOne(ctx context.Context, query *domain.Flow, opts ...option.QueryOption) (*domain.Flow, error) {
+	for _, flow := range f.flows {
+		if flow.ID == query.ID {
+			return flow, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeFlows) Update(ctx context.Context, id string, updates any) error {
+	for _, flow := range f.flows {
+		if status, ok := updates.(map[string]any)["status"].(string); ok && flow.ID == id {
+			flow.Status = status
+		}
+	}
+	return nil
+}
+
+// fakeSettings serves one organization's flow settings.
+type fakeSettings struct {
+	repository.Repository[domain.FlowSettings]
+	settings *domain.FlowSettings
+}
+
+func (f *fakeSettings) FindOne(ctx context.Context, query *domain.FlowSettings, opts ...option.QueryOption) (*domain.FlowSettings, error) {
+	return f.settings, nil
+}
+
+// fakeBudget charges spends to the flow in memory, once per spend, pauses it when
+// its budget runs out and gives released spends back.
+type fakeBudget struct {
+	flow   *domain.Flow
+	spends map[string]*domain.BudgetSpend
+}
+
+func (f *fakeBudget) Reserve(ctx context.Context, spend *domain.BudgetSpend) (*budget.Reservation, error) {
+	if exist, ok := f.spends[spend.ID]; ok && exist.VoidedAt == nil {
+		return &budget.Reservation{Granted: exist.Granted}, nil
+	}
+
+	spend.Granted = f.flow.BudgetConsumed+spend.Points <= f.flow.Budget
+	if spend.Granted {
+		f.flow.BudgetConsumed += spend.Points
+	}
+	f.spends[spend.ID] = spend
+
+	res := &budget.Reservation{Granted: spend.Granted}
+	if (!spend.Granted || f.flow.BudgetRemaining() == 0) && f.flow.Status == workflowv1.FlowStatus_ACTIVE.String() {
+		f.flow.Status = workflowv1.FlowStatus_PAUSED.String()
+		spend.Paused = true
+		res.Paused = f.flow
+	}
+	return res, nil
+}
+
+func (f *fakeBudget) Release(ctx context.Context, spendID string) (*domain.Flow, error) {
+	spend, ok := f.spends[spendID]
+	if !ok || !spend.Granted || spend.VoidedAt != nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	spend.VoidedAt = &now
+	f.flow.BudgetConsumed -= spend.Points
+
+	if spend.Paused && f.flow.Status == workflowv1.FlowStatus_PAUSED.String() && f.flow.BudgetRemaining() > 0 {
+		f.flow.Status = workflowv1.FlowStatus_ACTIVE.String()
+		return f.flow, nil
+	}
+	return nil, nil
+}
+
+// fakeExecutions keeps execution records in memory, keyed by ID.
+type fakeExecutions struct {
+	repository.Repository[domain.FlowExecution]
+	records map[string]*domain.FlowExecution
+}
+
+func (f *fakeExecutions) FindOne(ctx context.Context, query *domain.FlowExecution, opts ...option.QueryOption) (*domain.FlowExecution, error) {
+	for _, r := range f.records {
+		if (query.ID == "" || r.ID == query.ID) &&
+			(query.WorkflowID == "" || r.WorkflowID == query.WorkflowID) &&
+			(query.FlowID == "" || r.FlowID == query.FlowID) {
+			found := *r
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeExecutions) Create(ctx context.Context, record *domain.FlowExecution) error {
+	stored := *record
+	f.records[record.ID] = &stored
+	return nil
+}
+
+func (f *fakeExecutions) Update(ctx context.Context, id string, update any) error {
+	r := f.records[id]
+	for k, v := range update.(map[string]any) {
+		switch k {
+		case "status":
+			r.Status = v.(string)
+		case "points":
+			r.Points = v.(int64)
+		case "error":
+			r.Error = v.(string)
+		case "skip_reason":
+			r.SkipReason = v.(string)
+		case "ledger_entry_ids":
+			r.LedgerEntryIDs = v.(datatypes.JSON)
+		}
+	}
+	return nil
+}
+
+// fakeVersions serves every version from the stored flows.
+type fakeVersions struct {
+	repository.Repository[domain.FlowVersion]
+	flows []*domain.Flow
+}
+
+func (f *fakeVersions) FindOne(ctx context.Context, query *domain.FlowVersion, opts ...option.QueryOption) (*domain.FlowVersion, error) {
+	for _, flow := range f.flows {
+		if flow.ID == query.FlowID && flow.Version == query.Version {
+			return &domain.FlowVersion{FlowID: flow.ID, OrganizationID: flow.OrganizationID, Version: flow.Version, Nodes: flow.Nodes, Edges: flow.Edges}, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeWaits keeps registered waits in memory, keyed by ID.
+type fakeWaits struct {
+	repository.Repository[domain.FlowWait]
+	waits map[string]*domain.FlowWait
+}
+
+func (f *fakeWaits) FindOne(ctx context.Context, query *domain.FlowWait, opts ...option.QueryOption) (*domain.FlowWait, error) {
+	return f.waits[query.ID], nil
+}
+
+func (f *fakeWaits) Create(ctx context.Context, w *domain.FlowWait) error {
+	f.waits[w.ID] = w
+	return nil
+}
+
+func (f *fakeWaits) Update(ctx context.Context, id string, update any) error {
+	if w, ok := f.waits[id]; ok {
+		w.Status = update.(map[string]any)["status"].(string)
+	}
+	return nil
+}
+
+// fakeUsage keeps frequency cap usage in memory, keyed by ID.
+type fakeUsage struct {
+	repository.Repository[domain.FrequencyUsage]
+	usage map[string]*domain.FrequencyUsage
+}
+
+func (f *fakeUsage) FindOne(ctx context.Context, query *domain.FrequencyUsage, opts ...option.QueryOption) (*domain.FrequencyUsage, error) {
+	return f.usage[query.ID], nil
+}
+
+func (f *fakeUsage) Count(ctx context.Context, query *domain.FrequencyUsage) (int64, error) {
+	var n int64
+	for _, u := range f.usage {
+		if u.CapKey == query.CapKey {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeUsage) Create(ctx context.Context, u *domain.FrequencyUsage) error {
+	f.usage[u.ID] = u
+	return nil
+}
+
+// only returns the single execution record of a run.
+func (f *fakeExecutions) only(t *testing.T) *domain.FlowExecution {
+	t.Helper()
+
+	if len(f.records) != 1 {
+		t.Fatalf("expected one execution record, got %d", len(f.records))
+	}
+
+	for _, r := range f.records {
+		return r
+	}
+	return nil
+}
+
+func rewardAction(t *testing.T, p *workflowv1.RewardPoint) *domain.NodeAction {
+	t.Helper()
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &domain.NodeAction{Type: workflowv1.ActionType_REWARD_POINT.String(), Parameters: b}
+}
+
+// flowOf builds a stored flow that fires actions for purchases over 10000.
+func flowOf(t *testing.T, actions ...*domain.NodeAction) *domain.Flow {
+	t.Helper()
+
+	nodes := []domain.Node{
+		{ID: "start", Type: workflowv1.NodeType_TRIGGER, Trigger: &domain.NodeTrigger{Key: "TRANSACTION"}},
+		{ID: "cond", Type: workflowv1.NodeType_CONDITION, Condition: &domain.NodeCondition{Expression: "amount > 10000"}},
+	}
+	edges := []*workflowv1.Edge{{Id: "e0", Source: "start", Target: "cond"}}
+
+	for i, a := range actions {
+		id := fmt.Sprintf("action-%d", i)
+		nodes = append(nodes, domain.Node{ID: id, Type: workflowv1.NodeType_ACTION, Action: a})
+		edges = append(edges, &workflowv1.Edge{Id: "e-" + id, Type: "EDGE_TYPE_THEN", Source: "cond", Target: id})
+	}
+
+	n, err := json.Marshal(nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	e, err := json.Marshal(edges)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &domain.Flow{ID: "flow-id", OrganizationID: "org-id", Nodes: n, Edges: e, Version: 3}
+}
+
+// registry handles the ledger actions with the fake ledger; the other handlers have
+// no backing store.
+func registry(t *testing.T, ledger *fakeLedger) *actions.Registry {
+	t.Helper()
+
+	r, err := actions.NewRegistry(
+		&actions.Coupon{},
+		&actions.MemberTag{},
+		&actions.MemberAttribute{},
+		&actions.Tier{},
+		&actions.Notification{},
+		&actions.Webhook{},
+		&actions.DeductPoints{Ledger: ledger},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return r
+}
+
+func runEarnPoint(t *testing.T, amount int64, flows ...*domain.Flow) (*testsuite.TestWorkflowEnvironment, *fakeLedger, *fakeExecutions) {
+	t.Helper()
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+
+	ledger := &fakeLedger{}
+	executions := &fakeExecutions{records: map[string]*domain.FlowExecution{}}
+	Register(env, &activities.Activities{
+		Ledger:    ledger,
+		Flow:      &fakeFlows{flows: flows},
+		Version:   &fakeVersions{flows: flows},
+		Execution: executions,
+		Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		Actions:   registry(t, ledger),
+	})
+
+	env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		ReferenceID:    "order-1",
+		Attributes:     map[string]any{"amount": amount},
+	})
+
+	return env, ledger, executions
+}
+
+func TestEarnPointCreditsRewardActions(t *testing.T) {
+	env, ledger, executions := runEarnPoint(t, 25000, flowOf(t,
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}),
+		rewardAction(t, &workflowv1.RewardPoint{
+			RewardPointType:  workflowv1.RewardPointType_MULTIPLE,
+			UnitAmount:       10000,
+			RewardPointValue: 0.001,
+		}),
+	))
+
+	if !env.IsWorkflowCompleted() || env.GetWorkflowError() != nil {
+		t.Fatalf("workflow did not complete: %v", env.GetWorkflowError())
+	}
+
+	if len(ledger.requests) != 1 {
+		t.Fatalf("expected one ledger entry, got %d", len(ledger.requests))
+	}
+
+	req := ledger.requests[0]
+	if req.Amount != 70 || req.Type != ledgerv1.EntryType_CREDIT || req.ReferenceId != "order-1" || req.OrgId != "org-id" {
+		t.Fatalf("unexpected ledger request %+v", req)
+	}
+
+	if req.Metadata["flow_versions"] != "flow-id@3" {
+		t.Fatalf("expected the flow version to be recorded, got %+v", req.Metadata)
+	}
+
+	record := executions.only(t)
+	if record.Status != domain.ExecutionStatusCompleted || record.Points != 70 || record.FlowVersion != 3 || record.ReferenceID != "order-1" {
+		t.Fatalf("unexpected execution record %+v", record)
+	}
+
+	if ids := record.GetLedgerEntryIDs(); len(ids) != 1 || ids[0] != "entry-order-1" {
+		t.Fatalf("expected the ledger entry to be recorded, got %v", ids)
+	}
+
+	if len(record.GetTrace()) == 0 || len(record.GetActions()) != 2 {
+		t.Fatalf("expected the trace and actions to be recorded, got %s %s", record.Trace, record.Actions)
+	}
+}
+
+func TestEarnPointWithoutRewardSkipsLedger(t *testing.T) {
+	reward := rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50})
+	env, ledger, executions := runEarnPoint(t, 5000, flowOf(t, reward))
+
+	if !env.IsWorkflowCompleted() || env.GetWorkflowError() != nil {
+		t.Fatalf("workflow did not complete: %v", env.GetWorkflowError())
+	}
+
+	if len(ledger.requests) != 0 {
+		t.Fatalf("expected no ledger entry, got %d", len(ledger.requests))
+	}
+
+	record := executions.only(t)
+	if record.Status != domain.ExecutionStatusCompleted || record.Points != 0 || len(record.GetLedgerEntryIDs()) != 0 {
+		t.Fatalf("unexpected execution record %+v", record)
+	}
+}
+
+func TestEarnPointRejectsInvalidParameters(t *testing.T) {
+	env, ledger, executions := runEarnPoint(t, 25000, flowOf(t,
+		&domain.NodeAction{Type: workflowv1.ActionType_REWARD_POINT.String(), Parameters: []byte(`{"reward_point_value":"fifty"}`)},
+	))
+
+	if env.GetWorkflowError() == nil {
+		t.Fatalf("expected workflow error")
+	}
+
+	if len(ledger.requests) != 0 {
+		t.Fatalf("expected no ledger entry, got %d", len(ledger.requests))
+	}
+
+	if record := executions.only(t); record.Status != domain.ExecutionStatusFailed || record.Error == "" {
+		t.Fatalf("expected the execution to be recorded as failed, got %+v", record)
+	}
+}
+
+func TestEarnPointRecordsBrokenFlowAsFailed(t *testing.T) {
+	broken := flowOf(t)
+	broken.Nodes = []byte(`[{"id":"start","type":"TRIGGER"}]`)
+
+	env, ledger, executions := runEarnPoint(t, 25000, broken)
+
+	if !env.IsWorkflowCompleted() || env.GetWorkflowError() != nil {
+		t.Fatalf("workflow did not complete: %v", env.GetWorkflowError())
+	}
+
+	if len(ledger.requests) != 0 {
+		t.Fatalf("expected no ledger entry, got %d", len(ledger.requests))
+	}
+
+	if record := executions.only(t); record.Status != domain.ExecutionStatusFailed || record.Error == "" {
+		t.Fatalf("expected the execution to be recorded as failed, got %+v", record)
+	}
+}
+
+func TestEarnPointResumesAfterWait(t *testing.T) {
+	reward := func(value float64) *domain.NodeAction {
+		return rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: value})
+	}
+
+	nodes, _ := json.Marshal([]domain.Node{
+		{ID: "start", Type: workflowv1.NodeType_TRIGGER, Trigger: &domain.NodeTrigger{Key: "TRANSACTION"}},
+		{ID: "now", Type: workflowv1.NodeType_ACTION, Action: reward(50)},
+		{ID: "wait", Type: workflowv1.NodeType_WAIT, Wait: &domain.NodeWait{Duration: "1d"}},
+		{ID: "later", Type: workflowv1.NodeType_ACTION, Action: reward(20)},
+	})
+	edges, _ := json.Marshal([]*workflowv1.Edge{
+		{Id: "e0", Source: "start", Target: "now"},
+		{Id: "e1", Source: "start", Target: "wait"},
+		{Id: "e2", Source: "wait", Target: "later"},
+	})
+
+	env, ledger, executions := runEarnPoint(t, 100, &domain.Flow{ID: "flow-id", OrganizationID: "org-id", Nodes: nodes, Edges: edges, Version: 3})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatalf("workflow did not complete")
+	}
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("unexpected workflow error: %v", err)
+	}
+
+	if len(ledger.requests) != 2 {
+		t.Fatalf("expected two ledger entries, got %d", len(ledger.requests))
+	}
+
+	first, resumed := ledger.requests[0], ledger.requests[1]
+	if first.Amount != 50 || first.ReferenceId != "order-1" {
+		t.Fatalf("first entry = %d on %s, want 50 on order-1", first.Amount, first.ReferenceId)
+	}
+	if resumed.Amount != 20 || resumed.ReferenceId != "order-1:wait" || resumed.Metadata["resumed_from"] != "wait" {
+		t.Fatalf("resumed entry = %d on %s, want 20 on order-1:wait", resumed.Amount, resumed.ReferenceId)
+	}
+
+	record := executions.only(t)
+	if record.Status != domain.ExecutionStatusCompleted || record.Points != 70 {
+		t.Fatalf("record = %s with %d points, want COMPLETED with 70", record.Status, record.Points)
+	}
+
+	if ids := record.GetLedgerEntryIDs(); len(ids) != 2 {
+		t.Fatalf("ledger entry ids = %v, want both entries", ids)
+	}
+}
+
+func TestEarnPointWaitForEventTakesBranch(t *testing.T) {
+	reward := func(value float64) *domain.NodeAction {
+		return rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: value})
+	}
+
+	nodes, _ := json.Marshal([]domain.Node{
+		{ID: "start", Type: workflowv1.NodeType_TRIGGER, Trigger: &domain.NodeTrigger{Key: "TRANSACTION"}},
+		{ID: "review", Type: workflowv1.NodeType_WAIT_FOR_EVENT, WaitEvent: &domain.NodeWaitEvent{Event: "REVIEW", Timeout: "3d"}},
+		{ID: "thanks", Type: workflowv1.NodeType_ACTION, Action: reward(30)},
+		{ID: "nudge", Type: workflowv1.NodeType_ACTION, Action: reward(1)},
+	})
+	edges, _ := json.Marshal([]*workflowv1.Edge{
+		{Id: "e0", Source: "start", Target: "review"},
+		{Id: "e1", Type: "EDGE_TYPE_THEN", Source: "review", Target: "thanks"},
+		{Id: "e2", Type: "OTHERWISE", Source: "review", Target: "nudge"},
+	})
+	flow := &domain.Flow{ID: "flow-id", OrganizationID: "org-id", Nodes: nodes, Edges: edges, Version: 3}
+
+	cases := []struct {
+		name   string
+		signal bool
+		points int64
+	}{
+		{"event arrives", true, 30},
+		{"times out", false, 1},
+	}
+
+	for _, c := range cases {
+		var suite testsuite.WorkflowTestSuite
+		env := suite.NewTestWorkflowEnvironment()
+
+		ledger := &fakeLedger{}
+		executions := &fakeExecutions{records: map[string]*domain.FlowExecution{}}
+		Register(env, &activities.Activities{
+			Ledger:    ledger,
+			Flow:      &fakeFlows{flows: []*domain.Flow{flow}},
+			Version:   &fakeVersions{flows: []*domain.Flow{flow}},
+			Execution: executions,
+			Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		})
+
+		if c.signal {
+			env.RegisterDelayedCallback(func() {
+				record := executions.only(t)
+				env.SignalWorkflow(domain.WaitSignal(domain.WaitID(record.ID, "review")), map[string]any{"rating": 5})
+			}, time.Hour)
+		}
+
+		env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+			OrganizationID: "org-id",
+			UserID:         "user-id",
+			ReferenceID:    "order-1",
+			Attributes:     map[string]any{"amount": int64(100)},
+		})
+
+		if err := env.GetWorkflowError(); err != nil {
+			t.Fatalf("%s: unexpected workflow error: %v", c.name, err)
+		}
+
+		if len(ledger.requests) != 1 || ledger.requests[0].Amount != c.points || ledger.requests[0].ReferenceId != "order-1:review" {
+			t.Fatalf("%s: expected one entry of %d on order-1:review, got %+v", c.name, c.points, ledger.requests)
+		}
+	}
+}
+
+func TestEarnPointRunsOtherActions(t *testing.T) {
+	env, ledger, executions := runEarnPoint(t, 25000, flowOf(t,
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}),
+		&domain.NodeAction{Type: workflowv1.ActionType_DEDUCT_POINTS.String(), Parameters: []byte(`{"points":10}`)},
+	))
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("unexpected workflow error: %v", err)
+	}
+
+	if len(ledger.requests) != 2 {
+		t.Fatalf("expected a credit and a debit, got %d entries", len(ledger.requests))
+	}
+
+	record := executions.only(t)
+	credit, debit := ledger.requests[0], ledger.requests[1]
+	if credit.Type != ledgerv1.EntryType_CREDIT || credit.Amount != 50 {
+		t.Fatalf("first entry = %s %d, want CREDIT 50", credit.Type, credit.Amount)
+	}
+	if debit.Type != ledgerv1.EntryType_DEBIT || debit.Amount != 10 || debit.ReferenceId != record.ID+":1" {
+		t.Fatalf("second entry = %s %d on %s, want DEBIT 10 on %s:1", debit.Type, debit.Amount, debit.ReferenceId, record.ID)
+	}
+
+	if record.Status != domain.ExecutionStatusCompleted {
+		t.Fatalf("record status = %s, want COMPLETED", record.Status)
+	}
+}
+
+// cappedFlow puts a frequency cap on the trigger of a flow built with flowOf.
+func cappedFlow(t *testing.T, c *domain.FrequencyCap, actions ...*domain.NodeAction) *domain.Flow {
+	t.Helper()
+
+	flow := flowOf(t, actions...)
+
+	var nodes []*domain.Node
+	if err := json.Unmarshal(flow.Nodes, &nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nodes[0].Trigger.Cap = c
+
+	b, err := json.Marshal(nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	flow.Nodes = b
+
+	return flow
+}
+
+// runCapped runs an order through the flow, counting caps in usage, and returns the
+// ledger and the run's execution record.
+func runCapped(t *testing.T, usage *fakeUsage, flow *domain.Flow, reference string) (*fakeLedger, *domain.FlowExecution) {
+	t.Helper()
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+
+	ledger := &fakeLedger{}
+	executions := &fakeExecutions{records: map[string]*domain.FlowExecution{}}
+	Register(env, &activities.Activities{
+		Ledger:    ledger,
+		Flow:      &fakeFlows{flows: []*domain.Flow{flow}},
+		Version:   &fakeVersions{flows: []*domain.Flow{flow}},
+		Execution: executions,
+		Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		Actions:   registry(t, ledger),
+		Caps:      &frequency.Limiter{Usage: usage},
+	})
+
+	env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		ReferenceID:    reference,
+		Attributes:     map[string]any{"amount": int64(25000)},
+	})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("unexpected workflow error: %v", err)
+	}
+
+	return ledger, executions.only(t)
+}
+
+func TestEarnPointEnforcesFlowCap(t *testing.T) {
+	usage := &fakeUsage{usage: map[string]*domain.FrequencyUsage{}}
+	flow := cappedFlow(t, &domain.FrequencyCap{Limit: 1, Period: domain.CapDay},
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}),
+	)
+
+	ledger, first := runCapped(t, usage, flow, "order-1")
+	if len(ledger.requests) != 1 || first.Status != domain.ExecutionStatusCompleted {
+		t.Fatalf("first order: %d entries, status %s, want one entry and COMPLETED", len(ledger.requests), first.Status)
+	}
+
+	ledger, second := runCapped(t, usage, flow, "order-2")
+	if len(ledger.requests) != 0 {
+		t.Fatalf("second order credited %+v, want nothing", ledger.requests)
+	}
+
+	if second.Status != domain.ExecutionStatusCapped || second.SkipReason == "" || len(second.GetActions()) != 0 {
+		t.Fatalf("second record = %s %q with %d actions, want CAPPED with a reason and none", second.Status, second.SkipReason, len(second.GetActions()))
+	}
+
+	if len(usage.usage) != 1 {
+		t.Fatalf("expected the first order to be counted once, got %d", len(usage.usage))
+	}
+}
+
+func TestEarnPointSkipsCappedAction(t *testing.T) {
+	usage := &fakeUsage{usage: map[string]*domain.FrequencyUsage{}}
+	bonus := rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 100})
+	bonus.Cap = &domain.FrequencyCap{Limit: 1, Period: domain.CapLifetime}
+	flow := flowOf(t,
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}),
+		bonus,
+	)
+
+	if ledger, _ := runCapped(t, usage, flow, "order-1"); len(ledger.requests) != 1 || ledger.requests[0].Amount != 150 {
+		t.Fatalf("first order credited %+v, want 150", ledger.requests)
+	}
+
+	ledger, record := runCapped(t, usage, flow, "order-2")
+	if len(ledger.requests) != 1 || ledger.requests[0].Amount != 50 {
+		t.Fatalf("second order credited %+v, want 50", ledger.requests)
+	}
+
+	var skipped string
+	for _, step := range record.GetTrace() {
+		if step.NodeID == "action-1" {
+			skipped = step.Skipped
+		}
+	}
+	if record.Status != domain.ExecutionStatusCompleted || skipped == "" {
+		t.Fatalf("record = %s, skipped = %q, want COMPLETED with the bonus skipped", record.Status, skipped)
+	}
+}
+
+func TestEarnPointChargesFlowBudget(t *testing.T) {
+	flow := flowOf(t,
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}),
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 70}),
+	)
+	flow.Budget, flow.Status = 100, workflowv1.FlowStatus_ACTIVE.String()
+	store := &fakeBudget{flow: flow, spends: map[string]*domain.BudgetSpend{}}
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+
+	ledger := &fakeLedger{}
+	executions := &fakeExecutions{records: map[string]*domain.FlowExecution{}}
+	Register(env, &activities.Activities{
+		Ledger:    ledger,
+		Flow:      &fakeFlows{flows: []*domain.Flow{flow}},
+		Version:   &fakeVersions{flows: []*domain.Flow{flow}},
+		Execution: executions,
+		Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		Actions:   registry(t, ledger),
+		Budget:    store,
+	})
+
+	env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		ReferenceID:    "order-1",
+		Attributes:     map[string]any{"amount": int64(25000)},
+	})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("unexpected workflow error: %v", err)
+	}
+
+	if len(ledger.requests) != 1 || ledger.requests[0].Amount != 50 {
+		t.Fatalf("credited %+v, want the 50 the budget covers", ledger.requests)
+	}
+
+	if flow.BudgetConsumed != 50 || flow.Status != workflowv1.FlowStatus_PAUSED.String() {
+		t.Fatalf("budget consumed = %d, status = %s, want 50 and PAUSED", flow.BudgetConsumed, flow.Status)
+	}
+
+	record := executions.only(t)
+	if record.Status != domain.ExecutionStatusCompleted || record.Points != 50 || record.SkipReason != domain.BudgetExhausted {
+		t.Fatalf("record = %s %d %q, want COMPLETED 50 with the budget reason", record.Status, record.Points, record.SkipReason)
+	}
+}
+
+func TestEarnPointReleasesBudgetWhenCreditFails(t *testing.T) {
+	flow := flowOf(t, rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 100}))
+	flow.Budget, flow.Status = 100, workflowv1.FlowStatus_ACTIVE.String()
+	store := &fakeBudget{flow: flow, spends: map[string]*domain.BudgetSpend{}}
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+
+	ledger := &fakeLedger{err: errors.New("ledger unavailable")}
+	Register(env, &activities.Activities{
+		Ledger:    ledger,
+		Flow:      &fakeFlows{flows: []*domain.Flow{flow}},
+		Version:   &fakeVersions{flows: []*domain.Flow{flow}},
+		Execution: &fakeExecutions{records: map[string]*domain.FlowExecution{}},
+		Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		Actions:   registry(t, ledger),
+		Budget:    store,
+	})
+
+	env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		ReferenceID:    "order-1",
+		Attributes:     map[string]any{"amount": int64(25000)},
+	})
+
+	if err := env.GetWorkflowError(); err == nil {
+		t.Fatalf("expected the workflow to fail with the ledger")
+	}
+
+	if flow.BudgetConsumed != 0 || flow.Status != workflowv1.FlowStatus_ACTIVE.String() {
+		t.Fatalf("budget consumed = %d, status = %s, want 0 and ACTIVE again", flow.BudgetConsumed, flow.Status)
+	}
+
+	for id, spend := range store.spends {
+		if spend.VoidedAt == nil {
+			t.Fatalf("spend %s wasn't voided", id)
+		}
+	}
+}
+
+func TestEarnPointResolvesStackingPolicy(t *testing.T) {
+	small := flowOf(t, rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}))
+	small.ID, small.Priority = "small", 9
+	large := flowOf(t, rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 80}))
+	large.ID = "large"
+	flows := []*domain.Flow{small, large}
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+
+	ledger := &fakeLedger{}
+	executions := &fakeExecutions{records: map[string]*domain.FlowExecution{}}
+	Register(env, &activities.Activities{
+		Ledger:    ledger,
+		Flow:      &fakeFlows{flows: flows},
+		Version:   &fakeVersions{flows: flows},
+		Execution: executions,
+		Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		Settings:  &fakeSettings{settings: &domain.FlowSettings{StackingPolicy: domain.StackingBestReward}},
+		Actions:   registry(t, ledger),
+	})
+
+	env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		ReferenceID:    "order-1",
+		Attributes:     map[string]any{"amount": int64(25000)},
+	})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("unexpected workflow error: %v", err)
+	}
+
+	if len(ledger.requests) != 1 || ledger.requests[0].Amount != 80 {
+		t.Fatalf("credited %+v, want the best reward of 80", ledger.requests)
+	}
+
+	var result activities.EarnPointResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Fired) != 1 || result.Fired[0].FlowID != "large" || result.Fired[0].Points != 80 {
+		t.Fatalf("fired %+v, want large with 80 points", result.Fired)
+	}
+	if len(result.Suppressed) != 1 || result.Suppressed[0].FlowID != "small" || result.Suppressed[0].Reason == "" {
+		t.Fatalf("suppressed %+v, want small with a reason", result.Suppressed)
+	}
+
+	for _, r := range executions.records {
+		if r.FlowID == "small" && r.Status != domain.ExecutionStatusSuppressed {
+			t.Fatalf("small's record is %s, want SUPPRESSED", r.Status)
+		}
+	}
+}
+
+// runStacked runs an order through small and large under BEST_REWARD, counting caps
+// in usage and charging budgets in store, and returns the ledger and the result.
+func runStacked(t *testing.T, flows []*domain.Flow, usage *fakeUsage, store budget.Store, reference string) (*fakeLedger, *activities.EarnPointResult) {
+	t.Helper()
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+
+	ledger := &fakeLedger{}
+	Register(env, &activities.Activities{
+		Ledger:    ledger,
+		Flow:      &fakeFlows{flows: flows},
+		Version:   &fakeVersions{flows: flows},
+		Execution: &fakeExecutions{records: map[string]*domain.FlowExecution{}},
+		Wait:      &fakeWaits{waits: map[string]*domain.FlowWait{}},
+		Settings:  &fakeSettings{settings: &domain.FlowSettings{StackingPolicy: domain.StackingBestReward}},
+		Actions:   registry(t, ledger),
+		Caps:      &frequency.Limiter{Usage: usage},
+		Budget:    store,
+	})
+
+	env.ExecuteWorkflow(WorkflowEarnPoint, &activities.EarnPointRequest{
+		OrganizationID: "org-id",
+		UserID:         "user-id",
+		ReferenceID:    reference,
+		Attributes:     map[string]any{"amount": int64(25000)},
+	})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("unexpected workflow error: %v", err)
+	}
+
+	var result activities.EarnPointResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return ledger, &result
+}
+
+func TestEarnPointCappedWinnerGivesWayToRunnerUp(t *testing.T) {
+	small := flowOf(t, rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}))
+	small.ID = "small"
+	large := cappedFlow(t, &domain.FrequencyCap{Limit: 1, Period: domain.CapDay},
+		rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 80}),
+	)
+	large.ID = "large"
+	flows := []*domain.Flow{small, large}
+	usage := &fakeUsage{usage: map[string]*domain.FrequencyUsage{}}
+
+	ledger, _ := runStacked(t, flows, usage, nil, "order-1")
+	if len(ledger.requests) != 1 || ledger.requests[0].Amount != 80 {
+		t.Fatalf("first order credited %+v, want large's 80", ledger.requests)
+	}
+
+	ledger, second := runStacked(t, flows, usage, nil, "order-2")
+	if len(ledger.requests) != 1 || ledger.requests[0].Amount != 50 {
+		t.Fatalf("second order credited %+v, want small's 50", ledger.requests)
+	}
+
+	if len(second.Fired) != 1 || second.Fired[0].FlowID != "small" {
+		t.Fatalf("second order fired %+v, want small", second.Fired)
+	}
+	if len(second.Suppressed) != 1 || second.Suppressed[0].FlowID != "large" || strings.HasPrefix(second.Suppressed[0].Reason, "suppressed") {
+		t.Fatalf("second order skipped %+v, want large capped", second.Suppressed)
+	}
+}
+
+func TestEarnPointOutOfBudgetWinnerGivesWayToRunnerUp(t *testing.T) {
+	small := flowOf(t, rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 50}))
+	small.ID = "small"
+	large := flowOf(t, rewardAction(t, &workflowv1.RewardPoint{RewardPointType: workflowv1.RewardPointType_FIXED, RewardPointValue: 80}))
+	large.ID, large.Status, large.Budget, large.BudgetConsumed = "large", workflowv1.FlowStatus_ACTIVE.String(), 100, 40
+	flows := []*domain.Flow{small, large}
+	store := &fakeBudget{flow: large, spends: map[string]*domain.BudgetSpend{}}
+
+	ledger, result := runStacked(t, flows, &fakeUsage{usage: map[string]*domain.FrequencyUsage{}}, store, "order-1")
+	if len(ledger.requests) != 1 || ledger.requests[0].Amount != 50 {
+		t.Fatalf("credited %+v, want small's 50", ledger.requests)
+	}
+
+	if len(result.Suppressed) != 1 || result.Suppressed[0].Reason != domain.BudgetExhausted {
+		t.Fatalf("skipped %+v, want large out of budget", result.Suppressed)
+	}
+
+	if large.Status != workflowv1.FlowStatus_PAUSED.String() || large.BudgetConsumed != 40 {
+		t.Fatalf("large is %s with %d consumed, want PAUSED with 40", large.Status, large.BudgetConsumed)
+	}
+}
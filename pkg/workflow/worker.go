@@ -0,0 +1,63 @@
+package workflow
+
+import (
+	"context"
+
+	grpc_client "github.com/smallbiznis/smallbiznis-apps/pkg/client"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/actions"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/activities"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/budget"
+	"github.com/smallbiznis/smallbiznis-apps/pkg/workflow/frequency"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Worker runs the point workflows on POINT_TASK_QUEUE. It needs the Temporal client
+// from ProvideClient and a database holding the organizations' flows; notification
+// actions also need a message.Publisher. Frequency caps are counted in Redis when a
+// *redis.Client is provided, and in the database otherwise.
+var Worker = fx.Module("temporal.worker",
+	fx.Provide(
+		grpc_client.NewLedgerClient,
+		actions.New,
+		frequency.New,
+		budget.New,
+		activities.New,
+		NewWorker,
+	),
+	fx.Invoke(StartWorker),
+)
+
+// Register adds the point workflows and activities to a worker or a test environment.
+func Register(r worker.Registry, acts *activities.Activities) {
+	r.RegisterWorkflowWithOptions(EarnPoint, workflow.RegisterOptions{Name: WorkflowEarnPoint})
+	r.RegisterWorkflowWithOptions(LedgerEntry, workflow.RegisterOptions{Name: WorkflowLedgerEntry})
+	r.RegisterActivity(acts)
+}
+
+func NewWorker(c client.Client, acts *activities.Activities) worker.Worker {
+	w := worker.New(c, POINT_TASK_QUEUE.String(), worker.Options{})
+	Register(w, acts)
+	return w
+}
+
+func StartWorker(lc fx.Lifecycle, w worker.Worker) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := w.Start(); err != nil {
+				zap.L().Error("failed to start temporal worker", zap.Error(err))
+				return err
+			}
+
+			zap.L().Info("temporal worker started", zap.String("task_queue", POINT_TASK_QUEUE.String()))
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			w.Stop()
+			return nil
+		},
+	})
+}